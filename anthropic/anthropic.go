@@ -6,12 +6,15 @@ package anthropic
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 
 	anthropicSDK "github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
 
 	"github.com/mattermost/mattermost-plugin-ai/llm"
 )
@@ -32,62 +35,23 @@ type messageState struct {
 	context  *llm.Context
 }
 
-// customHeadersTransport wraps an http.RoundTripper to add custom headers to every request
-type customHeadersTransport struct {
-	base    http.RoundTripper
-	headers map[string]string
-}
-
-func (t *customHeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Clone the request to avoid modifying the original
-	newReq := req.Clone(req.Context())
-
-	// Add custom headers
-	for key, value := range t.headers {
-		newReq.Header.Set(key, value)
-	}
-
-	return t.base.RoundTrip(newReq)
-}
-
-// wrapHTTPClientWithCustomHeaders wraps an http.Client to add custom headers to all requests
-func wrapHTTPClientWithCustomHeaders(baseClient *http.Client, customHeaders map[string]string) *http.Client {
-	if len(customHeaders) == 0 {
-		return baseClient
-	}
-
-	transport := baseClient.Transport
-	if transport == nil {
-		transport = http.DefaultTransport
-	}
-
-	wrappedClient := &http.Client{
-		Transport: &customHeadersTransport{
-			base:    transport,
-			headers: customHeaders,
-		},
-		CheckRedirect: baseClient.CheckRedirect,
-		Jar:           baseClient.Jar,
-		Timeout:       baseClient.Timeout,
-	}
-
-	return wrappedClient
-}
-
 type Anthropic struct {
 	client           anthropicSDK.Client
 	defaultModel     string
 	inputTokenLimit  int
 	outputTokenLimit int
+	promptCaching    bool
 }
 
 func New(llmService llm.ServiceConfig, httpClient *http.Client) *Anthropic {
 	// Wrap the HTTP client with custom headers if any are provided
-	wrappedHTTPClient := wrapHTTPClientWithCustomHeaders(httpClient, llmService.CustomHeaders)
+	wrappedHTTPClient := llm.WrapHTTPClientWithCustomHeaders(httpClient, llmService.CustomHeaders)
 
 	client := anthropicSDK.NewClient(
 		option.WithAPIKey(llmService.APIKey),
 		option.WithHTTPClient(wrappedHTTPClient),
+		// Retries are handled by llm.RetryWrapper, which also fails over to other services.
+		option.WithMaxRetries(0),
 	)
 
 	return &Anthropic{
@@ -95,6 +59,7 @@ func New(llmService llm.ServiceConfig, httpClient *http.Client) *Anthropic {
 		defaultModel:     llmService.DefaultModel,
 		inputTokenLimit:  llmService.InputTokenLimit,
 		outputTokenLimit: llmService.OutputTokenLimit,
+		promptCaching:    llmService.EnablePromptCaching,
 	}
 }
 
@@ -109,8 +74,29 @@ func isValidImageType(mimeType string) bool {
 	return validTypes[mimeType]
 }
 
+// documentBlock sends PDFs as document blocks and other documents, or PDFs that can't be sent, as their extracted text.
+func documentBlock(file llm.File) anthropicSDK.ContentBlockParamUnion {
+	if file.MimeType != "application/pdf" || !file.SendNatively() {
+		return anthropicSDK.NewTextBlock(file.DocumentText())
+	}
+
+	data, err := io.ReadAll(file.Reader)
+	if err != nil {
+		return anthropicSDK.NewTextBlock(file.DocumentText())
+	}
+
+	block := anthropicSDK.NewDocumentBlock(anthropicSDK.Base64PDFSourceParam{
+		Data: base64.StdEncoding.EncodeToString(data),
+	})
+	if file.Name != "" {
+		block.OfDocument.Title = anthropicSDK.String(file.Name)
+	}
+	return block
+}
+
 // conversationToMessages creates a system prompt and a slice of input messages from conversation posts.
-func conversationToMessages(posts []llm.Post) (string, []anthropicSDK.MessageParam) {
+// The reasoning behind tool calls is only included with includeReasoning, which is required when thinking is enabled.
+func conversationToMessages(posts []llm.Post, includeReasoning bool) (string, []anthropicSDK.MessageParam) {
 	systemMessage := ""
 	messages := make([]anthropicSDK.MessageParam, 0, len(posts))
 
@@ -130,6 +116,9 @@ func conversationToMessages(posts []llm.Post) (string, []anthropicSDK.MessagePar
 	for _, post := range posts {
 		switch post.Role {
 		case llm.PostRoleSystem:
+			if systemMessage != "" {
+				systemMessage += "\n\n"
+			}
 			systemMessage += post.Message
 			continue
 		case llm.PostRoleBot:
@@ -146,12 +135,27 @@ func conversationToMessages(posts []llm.Post) (string, []anthropicSDK.MessagePar
 			continue
 		}
 
+		// Thinking must come before the text and tool use it led to.
+		if includeReasoning && len(post.ToolUse) > 0 {
+			for _, reasoning := range post.Reasoning {
+				if reasoning.RedactedData != "" {
+					currentBlocks = append(currentBlocks, anthropicSDK.NewRedactedThinkingBlock(reasoning.RedactedData))
+				} else {
+					currentBlocks = append(currentBlocks, anthropicSDK.NewThinkingBlock(reasoning.Signature, reasoning.Text))
+				}
+			}
+		}
+
 		if post.Message != "" {
 			textBlock := anthropicSDK.NewTextBlock(post.Message)
 			currentBlocks = append(currentBlocks, textBlock)
 		}
 
 		for _, file := range post.Files {
+			if file.Kind == llm.FileKindDocument {
+				currentBlocks = append(currentBlocks, documentBlock(file))
+				continue
+			}
 			if !isValidImageType(file.MimeType) {
 				textBlock := anthropicSDK.NewTextBlock(fmt.Sprintf("[Unsupported image type: %s]", file.MimeType))
 				currentBlocks = append(currentBlocks, textBlock)
@@ -216,7 +220,7 @@ func (a *Anthropic) createConfig(opts []llm.LanguageModelOption) llm.LanguageMod
 	return cfg
 }
 
-func (a *Anthropic) streamChatWithTools(state messageState) {
+func (a *Anthropic) streamChatWithTools(ctx context.Context, state messageState) {
 	if state.depth >= MaxToolResolutionDepth {
 		state.output <- llm.TextStreamEvent{
 			Type:  llm.EventTypeError,
@@ -235,7 +239,37 @@ func (a *Anthropic) streamChatWithTools(state messageState) {
 		}},
 		Tools: convertTools(state.tools),
 	}
-	stream := a.client.Messages.NewStreaming(context.Background(), params)
+	params.StopSequences = state.config.StopSequences
+	if state.config.ThinkingBudgetTokens == 0 {
+		// Sampling can't be adjusted while thinking. Seeds are not supported at all.
+		if state.config.Temperature != nil {
+			params.Temperature = anthropicSDK.Float(float64(*state.config.Temperature))
+		}
+		if state.config.TopP != nil {
+			params.TopP = anthropicSDK.Float(float64(*state.config.TopP))
+		}
+	}
+	if state.config.ThinkingBudgetTokens > 0 {
+		params.Thinking = anthropicSDK.ThinkingConfigParamOfEnabled(int64(state.config.ThinkingBudgetTokens))
+		// The thinking budget is part of max tokens, keep the full output limit available for the answer.
+		params.MaxTokens += int64(state.config.ThinkingBudgetTokens)
+	}
+	if state.config.JSONOutputFormat != nil {
+		tool, err := jsonOutputTool(state.config.JSONOutputFormat)
+		if err != nil {
+			state.output <- llm.TextStreamEvent{
+				Type:  llm.EventTypeError,
+				Value: &llm.StructuredOutputError{Err: err},
+			}
+			return
+		}
+		params.Tools = []anthropicSDK.ToolUnionParam{tool}
+		params.ToolChoice = anthropicSDK.ToolChoiceParamOfTool(llm.JSONOutputToolName)
+	}
+	if a.promptCaching {
+		addCacheBreakpoints(&params)
+	}
+	stream := a.client.Messages.NewStreaming(ctx, params)
 
 	message := anthropicSDK.Message{}
 	for stream.Next() {
@@ -251,17 +285,30 @@ func (a *Anthropic) streamChatWithTools(state messageState) {
 		// Stream text content immediately
 		switch eventVariant := event.AsAny().(type) { //nolint:gocritic
 		case anthropicSDK.ContentBlockDeltaEvent:
-			switch deltaVariant := eventVariant.Delta.AsAny().(type) { //nolint:gocritic
+			switch deltaVariant := eventVariant.Delta.AsAny().(type) {
 			case anthropicSDK.TextDelta:
 				state.output <- llm.TextStreamEvent{
 					Type:  llm.EventTypeText,
 					Value: deltaVariant.Text,
 				}
+			case anthropicSDK.ThinkingDelta:
+				state.output <- llm.TextStreamEvent{
+					Type:  llm.EventTypeReasoning,
+					Value: deltaVariant.Thinking,
+				}
 			}
 		}
 	}
 
 	if err := stream.Err(); err != nil {
+		var apiErr *anthropicSDK.Error
+		if errors.As(err, &apiErr) {
+			providerErr := &llm.ProviderError{StatusCode: apiErr.StatusCode, Err: err}
+			if apiErr.Response != nil {
+				providerErr.RetryAfter = llm.RetryAfterFromHeader(apiErr.Response.Header)
+			}
+			err = providerErr
+		}
 		state.output <- llm.TextStreamEvent{
 			Type:  llm.EventTypeError,
 			Value: fmt.Errorf("error from anthropic stream: %w", err),
@@ -269,21 +316,46 @@ func (a *Anthropic) streamChatWithTools(state messageState) {
 		return
 	}
 
+	// Report token usage
+	state.output <- llm.TextStreamEvent{
+		Type:  llm.EventTypeUsage,
+		Value: llm.UsageWithCacheTokens(message.Usage.InputTokens, message.Usage.OutputTokens, message.Usage.CacheReadInputTokens, message.Usage.CacheCreationInputTokens),
+	}
+
+	if state.config.JSONOutputFormat != nil {
+		sendJSONOutput(state, message)
+		return
+	}
+
 	// Check for tool usage in the message
 	pendingToolCalls := make([]llm.ToolCall, 0, len(message.Content))
+	var reasoning []llm.ReasoningBlock
 	for _, block := range message.Content {
-		if block.Type == "tool_use" {
+		switch block.Type {
+		case "tool_use":
 			pendingToolCalls = append(pendingToolCalls, llm.ToolCall{
 				ID:          block.ID,
 				Name:        block.Name,
 				Description: "",
 				Arguments:   block.Input,
 			})
+		case "thinking":
+			reasoning = append(reasoning, llm.ReasoningBlock{Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			reasoning = append(reasoning, llm.ReasoningBlock{RedactedData: block.Data})
 		}
 	}
 
 	// If tools were used, send tool calls event
 	if len(pendingToolCalls) > 0 {
+		// Anthropic requires the thinking behind tool calls to be sent back unchanged with their results.
+		if len(reasoning) > 0 {
+			state.output <- llm.TextStreamEvent{
+				Type:  llm.EventTypeReasoningBlocks,
+				Value: reasoning,
+			}
+		}
+
 		state.output <- llm.TextStreamEvent{
 			Type:  llm.EventTypeToolCalls,
 			Value: pendingToolCalls,
@@ -297,12 +369,69 @@ func (a *Anthropic) streamChatWithTools(state messageState) {
 	}
 }
 
-func (a *Anthropic) ChatCompletion(request llm.CompletionRequest, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+// addCacheBreakpoints marks the parts of a request that stay the same from one turn to the next for prompt caching.
+// Anthropic allows four breakpoints: the tools, the system prompt and the last two user messages.
+// The breakpoint on the last message caches the conversation for the next turn, the one before reads what the previous turn cached.
+func addCacheBreakpoints(params *anthropicSDK.MessageNewParams) {
+	if len(params.Tools) > 0 {
+		// Tools come first in the prompt, so one breakpoint on the last tool caches all of them.
+		if cacheControl := params.Tools[len(params.Tools)-1].GetCacheControl(); cacheControl != nil {
+			*cacheControl = anthropicSDK.NewCacheControlEphemeralParam()
+		}
+	}
+
+	if len(params.System) > 0 && params.System[len(params.System)-1].Text != "" {
+		params.System[len(params.System)-1].CacheControl = anthropicSDK.NewCacheControlEphemeralParam()
+	}
+
+	breakpoints := 0
+	for i := len(params.Messages) - 1; i >= 0 && breakpoints < 2; i-- {
+		if params.Messages[i].Role != anthropicSDK.MessageParamRoleUser {
+			continue
+		}
+		if addMessageCacheBreakpoint(params.Messages[i]) {
+			breakpoints++
+		}
+	}
+}
+
+// addMessageCacheBreakpoint marks the last block of the message that can be cached, thinking blocks can't be.
+func addMessageCacheBreakpoint(message anthropicSDK.MessageParam) bool {
+	for i := len(message.Content) - 1; i >= 0; i-- {
+		block := message.Content[i]
+		if block.OfThinking != nil || block.OfRedactedThinking != nil {
+			continue
+		}
+		if cacheControl := block.GetCacheControl(); cacheControl != nil {
+			*cacheControl = anthropicSDK.NewCacheControlEphemeralParam()
+			return true
+		}
+	}
+	return false
+}
+
+// sendJSONOutput sends the input the model gave the structured output tool as the text of the response.
+func sendJSONOutput(state messageState, message anthropicSDK.Message) {
+	var input string
+	for _, block := range message.Content {
+		if block.Type == "tool_use" && block.Name == llm.JSONOutputToolName {
+			input = string(block.Input)
+			break
+		}
+	}
+	llm.SendJSONToolOutput(state.output, state.config.JSONOutputFormat, input, string(message.StopReason))
+}
+
+func (a *Anthropic) ChatCompletion(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
 	eventStream := make(chan llm.TextStreamEvent)
 
 	cfg := a.createConfig(opts)
+	if cfg.JSONOutputFormat != nil {
+		// Thinking can't be used when the model is made to call a specific tool.
+		cfg.ThinkingBudgetTokens = 0
+	}
 
-	system, messages := conversationToMessages(request.Posts)
+	system, messages := conversationToMessages(request.Posts, cfg.ThinkingBudgetTokens > 0)
 
 	initialState := messageState{
 		messages: messages,
@@ -318,17 +447,19 @@ func (a *Anthropic) ChatCompletion(request llm.CompletionRequest, opts ...llm.La
 		initialState.resolver = request.Context.Tools.ResolveTool
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
 	go func() {
 		defer close(eventStream)
-		a.streamChatWithTools(initialState)
+		defer cancel()
+		a.streamChatWithTools(ctx, initialState)
 	}()
 
-	return &llm.TextStreamResult{Stream: eventStream}, nil
+	return &llm.TextStreamResult{Stream: eventStream, Cancel: cancel}, nil
 }
 
-func (a *Anthropic) ChatCompletionNoStream(request llm.CompletionRequest, opts ...llm.LanguageModelOption) (string, error) {
+func (a *Anthropic) ChatCompletionNoStream(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (string, error) {
 	// This could perform better if we didn't use the streaming API here, but the complexity is not worth it.
-	result, err := a.ChatCompletion(request, opts...)
+	result, err := a.ChatCompletion(ctx, request, opts...)
 	if err != nil {
 		return "", err
 	}
@@ -336,7 +467,7 @@ func (a *Anthropic) ChatCompletionNoStream(request llm.CompletionRequest, opts .
 }
 
 func (a *Anthropic) CountTokens(text string) int {
-	return 0
+	return llm.TokenizerForModel(a.defaultModel).CountTokens(text)
 }
 
 // convertTools converts from llm.Tool to anthropicSDK.ToolUnionParam format
@@ -354,6 +485,42 @@ func convertTools(tools []llm.Tool) []anthropicSDK.ToolUnionParam {
 	return converted
 }
 
+// jsonOutputTool describes the structured output tool, whose input must match schema.
+func jsonOutputTool(schema *jsonschema.Schema) (anthropicSDK.ToolUnionParam, error) {
+	if err := llm.CheckJSONOutputToolSchema(schema); err != nil {
+		return anthropicSDK.ToolUnionParam{}, err
+	}
+
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return anthropicSDK.ToolUnionParam{}, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(schemaJSON, &fields); err != nil {
+		return anthropicSDK.ToolUnionParam{}, fmt.Errorf("failed to unmarshal schema: %w", err)
+	}
+	inputSchema := anthropicSDK.ToolInputSchemaParam{
+		Properties:  fields["properties"],
+		Required:    schema.Required,
+		ExtraFields: map[string]any{},
+	}
+	for key, value := range fields {
+		switch key {
+		case "type", "properties", "required":
+		default:
+			inputSchema.ExtraFields[key] = value
+		}
+	}
+
+	return anthropicSDK.ToolUnionParam{
+		OfTool: &anthropicSDK.ToolParam{
+			Name:        llm.JSONOutputToolName,
+			Description: anthropicSDK.String(llm.JSONOutputToolDescription),
+			InputSchema: inputSchema,
+		},
+	}, nil
+}
+
 func (a *Anthropic) InputTokenLimit() int {
 	if a.inputTokenLimit > 0 {
 		return a.inputTokenLimit
@@ -5,10 +5,18 @@ package anthropic
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	anthropicSDK "github.com/anthropics/anthropic-sdk-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/mattermost/mattermost-plugin-ai/llm"
 )
@@ -233,9 +241,323 @@ func TestConversationToMessages(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotSystem, gotMessages := conversationToMessages(tt.conversation)
+			gotSystem, gotMessages := conversationToMessages(tt.conversation, false)
 			assert.Equal(t, tt.wantSystem, gotSystem)
 			assert.Equal(t, tt.wantMessages, gotMessages)
 		})
 	}
 }
+
+func TestConversationToMessagesReasoning(t *testing.T) {
+	conversation := []llm.Post{
+		{Role: llm.PostRoleUser, Message: "Search for x"},
+		{
+			Role:    llm.PostRoleBot,
+			Message: "Searching",
+			ToolUse: []llm.ToolCall{{ID: "toolu_1", Name: "search", Arguments: []byte(`{"q":"x"}`), Result: "found", Status: llm.ToolCallStatusSuccess}},
+			Reasoning: []llm.ReasoningBlock{
+				{Text: "The user wants a search.", Signature: "sig"},
+				{RedactedData: "encrypted"},
+			},
+		},
+	}
+
+	_, messages := conversationToMessages(conversation, true)
+	require.Len(t, messages, 3)
+	assistant := messages[1].Content
+	require.Len(t, assistant, 4)
+	assert.Equal(t, anthropicSDK.NewThinkingBlock("sig", "The user wants a search."), assistant[0])
+	assert.Equal(t, anthropicSDK.NewRedactedThinkingBlock("encrypted"), assistant[1])
+	assert.Equal(t, anthropicSDK.NewTextBlock("Searching"), assistant[2])
+
+	// Without thinking enabled the reasoning must be left out.
+	_, messages = conversationToMessages(conversation, false)
+	require.Len(t, messages[1].Content, 2)
+	assert.Equal(t, anthropicSDK.NewTextBlock("Searching"), messages[1].Content[0])
+}
+
+func TestConversationToMessagesDocuments(t *testing.T) {
+	conversation := []llm.Post{
+		{
+			Role:    llm.PostRoleUser,
+			Message: "Compare these",
+			Files: []llm.File{
+				{Kind: llm.FileKindDocument, Name: "report.pdf", MimeType: "application/pdf", Size: 3, Reader: bytes.NewReader([]byte("pdf")), Text: "report text"},
+				{Kind: llm.FileKindDocument, Name: "large.pdf", MimeType: "application/pdf", Size: 100 * 1024 * 1024, Text: "large text"},
+				{Kind: llm.FileKindDocument, Name: "empty.pdf", MimeType: "application/pdf"},
+			},
+		},
+	}
+
+	_, messages := conversationToMessages(conversation, false)
+	require.Len(t, messages, 1)
+	content := messages[0].Content
+	require.Len(t, content, 4)
+
+	document := content[1].OfDocument
+	require.NotNil(t, document)
+	require.NotNil(t, document.Source.OfBase64)
+	assert.Equal(t, "cGRm", document.Source.OfBase64.Data)
+	assert.Equal(t, "report.pdf", document.Title.Value)
+
+	// Documents that can't be sent are given as their extracted text.
+	assert.Equal(t, anthropicSDK.NewTextBlock("File Name: large.pdf\nContent: large text"), content[2])
+	assert.Equal(t, anthropicSDK.NewTextBlock("[The text of document empty.pdf could not be extracted]"), content[3])
+}
+
+// redirectTransport sends every request to a test server.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newStreamingTestProvider returns a provider whose requests are answered with the given server-sent events.
+// The body of the last request is decoded into requestBody.
+func newStreamingTestProvider(t *testing.T, events []string, requestBody *map[string]any) *Anthropic {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, requestBody))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var eventType struct {
+				Type string `json:"type"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(event), &eventType))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType.Type, event)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return New(llm.ServiceConfig{APIKey: "key", DefaultModel: "claude-test", OutputTokenLimit: 1000}, &http.Client{Transport: &redirectTransport{target: target}})
+}
+
+func TestStreamThinking(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"I should "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"search."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig123"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"search","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":\"x\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	var requestBody map[string]any
+	provider := newStreamingTestProvider(t, events, &requestBody)
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Search for x"}},
+		Context: llm.NewContext(),
+	}, llm.WithThinkingBudget(2048))
+	require.NoError(t, err)
+
+	var reasoningText string
+	var reasoning []llm.ReasoningBlock
+	var toolCalls []llm.ToolCall
+	for event := range result.Stream {
+		switch event.Type {
+		case llm.EventTypeReasoning:
+			reasoningText += event.Value.(string)
+		case llm.EventTypeReasoningBlocks:
+			reasoning = event.Value.([]llm.ReasoningBlock)
+		case llm.EventTypeToolCalls:
+			require.NotNil(t, reasoning, "reasoning blocks must arrive before the tool calls")
+			toolCalls = event.Value.([]llm.ToolCall)
+		case llm.EventTypeError:
+			require.NoError(t, event.Value.(error))
+		}
+	}
+
+	assert.Equal(t, "I should search.", reasoningText)
+	assert.Equal(t, []llm.ReasoningBlock{{Text: "I should search.", Signature: "sig123"}}, reasoning)
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, "search", toolCalls[0].Name)
+
+	assert.Equal(t, map[string]any{"type": "enabled", "budget_tokens": float64(2048)}, requestBody["thinking"])
+	assert.Equal(t, float64(3048), requestBody["max_tokens"])
+}
+
+// jsonOutputEvents streams a message where the structured output tool is called with input.
+func jsonOutputEvents(input string) []string {
+	partialJSON, _ := json.Marshal(input)
+	return []string{
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"json_output","input":{}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":` + string(partialJSON) + `}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		`{"type":"message_stop"}`,
+	}
+}
+
+type gradeOutput struct {
+	Pass  bool `json:"pass"`
+	Score int  `json:"score"`
+}
+
+func TestJSONOutput(t *testing.T) {
+	request := llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Grade this"}},
+		Context: llm.NewContext(),
+	}
+
+	t.Run("forces the output tool", func(t *testing.T) {
+		var requestBody map[string]any
+		provider := newStreamingTestProvider(t, jsonOutputEvents(`{"pass":true,"score":3}`), &requestBody)
+
+		output, err := provider.ChatCompletionNoStream(context.Background(), request, llm.WithThinkingBudget(2048), llm.WithJSONOutput[gradeOutput]())
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"pass":true,"score":3}`, output)
+
+		assert.Equal(t, map[string]any{"type": "tool", "name": "json_output"}, requestBody["tool_choice"])
+		tools := requestBody["tools"].([]any)
+		require.Len(t, tools, 1)
+		inputSchema := tools[0].(map[string]any)["input_schema"].(map[string]any)
+		assert.Equal(t, "object", inputSchema["type"])
+		assert.ElementsMatch(t, []any{"pass", "score"}, inputSchema["required"])
+		assert.Contains(t, inputSchema["properties"], "score")
+		assert.NotContains(t, requestBody, "thinking", "thinking can't be used with a forced tool")
+	})
+
+	t.Run("output not matching the schema", func(t *testing.T) {
+		var requestBody map[string]any
+		provider := newStreamingTestProvider(t, jsonOutputEvents(`{"pass":"yes"}`), &requestBody)
+
+		_, err := provider.ChatCompletionNoStream(context.Background(), request, llm.WithJSONOutput[gradeOutput]())
+		var structuredErr *llm.StructuredOutputError
+		require.ErrorAs(t, err, &structuredErr)
+		assert.Equal(t, `{"pass":"yes"}`, structuredErr.Output)
+	})
+
+	t.Run("schema without an object at the root", func(t *testing.T) {
+		var requestBody map[string]any
+		provider := newStreamingTestProvider(t, nil, &requestBody)
+
+		_, err := provider.ChatCompletionNoStream(context.Background(), request, llm.WithJSONOutput[[]string]())
+		assert.ErrorIs(t, err, llm.ErrStructuredOutput)
+		assert.Nil(t, requestBody, "no request should be sent")
+	})
+}
+
+func TestSamplingParameters(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}`,
+		`{"type":"message_stop"}`,
+	}
+	request := llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	}
+
+	var requestBody map[string]any
+	provider := newStreamingTestProvider(t, events, &requestBody)
+
+	_, err := provider.ChatCompletionNoStream(context.Background(), request,
+		llm.WithTemperature(0),
+		llm.WithTopP(0.5),
+		llm.WithStopSequences([]string{"END"}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), requestBody["temperature"])
+	assert.Equal(t, 0.5, requestBody["top_p"])
+	assert.Equal(t, []any{"END"}, requestBody["stop_sequences"])
+
+	requestBody = nil
+	_, err = provider.ChatCompletionNoStream(context.Background(), request,
+		llm.WithTemperature(0),
+		llm.WithThinkingBudget(2048),
+	)
+	require.NoError(t, err)
+	assert.NotContains(t, requestBody, "temperature", "sampling can't be adjusted while thinking")
+}
+
+func TestAddCacheBreakpoints(t *testing.T) {
+	conversation := []llm.Post{
+		{Role: llm.PostRoleSystem, Message: "You are a helpful assistant."},
+		{Role: llm.PostRoleUser, Message: "First question"},
+		{Role: llm.PostRoleBot, Message: "First answer"},
+		{Role: llm.PostRoleUser, Message: "Search for x"},
+		{
+			Role:      llm.PostRoleBot,
+			ToolUse:   []llm.ToolCall{{ID: "toolu_1", Name: "search", Arguments: []byte(`{}`), Result: "found", Status: llm.ToolCallStatusSuccess}},
+			Reasoning: []llm.ReasoningBlock{{Text: "Searching", Signature: "sig"}},
+		},
+	}
+	system, messages := conversationToMessages(conversation, true)
+	params := anthropicSDK.MessageNewParams{
+		System:   []anthropicSDK.TextBlockParam{{Text: system}},
+		Messages: messages,
+		Tools: convertTools([]llm.Tool{
+			{Name: "search", Schema: llm.NewJSONSchemaFromStruct[struct{}]()},
+			{Name: "lookup", Schema: llm.NewJSONSchemaFromStruct[struct{}]()},
+		}),
+	}
+
+	addCacheBreakpoints(&params)
+
+	ephemeral := anthropicSDK.NewCacheControlEphemeralParam()
+	assert.Equal(t, ephemeral, params.System[0].CacheControl)
+	assert.Equal(t, ephemeral, *params.Tools[1].GetCacheControl())
+	assert.Zero(t, *params.Tools[0].GetCacheControl())
+
+	// The tool results and the question before them are the last two user messages.
+	require.Len(t, params.Messages, 5)
+	assert.Zero(t, *params.Messages[0].Content[0].GetCacheControl())
+	assert.Zero(t, *params.Messages[1].Content[0].GetCacheControl())
+	assert.Equal(t, ephemeral, *params.Messages[2].Content[0].GetCacheControl())
+	assert.Zero(t, *params.Messages[3].Content[1].GetCacheControl())
+	assert.Equal(t, ephemeral, *params.Messages[4].Content[0].GetCacheControl())
+}
+
+func TestPromptCachingUsage(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"usage":{"input_tokens":10,"cache_read_input_tokens":2000,"cache_creation_input_tokens":300,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	var requestBody map[string]any
+	provider := newStreamingTestProvider(t, events, &requestBody)
+	provider.promptCaching = true
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts: []llm.Post{
+			{Role: llm.PostRoleSystem, Message: "You are a helpful assistant."},
+			{Role: llm.PostRoleUser, Message: "Hi"},
+		},
+		Context: llm.NewContext(),
+	})
+	require.NoError(t, err)
+
+	var usage llm.TokenUsage
+	for event := range result.Stream {
+		if event.Type == llm.EventTypeUsage {
+			usage = event.Value.(llm.TokenUsage)
+		}
+	}
+	assert.Equal(t, llm.TokenUsage{InputTokens: 2310, OutputTokens: 2, CachedTokens: 2000, CacheWriteTokens: 300}, usage)
+
+	system := requestBody["system"].([]any)
+	assert.Equal(t, map[string]any{"type": "ephemeral"}, system[0].(map[string]any)["cache_control"])
+}
@@ -5,10 +5,13 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -48,6 +51,8 @@ type MCPClientManager interface {
 
 // API represents the HTTP API functionality for the plugin
 type API struct {
+	// ctx bounds the lifetime of LLM requests that outlive the HTTP request that started them
+	ctx                  context.Context
 	bots                 *bots.MMBots
 	conversationsService *conversations.Conversations
 	meetingsService      *meetings.Service
@@ -69,6 +74,7 @@ type API struct {
 
 // New creates a new API instance
 func New(
+	ctx context.Context,
 	bots *bots.MMBots,
 	conversationsService *conversations.Conversations,
 	meetingsService *meetings.Service,
@@ -87,6 +93,7 @@ func New(
 	mcpClientManager MCPClientManager,
 ) *API {
 	return &API{
+		ctx:                  ctx,
 		bots:                 bots,
 		conversationsService: conversationsService,
 		meetingsService:      meetingsService,
@@ -122,16 +129,20 @@ func (a *API) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Reques
 	router.GET("/oauth/callback", a.handleOAuthCallback)
 	router.GET("/ai_threads", a.handleGetAIThreads)
 	router.GET("/ai_bots", a.handleGetAIBots)
+	router.GET("/voice_replies", a.handleGetVoiceReplySettings)
+	router.PUT("/voice_replies", a.handleSaveVoiceReplySettings)
+	router.GET("/indexing_settings", a.handleGetIndexingSettings)
+	router.PUT("/indexing_settings", a.handleSaveIndexingSettings)
 
 	botRequiredRouter := router.Group("")
 	botRequiredRouter.Use(a.aiBotRequired)
 
 	postRouter := botRequiredRouter.Group("/post/:postid")
 	postRouter.Use(a.postAuthorizationRequired)
-	postRouter.POST("/react", a.handleReact)
-	postRouter.POST("/analyze", a.handleThreadAnalysis)
-	postRouter.POST("/transcribe/file/:fileid", a.handleTranscribeFile)
-	postRouter.POST("/summarize_transcription", a.handleSummarizeTranscription)
+	postRouter.POST("/react", a.rateLimitRequired, a.handleReact)
+	postRouter.POST("/analyze", a.rateLimitRequired, a.handleThreadAnalysis)
+	postRouter.POST("/transcribe/file/:fileid", a.rateLimitRequired, a.handleTranscribeFile)
+	postRouter.POST("/summarize_transcription", a.rateLimitRequired, a.handleSummarizeTranscription)
 	postRouter.POST("/stop", a.handleStop)
 	postRouter.POST("/regenerate", a.handleRegenerate)
 	postRouter.POST("/tool_call", a.handleToolCall)
@@ -139,7 +150,8 @@ func (a *API) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Reques
 
 	channelRouter := botRequiredRouter.Group("/channel/:channelid")
 	channelRouter.Use(a.channelAuthorizationRequired)
-	channelRouter.POST("/interval", a.handleInterval)
+	channelRouter.POST("/interval", a.rateLimitRequired, a.handleInterval)
+	channelRouter.POST("/generate_image", a.rateLimitRequired, a.handleGenerateImage)
 
 	adminRouter := router.Group("/admin")
 	adminRouter.Use(a.mattermostAdminAuthorizationRequired)
@@ -147,12 +159,13 @@ func (a *API) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Reques
 	adminRouter.GET("/reindex/status", a.handleGetJobStatus)
 	adminRouter.POST("/reindex/cancel", a.handleCancelJob)
 	adminRouter.GET("/mcp/tools", a.handleGetMCPTools)
+	adminRouter.GET("/rate_limits", a.handleGetRateLimits)
 
 	searchRouter := botRequiredRouter.Group("/search")
 	// Only returns search results
 	searchRouter.POST("", a.handleSearchQuery)
 	// Initiates a search and responds to the user in a DM with the selected bot
-	searchRouter.POST("/run", a.handleRunSearch)
+	searchRouter.POST("/run", a.rateLimitRequired, a.handleRunSearch)
 
 	router.ServeHTTP(w, r)
 }
@@ -191,6 +204,42 @@ func (a *API) aiBotRequired(c *gin.Context) {
 	c.Set(ContextBotKey, bot)
 }
 
+// rateLimitRequired rejects requests from users who have reached one of the bot's rate limits.
+func (a *API) rateLimitRequired(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	bot := c.MustGet(ContextBotKey).(*bots.Bot)
+
+	teamID := ""
+	if channel, ok := c.Get(ContextChannelKey); ok {
+		teamID = channel.(*model.Channel).TeamId
+	}
+
+	if err := a.bots.CheckRateLimits(bot, userID, teamID); err != nil {
+		a.abortRateLimited(c, userID, err)
+		return
+	}
+}
+
+// abortRateLimited responds to a failed rate limit check, telling rate limited users why in their language.
+func (a *API) abortRateLimited(c *gin.Context, userID string, err error) {
+	var rateLimitErr *bots.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	locale := ""
+	if user, userErr := a.pluginAPI.User.Get(userID); userErr == nil {
+		locale = user.Locale
+	}
+
+	retryAfter := max(int(math.Ceil(time.Until(rateLimitErr.ResetAt).Seconds())), 1)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error": i18n.FormatRateLimitMessage(a.i18nBundle, locale, rateLimitErr.Scope),
+	})
+}
+
 func (a *API) ginlogger(c *gin.Context) {
 	c.Next()
 
@@ -246,6 +295,7 @@ type AIBotInfo struct {
 	ChannelIDs         []string               `json:"channelIDs"`
 	UserAccessLevel    llm.UserAccessLevel    `json:"userAccessLevel"`
 	UserIDs            []string               `json:"userIDs"`
+	VoiceReplies       bool                   `json:"voiceReplies"`
 }
 
 type AIBotsResponse struct {
@@ -286,6 +336,7 @@ func (a *API) getAIBotsForUser(userID string) ([]AIBotInfo, error) {
 			ChannelIDs:         bot.GetConfig().ChannelIDs,
 			UserAccessLevel:    bot.GetConfig().UserAccessLevel,
 			UserIDs:            bot.GetConfig().UserIDs,
+			VoiceReplies:       bot.GetConfig().TextToSpeech.Enabled,
 		})
 		if bot.GetMMBot().Username == defaultBotName {
 			bots[0], bots[i] = bots[i], bots[0]
@@ -311,3 +362,71 @@ func (a *API) handleGetAIBots(c *gin.Context) {
 		SearchEnabled: searchEnabled,
 	})
 }
+
+func (a *API) handleGetVoiceReplySettings(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	settings, err := a.conversationsService.GetVoiceReplySettings(userID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func (a *API) handleSaveVoiceReplySettings(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+
+	var settings conversations.VoiceReplySettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	// Any voice is accepted, compatible servers offer voices beyond the ones listed in llm.SpeechVoices.
+	settings.Voice = strings.TrimSpace(settings.Voice)
+
+	if err := a.conversationsService.SaveVoiceReplySettings(userID, settings); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func (a *API) handleGetIndexingSettings(c *gin.Context) {
+	if a.indexerService == nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("search functionality is not configured"))
+		return
+	}
+
+	userID := c.GetHeader("Mattermost-User-Id")
+	settings, err := a.indexerService.GetIndexingSettings(userID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func (a *API) handleSaveIndexingSettings(c *gin.Context) {
+	if a.indexerService == nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("search functionality is not configured"))
+		return
+	}
+
+	userID := c.GetHeader("Mattermost-User-Id")
+
+	var settings indexer.IndexingSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	if err := a.indexerService.SaveIndexingSettings(userID, settings); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
@@ -5,19 +5,30 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/indexer"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
 	"github.com/mattermost/mattermost-plugin-ai/mcp"
 	"github.com/mattermost/mattermost/server/public/model"
 )
 
-// handleReindexPosts starts a background job to reindex all posts
+// handleReindexPosts starts a background job to reindex all posts, or the posts created since a time when
+// the body sets it
 func (a *API) handleReindexPosts(c *gin.Context) {
-	if err := a.enforceEmptyBody(c); err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
+	var options indexer.ReindexOptions
+	if err := json.NewDecoder(c.Request.Body).Decode(&options); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid reindex options: %w", err))
+		return
+	}
+	if options.Since < 0 {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("since must be a time in milliseconds"))
 		return
 	}
 	if a.indexerService == nil {
@@ -25,16 +36,14 @@ func (a *API) handleReindexPosts(c *gin.Context) {
 		return
 	}
 
-	jobStatus, err := a.indexerService.StartReindexJob()
+	jobStatus, err := a.indexerService.StartReindexJob(options)
 	if err != nil {
-		switch err.Error() {
-		case "job already running":
+		if errors.Is(err, indexer.ErrJobRunning) {
 			c.JSON(http.StatusConflict, jobStatus)
 			return
-		default:
-			c.AbortWithError(http.StatusInternalServerError, err)
-			return
 		}
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, jobStatus)
@@ -205,3 +214,37 @@ func (a *API) discoverServerTools(ctx context.Context, requestingAdminID string,
 
 	return tools, nil
 }
+
+// BotRateLimitInfo is a bot's rate limits along with how much of them is currently used
+type BotRateLimitInfo struct {
+	BotID       string                    `json:"botID"`
+	BotUsername string                    `json:"botUsername"`
+	Limits      llm.RateLimitConfig       `json:"limits"`
+	Consumption bots.RateLimitConsumption `json:"consumption"`
+}
+
+// handleGetRateLimits returns the current rate limit consumption of every bot.
+// The optional user_id and team_id query parameters add the consumption of that user and team.
+func (a *API) handleGetRateLimits(c *gin.Context) {
+	userID := c.Query("user_id")
+	teamID := c.Query("team_id")
+
+	allBots := a.bots.GetAllBots()
+	response := make([]BotRateLimitInfo, 0, len(allBots))
+	for _, bot := range allBots {
+		consumption, err := a.bots.GetRateLimitConsumption(bot, userID, teamID)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to get rate limit consumption: %w", err))
+			return
+		}
+
+		response = append(response, BotRateLimitInfo{
+			BotID:       bot.GetMMBot().UserId,
+			BotUsername: bot.GetMMBot().Username,
+			Limits:      bot.GetConfig().RateLimits,
+			Consumption: consumption,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -4,9 +4,11 @@
 package api
 
 import (
-	stdcontext "context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	"errors"
 
@@ -14,7 +16,9 @@ import (
 	"github.com/gin-gonic/gin/render"
 	"github.com/mattermost/mattermost-plugin-ai/bots"
 	"github.com/mattermost/mattermost-plugin-ai/channels"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
 	"github.com/mattermost/mattermost-plugin-ai/mmapi"
+	"github.com/mattermost/mattermost-plugin-ai/mmtools"
 	"github.com/mattermost/mattermost-plugin-ai/prompts"
 	"github.com/mattermost/mattermost-plugin-ai/streaming"
 	"github.com/mattermost/mattermost/server/public/model"
@@ -126,7 +130,7 @@ func (a *API) handleInterval(c *gin.Context) {
 	}
 
 	// Call channels interval processing
-	resultStream, err := channels.New(bot.LLM(), a.prompts, a.mmClient, a.dbClient).Interval(context, channel.Id, data.StartTime, data.EndTime, promptPreset)
+	resultStream, err := channels.New(bot.LLM(), a.prompts, a.mmClient, a.dbClient).Interval(a.ctx, context, channel.Id, data.StartTime, data.EndTime, promptPreset)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -137,7 +141,7 @@ func (a *API) handleInterval(c *gin.Context) {
 	post.AddProp(streaming.NoRegen, "true")
 
 	// Stream result to new DM
-	if err := a.streamingService.StreamToNewDM(stdcontext.Background(), bot.GetMMBot().UserId, resultStream, user.Id, post, ""); err != nil {
+	if err := a.streamingService.StreamToNewDM(a.ctx, bot.GetMMBot().UserId, resultStream, user.Id, post, ""); err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
@@ -153,3 +157,94 @@ func (a *API) handleInterval(c *gin.Context) {
 
 	c.Render(http.StatusOK, render.JSON{Data: result})
 }
+
+func (a *API) handleGenerateImage(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	channel := c.MustGet(ContextChannelKey).(*model.Channel)
+	bot := c.MustGet(ContextBotKey).(*bots.Bot)
+
+	if !a.pluginAPI.User.HasPermissionToChannel(userID, channel.Id, model.PermissionCreatePost) {
+		c.AbortWithError(http.StatusForbidden, errors.New("user doesn't have permission to post in channel"))
+		return
+	}
+
+	generator := a.bots.GetImageGenerator(bot)
+	if generator == nil {
+		c.AbortWithError(http.StatusBadRequest, errors.New("bot can't generate images"))
+		return
+	}
+
+	data := struct {
+		Prompt string `json:"prompt"`
+		Size   string `json:"size"`
+		RootID string `json:"root_id"`
+	}{}
+	err := json.NewDecoder(c.Request.Body).Decode(&data)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	defer c.Request.Body.Close()
+
+	data.Prompt = strings.TrimSpace(data.Prompt)
+	if data.Prompt == "" || len(data.Prompt) > mmtools.MaxImagePromptLength {
+		c.AbortWithError(http.StatusBadRequest, errors.New("prompt must be between 1 and 4000 characters"))
+		return
+	}
+	imageConfig := bot.GetConfig().ImageGeneration
+	size := imageConfig.Size
+	if data.Size != "" {
+		if !slices.Contains(llm.ImageSizes, data.Size) {
+			c.AbortWithError(http.StatusBadRequest, fmt.Errorf("unsupported image size: %s", data.Size))
+			return
+		}
+		size = data.Size
+	}
+	if data.RootID != "" {
+		rootPost, rootErr := a.pluginAPI.Post.GetPost(data.RootID)
+		if rootErr != nil || rootPost.ChannelId != channel.Id {
+			c.AbortWithError(http.StatusBadRequest, errors.New("root post is not in the channel"))
+			return
+		}
+	}
+
+	// The request was counted towards the rate limits when it was admitted.
+	llmContext := llm.NewContext()
+	llmContext.RequestingUser = &model.User{Id: userID}
+	llmContext.Channel = channel
+	image, err := generator.GenerateImage(c.Request.Context(), llm.ImageRequest{
+		Prompt:  data.Prompt,
+		Model:   imageConfig.Model,
+		Size:    size,
+		Context: llmContext,
+	})
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to generate image: %w", err))
+		return
+	}
+
+	fileInfo, err := a.mmClient.UploadFile(image.Data, channel.Id, mmtools.GeneratedImageFileName)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to upload image: %w", err))
+		return
+	}
+
+	post := &model.Post{
+		ChannelId: channel.Id,
+		RootId:    data.RootID,
+		Message:   data.Prompt,
+		FileIds:   []string{fileInfo.Id},
+	}
+	post.AddProp(streaming.NoRegen, "true")
+	if err := a.conversationsService.BotCreateNonResponsePost(bot.GetMMBot().UserId, userID, post); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to create post: %w", err))
+		return
+	}
+
+	result := map[string]string{
+		"postid":    post.Id,
+		"channelid": post.ChannelId,
+	}
+
+	c.Render(http.StatusOK, render.JSON{Data: result})
+}
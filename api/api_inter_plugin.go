@@ -17,6 +17,8 @@ type SimpleCompletionRequest struct {
 	BotUsername     string         `json:"botUsername"`
 	RequesterUserID string         `json:"requesterUserID"`
 	Parameters      map[string]any `json:"parameters"`
+	// Sampling overrides the bot's sampling settings for this request.
+	Sampling *llm.SamplingConfig `json:"sampling"`
 }
 
 func (a *API) handleInterPluginSimpleCompletion(c *gin.Context) {
@@ -31,6 +33,15 @@ func (a *API) handleInterPluginSimpleCompletion(c *gin.Context) {
 		return
 	}
 
+	var samplingOptions []llm.LanguageModelOption
+	if req.Sampling != nil {
+		if !req.Sampling.IsValid() {
+			c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid sampling parameters"))
+			return
+		}
+		samplingOptions = req.Sampling.Options()
+	}
+
 	// If bot username is not provided, use the default bot
 	botUsername := req.BotUsername
 	if botUsername == "" {
@@ -44,6 +55,11 @@ func (a *API) handleInterPluginSimpleCompletion(c *gin.Context) {
 		return
 	}
 
+	if err := a.bots.CheckRateLimits(bot, userID, ""); err != nil {
+		a.abortRateLimited(c, userID, err)
+		return
+	}
+
 	// Get user information
 	user, err := a.pluginAPI.User.Get(userID)
 	if err != nil {
@@ -86,10 +102,11 @@ func (a *API) handleInterPluginSimpleCompletion(c *gin.Context) {
 			},
 		},
 		Context: context,
+		Feature: llm.FeatureInterPlugin,
 	}
 
 	// Execute the completion
-	response, err := bot.LLM().ChatCompletionNoStream(completionRequest)
+	response, err := bot.LLM().ChatCompletionNoStream(c.Request.Context(), completionRequest, samplingOptions...)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to execute chat completion: %v", err))
 		return
@@ -10,6 +10,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
 )
 
 // SearchRequest represents a search query request from the API
@@ -18,6 +19,8 @@ type SearchRequest struct {
 	TeamID     string `json:"teamId"`
 	ChannelID  string `json:"channelId"`
 	MaxResults int    `json:"maxResults"`
+	// Mode is vector, keyword or hybrid, empty uses the configured search mode.
+	Mode string `json:"mode"`
 }
 
 func (a *API) handleRunSearch(c *gin.Context) {
@@ -40,7 +43,12 @@ func (a *API) handleRunSearch(c *gin.Context) {
 		return
 	}
 
-	result, err := a.searchService.RunSearch(c.Request.Context(), userID, bot, req.Query, req.TeamID, req.ChannelID, req.MaxResults)
+	if !embeddings.IsValidSearchMode(req.Mode) {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid search mode: %s", req.Mode))
+		return
+	}
+
+	result, err := a.searchService.RunSearch(a.ctx, userID, bot, req.Query, req.TeamID, req.ChannelID, req.MaxResults, req.Mode)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -64,7 +72,12 @@ func (a *API) handleSearchQuery(c *gin.Context) {
 		return
 	}
 
-	response, err := a.searchService.SearchQuery(c.Request.Context(), userID, bot, req.Query, req.TeamID, req.ChannelID, req.MaxResults)
+	if !embeddings.IsValidSearchMode(req.Mode) {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid search mode: %s", req.Mode))
+		return
+	}
+
+	response, err := a.searchService.SearchQuery(c.Request.Context(), userID, bot, req.Query, req.TeamID, req.ChannelID, req.MaxResults, req.Mode)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -158,6 +158,32 @@ func TestHandleSearchQuery(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectError:    false,
 		},
+		{
+			name: "search query passes the search mode",
+			setupMock: func(t *testing.T) *search.Search {
+				mockEmbedding := mocks.NewMockEmbeddingSearch(t)
+				mockEmbedding.On("Search", mock.Anything, "ERR_4012", mock.MatchedBy(func(opts embeddings.SearchOptions) bool {
+					return opts.Mode == embeddings.SearchModeKeyword
+				})).Return([]embeddings.SearchResult{}, nil)
+				return search.New(mockEmbedding, nil, nil, nil, nil)
+			},
+			requestBody: SearchRequest{
+				Query: "ERR_4012",
+				Mode:  embeddings.SearchModeKeyword,
+			},
+			expectedStatus: http.StatusOK,
+			expectError:    false,
+		},
+		{
+			name:          "search query fails - invalid search mode",
+			searchService: search.New(mocks.NewMockEmbeddingSearch(t), nil, nil, nil, nil),
+			requestBody: SearchRequest{
+				Query: "test query",
+				Mode:  "fuzzy",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
 		{
 			name:          "search query fails - service disabled",
 			searchService: search.New(nil, nil, nil, nil, nil),
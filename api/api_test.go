@@ -66,7 +66,7 @@ func (e *TestEnvironment) Cleanup(t *testing.T) {
 // createTestBots creates a test MMBots instance for testing
 func createTestBots(mockAPI *plugintest.API, client *pluginapi.Client) *bots.MMBots {
 	licenseChecker := enterprise.NewLicenseChecker(client)
-	testBots := bots.New(mockAPI, client, licenseChecker, nil, &http.Client{})
+	testBots := bots.New(mockAPI, client, licenseChecker, nil, &http.Client{}, nil, nil, nil)
 	return testBots
 }
 
@@ -98,7 +98,7 @@ func SetupTestEnvironment(t *testing.T) *TestEnvironment {
 	// Create minimal conversations service for testing
 	conversationsService := &conversations.Conversations{}
 
-	api := New(testBots, conversationsService, nil, nil, nil, client, noopMetrics, nil, &testConfigImpl{}, nil, nil, nil, nil, nil, nil, &mockMCPClientManager{})
+	api := New(context.Background(), testBots, conversationsService, nil, nil, nil, client, noopMetrics, nil, &testConfigImpl{}, nil, nil, nil, nil, nil, nil, &mockMCPClientManager{})
 
 	return &TestEnvironment{
 		api:     api,
@@ -298,7 +298,6 @@ func TestEmptyBodyCheckerInApi(t *testing.T) {
 		"summarize transcription": "/post/postid/summarize_transcription?botUsername=thebot",
 		"regen":                   "/post/postid/regenerate",
 		"postback summary":        "/post/postid/postback_summary",
-		"reindex":                 "/admin/reindex",
 		"cancel":                  "/admin/reindex/cancel",
 	} {
 		t.Run(urlName, func(t *testing.T) {
@@ -323,6 +322,33 @@ func TestEmptyBodyCheckerInApi(t *testing.T) {
 	}
 }
 
+func TestReindexOptions(t *testing.T) {
+	// This just makes gin not output a whole bunch of debug stuff.
+	// maybe pipe this to the test log?
+	gin.SetMode(gin.ReleaseMode)
+	gin.DefaultWriter = io.Discard
+
+	for name, body := range map[string]string{
+		"invalid json":   "non-empty body",
+		"negative since": `{"since": -1}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := SetupTestEnvironment(t)
+			defer e.Cleanup(t)
+
+			e.mockAPI.On("LogError", mock.Anything)
+			e.mockAPI.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(true)
+
+			request := httptest.NewRequest(http.MethodPost, "/admin/reindex", strings.NewReader(body))
+			request.Header.Add("Mattermost-User-ID", "userid")
+			recorder := httptest.NewRecorder()
+			e.api.ServeHTTP(&plugin.Context{}, recorder, request)
+			resp := recorder.Result()
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
 func TestChannelRouter(t *testing.T) {
 	// This just makes gin not output a whole bunch of debug stuff.
 	// maybe pipe this to the test log?
@@ -6,54 +6,13 @@
 package asage
 
 import (
+	"context"
+	"errors"
 	"net/http"
-	"strings"
 
 	"github.com/mattermost/mattermost-plugin-ai/llm"
 )
 
-// customHeadersTransport wraps an http.RoundTripper to add custom headers to every request
-type customHeadersTransport struct {
-	base    http.RoundTripper
-	headers map[string]string
-}
-
-func (t *customHeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Clone the request to avoid modifying the original
-	newReq := req.Clone(req.Context())
-
-	// Add custom headers
-	for key, value := range t.headers {
-		newReq.Header.Set(key, value)
-	}
-
-	return t.base.RoundTrip(newReq)
-}
-
-// wrapHTTPClientWithCustomHeaders wraps an http.Client to add custom headers to all requests
-func wrapHTTPClientWithCustomHeaders(baseClient *http.Client, customHeaders map[string]string) *http.Client {
-	if len(customHeaders) == 0 {
-		return baseClient
-	}
-
-	transport := baseClient.Transport
-	if transport == nil {
-		transport = http.DefaultTransport
-	}
-
-	wrappedClient := &http.Client{
-		Transport: &customHeadersTransport{
-			base:    transport,
-			headers: customHeaders,
-		},
-		CheckRedirect: baseClient.CheckRedirect,
-		Jar:           baseClient.Jar,
-		Timeout:       baseClient.Timeout,
-	}
-
-	return wrappedClient
-}
-
 type Provider struct {
 	client           *Client
 	defaultModel     string
@@ -63,7 +22,7 @@ type Provider struct {
 
 func New(llmService llm.ServiceConfig, httpClient *http.Client) *Provider {
 	// Wrap the HTTP client with custom headers if any are provided
-	wrappedHTTPClient := wrapHTTPClientWithCustomHeaders(httpClient, llmService.CustomHeaders)
+	wrappedHTTPClient := llm.WrapHTTPClientWithCustomHeaders(httpClient, llmService.CustomHeaders)
 	client := NewClient(llmService.APIKey, wrappedHTTPClient, llmService.APIURL)
 
 	return &Provider{
@@ -84,9 +43,15 @@ func conversationToMessagesList(posts []llm.Post) []Message {
 		} else if post.Role == llm.PostRoleSystem {
 			continue // ASage doesn't support this
 		}
+		message := post.Message
+		for _, file := range post.Files {
+			if file.Kind == llm.FileKindDocument {
+				message += "\n" + file.DocumentText()
+			}
+		}
 		result = append(result, Message{
 			User:    role,
-			Message: post.Message,
+			Message: message,
 		})
 	}
 
@@ -109,27 +74,44 @@ func (s *Provider) createConfig(opts []llm.LanguageModelOption) llm.LanguageMode
 }
 
 func (s *Provider) queryParamsFromConfig(cfg llm.LanguageModelConfig) QueryParams {
-	return QueryParams{
+	params := QueryParams{
 		Model: cfg.Model,
 	}
+	// Temperature is the only sampling parameter Ask Sage supports.
+	if cfg.Temperature != nil {
+		temperature := float64(*cfg.Temperature)
+		params.Temperature = &temperature
+	}
+	return params
 }
 
-func (s *Provider) ChatCompletion(request llm.CompletionRequest, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+func (s *Provider) ChatCompletion(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
 	// ASage does not support streaming.
-	result, err := s.ChatCompletionNoStream(request, opts...)
+	result, err := s.ChatCompletionNoStream(ctx, request, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return llm.NewStreamFromString(result), nil
+
+	// ASage does not report usage either, so estimate it.
+	usage := llm.TokenUsage{
+		InputTokens:  int64(s.CountTokens(request.String())),
+		OutputTokens: int64(s.CountTokens(result)),
+	}
+	return llm.NewStreamFromStringWithUsage(result, usage), nil
 }
 
-func (s *Provider) ChatCompletionNoStream(request llm.CompletionRequest, opts ...llm.LanguageModelOption) (string, error) {
-	params := s.queryParamsFromConfig(s.createConfig(opts))
+func (s *Provider) ChatCompletionNoStream(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (string, error) {
+	cfg := s.createConfig(opts)
+	if cfg.JSONOutputFormat != nil {
+		return "", &llm.StructuredOutputError{Err: errors.New("ASage does not support structured output")}
+	}
+
+	params := s.queryParamsFromConfig(cfg)
 	params.Message = conversationToMessagesList(request.Posts)
 	params.SystemPrompt = request.ExtractSystemMessage()
 	params.Persona = "default"
 
-	response, err := s.client.Query(params)
+	response, err := s.client.Query(ctx, params)
 	if err != nil {
 		return "", err
 	}
@@ -138,11 +120,7 @@ func (s *Provider) ChatCompletionNoStream(request llm.CompletionRequest, opts ..
 
 // TODO: Implement actual token counting. For now just estimated based off OpenAI estimations
 func (s *Provider) CountTokens(text string) int {
-	charCount := float64(len(text)) / 4.0
-	wordCount := float64(len(strings.Fields(text))) / 0.75
-
-	// Average the two and add a buffer
-	return int((charCount+wordCount)/2.0) + 100
+	return llm.TokenizerForModel(s.defaultModel).CountTokens(text)
 }
 
 // TODO: Figure out what the actual token limit is. For now just be conservative.
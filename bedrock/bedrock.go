@@ -0,0 +1,471 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+// Package bedrock implements a language model backed by the AWS Bedrock Converse API.
+package bedrock
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+)
+
+const (
+	DefaultMaxTokens       = 8192
+	DefaultInputTokenLimit = 200000
+	// MaxImageSize is the largest image the Converse API accepts.
+	MaxImageSize = 3932160
+)
+
+var defaultCachePoint = &CachePoint{Type: "default"}
+
+type Bedrock struct {
+	client           *Client
+	defaultModel     string
+	inputTokenLimit  int
+	outputTokenLimit int
+	promptCaching    bool
+}
+
+func New(llmService llm.ServiceConfig, httpClient *http.Client) *Bedrock {
+	// Custom headers are added after signing, so they are not covered by the signature.
+	wrappedHTTPClient := llm.WrapHTTPClientWithCustomHeaders(httpClient, llmService.CustomHeaders)
+	credentials := newCredentialsProvider(llmService.AccessKeyID, llmService.SecretAccessKey)
+
+	return &Bedrock{
+		client:           newClient(llmService.Region, llmService.APIURL, credentials, wrappedHTTPClient),
+		defaultModel:     llmService.DefaultModel,
+		inputTokenLimit:  llmService.InputTokenLimit,
+		outputTokenLimit: llmService.OutputTokenLimit,
+		promptCaching:    llmService.EnablePromptCaching,
+	}
+}
+
+// imageFormat returns the Converse format of a supported image type.
+func imageFormat(mimeType string) (string, bool) {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return strings.TrimPrefix(mimeType, "image/"), true
+	}
+	return "", false
+}
+
+// conversationToMessages creates the system prompt and the messages of a request from conversation posts.
+// The reasoning behind tool calls is only included with includeReasoning, which is required when thinking is enabled.
+func conversationToMessages(posts []llm.Post, includeReasoning bool) ([]SystemBlock, []Message) {
+	var system []SystemBlock
+	messages := make([]Message, 0, len(posts))
+
+	// Consecutive posts of the same role are merged into a single message.
+	appendBlocks := func(role string, blocks ...ContentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if len(messages) > 0 && messages[len(messages)-1].Role == role {
+			messages[len(messages)-1].Content = append(messages[len(messages)-1].Content, blocks...)
+			return
+		}
+		messages = append(messages, Message{Role: role, Content: blocks})
+	}
+
+	for _, post := range posts {
+		role := RoleUser
+		switch post.Role {
+		case llm.PostRoleSystem:
+			system = append(system, SystemBlock{Text: post.Message})
+			continue
+		case llm.PostRoleBot:
+			role = RoleAssistant
+		case llm.PostRoleUser:
+		default:
+			continue
+		}
+
+		var blocks []ContentBlock
+
+		// Reasoning must come before the text and tool use it led to.
+		if includeReasoning && len(post.ToolUse) > 0 {
+			for _, reasoning := range post.Reasoning {
+				if reasoning.RedactedData != "" {
+					redacted, err := base64.StdEncoding.DecodeString(reasoning.RedactedData)
+					if err != nil {
+						continue
+					}
+					blocks = append(blocks, ContentBlock{ReasoningContent: &ReasoningContent{RedactedContent: redacted}})
+					continue
+				}
+				blocks = append(blocks, ContentBlock{ReasoningContent: &ReasoningContent{
+					ReasoningText: &ReasoningText{Text: reasoning.Text, Signature: reasoning.Signature},
+				}})
+			}
+		}
+
+		if post.Message != "" {
+			blocks = append(blocks, ContentBlock{Text: post.Message})
+		}
+
+		for _, file := range post.Files {
+			if file.Kind == llm.FileKindDocument {
+				blocks = append(blocks, ContentBlock{Text: file.DocumentText()})
+				continue
+			}
+			format, ok := imageFormat(file.MimeType)
+			if !ok {
+				blocks = append(blocks, ContentBlock{Text: fmt.Sprintf("[Unsupported image type: %s]", file.MimeType)})
+				continue
+			}
+			if file.Size > MaxImageSize {
+				blocks = append(blocks, ContentBlock{Text: "[Image larger than 3.75MB was not included]"})
+				continue
+			}
+			data, err := io.ReadAll(file.Reader)
+			if err != nil {
+				blocks = append(blocks, ContentBlock{Text: "[Error reading image data]"})
+				continue
+			}
+			blocks = append(blocks, ContentBlock{Image: &ImageBlock{Format: format, Source: ImageSource{Bytes: data}}})
+		}
+
+		for _, tool := range post.ToolUse {
+			input := tool.Arguments
+			if len(input) == 0 {
+				input = json.RawMessage("{}")
+			}
+			blocks = append(blocks, ContentBlock{ToolUse: &ToolUseBlock{
+				ToolUseID: tool.ID,
+				Name:      tool.Name,
+				Input:     input,
+			}})
+		}
+		appendBlocks(role, blocks...)
+
+		// Results of the tool calls are given back by the user.
+		if len(post.ToolUse) > 0 {
+			resultBlocks := make([]ContentBlock, 0, len(post.ToolUse))
+			for _, tool := range post.ToolUse {
+				status := "success"
+				if tool.Status != llm.ToolCallStatusSuccess {
+					status = "error"
+				}
+				resultBlocks = append(resultBlocks, ContentBlock{ToolResult: &ToolResultBlock{
+					ToolUseID: tool.ID,
+					Content:   []ToolResultContentBlock{{Text: tool.Result}},
+					Status:    status,
+				}})
+			}
+			appendBlocks(RoleUser, resultBlocks...)
+		}
+	}
+
+	return system, messages
+}
+
+func convertTools(tools []llm.Tool) []Tool {
+	converted := make([]Tool, 0, len(tools))
+	for _, tool := range tools {
+		converted = append(converted, Tool{ToolSpec: &ToolSpec{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: InputSchema{JSON: tool.Schema},
+		}})
+	}
+	return converted
+}
+
+// jsonOutputTool describes the structured output tool, whose input must match schema.
+func jsonOutputTool(schema *jsonschema.Schema) (Tool, error) {
+	if err := llm.CheckJSONOutputToolSchema(schema); err != nil {
+		return Tool{}, err
+	}
+
+	return Tool{ToolSpec: &ToolSpec{
+		Name:        llm.JSONOutputToolName,
+		Description: llm.JSONOutputToolDescription,
+		InputSchema: InputSchema{JSON: schema},
+	}}, nil
+}
+
+// addCachePoints marks the parts of a request that stay the same from one turn to the next for prompt caching:
+// the tools, the system prompt and the last two user messages.
+// The point after the last message caches the conversation for the next turn, the one before reads what the previous turn cached.
+func addCachePoints(request *ConverseRequest) {
+	if request.ToolConfig != nil && len(request.ToolConfig.Tools) > 0 {
+		request.ToolConfig.Tools = append(request.ToolConfig.Tools, Tool{CachePoint: defaultCachePoint})
+	}
+
+	if len(request.System) > 0 {
+		request.System = append(request.System, SystemBlock{CachePoint: defaultCachePoint})
+	}
+
+	cachePoints := 0
+	for i := len(request.Messages) - 1; i >= 0 && cachePoints < 2; i-- {
+		if request.Messages[i].Role != RoleUser {
+			continue
+		}
+		request.Messages[i].Content = append(request.Messages[i].Content, ContentBlock{CachePoint: defaultCachePoint})
+		cachePoints++
+	}
+}
+
+func (b *Bedrock) GetDefaultConfig() llm.LanguageModelConfig {
+	config := llm.LanguageModelConfig{
+		Model:              b.defaultModel,
+		MaxGeneratedTokens: DefaultMaxTokens,
+	}
+	if b.outputTokenLimit > 0 {
+		config.MaxGeneratedTokens = b.outputTokenLimit
+	}
+	return config
+}
+
+func (b *Bedrock) createConfig(opts []llm.LanguageModelOption) llm.LanguageModelConfig {
+	cfg := b.GetDefaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+func (b *Bedrock) requestFromConfig(cfg llm.LanguageModelConfig, request llm.CompletionRequest) (ConverseRequest, error) {
+	system, messages := conversationToMessages(request.Posts, cfg.ThinkingBudgetTokens > 0)
+	converseRequest := ConverseRequest{
+		Messages: messages,
+		System:   system,
+		InferenceConfig: &InferenceConfig{
+			MaxTokens:     cfg.MaxGeneratedTokens,
+			StopSequences: cfg.StopSequences,
+		},
+	}
+
+	if cfg.ThinkingBudgetTokens > 0 {
+		converseRequest.AdditionalModelRequestFields = map[string]any{
+			"thinking": map[string]any{"type": "enabled", "budget_tokens": cfg.ThinkingBudgetTokens},
+		}
+		// The thinking budget is part of max tokens, keep the full output limit available for the answer.
+		converseRequest.InferenceConfig.MaxTokens += cfg.ThinkingBudgetTokens
+	} else {
+		// Sampling can't be adjusted while thinking. Seeds are not supported at all.
+		converseRequest.InferenceConfig.Temperature = cfg.Temperature
+		converseRequest.InferenceConfig.TopP = cfg.TopP
+	}
+
+	switch {
+	case cfg.JSONOutputFormat != nil:
+		tool, err := jsonOutputTool(cfg.JSONOutputFormat)
+		if err != nil {
+			return ConverseRequest{}, &llm.StructuredOutputError{Err: err}
+		}
+		converseRequest.ToolConfig = &ToolConfig{
+			Tools:      []Tool{tool},
+			ToolChoice: &ToolChoice{Tool: &SpecificToolChoice{Name: llm.JSONOutputToolName}},
+		}
+	case request.Context != nil && request.Context.Tools != nil && len(request.Context.Tools.GetTools()) > 0:
+		converseRequest.ToolConfig = &ToolConfig{Tools: convertTools(request.Context.Tools.GetTools())}
+	}
+
+	if b.promptCaching {
+		addCachePoints(&converseRequest)
+	}
+
+	return converseRequest, nil
+}
+
+// contentBlock accumulates a streamed content block of the response.
+type contentBlock struct {
+	toolUseID       string
+	toolName        string
+	input           strings.Builder
+	isReasoning     bool
+	reasoning       strings.Builder
+	signature       string
+	redactedContent []byte
+}
+
+func (b *Bedrock) streamToChannel(ctx context.Context, cfg llm.LanguageModelConfig, request ConverseRequest, output chan<- llm.TextStreamEvent) {
+	blocks := map[int]*contentBlock{}
+	getBlock := func(index int) *contentBlock {
+		if blocks[index] == nil {
+			blocks[index] = &contentBlock{}
+		}
+		return blocks[index]
+	}
+	var usage *Usage
+	var stopReason string
+
+	err := b.client.ConverseStream(ctx, cfg.Model, request, func(event StreamEvent) error {
+		switch {
+		case event.ContentBlockStart != nil:
+			if toolUse := event.ContentBlockStart.Start.ToolUse; toolUse != nil {
+				block := getBlock(event.ContentBlockStart.ContentBlockIndex)
+				block.toolUseID = toolUse.ToolUseID
+				block.toolName = toolUse.Name
+			}
+		case event.ContentBlockDelta != nil:
+			block := getBlock(event.ContentBlockDelta.ContentBlockIndex)
+			delta := event.ContentBlockDelta.Delta
+			switch {
+			case delta.Text != nil:
+				if *delta.Text != "" {
+					output <- llm.TextStreamEvent{
+						Type:  llm.EventTypeText,
+						Value: *delta.Text,
+					}
+				}
+			case delta.ToolUse != nil:
+				block.input.WriteString(delta.ToolUse.Input)
+			case delta.ReasoningContent != nil:
+				block.isReasoning = true
+				reasoning := delta.ReasoningContent
+				if reasoning.Text != nil && *reasoning.Text != "" {
+					block.reasoning.WriteString(*reasoning.Text)
+					output <- llm.TextStreamEvent{
+						Type:  llm.EventTypeReasoning,
+						Value: *reasoning.Text,
+					}
+				}
+				if reasoning.Signature != nil {
+					block.signature += *reasoning.Signature
+				}
+				block.redactedContent = append(block.redactedContent, reasoning.RedactedContent...)
+			}
+		case event.MessageStop != nil:
+			stopReason = event.MessageStop.StopReason
+		case event.Metadata != nil:
+			usage = &event.Metadata.Usage
+		}
+		return nil
+	})
+	if err != nil {
+		output <- llm.TextStreamEvent{
+			Type:  llm.EventTypeError,
+			Value: fmt.Errorf("error from bedrock stream: %w", err),
+		}
+		return
+	}
+
+	if usage != nil {
+		output <- llm.TextStreamEvent{
+			Type:  llm.EventTypeUsage,
+			Value: llm.UsageWithCacheTokens(usage.InputTokens, usage.OutputTokens, usage.CacheReadInputTokens, usage.CacheWriteInputTokens),
+		}
+	}
+
+	indexes := make([]int, 0, len(blocks))
+	for index := range blocks {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var pendingToolCalls []llm.ToolCall
+	var reasoning []llm.ReasoningBlock
+	for _, index := range indexes {
+		block := blocks[index]
+		switch {
+		case block.toolUseID != "":
+			arguments := json.RawMessage(block.input.String())
+			if len(arguments) == 0 {
+				arguments = json.RawMessage("{}")
+			}
+			pendingToolCalls = append(pendingToolCalls, llm.ToolCall{
+				ID:        block.toolUseID,
+				Name:      block.toolName,
+				Arguments: arguments,
+			})
+		case block.isReasoning && len(block.redactedContent) > 0:
+			reasoning = append(reasoning, llm.ReasoningBlock{RedactedData: base64.StdEncoding.EncodeToString(block.redactedContent)})
+		case block.isReasoning:
+			reasoning = append(reasoning, llm.ReasoningBlock{Text: block.reasoning.String(), Signature: block.signature})
+		}
+	}
+
+	if cfg.JSONOutputFormat != nil {
+		sendJSONOutput(cfg, pendingToolCalls, stopReason, output)
+		return
+	}
+
+	if len(pendingToolCalls) > 0 {
+		// The reasoning behind tool calls must be sent back unchanged with their results.
+		if len(reasoning) > 0 {
+			output <- llm.TextStreamEvent{
+				Type:  llm.EventTypeReasoningBlocks,
+				Value: reasoning,
+			}
+		}
+
+		output <- llm.TextStreamEvent{
+			Type:  llm.EventTypeToolCalls,
+			Value: pendingToolCalls,
+		}
+	}
+
+	output <- llm.TextStreamEvent{
+		Type:  llm.EventTypeEnd,
+		Value: nil,
+	}
+}
+
+// sendJSONOutput sends the input the model gave the structured output tool as the text of the response.
+func sendJSONOutput(cfg llm.LanguageModelConfig, toolCalls []llm.ToolCall, stopReason string, output chan<- llm.TextStreamEvent) {
+	var input string
+	for _, toolCall := range toolCalls {
+		if toolCall.Name == llm.JSONOutputToolName {
+			input = string(toolCall.Arguments)
+			break
+		}
+	}
+	llm.SendJSONToolOutput(output, cfg.JSONOutputFormat, input, stopReason)
+}
+
+func (b *Bedrock) ChatCompletion(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	cfg := b.createConfig(opts)
+	if cfg.Model == "" {
+		return nil, errors.New("no model configured")
+	}
+	if cfg.JSONOutputFormat != nil {
+		// Thinking can't be used when the model is made to call a specific tool.
+		cfg.ThinkingBudgetTokens = 0
+	}
+	converseRequest, err := b.requestFromConfig(cfg, request)
+	if err != nil {
+		return nil, err
+	}
+
+	eventStream := make(chan llm.TextStreamEvent)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer close(eventStream)
+		defer cancel()
+		b.streamToChannel(ctx, cfg, converseRequest, eventStream)
+	}()
+
+	return &llm.TextStreamResult{Stream: eventStream, Cancel: cancel}, nil
+}
+
+func (b *Bedrock) ChatCompletionNoStream(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (string, error) {
+	result, err := b.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.ReadAll()
+}
+
+func (b *Bedrock) CountTokens(text string) int {
+	return llm.TokenizerForModel(b.defaultModel).CountTokens(text)
+}
+
+func (b *Bedrock) InputTokenLimit() int {
+	if b.inputTokenLimit > 0 {
+		return b.inputTokenLimit
+	}
+	return DefaultInputTokenLimit
+}
@@ -0,0 +1,313 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+)
+
+// encodeMessage frames a message the way the Bedrock runtime does in its event streams.
+func encodeMessage(headers map[string]string, payload string) []byte {
+	var encodedHeaders bytes.Buffer
+	for name, value := range headers {
+		encodedHeaders.WriteByte(byte(len(name)))
+		encodedHeaders.WriteString(name)
+		encodedHeaders.WriteByte(7)
+		_ = binary.Write(&encodedHeaders, binary.BigEndian, uint16(len(value)))
+		encodedHeaders.WriteString(value)
+	}
+
+	totalLength := preludeLength + encodedHeaders.Len() + len(payload) + 4
+	message := binary.BigEndian.AppendUint32(nil, uint32(totalLength))
+	message = binary.BigEndian.AppendUint32(message, uint32(encodedHeaders.Len()))
+	message = binary.BigEndian.AppendUint32(message, crc32.ChecksumIEEE(message))
+	message = append(message, encodedHeaders.Bytes()...)
+	message = append(message, payload...)
+	return binary.BigEndian.AppendUint32(message, crc32.ChecksumIEEE(message))
+}
+
+func event(eventType, payload string) []byte {
+	return encodeMessage(map[string]string{":message-type": "event", ":event-type": eventType, ":content-type": "application/json"}, payload)
+}
+
+// newTestProvider returns a provider whose requests are answered with the given event stream messages.
+func newTestProvider(t *testing.T, config llm.ServiceConfig, messages ...[]byte) (*Bedrock, *recordedRequest) {
+	recorded := &recordedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorded.path = r.URL.EscapedPath()
+		recorded.header = r.Header.Clone()
+		recorded.body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&recorded.body))
+
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		for _, message := range messages {
+			_, _ = w.Write(message)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config.APIURL = server.URL
+	config.Region = "us-west-2"
+	if config.AccessKeyID == "" {
+		config.AccessKeyID = "key"
+		config.SecretAccessKey = "secret"
+	}
+	if config.DefaultModel == "" {
+		config.DefaultModel = "anthropic.claude-test-v1:0"
+	}
+	return New(config, &http.Client{}), recorded
+}
+
+type recordedRequest struct {
+	path   string
+	header http.Header
+	body   map[string]any
+}
+
+func readEvents(result *llm.TextStreamResult) []llm.TextStreamEvent {
+	var events []llm.TextStreamEvent
+	for event := range result.Stream {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestStreaming(t *testing.T) {
+	provider, recorded := newTestProvider(t, llm.ServiceConfig{},
+		event("messageStart", `{"role":"assistant"}`),
+		event("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hello"}}`),
+		event("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":" there"}}`),
+		event("contentBlockStop", `{"contentBlockIndex":0}`),
+		event("messageStop", `{"stopReason":"end_turn"}`),
+		event("metadata", `{"usage":{"inputTokens":4,"outputTokens":3,"totalTokens":17,"cacheReadInputTokens":8,"cacheWriteInputTokens":2},"metrics":{"latencyMs":100}}`),
+	)
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts: []llm.Post{
+			{Role: llm.PostRoleSystem, Message: "Be brief."},
+			{Role: llm.PostRoleUser, Message: "Hi"},
+		},
+		Context: llm.NewContext(),
+	}, llm.WithTemperature(0), llm.WithStopSequences([]string{"STOP"}))
+	require.NoError(t, err)
+
+	events := readEvents(result)
+	require.Len(t, events, 4)
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeText, Value: "Hello"}, events[0])
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeText, Value: " there"}, events[1])
+	assert.Equal(t, llm.TokenUsage{InputTokens: 14, OutputTokens: 3, CachedTokens: 8, CacheWriteTokens: 2}, events[2].Value)
+	assert.Equal(t, llm.EventTypeEnd, events[3].Type)
+
+	assert.Equal(t, "/model/anthropic.claude-test-v1%3A0/converse-stream", recorded.path)
+	assert.Contains(t, recorded.header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/")
+	assert.Contains(t, recorded.header.Get("Authorization"), "/us-west-2/bedrock/aws4_request")
+	assert.NotEmpty(t, recorded.header.Get("X-Amz-Date"))
+
+	assert.Equal(t, []any{map[string]any{"text": "Be brief."}}, recorded.body["system"])
+	assert.Equal(t, []any{map[string]any{"role": "user", "content": []any{map[string]any{"text": "Hi"}}}}, recorded.body["messages"])
+	assert.Equal(t, map[string]any{
+		"maxTokens":     float64(DefaultMaxTokens),
+		"temperature":   float64(0),
+		"stopSequences": []any{"STOP"},
+	}, recorded.body["inferenceConfig"])
+	assert.Nil(t, recorded.body["toolConfig"])
+}
+
+func TestToolUse(t *testing.T) {
+	provider, recorded := newTestProvider(t, llm.ServiceConfig{},
+		event("messageStart", `{"role":"assistant"}`),
+		event("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"reasoningContent":{"text":"Need to search"}}}`),
+		event("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"reasoningContent":{"signature":"sig"}}}`),
+		event("contentBlockStop", `{"contentBlockIndex":0}`),
+		event("contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"tooluse_1","name":"search"}}}`),
+		event("contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"query\":"}}}`),
+		event("contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"\"x\"}"}}}`),
+		event("contentBlockStop", `{"contentBlockIndex":1}`),
+		event("messageStop", `{"stopReason":"tool_use"}`),
+		event("metadata", `{"usage":{"inputTokens":10,"outputTokens":5}}`),
+	)
+
+	tools := llm.NewToolStore(nil, false)
+	tools.AddTools([]llm.Tool{{
+		Name:        "search",
+		Description: "Search for things",
+		Schema: llm.NewJSONSchemaFromStruct[struct {
+			Query string `json:"query" jsonschema:"what to search for"`
+		}](),
+	}})
+	llmContext := llm.NewContext()
+	llmContext.Tools = tools
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts: []llm.Post{
+			{Role: llm.PostRoleUser, Message: "Find y", Files: []llm.File{{MimeType: "image/png", Size: 3, Reader: bytes.NewReader([]byte("png"))}}},
+			{
+				Role:      llm.PostRoleBot,
+				Reasoning: []llm.ReasoningBlock{{Text: "Searching", Signature: "old"}},
+				ToolUse:   []llm.ToolCall{{ID: "tooluse_0", Name: "search", Arguments: []byte(`{"query":"y"}`), Result: "nothing", Status: llm.ToolCallStatusSuccess}},
+			},
+			{Role: llm.PostRoleUser, Message: "Try x"},
+		},
+		Context: llmContext,
+	}, llm.WithThinkingBudget(1024), llm.WithTemperature(0.5))
+	require.NoError(t, err)
+
+	events := readEvents(result)
+	require.Len(t, events, 5)
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeReasoning, Value: "Need to search"}, events[0])
+	assert.Equal(t, llm.EventTypeUsage, events[1].Type)
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeReasoningBlocks, Value: []llm.ReasoningBlock{{Text: "Need to search", Signature: "sig"}}}, events[2])
+	require.Equal(t, llm.EventTypeToolCalls, events[3].Type)
+	toolCalls := events[3].Value.([]llm.ToolCall)
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, "tooluse_1", toolCalls[0].ID)
+	assert.Equal(t, "search", toolCalls[0].Name)
+	assert.JSONEq(t, `{"query":"x"}`, string(toolCalls[0].Arguments))
+	assert.Equal(t, llm.EventTypeEnd, events[4].Type)
+
+	// The tool result and the next user message are merged, as roles must alternate.
+	messages := recorded.body["messages"].([]any)
+	require.Len(t, messages, 3)
+	assert.Equal(t, map[string]any{"role": "user", "content": []any{
+		map[string]any{"text": "Find y"},
+		map[string]any{"image": map[string]any{"format": "png", "source": map[string]any{"bytes": "cG5n"}}},
+	}}, messages[0])
+	assert.Equal(t, map[string]any{"role": "assistant", "content": []any{
+		map[string]any{"reasoningContent": map[string]any{"reasoningText": map[string]any{"text": "Searching", "signature": "old"}}},
+		map[string]any{"toolUse": map[string]any{"toolUseId": "tooluse_0", "name": "search", "input": map[string]any{"query": "y"}}},
+	}}, messages[1])
+	assert.Equal(t, map[string]any{"role": "user", "content": []any{
+		map[string]any{"toolResult": map[string]any{"toolUseId": "tooluse_0", "content": []any{map[string]any{"text": "nothing"}}, "status": "success"}},
+		map[string]any{"text": "Try x"},
+	}}, messages[2])
+
+	toolConfig := recorded.body["toolConfig"].(map[string]any)
+	toolSpec := toolConfig["tools"].([]any)[0].(map[string]any)["toolSpec"].(map[string]any)
+	assert.Equal(t, "search", toolSpec["name"])
+	assert.Contains(t, toolSpec["inputSchema"].(map[string]any)["json"], "properties")
+
+	// Sampling can't be changed while thinking.
+	assert.Equal(t, map[string]any{"maxTokens": float64(DefaultMaxTokens + 1024)}, recorded.body["inferenceConfig"])
+	assert.Equal(t, map[string]any{"thinking": map[string]any{"type": "enabled", "budget_tokens": float64(1024)}}, recorded.body["additionalModelRequestFields"])
+}
+
+func TestJSONOutput(t *testing.T) {
+	type answer struct {
+		Answer string `json:"answer"`
+	}
+
+	t.Run("valid output", func(t *testing.T) {
+		provider, recorded := newTestProvider(t, llm.ServiceConfig{},
+			event("contentBlockStart", `{"contentBlockIndex":0,"start":{"toolUse":{"toolUseId":"tooluse_1","name":"json_output"}}}`),
+			event("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"toolUse":{"input":"{\"answer\":\"42\"}"}}}`),
+			event("messageStop", `{"stopReason":"tool_use"}`),
+		)
+
+		output, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{
+			Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "What is the answer?"}},
+			Context: llm.NewContext(),
+		}, llm.WithJSONOutput[answer](), llm.WithThinkingBudget(1024))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"answer":"42"}`, output)
+
+		toolConfig := recorded.body["toolConfig"].(map[string]any)
+		assert.Equal(t, map[string]any{"tool": map[string]any{"name": llm.JSONOutputToolName}}, toolConfig["toolChoice"])
+		assert.Nil(t, recorded.body["additionalModelRequestFields"])
+	})
+
+	t.Run("invalid output", func(t *testing.T) {
+		provider, _ := newTestProvider(t, llm.ServiceConfig{},
+			event("contentBlockStart", `{"contentBlockIndex":0,"start":{"toolUse":{"toolUseId":"tooluse_1","name":"json_output"}}}`),
+			event("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"toolUse":{"input":"{\"answer\":42}"}}}`),
+			event("messageStop", `{"stopReason":"tool_use"}`),
+		)
+
+		_, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{
+			Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "What is the answer?"}},
+			Context: llm.NewContext(),
+		}, llm.WithJSONOutput[answer]())
+		assert.ErrorIs(t, err, llm.ErrStructuredOutput)
+	})
+}
+
+func TestPromptCaching(t *testing.T) {
+	provider, recorded := newTestProvider(t, llm.ServiceConfig{EnablePromptCaching: true},
+		event("messageStop", `{"stopReason":"end_turn"}`),
+	)
+
+	_, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{
+		Posts: []llm.Post{
+			{Role: llm.PostRoleSystem, Message: "Be brief."},
+			{Role: llm.PostRoleUser, Message: "Hi"},
+			{Role: llm.PostRoleBot, Message: "Hello"},
+			{Role: llm.PostRoleUser, Message: "Bye"},
+		},
+		Context: llm.NewContext(),
+	})
+	require.NoError(t, err)
+
+	cachePoint := map[string]any{"cachePoint": map[string]any{"type": "default"}}
+	assert.Equal(t, []any{map[string]any{"text": "Be brief."}, cachePoint}, recorded.body["system"])
+	messages := recorded.body["messages"].([]any)
+	assert.Equal(t, []any{map[string]any{"text": "Hi"}, cachePoint}, messages[0].(map[string]any)["content"])
+	assert.Equal(t, []any{map[string]any{"text": "Hello"}}, messages[1].(map[string]any)["content"])
+	assert.Equal(t, []any{map[string]any{"text": "Bye"}, cachePoint}, messages[2].(map[string]any)["content"])
+}
+
+func TestErrors(t *testing.T) {
+	t.Run("error response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Amzn-Errortype", "ThrottlingException:http://internal.amazon.com/coral/com.amazon.bedrock/")
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"message":"Too many requests, please wait before trying again."}`))
+		}))
+		defer server.Close()
+
+		provider := New(llm.ServiceConfig{Region: "us-east-1", AccessKeyID: "key", SecretAccessKey: "secret", APIURL: server.URL, DefaultModel: "model"}, &http.Client{})
+		_, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{Context: llm.NewContext()})
+
+		var providerErr *llm.ProviderError
+		require.ErrorAs(t, err, &providerErr)
+		assert.Equal(t, http.StatusTooManyRequests, providerErr.StatusCode)
+		assert.Equal(t, "2s", providerErr.RetryAfter.String())
+		assert.Contains(t, err.Error(), "ThrottlingException")
+		assert.True(t, llm.IsRetryableError(err))
+	})
+
+	t.Run("exception in stream", func(t *testing.T) {
+		provider, _ := newTestProvider(t, llm.ServiceConfig{},
+			event("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hel"}}`),
+			encodeMessage(map[string]string{":message-type": "exception", ":exception-type": "serviceUnavailableException"}, `{"message":"Model is overloaded"}`),
+		)
+
+		_, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{Context: llm.NewContext()})
+
+		var providerErr *llm.ProviderError
+		require.ErrorAs(t, err, &providerErr)
+		assert.Equal(t, http.StatusServiceUnavailable, providerErr.StatusCode)
+		assert.Contains(t, err.Error(), "Model is overloaded")
+	})
+
+	t.Run("corrupted stream", func(t *testing.T) {
+		message := event("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hello"}}`)
+		message[len(message)-5] ^= 0xff
+		provider, _ := newTestProvider(t, llm.ServiceConfig{}, message)
+
+		_, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{Context: llm.NewContext()})
+		assert.ErrorContains(t, err, "checksum mismatch")
+	})
+}
@@ -0,0 +1,332 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+)
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ContentBlock is one piece of a Message, exactly one of its fields is set.
+type ContentBlock struct {
+	Text             string            `json:"text,omitempty"`
+	Image            *ImageBlock       `json:"image,omitempty"`
+	ToolUse          *ToolUseBlock     `json:"toolUse,omitempty"`
+	ToolResult       *ToolResultBlock  `json:"toolResult,omitempty"`
+	ReasoningContent *ReasoningContent `json:"reasoningContent,omitempty"`
+	CachePoint       *CachePoint       `json:"cachePoint,omitempty"`
+}
+
+type ImageBlock struct {
+	// Format is the image type without the image/ prefix.
+	Format string      `json:"format"`
+	Source ImageSource `json:"source"`
+}
+
+type ImageSource struct {
+	// Bytes are base64 encoded when marshalled.
+	Bytes []byte `json:"bytes"`
+}
+
+type ToolUseBlock struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+type ToolResultBlock struct {
+	ToolUseID string                   `json:"toolUseId"`
+	Content   []ToolResultContentBlock `json:"content"`
+	// Status is success or error.
+	Status string `json:"status,omitempty"`
+}
+
+type ToolResultContentBlock struct {
+	Text string `json:"text"`
+}
+
+type ReasoningContent struct {
+	ReasoningText *ReasoningText `json:"reasoningText,omitempty"`
+	// RedactedContent are base64 encoded when marshalled.
+	RedactedContent []byte `json:"redactedContent,omitempty"`
+}
+
+type ReasoningText struct {
+	Text      string `json:"text"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// CachePoint marks the end of a prefix of the request that can be cached.
+type CachePoint struct {
+	Type string `json:"type"`
+}
+
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+type SystemBlock struct {
+	Text       string      `json:"text,omitempty"`
+	CachePoint *CachePoint `json:"cachePoint,omitempty"`
+}
+
+type InferenceConfig struct {
+	MaxTokens     int      `json:"maxTokens,omitempty"`
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopP          *float32 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type ToolSpec struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema InputSchema `json:"inputSchema"`
+}
+
+type InputSchema struct {
+	JSON any `json:"json"`
+}
+
+type Tool struct {
+	ToolSpec   *ToolSpec   `json:"toolSpec,omitempty"`
+	CachePoint *CachePoint `json:"cachePoint,omitempty"`
+}
+
+type ToolChoice struct {
+	Auto *struct{}           `json:"auto,omitempty"`
+	Any  *struct{}           `json:"any,omitempty"`
+	Tool *SpecificToolChoice `json:"tool,omitempty"`
+}
+
+type SpecificToolChoice struct {
+	Name string `json:"name"`
+}
+
+type ToolConfig struct {
+	Tools      []Tool      `json:"tools"`
+	ToolChoice *ToolChoice `json:"toolChoice,omitempty"`
+}
+
+type ConverseRequest struct {
+	Messages        []Message        `json:"messages"`
+	System          []SystemBlock    `json:"system,omitempty"`
+	InferenceConfig *InferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *ToolConfig      `json:"toolConfig,omitempty"`
+	// AdditionalModelRequestFields are passed on to the model as they are, this is how thinking is enabled.
+	AdditionalModelRequestFields map[string]any `json:"additionalModelRequestFields,omitempty"`
+}
+
+// StreamEvent is one event of a Converse stream, exactly one of its fields is set.
+type StreamEvent struct {
+	ContentBlockStart *ContentBlockStartEvent
+	ContentBlockDelta *ContentBlockDeltaEvent
+	MessageStop       *MessageStopEvent
+	Metadata          *MetadataEvent
+}
+
+type ContentBlockStartEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             struct {
+		ToolUse *struct {
+			ToolUseID string `json:"toolUseId"`
+			Name      string `json:"name"`
+		} `json:"toolUse,omitempty"`
+	} `json:"start"`
+}
+
+type ContentBlockDeltaEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Delta             struct {
+		Text    *string `json:"text,omitempty"`
+		ToolUse *struct {
+			Input string `json:"input"`
+		} `json:"toolUse,omitempty"`
+		ReasoningContent *struct {
+			Text            *string `json:"text,omitempty"`
+			Signature       *string `json:"signature,omitempty"`
+			RedactedContent []byte  `json:"redactedContent,omitempty"`
+		} `json:"reasoningContent,omitempty"`
+	} `json:"delta"`
+}
+
+type MessageStopEvent struct {
+	StopReason string `json:"stopReason"`
+}
+
+type Usage struct {
+	InputTokens           int64 `json:"inputTokens"`
+	OutputTokens          int64 `json:"outputTokens"`
+	CacheReadInputTokens  int64 `json:"cacheReadInputTokens"`
+	CacheWriteInputTokens int64 `json:"cacheWriteInputTokens"`
+}
+
+type MetadataEvent struct {
+	Usage Usage `json:"usage"`
+}
+
+// exceptionStatusCodes are the HTTP statuses matching the exceptions the service can send in the middle of a stream.
+var exceptionStatusCodes = map[string]int{
+	"validationException":         http.StatusBadRequest,
+	"throttlingException":         http.StatusTooManyRequests,
+	"modelStreamErrorException":   http.StatusFailedDependency,
+	"internalServerException":     http.StatusInternalServerError,
+	"serviceUnavailableException": http.StatusServiceUnavailable,
+}
+
+type Client struct {
+	endpoint    string
+	region      string
+	httpClient  *http.Client
+	credentials credentialsProvider
+}
+
+// newClient creates a client for the Bedrock runtime of region. endpoint replaces the regional endpoint when set,
+// for example to go through a VPC endpoint.
+func newClient(region, endpoint string, credentials credentialsProvider, httpClient *http.Client) *Client {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", region)
+	}
+
+	return &Client{
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		region:      region,
+		httpClient:  httpClient,
+		credentials: credentials,
+	}
+}
+
+// ConverseStream sends the request and calls handle with every event of the response as it arrives.
+// Error responses and exceptions are returned as an *llm.ProviderError.
+func (c *Client) ConverseStream(ctx context.Context, modelID string, request ConverseRequest, handle func(StreamEvent) error) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	credentials, err := c.credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Model IDs contain colons and may be ARNs, so they are escaped more strictly than a path segment has to be.
+	endpoint := fmt.Sprintf("%s/model/%s/converse-stream", c.endpoint, uriEncode(modelID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	signRequest(req, body, credentials, c.region, signingService, time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		message := string(responseBody)
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(responseBody, &apiErr) == nil && apiErr.Message != "" {
+			message = apiErr.Message
+		}
+		errorType, _, _ := strings.Cut(resp.Header.Get("X-Amzn-Errortype"), ":")
+		return &llm.ProviderError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: llm.RetryAfterFromHeader(resp.Header),
+			Err:        fmt.Errorf("bedrock returned %s %s: %s", resp.Status, errorType, message),
+		}
+	}
+
+	reader := newEventStreamReader(resp.Body)
+	for {
+		message, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read response event: %w", err)
+		}
+
+		event, err := parseStreamEvent(message)
+		if err != nil {
+			return err
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
+
+func parseStreamEvent(message eventMessage) (StreamEvent, error) {
+	switch message.Headers[":message-type"] {
+	case "event":
+	case "exception":
+		return StreamEvent{}, streamException(message.Headers[":exception-type"], message.Payload)
+	default:
+		return StreamEvent{}, streamException(message.Headers[":error-code"], []byte(message.Headers[":error-message"]))
+	}
+
+	var event StreamEvent
+	var target any
+	switch message.Headers[":event-type"] {
+	case "contentBlockStart":
+		event.ContentBlockStart = &ContentBlockStartEvent{}
+		target = event.ContentBlockStart
+	case "contentBlockDelta":
+		event.ContentBlockDelta = &ContentBlockDeltaEvent{}
+		target = event.ContentBlockDelta
+	case "messageStop":
+		event.MessageStop = &MessageStopEvent{}
+		target = event.MessageStop
+	case "metadata":
+		event.Metadata = &MetadataEvent{}
+		target = event.Metadata
+	default:
+		// messageStart and contentBlockStop carry nothing that isn't known otherwise.
+		return event, nil
+	}
+
+	if err := json.Unmarshal(message.Payload, target); err != nil {
+		return StreamEvent{}, fmt.Errorf("failed to parse %s event: %w", message.Headers[":event-type"], err)
+	}
+	return event, nil
+}
+
+func streamException(exceptionType string, payload []byte) error {
+	message := string(payload)
+	var exception struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(payload, &exception) == nil && exception.Message != "" {
+		message = exception.Message
+	}
+
+	statusCode, ok := exceptionStatusCodes[exceptionType]
+	if !ok {
+		statusCode = http.StatusInternalServerError
+	}
+	return &llm.ProviderError{
+		StatusCode: statusCode,
+		Err:        fmt.Errorf("bedrock stream failed with %s: %s", exceptionType, message),
+	}
+}
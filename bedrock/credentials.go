@@ -0,0 +1,171 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMetadataEndpoint = "http://169.254.169.254"
+	metadataTokenTTLSeconds = "21600"
+	// credentialRefreshWindow is how long before they expire instance role credentials are replaced.
+	credentialRefreshWindow = 5 * time.Minute
+)
+
+// Credentials are the AWS keys requests are signed with.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expires is zero for credentials that don't expire.
+	Expires time.Time
+}
+
+// credentialsProvider resolves the credentials to sign a request with.
+type credentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+type staticCredentials struct {
+	credentials Credentials
+}
+
+func (s staticCredentials) Retrieve(context.Context) (Credentials, error) {
+	return s.credentials, nil
+}
+
+// newCredentialsProvider uses the configured keys when there are any, then the standard AWS environment variables,
+// and finally the role of the EC2 instance the server runs on.
+func newCredentialsProvider(accessKeyID, secretAccessKey string) credentialsProvider {
+	if accessKeyID != "" {
+		return staticCredentials{Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey}}
+	}
+
+	if envKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); envKeyID != "" {
+		return staticCredentials{Credentials{
+			AccessKeyID:     envKeyID,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}}
+	}
+
+	endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultMetadataEndpoint
+	}
+	return newInstanceRoleCredentials(endpoint)
+}
+
+// instanceRoleCredentials fetches temporary credentials from the EC2 instance metadata service using IMDSv2.
+type instanceRoleCredentials struct {
+	endpoint string
+	// The metadata service is link-local, which the restricted client used for LLM requests may refuse to reach.
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	cached Credentials
+}
+
+func newInstanceRoleCredentials(endpoint string) *instanceRoleCredentials {
+	return &instanceRoleCredentials{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (c *instanceRoleCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached.AccessKeyID != "" && time.Until(c.cached.Expires) > credentialRefreshWindow {
+		return c.cached, nil
+	}
+
+	credentials, err := c.fetch(ctx)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get instance role credentials: %w", err)
+	}
+	c.cached = credentials
+	return credentials, nil
+}
+
+func (c *instanceRoleCredentials) fetch(ctx context.Context) (Credentials, error) {
+	token, err := c.request(ctx, http.MethodPut, "/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": metadataTokenTTLSeconds,
+	})
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get metadata token: %w", err)
+	}
+	tokenHeader := map[string]string{"X-aws-ec2-metadata-token": token}
+
+	roles, err := c.request(ctx, http.MethodGet, "/latest/meta-data/iam/security-credentials/", tokenHeader)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get instance role: %w", err)
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(roles), "\n")
+	if role == "" {
+		return Credentials{}, errors.New("no role is attached to the instance")
+	}
+
+	body, err := c.request(ctx, http.MethodGet, "/latest/meta-data/iam/security-credentials/"+role, tokenHeader)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get credentials for role %s: %w", role, err)
+	}
+
+	var response struct {
+		Code            string
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return Credentials{}, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+	if response.Code != "" && response.Code != "Success" {
+		return Credentials{}, fmt.Errorf("metadata service returned %s", response.Code)
+	}
+
+	return Credentials{
+		AccessKeyID:     response.AccessKeyID,
+		SecretAccessKey: response.SecretAccessKey,
+		SessionToken:    response.Token,
+		Expires:         response.Expiration,
+	}, nil
+}
+
+func (c *instanceRoleCredentials) request(ctx context.Context, method, path string, headers map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata service returned %s", resp.Status)
+	}
+	return string(body), nil
+}
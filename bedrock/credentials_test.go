@@ -0,0 +1,73 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package bedrock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsProvider(t *testing.T) {
+	t.Run("configured keys come first", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+
+		credentials, err := newCredentialsProvider("key", "secret").Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}, credentials)
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+		t.Setenv("AWS_SESSION_TOKEN", "env-token")
+
+		credentials, err := newCredentialsProvider("", "").Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Credentials{AccessKeyID: "env-key", SecretAccessKey: "env-secret", SessionToken: "env-token"}, credentials)
+	})
+
+	t.Run("instance role", func(t *testing.T) {
+		expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			switch {
+			case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+				assert.Equal(t, metadataTokenTTLSeconds, r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+				fmt.Fprint(w, "imds-token")
+				return
+			case r.Header.Get("X-aws-ec2-metadata-token") != "imds-token":
+				w.WriteHeader(http.StatusUnauthorized)
+			case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+				fmt.Fprint(w, "agents-role\n")
+			case r.URL.Path == "/latest/meta-data/iam/security-credentials/agents-role":
+				fmt.Fprintf(w, `{"Code":"Success","AccessKeyId":"role-key","SecretAccessKey":"role-secret","Token":"role-token","Expiration":"%s"}`, expiration.Format(time.RFC3339))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		t.Setenv("AWS_ACCESS_KEY_ID", "")
+		t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.URL)
+		provider := newCredentialsProvider("", "")
+
+		credentials, err := provider.Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Credentials{AccessKeyID: "role-key", SecretAccessKey: "role-secret", SessionToken: "role-token", Expires: expiration}, credentials)
+		assert.Equal(t, 3, requests)
+
+		// Credentials are reused until they are about to expire.
+		_, err = provider.Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 3, requests)
+	})
+}
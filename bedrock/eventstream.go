@@ -0,0 +1,123 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package bedrock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// preludeLength covers the total length, the headers length and the prelude checksum.
+	preludeLength = 12
+	// maxMessageLength is the largest message the service sends.
+	maxMessageLength = 24 * 1024 * 1024
+)
+
+// eventMessage is a single message of an application/vnd.amazon.eventstream response.
+type eventMessage struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+// eventStreamReader decodes the binary event stream framing Bedrock uses for streaming responses.
+type eventStreamReader struct {
+	reader io.Reader
+}
+
+func newEventStreamReader(reader io.Reader) *eventStreamReader {
+	return &eventStreamReader{reader: reader}
+}
+
+// Next returns the next message, or io.EOF once the stream ends between messages.
+func (r *eventStreamReader) Next() (eventMessage, error) {
+	prelude := make([]byte, preludeLength)
+	if _, err := io.ReadFull(r.reader, prelude); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return eventMessage{}, fmt.Errorf("truncated message prelude: %w", err)
+		}
+		return eventMessage{}, err
+	}
+
+	totalLength := binary.BigEndian.Uint32(prelude[0:4])
+	headersLength := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return eventMessage{}, errors.New("message prelude checksum mismatch")
+	}
+	if totalLength > maxMessageLength || totalLength < preludeLength+4 || headersLength > totalLength-preludeLength-4 {
+		return eventMessage{}, fmt.Errorf("invalid message length %d with headers length %d", totalLength, headersLength)
+	}
+
+	message := make([]byte, totalLength)
+	copy(message, prelude)
+	if _, err := io.ReadFull(r.reader, message[preludeLength:]); err != nil {
+		return eventMessage{}, fmt.Errorf("truncated message: %w", err)
+	}
+	if crc32.ChecksumIEEE(message[:totalLength-4]) != binary.BigEndian.Uint32(message[totalLength-4:]) {
+		return eventMessage{}, errors.New("message checksum mismatch")
+	}
+
+	headers, err := decodeHeaders(message[preludeLength : preludeLength+headersLength])
+	if err != nil {
+		return eventMessage{}, err
+	}
+
+	return eventMessage{
+		Headers: headers,
+		Payload: message[preludeLength+headersLength : totalLength-4],
+	}, nil
+}
+
+// decodeHeaders keeps the string valued headers, which are the only ones Bedrock sends.
+func decodeHeaders(data []byte) (map[string]string, error) {
+	headers := map[string]string{}
+	errTruncated := errors.New("truncated message headers")
+
+	for len(data) > 0 {
+		nameLength := int(data[0])
+		if len(data) < 1+nameLength+1 {
+			return nil, errTruncated
+		}
+		name := string(data[1 : 1+nameLength])
+		valueType := data[1+nameLength]
+		data = data[1+nameLength+1:]
+
+		var valueLength int
+		switch valueType {
+		case 0, 1: // true, false
+			valueLength = 0
+		case 2: // byte
+			valueLength = 1
+		case 3: // int16
+			valueLength = 2
+		case 4: // int32
+			valueLength = 4
+		case 5, 8: // int64, timestamp
+			valueLength = 8
+		case 9: // uuid
+			valueLength = 16
+		case 6, 7: // bytes, string
+			if len(data) < 2 {
+				return nil, errTruncated
+			}
+			valueLength = int(binary.BigEndian.Uint16(data[0:2]))
+			data = data[2:]
+		default:
+			return nil, fmt.Errorf("unknown type %d for header %s", valueType, name)
+		}
+
+		if len(data) < valueLength {
+			return nil, errTruncated
+		}
+		if valueType == 7 {
+			headers[name] = string(data[:valueLength])
+		}
+		data = data[valueLength:]
+	}
+
+	return headers, nil
+}
@@ -12,6 +12,10 @@ type Bot struct {
 	cfg   llm.BotConfig
 	mmBot *model.Bot
 	llm   llm.LanguageModel
+	// toolsUnsupported is set when a model of the bot is known not to support tools.
+	toolsUnsupported bool
+	// readsDocuments is set when a model of the bot reads PDFs rather than their extracted text.
+	readsDocuments bool
 }
 
 func NewBot(cfg llm.BotConfig, bot *model.Bot) *Bot {
@@ -25,6 +29,16 @@ func (b *Bot) GetConfig() llm.BotConfig {
 	return b.cfg
 }
 
+// ToolsDisabled reports whether the bot must not be given tools, because it is configured so or its model can't use them.
+func (b *Bot) ToolsDisabled() bool {
+	return b.cfg.DisableTools || b.toolsUnsupported
+}
+
+// ReadsDocuments reports whether PDFs should be sent to the bot's models, which otherwise only get their extracted text.
+func (b *Bot) ReadsDocuments() bool {
+	return b.readsDocuments
+}
+
 func (b *Bot) GetMMBot() *model.Bot {
 	return b.mmBot
 }
@@ -4,18 +4,25 @@
 package bots
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/mattermost/mattermost-plugin-ai/anthropic"
 	"github.com/mattermost/mattermost-plugin-ai/asage"
+	"github.com/mattermost/mattermost-plugin-ai/bedrock"
 	"github.com/mattermost/mattermost-plugin-ai/config"
 	"github.com/mattermost/mattermost-plugin-ai/enterprise"
+	"github.com/mattermost/mattermost-plugin-ai/gemini"
 	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost-plugin-ai/metrics"
 	"github.com/mattermost/mattermost-plugin-ai/mmapi"
 	"github.com/mattermost/mattermost-plugin-ai/openai"
+	"github.com/mattermost/mattermost-plugin-ai/prompts"
 	"github.com/mattermost/mattermost-plugin-ai/subtitles"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/pluginapi"
@@ -26,31 +33,62 @@ type Config interface {
 	GetDefaultBotName() string
 	EnableLLMLogging() bool
 	GetTranscriptGenerator() string
+	GetModelCapabilities() []llm.ModelCapabilitiesOverride
 }
 
+// modelListTimeout bounds how long a service is given to list its models.
+const modelListTimeout = 15 * time.Second
+
 // Transcriber interface defines the contract for transcription services
 type Transcriber interface {
 	Transcribe(file io.Reader) (*subtitles.Subtitles, error)
 }
 
+// ImageGenerator is implemented by services that can generate images from a prompt.
+type ImageGenerator interface {
+	GenerateImage(ctx context.Context, request llm.ImageRequest) (*llm.GeneratedImage, error)
+}
+
+// Synthesizer is implemented by services that can read text aloud.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, request llm.SpeechRequest) ([]byte, error)
+}
+
 type MMBots struct {
 	ensureBotsClusterMutex cluster.MutexPluginAPI
 	pluginAPI              *pluginapi.Client
 	licenseChecker         *enterprise.LicenseChecker
 	config                 Config
 	llmUpstreamHTTPClient  *http.Client
+	usageSink              llm.UsageSink
+	prompts                *llm.Prompts
+	metricsService         metrics.Metrics
+	rateLimiter            *RateLimiter
+	models                 *llm.ModelRegistry
+
+	// listedModelsLock guards listedModels, the services whose models were added to the registry.
+	listedModelsLock sync.Mutex
+	listedModels     map[string]bool
 
 	botsLock sync.RWMutex
 	bots     []*Bot
 }
 
-func New(mutexPluginAPI cluster.MutexPluginAPI, pluginAPI *pluginapi.Client, licenseChecker *enterprise.LicenseChecker, config Config, llmUpstreamHTTPClient *http.Client) *MMBots {
+// New creates the bots service. usageSink receives the token usage of every LLM request and may be nil.
+// prompts are used by bots summarizing long conversations, without them truncation falls back to dropping history.
+func New(mutexPluginAPI cluster.MutexPluginAPI, pluginAPI *pluginapi.Client, licenseChecker *enterprise.LicenseChecker, config Config, llmUpstreamHTTPClient *http.Client, usageSink llm.UsageSink, prompts *llm.Prompts, metricsService metrics.Metrics) *MMBots {
 	return &MMBots{
 		ensureBotsClusterMutex: mutexPluginAPI,
 		pluginAPI:              pluginAPI,
 		licenseChecker:         licenseChecker,
 		config:                 config,
 		llmUpstreamHTTPClient:  llmUpstreamHTTPClient,
+		usageSink:              usageSink,
+		prompts:                prompts,
+		metricsService:         metricsService,
+		rateLimiter:            NewRateLimiter(&kvCounterStore{kv: &pluginAPI.KV}),
+		models:                 llm.NewModelRegistry(),
+		listedModels:           map[string]bool{},
 	}
 }
 
@@ -73,12 +111,19 @@ func (b *MMBots) EnsureBots(cfgBots []llm.BotConfig) error {
 		cfgBots = cfgBots[:1]
 	}
 
+	b.models.SetOverrides(b.config.GetModelCapabilities())
+	b.listModels(cfgBots)
+
 	aiBotConfigsByUsername := make(map[string]llm.BotConfig)
 	for _, bot := range cfgBots {
 		if !bot.IsValid() {
 			b.pluginAPI.Log.Error("Configured bot is not valid", "bot_name", bot.Name, "bot_display_name", bot.DisplayName)
 			continue
 		}
+		// Bots configured before their models were known are kept, disabling them would break them on upgrade.
+		if err := b.models.ValidateBot(bot); err != nil {
+			b.pluginAPI.Log.Error("Configured bot uses features its model does not support", "bot_name", bot.Name, "error", err.Error())
+		}
 		if _, ok := aiBotConfigsByUsername[bot.Name]; ok {
 			// Duplicate bot names have to be fatal because they would cause a bot to be modified inappropreately.
 			return fmt.Errorf("duplicate bot name: %s", bot.Name)
@@ -104,7 +149,7 @@ func (b *MMBots) EnsureBots(cfgBots []llm.BotConfig) error {
 	// For each bot in the configuration, try to find an existing bot matching the username.
 	// If it exists, update it to match. Otherwise, create a new bot.
 	for _, bot := range cfgBots {
-		if !bot.IsValid() {
+		if _, ok := aiBotConfigsByUsername[bot.Name]; !ok {
 			continue
 		}
 		description := "Powered by " + bot.Service.Type
@@ -140,6 +185,80 @@ func (b *MMBots) EnsureBots(cfgBots []llm.BotConfig) error {
 	return nil
 }
 
+// ValidateBotConfigs checks configured bots against what their models support, using overrides in place of the current ones.
+func (b *MMBots) ValidateBotConfigs(cfgBots []llm.BotConfig, overrides []llm.ModelCapabilitiesOverride) error {
+	models := b.models.WithOverrides(overrides)
+	var errs []error
+	for _, bot := range cfgBots {
+		if err := models.ValidateBot(bot); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listModels adds the models of the services configured to list them to the registry, once per service.
+// The services are asked in the background, the bots are updated once their models are known.
+func (b *MMBots) listModels(cfgBots []llm.BotConfig) {
+	type serviceLister struct {
+		key     string
+		service llm.ServiceConfig
+		lister  llm.ModelLister
+	}
+	var listers []serviceLister
+	for _, bot := range cfgBots {
+		for _, service := range bot.Services() {
+			if !service.FetchModelCapabilities {
+				continue
+			}
+
+			key := service.Type + "|" + service.APIURL + "|" + service.APIKey
+			b.listedModelsLock.Lock()
+			listed := b.listedModels[key]
+			b.listedModels[key] = true
+			b.listedModelsLock.Unlock()
+			if listed {
+				continue
+			}
+
+			lister, ok := b.getServiceLLM(service).(llm.ModelLister)
+			if !ok {
+				b.pluginAPI.Log.Warn("Service can't list its models", "service_name", service.Name, "service_type", service.Type)
+				continue
+			}
+			listers = append(listers, serviceLister{key: key, service: service, lister: lister})
+		}
+	}
+	if len(listers) == 0 {
+		return
+	}
+
+	go func() {
+		discovered := false
+		for _, l := range listers {
+			ctx, cancel := context.WithTimeout(context.Background(), modelListTimeout)
+			models, err := l.lister.ListModels(ctx)
+			cancel()
+			if err != nil {
+				b.pluginAPI.Log.Warn("Failed to list the models of a service", "service_name", l.service.Name, "error", err.Error())
+				// Try again with the next configuration change.
+				b.listedModelsLock.Lock()
+				delete(b.listedModels, l.key)
+				b.listedModelsLock.Unlock()
+				continue
+			}
+			b.models.AddDiscovered(models)
+			discovered = true
+		}
+
+		if discovered {
+			b.botsLock.Lock()
+			defer b.botsLock.Unlock()
+			b.configureBots()
+		}
+	}()
+}
+
 func (b *MMBots) UpdateBotsCache(cfgBots []llm.BotConfig) error {
 	bots, err := b.pluginAPI.Bot.List(0, 1000, pluginapi.BotOwner("mattermost-ai"))
 	if err != nil {
@@ -158,43 +277,139 @@ func (b *MMBots) UpdateBotsCache(cfgBots []llm.BotConfig) error {
 		}
 	}
 
+	b.configureBots()
+
+	return nil
+}
+
+// configureBots sets up the bots for what their models support. The caller must hold botsLock.
+func (b *MMBots) configureBots() {
 	for _, bot := range b.bots {
-		bot.llm = b.getLLM(bot.cfg.Service)
+		bot.toolsUnsupported = !b.models.SupportsTools(bot.cfg)
+		bot.readsDocuments = b.models.ReadsDocuments(bot.cfg)
+		bot.llm = b.getLLM(bot.cfg, b.getTruncationStrategy(bot), b.getUsageSink(bot), bot.mmBot.UserId)
 	}
+}
 
-	return nil
+// getUsageSink returns where the bot's token usage is reported, nil if it doesn't need to be observed.
+func (b *MMBots) getUsageSink(bot *Bot) llm.UsageSink {
+	if !bot.cfg.RateLimits.HasTokenLimits() {
+		return b.usageSink
+	}
+	return &rateLimitUsageSink{
+		limiter: b.rateLimiter,
+		next:    b.usageSink,
+		log:     &b.pluginAPI.Log,
+	}
+}
+
+func (b *MMBots) getTruncationStrategy(bot *Bot) llm.TruncationStrategy {
+	switch bot.cfg.TruncationStrategy {
+	case llm.TruncationStrategySummarize:
+		cache := &kvHistorySummaryCache{
+			kv:    &b.pluginAPI.KV,
+			botID: bot.mmBot.UserId,
+		}
+		return llm.NewSummarizeTruncation(b.prompts, prompts.PromptSummarizeConversationHistorySystem, cache, &b.pluginAPI.Log)
+	default:
+		return llm.DropOldestTruncation{}
+	}
 }
 
-func (b *MMBots) getLLM(serviceConfig llm.ServiceConfig) llm.LanguageModel {
-	// Create the correct model
+func (b *MMBots) getLLM(botConfig llm.BotConfig, truncationStrategy llm.TruncationStrategy, usageSink llm.UsageSink, botID string) llm.LanguageModel {
+	serviceConfigs := botConfig.Services()
+	services := make([]llm.FailoverService, 0, len(serviceConfigs))
+	for _, serviceConfig := range serviceConfigs {
+		// Without a configured limit, truncate to the model's context window when it is known.
+		serviceConfig.InputTokenLimit = b.models.InputTokenLimit(serviceConfig)
+		model := b.getServiceLLM(serviceConfig)
+		if model == nil {
+			continue
+		}
+		if usageSink != nil {
+			model = llm.NewServiceUsageWrapper(model, serviceConfig.DefaultModel)
+		}
+		if b.models.IsReasoningModel(serviceConfig) {
+			model = llm.NewDefaultOptionsWrapper(model, llm.WithReasoningModel())
+		}
+		if !b.models.SupportsJSONSchema(serviceConfig) {
+			model = llm.NewJSONOutputUnsupportedWrapper(model)
+		}
+		services = append(services, llm.FailoverService{
+			Name:  serviceConfig.Name,
+			Model: llm.NewRetryWrapper(model, llm.DefaultRetryConfig),
+		})
+	}
+
 	var result llm.LanguageModel
+	switch len(services) {
+	case 0:
+		return nil
+	case 1:
+		result = services[0].Model
+	default:
+		result = llm.NewFailoverWrapper(services, func(from, to string, err error) {
+			b.pluginAPI.Log.Warn("LLM service failed, failing over", "bot_name", botConfig.Name, "from", from, "to", to, "error", err)
+			if b.metricsService != nil {
+				b.metricsService.IncrementLLMFailovers(botConfig.Name, from, to)
+			}
+		})
+	}
+
+	// Sampling and reasoning settings apply to every service, callers can still override them per request.
+	defaultOptions := botConfig.Sampling.Options()
+	if botConfig.ReasoningEffort != "" || botConfig.ThinkingBudgetTokens > 0 {
+		defaultOptions = append(defaultOptions,
+			llm.WithReasoningEffort(botConfig.ReasoningEffort),
+			llm.WithThinkingBudget(botConfig.ThinkingBudgetTokens),
+		)
+	}
+	if len(defaultOptions) > 0 {
+		result = llm.NewDefaultOptionsWrapper(result, defaultOptions...)
+	}
+
+	// Usage is observed below truncation so that the requests summarizing history are recorded too. It is
+	// recorded under the model of the service that answered, which each service reports with its usage.
+	if usageSink != nil {
+		result = llm.NewUsageWrapper(result, usageSink, botID)
+	}
+
+	// Truncation Support
+	result = llm.NewLLMTruncationWrapper(result, truncationStrategy)
+
+	// Logging
+	if b.config.EnableLLMLogging() {
+		result = llm.NewLanguageModelLogWrapper(b.pluginAPI.Log, result)
+	}
+
+	return result
+}
+
+// getServiceLLM creates the client for a single service, nil if the service type is unknown.
+func (b *MMBots) getServiceLLM(serviceConfig llm.ServiceConfig) llm.LanguageModel {
 	switch serviceConfig.Type {
 	case llm.ServiceTypeOpenAI:
-		result = openai.New(config.OpenAIConfigFromServiceConfig(serviceConfig), b.llmUpstreamHTTPClient)
+		return openai.New(config.OpenAIConfigFromServiceConfig(serviceConfig), b.llmUpstreamHTTPClient)
 	case llm.ServiceTypeOpenAICompatible:
-		result = openai.NewCompatible(config.OpenAIConfigFromServiceConfig(serviceConfig), b.llmUpstreamHTTPClient)
+		return openai.NewCompatible(config.OpenAIConfigFromServiceConfig(serviceConfig), b.llmUpstreamHTTPClient)
 	case llm.ServiceTypeAzure:
-		result = openai.NewAzure(config.OpenAIConfigFromServiceConfig(serviceConfig), b.llmUpstreamHTTPClient)
+		return openai.NewAzure(config.OpenAIConfigFromServiceConfig(serviceConfig), b.llmUpstreamHTTPClient)
 	case llm.ServiceTypeAnthropic:
-		result = anthropic.New(serviceConfig, b.llmUpstreamHTTPClient)
+		return anthropic.New(serviceConfig, b.llmUpstreamHTTPClient)
 	case llm.ServiceTypeASage:
-		result = asage.New(serviceConfig, b.llmUpstreamHTTPClient)
+		return asage.New(serviceConfig, b.llmUpstreamHTTPClient)
 	case llm.ServiceTypeCohere:
 		// Set the Cohere OpenAI compatibility endpoint
 		cohereCfg := serviceConfig
 		cohereCfg.APIURL = "https://api.cohere.ai/compatibility/v1"
-		result = openai.NewCompatible(config.OpenAIConfigFromServiceConfig(cohereCfg), b.llmUpstreamHTTPClient)
-	}
-
-	// Truncation Support
-	result = llm.NewLLMTruncationWrapper(result)
-
-	// Logging
-	if b.config.EnableLLMLogging() {
-		result = llm.NewLanguageModelLogWrapper(b.pluginAPI.Log, result)
+		return openai.NewCompatible(config.OpenAIConfigFromServiceConfig(cohereCfg), b.llmUpstreamHTTPClient)
+	case llm.ServiceTypeGemini:
+		return gemini.New(serviceConfig, b.llmUpstreamHTTPClient)
+	case llm.ServiceTypeBedrock:
+		return bedrock.New(serviceConfig, b.llmUpstreamHTTPClient)
 	}
 
-	return result
+	return nil
 }
 
 // TODO: This really doesn't belong here. Figure out where to put this.
@@ -222,6 +437,88 @@ func (b *MMBots) GetTranscribe() Transcriber {
 	}
 }
 
+// GetImageGenerator returns the image generator of the bot's service, nil if the bot doesn't generate images
+// or its service can't. The usage of every image is recorded, and counted towards the bot's token limits.
+func (b *MMBots) GetImageGenerator(bot *Bot) ImageGenerator {
+	if !bot.cfg.ImageGeneration.Enabled {
+		return nil
+	}
+
+	var generator ImageGenerator
+	service := bot.cfg.Service
+	switch service.Type {
+	case llm.ServiceTypeOpenAI:
+		generator = openai.New(config.OpenAIConfigFromServiceConfig(service), b.llmUpstreamHTTPClient)
+	case llm.ServiceTypeOpenAICompatible:
+		generator = openai.NewCompatible(config.OpenAIConfigFromServiceConfig(service), b.llmUpstreamHTTPClient)
+	case llm.ServiceTypeAzure:
+		generator = openai.NewAzure(config.OpenAIConfigFromServiceConfig(service), b.llmUpstreamHTTPClient)
+	default:
+		return nil
+	}
+
+	if sink := b.getUsageSink(bot); sink != nil {
+		generator = &imageUsageRecorder{
+			wrapped: generator,
+			sink:    sink,
+			botID:   bot.mmBot.UserId,
+		}
+	}
+	return generator
+}
+
+// imageUsageRecorder records the usage of every image generated. Images of models that don't report their usage
+// are recorded with the tokens of their prompt, so that each of them has a record.
+type imageUsageRecorder struct {
+	wrapped ImageGenerator
+	sink    llm.UsageSink
+	botID   string
+}
+
+func (r *imageUsageRecorder) GenerateImage(ctx context.Context, request llm.ImageRequest) (*llm.GeneratedImage, error) {
+	image, err := r.wrapped.GenerateImage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	record := llm.NewUsageRecord(r.botID, llm.FeatureImageGeneration, request.Context)
+	record.Model = image.Model
+	if image.Usage != nil {
+		record.Usage = *image.Usage
+	} else {
+		record.Usage = llm.TokenUsage{InputTokens: int64(llm.TokenizerForModel(image.Model).CountTokens(request.Prompt))}
+	}
+	record.CreateAt = time.Now().UnixMilli()
+	r.sink.RecordUsage(record)
+
+	return image, nil
+}
+
+// GetSynthesizer returns the speech synthesizer of the bot, nil if the bot doesn't reply with voice
+// or its service can't. A configured text to speech API is used in place of the bot's service.
+func (b *MMBots) GetSynthesizer(bot *Bot) Synthesizer {
+	tts := bot.cfg.TextToSpeech
+	if !tts.Enabled {
+		return nil
+	}
+
+	if tts.APIURL != "" {
+		return openai.NewCompatible(openai.Config{APIURL: tts.APIURL, APIKey: tts.APIKey}, b.llmUpstreamHTTPClient)
+	}
+
+	service := bot.cfg.Service
+	switch service.Type {
+	case llm.ServiceTypeOpenAI:
+		return openai.New(config.OpenAIConfigFromServiceConfig(service), b.llmUpstreamHTTPClient)
+	case llm.ServiceTypeOpenAICompatible:
+		return openai.NewCompatible(config.OpenAIConfigFromServiceConfig(service), b.llmUpstreamHTTPClient)
+	case llm.ServiceTypeAzure:
+		return openai.NewAzure(config.OpenAIConfigFromServiceConfig(service), b.llmUpstreamHTTPClient)
+	default:
+		return nil
+	}
+}
+
 func (b *MMBots) getTrasncriberBot() *Bot {
 	b.botsLock.RLock()
 	defer b.botsLock.RUnlock()
@@ -273,6 +570,11 @@ func (b *MMBots) GetBotByUsernameOrFirst(botUsername string) *Bot {
 	return nil
 }
 
+// GetDefaultBot retrieves the default bot, or the first bot if the default one is not found
+func (b *MMBots) GetDefaultBot() *Bot {
+	return b.GetBotByUsernameOrFirst(b.config.GetDefaultBotName())
+}
+
 // GetBotByID retrieves the bot associated with the given bot ID
 func (b *MMBots) GetBotByID(botID string) *Bot {
 	b.botsLock.RLock()
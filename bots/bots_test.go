@@ -30,6 +30,10 @@ func (m *mockConfig) GetTranscriptGenerator() string {
 	return "testbot"
 }
 
+func (m *mockConfig) GetModelCapabilities() []llm.ModelCapabilitiesOverride {
+	return nil
+}
+
 func TestEnsureBots(t *testing.T) {
 	testCases := []struct {
 		name               string
@@ -121,6 +125,25 @@ func TestEnsureBots(t *testing.T) {
 			expectError:        false,
 			numCreatedBots:     2,
 		},
+		{
+			name: "bot enabling features its model does not support should be kept",
+			cfgBots: []llm.BotConfig{
+				{
+					ID:           "test1",
+					Name:         "testbot1",
+					DisplayName:  "Test Bot 1",
+					EnableVision: true,
+					Service: llm.ServiceConfig{
+						Type:         llm.ServiceTypeOpenAI,
+						APIKey:       "test-api-key",
+						DefaultModel: "gpt-3.5-turbo",
+					},
+				},
+			},
+			isMultiLLMLicensed: false,
+			expectError:        false,
+			numCreatedBots:     1,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -159,9 +182,10 @@ func TestEnsureBots(t *testing.T) {
 
 			// Mock logging
 			mockAPI.On("LogError", mock.Anything).Return(nil).Maybe()
+			mockAPI.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
 
 			licenseChecker := enterprise.NewLicenseChecker(client)
-			mmBots := New(mockAPI, client, licenseChecker, &mockConfig{}, &http.Client{})
+			mmBots := New(mockAPI, client, licenseChecker, &mockConfig{}, &http.Client{}, nil, nil, nil)
 
 			defer mockAPI.AssertExpectations(t)
 
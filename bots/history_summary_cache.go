@@ -0,0 +1,39 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package bots
+
+import (
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+)
+
+const historySummaryExpiry = 30 * 24 * time.Hour
+
+// kvHistorySummaryCache keeps conversation history summaries in the KV store so they are shared across the cluster.
+type kvHistorySummaryCache struct {
+	kv    *pluginapi.KVService
+	botID string
+}
+
+func (c *kvHistorySummaryCache) key(conversationID string) string {
+	return "history_summary_" + c.botID + "_" + conversationID
+}
+
+func (c *kvHistorySummaryCache) GetSummary(conversationID string) (*llm.HistorySummary, error) {
+	var summary llm.HistorySummary
+	if err := c.kv.Get(c.key(conversationID), &summary); err != nil {
+		return nil, err
+	}
+	if summary.Summary == "" {
+		return nil, nil
+	}
+	return &summary, nil
+}
+
+func (c *kvHistorySummaryCache) SaveSummary(conversationID string, summary llm.HistorySummary) error {
+	_, err := c.kv.Set(c.key(conversationID), summary, pluginapi.SetExpiry(historySummaryExpiry))
+	return err
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package bots
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+)
+
+// ErrRateLimited is wrapped by every RateLimitError.
+var ErrRateLimited = errors.New("rate limited")
+
+const (
+	RateLimitScopeUserRequests = "user_requests"
+	RateLimitScopeUserTokens   = "user_tokens"
+	RateLimitScopeTeamTokens   = "team_tokens"
+	RateLimitScopeBotTokens    = "bot_tokens"
+)
+
+const (
+	requestCounterExpiry = 2 * time.Minute
+	tokenCounterExpiry   = 48 * time.Hour
+	counterMaxRetries    = 10
+)
+
+// RateLimitError is returned when a request would exceed one of the bot's rate limits.
+type RateLimitError struct {
+	// Scope is the limit that was reached, one of the RateLimitScope constants.
+	Scope string
+	// ResetAt is when the limit's window ends and requests are allowed again.
+	ResetAt time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s limit reached until %s", e.Scope, e.ResetAt.UTC().Format(time.RFC3339))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// CounterStore holds counters shared by all nodes of the cluster.
+type CounterStore interface {
+	// Get returns the value of the counter, zero if it does not exist.
+	Get(key string) (int64, error)
+	// Increment adds delta to the counter and returns its new value. The counter is removed after expiry.
+	Increment(key string, delta int64, expiry time.Duration) (int64, error)
+}
+
+// kvCounterStore keeps counters in the plugin KV store, updating them with compare and set.
+type kvCounterStore struct {
+	kv *pluginapi.KVService
+}
+
+func (s *kvCounterStore) Get(key string) (int64, error) {
+	var value int64
+	if err := s.kv.Get(key, &value); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (s *kvCounterStore) Increment(key string, delta int64, expiry time.Duration) (int64, error) {
+	for range counterMaxRetries {
+		var oldValue []byte
+		if err := s.kv.Get(key, &oldValue); err != nil {
+			return 0, fmt.Errorf("failed to get counter: %w", err)
+		}
+
+		var current int64
+		if oldValue != nil {
+			parsed, err := strconv.ParseInt(string(oldValue), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse counter: %w", err)
+			}
+			current = parsed
+		}
+
+		newValue := current + delta
+		saved, err := s.kv.Set(key, newValue, pluginapi.SetAtomic(oldValue), pluginapi.SetExpiry(expiry))
+		if err != nil {
+			return 0, fmt.Errorf("failed to set counter: %w", err)
+		}
+		if saved {
+			return newValue, nil
+		}
+	}
+
+	return 0, fmt.Errorf("failed to increment counter %s after %d attempts", key, counterMaxRetries)
+}
+
+// RateLimiter enforces the rate limits of bots with counters that are shared across the cluster.
+// Requests are counted when they are admitted, so that concurrent requests can't get past the limit, and tokens once
+// the provider reports them. Requests admitted just under a token limit can therefore still take consumption over it.
+type RateLimiter struct {
+	counters CounterStore
+	now      func() time.Time
+}
+
+func NewRateLimiter(counters CounterStore) *RateLimiter {
+	return &RateLimiter{
+		counters: counters,
+		now:      time.Now,
+	}
+}
+
+// Check returns a RateLimitError if userID may not make another request to the bot right now. Otherwise the request is
+// counted towards the requests per minute limit.
+// teamID may be empty for requests outside of a team, such as DMs, which are then not subject to the team limit.
+func (r *RateLimiter) Check(botID string, limits llm.RateLimitConfig, userID, teamID string) error {
+	now := r.now().UTC()
+
+	tokenLimits := []struct {
+		scope string
+		id    string
+		limit int64
+	}{
+		{RateLimitScopeUserTokens, userID, limits.UserTokensPerDay},
+		{RateLimitScopeTeamTokens, teamID, limits.TeamTokensPerDay},
+		{RateLimitScopeBotTokens, botID, limits.BotTokensPerDay},
+	}
+	for _, tokenLimit := range tokenLimits {
+		if tokenLimit.limit <= 0 || tokenLimit.id == "" {
+			continue
+		}
+		used, err := r.counters.Get(tokenCounterKey(botID, tokenLimit.scope, tokenLimit.id, now))
+		if err != nil {
+			return fmt.Errorf("failed to get token usage: %w", err)
+		}
+		if used >= tokenLimit.limit {
+			return &RateLimitError{Scope: tokenLimit.scope, ResetAt: endOfDay(now)}
+		}
+	}
+
+	if limits.UserRequestsPerMinute > 0 {
+		key := requestCounterKey(botID, userID, now)
+		requests, err := r.counters.Increment(key, 1, requestCounterExpiry)
+		if err != nil {
+			return fmt.Errorf("failed to count request: %w", err)
+		}
+		if requests > int64(limits.UserRequestsPerMinute) {
+			// Give the rejected request back so that retrying while limited does not extend the limit.
+			if _, err := r.counters.Increment(key, -1, requestCounterExpiry); err != nil {
+				return fmt.Errorf("failed to uncount rejected request: %w", err)
+			}
+			return &RateLimitError{Scope: RateLimitScopeUserRequests, ResetAt: now.Truncate(time.Minute).Add(time.Minute)}
+		}
+	}
+
+	return nil
+}
+
+// CountRequest counts a request of userID to the bot towards the requests per minute limit without checking it.
+func (r *RateLimiter) CountRequest(botID, userID string) error {
+	if _, err := r.counters.Increment(requestCounterKey(botID, userID, r.now().UTC()), 1, requestCounterExpiry); err != nil {
+		return fmt.Errorf("failed to count request: %w", err)
+	}
+	return nil
+}
+
+// RecordTokens adds the tokens used by a request to the daily counters of the user, team and bot.
+func (r *RateLimiter) RecordTokens(botID, userID, teamID string, tokens int64) error {
+	now := r.now().UTC()
+	ids := map[string]string{
+		RateLimitScopeUserTokens: userID,
+		RateLimitScopeTeamTokens: teamID,
+		RateLimitScopeBotTokens:  botID,
+	}
+	for scope, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, err := r.counters.Increment(tokenCounterKey(botID, scope, id, now), tokens, tokenCounterExpiry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RateLimitConsumption is what has been used so far in the current windows of a bot's rate limits.
+type RateLimitConsumption struct {
+	UserRequestsThisMinute int64 `json:"userRequestsThisMinute,omitempty"`
+	UserTokensToday        int64 `json:"userTokensToday,omitempty"`
+	TeamTokensToday        int64 `json:"teamTokensToday,omitempty"`
+	BotTokensToday         int64 `json:"botTokensToday"`
+}
+
+// Consumption reads the current consumption of the bot, and of the user and team when their IDs are not empty.
+func (r *RateLimiter) Consumption(botID, userID, teamID string) (RateLimitConsumption, error) {
+	now := r.now().UTC()
+	var consumption RateLimitConsumption
+	var err error
+
+	if consumption.BotTokensToday, err = r.counters.Get(tokenCounterKey(botID, RateLimitScopeBotTokens, botID, now)); err != nil {
+		return consumption, err
+	}
+	if userID != "" {
+		if consumption.UserRequestsThisMinute, err = r.counters.Get(requestCounterKey(botID, userID, now)); err != nil {
+			return consumption, err
+		}
+		if consumption.UserTokensToday, err = r.counters.Get(tokenCounterKey(botID, RateLimitScopeUserTokens, userID, now)); err != nil {
+			return consumption, err
+		}
+	}
+	if teamID != "" {
+		if consumption.TeamTokensToday, err = r.counters.Get(tokenCounterKey(botID, RateLimitScopeTeamTokens, teamID, now)); err != nil {
+			return consumption, err
+		}
+	}
+
+	return consumption, nil
+}
+
+func requestCounterKey(botID, userID string, now time.Time) string {
+	return fmt.Sprintf("ratelimit_%s_%s_%s_%d", botID, RateLimitScopeUserRequests, userID, now.Unix()/60)
+}
+
+func tokenCounterKey(botID, scope, id string, now time.Time) string {
+	return fmt.Sprintf("ratelimit_%s_%s_%s_%s", botID, scope, id, now.Format("20060102"))
+}
+
+func endOfDay(now time.Time) time.Time {
+	year, month, day := now.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+// rateLimitUsageSink counts the tokens of every request towards the daily limits before passing the record on.
+type rateLimitUsageSink struct {
+	limiter *RateLimiter
+	next    llm.UsageSink
+	log     *pluginapi.LogService
+}
+
+func (s *rateLimitUsageSink) RecordUsage(record llm.UsageRecord) {
+	tokens := record.Usage.InputTokens + record.Usage.OutputTokens
+	if err := s.limiter.RecordTokens(record.BotID, record.UserID, record.TeamID, tokens); err != nil {
+		s.log.Error("Failed to count tokens towards rate limits", "error", err, "bot_id", record.BotID)
+	}
+	if s.next != nil {
+		s.next.RecordUsage(record)
+	}
+}
+
+// CheckRateLimits returns an error wrapping ErrRateLimited if the user has reached one of the bot's rate limits.
+// It must be called once before every request a user makes to the bot, and counts that request. Follow-up calls the
+// plugin makes for the same request, such as generating a conversation title, are not counted.
+func (m *MMBots) CheckRateLimits(bot *Bot, userID, teamID string) error {
+	limits := bot.GetConfig().RateLimits
+	if limits == (llm.RateLimitConfig{}) {
+		return nil
+	}
+	return m.rateLimiter.Check(bot.GetMMBot().UserId, limits, userID, teamID)
+}
+
+// GetRateLimitConsumption returns the current consumption of the bot's rate limits by the bot and optionally a user and a team.
+func (m *MMBots) GetRateLimitConsumption(bot *Bot, userID, teamID string) (RateLimitConsumption, error) {
+	return m.rateLimiter.Consumption(bot.GetMMBot().UserId, userID, teamID)
+}
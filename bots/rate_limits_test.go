@@ -0,0 +1,212 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package bots
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryCounterStore struct {
+	mutex    sync.Mutex
+	counters map[string]int64
+}
+
+func (s *memoryCounterStore) Get(key string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.counters[key], nil
+}
+
+func (s *memoryCounterStore) Increment(key string, delta int64, expiry time.Duration) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counters[key] += delta
+	return s.counters[key], nil
+}
+
+func newTestRateLimiter(now *time.Time) *RateLimiter {
+	limiter := NewRateLimiter(&memoryCounterStore{counters: map[string]int64{}})
+	limiter.now = func() time.Time { return *now }
+	return limiter
+}
+
+func TestRateLimiterRequestsPerMinute(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 10, 0, time.UTC)
+	limiter := newTestRateLimiter(&now)
+	limits := llm.RateLimitConfig{UserRequestsPerMinute: 2}
+
+	require.NoError(t, limiter.Check("bot", limits, "user1", "team"))
+	require.NoError(t, limiter.Check("bot", limits, "user1", "team"))
+
+	err := limiter.Check("bot", limits, "user1", "team")
+	var rateLimitErr *RateLimitError
+	require.ErrorAs(t, err, &rateLimitErr)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, RateLimitScopeUserRequests, rateLimitErr.Scope)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 31, 0, 0, time.UTC), rateLimitErr.ResetAt)
+
+	consumption, err := limiter.Consumption("bot", "user1", "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), consumption.UserRequestsThisMinute, "rejected requests are not counted")
+
+	// Other users have their own limit.
+	require.NoError(t, limiter.Check("bot", limits, "user2", "team"))
+
+	// The next minute starts a new window.
+	now = now.Add(time.Minute)
+	require.NoError(t, limiter.Check("bot", limits, "user1", "team"))
+}
+
+func TestRateLimiterTokensPerDay(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	t.Run("user limit", func(t *testing.T) {
+		limiter := newTestRateLimiter(&now)
+		limits := llm.RateLimitConfig{UserTokensPerDay: 100}
+
+		require.NoError(t, limiter.RecordTokens("bot", "user1", "team", 60))
+		require.NoError(t, limiter.Check("bot", limits, "user1", "team"))
+
+		require.NoError(t, limiter.RecordTokens("bot", "user1", "team", 60))
+		var rateLimitErr *RateLimitError
+		require.ErrorAs(t, limiter.Check("bot", limits, "user1", "team"), &rateLimitErr)
+		assert.Equal(t, RateLimitScopeUserTokens, rateLimitErr.Scope)
+		assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), rateLimitErr.ResetAt)
+
+		require.NoError(t, limiter.Check("bot", limits, "user2", "team"))
+	})
+
+	t.Run("team limit does not apply outside of teams", func(t *testing.T) {
+		limiter := newTestRateLimiter(&now)
+		limits := llm.RateLimitConfig{TeamTokensPerDay: 100}
+
+		require.NoError(t, limiter.RecordTokens("bot", "user1", "team", 150))
+
+		var rateLimitErr *RateLimitError
+		require.ErrorAs(t, limiter.Check("bot", limits, "user2", "team"), &rateLimitErr)
+		assert.Equal(t, RateLimitScopeTeamTokens, rateLimitErr.Scope)
+		require.NoError(t, limiter.Check("bot", limits, "user2", ""))
+		require.NoError(t, limiter.Check("bot", limits, "user2", "otherteam"))
+	})
+
+	t.Run("bot limit resets the next day", func(t *testing.T) {
+		day := now
+		limiter := newTestRateLimiter(&day)
+		limits := llm.RateLimitConfig{BotTokensPerDay: 100}
+
+		require.NoError(t, limiter.RecordTokens("bot", "user1", "", 100))
+
+		var rateLimitErr *RateLimitError
+		require.ErrorAs(t, limiter.Check("bot", limits, "user2", ""), &rateLimitErr)
+		assert.Equal(t, RateLimitScopeBotTokens, rateLimitErr.Scope)
+		require.NoError(t, limiter.Check("otherbot", limits, "user2", ""))
+
+		day = day.Add(12 * time.Hour)
+		require.NoError(t, limiter.Check("bot", limits, "user2", ""))
+	})
+}
+
+func TestRateLimiterConsumption(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	limiter := newTestRateLimiter(&now)
+
+	require.NoError(t, limiter.CountRequest("bot", "user1"))
+	require.NoError(t, limiter.RecordTokens("bot", "user1", "team", 30))
+	require.NoError(t, limiter.RecordTokens("bot", "user2", "team", 20))
+
+	consumption, err := limiter.Consumption("bot", "user1", "team")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitConsumption{
+		UserRequestsThisMinute: 1,
+		UserTokensToday:        30,
+		TeamTokensToday:        50,
+		BotTokensToday:         50,
+	}, consumption)
+
+	consumption, err = limiter.Consumption("bot", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitConsumption{BotTokensToday: 50}, consumption)
+}
+
+func TestRateLimiterConcurrentRequests(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	limiter := newTestRateLimiter(&now)
+	limits := llm.RateLimitConfig{UserRequestsPerMinute: 3}
+
+	var admitted atomic.Int64
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.Check("bot", limits, "user1", "") == nil {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(3), admitted.Load(), "requests made at the same time are admitted up to the limit")
+}
+
+type recordingUsageSink struct {
+	records []llm.UsageRecord
+}
+
+func (s *recordingUsageSink) RecordUsage(record llm.UsageRecord) {
+	s.records = append(s.records, record)
+}
+
+type fakeImageGenerator struct {
+	usage *llm.TokenUsage
+}
+
+func (f fakeImageGenerator) GenerateImage(ctx context.Context, request llm.ImageRequest) (*llm.GeneratedImage, error) {
+	return &llm.GeneratedImage{Data: []byte("png"), Model: "dall-e-3", Usage: f.usage}, nil
+}
+
+func TestImageUsageRecorder(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	limiter := newTestRateLimiter(&now)
+	sink := &recordingUsageSink{}
+	llmContext := llm.NewContext()
+	llmContext.RequestingUser = &model.User{Id: "user1"}
+	llmContext.Channel = &model.Channel{Id: "channel1", TeamId: "team1"}
+	request := llm.ImageRequest{Prompt: "a red fox in the snow", Context: llmContext}
+
+	recorder := &imageUsageRecorder{
+		wrapped: fakeImageGenerator{usage: &llm.TokenUsage{InputTokens: 10, OutputTokens: 1000, Model: "gpt-image-1"}},
+		sink:    &rateLimitUsageSink{limiter: limiter, next: sink},
+		botID:   "bot",
+	}
+	_, err := recorder.GenerateImage(context.Background(), request)
+	require.NoError(t, err)
+
+	// Models that don't report usage have the prompt recorded.
+	recorder.wrapped = fakeImageGenerator{}
+	_, err = recorder.GenerateImage(context.Background(), request)
+	require.NoError(t, err)
+
+	require.Len(t, sink.records, 2)
+	assert.Equal(t, llm.FeatureImageGeneration, sink.records[0].Feature)
+	assert.Equal(t, "user1", sink.records[0].UserID)
+	assert.Equal(t, "team1", sink.records[0].TeamID)
+	assert.Equal(t, llm.TokenUsage{InputTokens: 10, OutputTokens: 1000, Model: "gpt-image-1"}, sink.records[0].Usage)
+	assert.Equal(t, "dall-e-3", sink.records[1].Model)
+	assert.Positive(t, sink.records[1].Usage.InputTokens)
+	assert.Zero(t, sink.records[1].Usage.OutputTokens)
+
+	consumption, err := limiter.Consumption("bot", "user1", "team1")
+	require.NoError(t, err)
+	assert.Equal(t, 1010+sink.records[1].Usage.InputTokens, consumption.UserTokensToday, "images count towards the token limits")
+}
@@ -1 +1,23 @@
 # Include custom targets and environment variables here
+
+# Tokenizer vocabularies are bundled so token counting never needs network access at runtime.
+# For offline builds, point TOKENIZER_VOCABULARIES_URL at a local mirror, e.g. file:///srv/mirror/encodings.
+TOKENIZER_VOCABULARIES_URL ?= https://openaipublic.blob.core.windows.net/encodings
+TOKENIZER_VOCABULARIES = cl100k_base o200k_base
+# Checksums of the vocabularies, also checked by the plugin before using them.
+TOKENIZER_VOCABULARIES_CHECKSUMS = $(CURDIR)/llm/tokenizer_vocabularies.sha256
+SHA256SUM ?= $(shell command -v sha256sum || echo shasum -a 256)
+
+## Downloads the BPE vocabularies used for token counting into the assets directory and verifies their checksums.
+.PHONY: tokenizer-vocabularies
+tokenizer-vocabularies:
+	mkdir -p $(ASSETS_DIR)/tokenizers
+	@for name in $(TOKENIZER_VOCABULARIES); do \
+		if [ ! -f $(ASSETS_DIR)/tokenizers/$$name.tiktoken ]; then \
+			echo "Downloading $$name.tiktoken"; \
+			curl -sSfL -o $(ASSETS_DIR)/tokenizers/$$name.tiktoken $(TOKENIZER_VOCABULARIES_URL)/$$name.tiktoken || exit 1; \
+		fi; \
+	done
+	cd $(ASSETS_DIR)/tokenizers && $(SHA256SUM) -c $(TOKENIZER_VOCABULARIES_CHECKSUMS)
+
+bundle: tokenizer-vocabularies
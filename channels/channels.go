@@ -4,6 +4,7 @@
 package channels
 
 import (
+	"context"
 	"slices"
 
 	"github.com/mattermost/mattermost-plugin-ai/format"
@@ -35,6 +36,7 @@ func New(
 }
 
 func (c *Channels) Interval(
+	ctx context.Context,
 	context *llm.Context,
 	channelID string,
 	startTime int64,
@@ -89,9 +91,10 @@ func (c *Channels) Interval(
 			},
 		},
 		Context: context,
+		Feature: llm.FeatureChannelSummary,
 	}
 
-	resultStream, err := c.llm.ChatCompletion(completionRequest)
+	resultStream, err := c.llm.ChatCompletion(ctx, completionRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -24,6 +24,8 @@ type Config struct {
 	AllowedUpstreamHostnames string                           `json:"allowedUpstreamHostnames"`
 	EmbeddingSearchConfig    embeddings.EmbeddingSearchConfig `json:"embeddingSearchConfig"`
 	MCP                      mcp.Config                       `json:"mcp"`
+	// ModelCapabilities override what is known about the capabilities of models.
+	ModelCapabilities []llm.ModelCapabilitiesOverride `json:"modelCapabilities"`
 }
 
 func (c *Config) Clone() *Config {
@@ -64,6 +66,10 @@ func (c *Container) GetDefaultBotName() string {
 	return c.cfg.Load().DefaultBotName
 }
 
+func (c *Container) GetModelCapabilities() []llm.ModelCapabilitiesOverride {
+	return c.cfg.Load().ModelCapabilities
+}
+
 func (c *Container) EnableLLMLogging() bool {
 	return c.cfg.Load().EnableLLMTrace
 }
@@ -130,5 +136,6 @@ func OpenAIConfigFromServiceConfig(serviceConfig llm.ServiceConfig) openai.Confi
 		StreamingTimeout: streamingTimeout,
 		SendUserID:       serviceConfig.SendUserID,
 		CustomHeaders:    serviceConfig.CustomHeaders,
+		StreamUsage:      serviceConfig.StreamUsage,
 	}
 }
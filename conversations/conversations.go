@@ -4,6 +4,7 @@
 package conversations
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -53,7 +54,7 @@ type Conversations struct {
 // MeetingsService defines the interface for meetings functionality needed by conversations
 type MeetingsService interface {
 	GetCaptionsFileIDFromProps(post *model.Post) (fileID string, err error)
-	SummarizeTranscription(bot *bots.Bot, transcription *subtitles.Subtitles, context *llm.Context) (*llm.TextStreamResult, error)
+	SummarizeTranscription(ctx context.Context, bot *bots.Bot, transcription *subtitles.Subtitles, context *llm.Context) (*llm.TextStreamResult, error)
 }
 
 func New(
@@ -86,7 +87,7 @@ func (c *Conversations) SetMeetingsService(meetingsService MeetingsService) {
 }
 
 // ProcessUserRequestWithContext is an internal helper that uses an existing context to process a message
-func (c *Conversations) ProcessUserRequestWithContext(bot *bots.Bot, postingUser *model.User, channel *model.Channel, post *model.Post, context *llm.Context) (*llm.TextStreamResult, error) {
+func (c *Conversations) ProcessUserRequestWithContext(ctx context.Context, bot *bots.Bot, postingUser *model.User, channel *model.Channel, post *model.Post, context *llm.Context) (*llm.TextStreamResult, error) {
 	var posts []llm.Post
 	if post.RootId == "" {
 		// A new conversation
@@ -117,18 +118,25 @@ func (c *Conversations) ProcessUserRequestWithContext(bot *bots.Bot, postingUser
 
 	posts = append(posts, c.PostToAIPost(bot, post))
 
+	conversationID := post.RootId
+	if conversationID == "" {
+		conversationID = post.Id
+	}
+
 	completionRequest := llm.CompletionRequest{
-		Posts:   posts,
-		Context: context,
+		Posts:          posts,
+		Context:        context,
+		Feature:        llm.FeatureConversation,
+		ConversationID: conversationID,
 	}
-	result, err := bot.LLM().ChatCompletion(completionRequest)
+	result, err := bot.LLM().ChatCompletion(ctx, completionRequest)
 	if err != nil {
 		return nil, err
 	}
 
 	go func() {
 		request := "Write a short title for the following request. Include only the title and nothing else, no quotations. Request:\n" + post.Message
-		if err := c.GenerateTitle(bot, request, post.Id, context); err != nil {
+		if err := c.GenerateTitle(ctx, bot, request, post.Id, context); err != nil {
 			c.mmClient.LogError("Failed to generate title", "error", err.Error())
 			return
 		}
@@ -138,7 +146,7 @@ func (c *Conversations) ProcessUserRequestWithContext(bot *bots.Bot, postingUser
 }
 
 // ProcessUserRequest processes a user request to a bot
-func (c *Conversations) ProcessUserRequest(bot *bots.Bot, postingUser *model.User, channel *model.Channel, post *model.Post) (*llm.TextStreamResult, error) {
+func (c *Conversations) ProcessUserRequest(ctx context.Context, bot *bots.Bot, postingUser *model.User, channel *model.Channel, post *model.Post) (*llm.TextStreamResult, error) {
 	// Create a context with default tools
 	context := c.contextBuilder.BuildLLMContextUserRequest(
 		bot,
@@ -155,16 +163,22 @@ func (c *Conversations) ProcessUserRequest(bot *bots.Bot, postingUser *model.Use
 		}
 	}
 
-	return c.ProcessUserRequestWithContext(bot, postingUser, channel, post, context)
+	return c.ProcessUserRequestWithContext(ctx, bot, postingUser, channel, post, context)
 }
 
-func (c *Conversations) GenerateTitle(bot *bots.Bot, request string, postID string, context *llm.Context) error {
+func (c *Conversations) GenerateTitle(ctx context.Context, bot *bots.Bot, request string, postID string, context *llm.Context) error {
 	titleRequest := llm.CompletionRequest{
 		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: request}},
 		Context: context,
+		Feature: llm.FeatureTitle,
 	}
 
-	conversationTitle, err := bot.LLM().ChatCompletionNoStream(titleRequest, llm.WithMaxGeneratedTokens(25))
+	// Titles should stay close to the request whatever sampling the bot uses for conversations.
+	conversationTitle, err := bot.LLM().ChatCompletionNoStream(ctx, titleRequest,
+		llm.WithMaxGeneratedTokens(25),
+		llm.WithTemperature(0.2),
+		llm.WithStopSequences(nil),
+	)
 	if err != nil {
 		return fmt.Errorf("failed to get title: %w", err)
 	}
@@ -281,6 +295,11 @@ func isImageMimeType(mimeType string) bool {
 	return strings.HasPrefix(mimeType, "image/")
 }
 
+// isDocumentMimeType reports whether files of the MIME type are sent as documents, to the providers that read them natively.
+func isDocumentMimeType(mimeType string) bool {
+	return mimeType == "application/pdf"
+}
+
 func (c *Conversations) PostToAIPost(bot *bots.Bot, post *model.Post) llm.Post {
 	var filesForUpstream []llm.File
 	message := format.PostBody(post)
@@ -319,6 +338,27 @@ func (c *Conversations) PostToAIPost(bot *bots.Bot, post *model.Post) llm.Post {
 			}
 		}
 
+		if isDocumentMimeType(fileInfo.MimeType) {
+			document := llm.File{
+				Kind:     llm.FileKindDocument,
+				Name:     fileInfo.Name,
+				MimeType: fileInfo.MimeType,
+				Size:     fileInfo.Size,
+				Text:     content,
+			}
+			// Larger documents, and documents for models that can't read them, are only given as their extracted text.
+			if fileInfo.Size <= maxFileSize && bot.ReadsDocuments() {
+				file, err := c.mmClient.GetFile(fileID)
+				if err != nil {
+					c.mmClient.LogError("Error getting file", "error", err)
+				} else {
+					document.Reader = file
+				}
+			}
+			filesForUpstream = append(filesForUpstream, document)
+			continue
+		}
+
 		if content != "" {
 			fileContent := fmt.Sprintf("File Name: %s\nContent: %s", fileInfo.Name, content)
 			extractedFileContents = append(extractedFileContents, fileContent)
@@ -331,6 +371,8 @@ func (c *Conversations) PostToAIPost(bot *bots.Bot, post *model.Post) llm.Post {
 				continue
 			}
 			filesForUpstream = append(filesForUpstream, llm.File{
+				Kind:     llm.FileKindImage,
+				Name:     fileInfo.Name,
 				Reader:   file,
 				MimeType: fileInfo.MimeType,
 				Size:     fileInfo.Size,
@@ -361,11 +403,19 @@ func (c *Conversations) PostToAIPost(bot *bots.Bot, post *model.Post) llm.Post {
 		}
 	}
 
+	var reasoning []llm.ReasoningBlock
+	if reasoningBlocks, ok := post.GetProp(streaming.ReasoningBlocksProp).(string); ok {
+		if err := json.Unmarshal([]byte(reasoningBlocks), &reasoning); err != nil {
+			c.mmClient.LogError("Error unmarshalling reasoning blocks", "error", err)
+		}
+	}
+
 	return llm.Post{
-		Role:    role,
-		Message: message,
-		Files:   filesForUpstream,
-		ToolUse: tools,
+		Role:      role,
+		Message:   message,
+		Files:     filesForUpstream,
+		ToolUse:   tools,
+		Reasoning: reasoning,
 	}
 }
 
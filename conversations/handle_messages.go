@@ -9,8 +9,8 @@ import (
 	"fmt"
 
 	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/i18n"
 	"github.com/mattermost/mattermost/server/public/model"
-	"github.com/mattermost/mattermost/server/public/plugin"
 )
 
 const (
@@ -26,8 +26,9 @@ var (
 	ErrNoResponse = errors.New("no response")
 )
 
-func (c *Conversations) MessageHasBeenPosted(ctx *plugin.Context, post *model.Post) {
-	if err := c.handleMessages(post); err != nil {
+// MessageHasBeenPosted responds to mentions and bot DMs. ctx bounds the lifetime of any resulting LLM request.
+func (c *Conversations) MessageHasBeenPosted(ctx context.Context, post *model.Post) {
+	if err := c.handleMessages(ctx, post); err != nil {
 		if errors.Is(err, ErrNoResponse) {
 			c.mmClient.LogDebug(err.Error())
 		} else {
@@ -36,7 +37,7 @@ func (c *Conversations) MessageHasBeenPosted(ctx *plugin.Context, post *model.Po
 	}
 }
 
-func (c *Conversations) handleMessages(post *model.Post) error {
+func (c *Conversations) handleMessages(ctx context.Context, post *model.Post) error {
 	// Don't respond to ourselves
 	if c.bots.IsAnyBot(post.UserId) {
 		return fmt.Errorf("not responding to ourselves: %w", ErrNoResponse)
@@ -79,23 +80,27 @@ func (c *Conversations) handleMessages(post *model.Post) error {
 
 	// Check we are mentioned like @ai
 	if bot := c.bots.GetBotMentioned(post.Message); bot != nil {
-		return c.handleMentions(bot, post, postingUser, channel)
+		return c.handleMentions(ctx, bot, post, postingUser, channel)
 	}
 
 	// Check if this is post in the DM channel with any bot
 	if bot := c.bots.GetBotForDMChannel(channel); bot != nil {
-		return c.handleDMs(bot, channel, postingUser, post)
+		return c.handleDMs(ctx, bot, channel, postingUser, post)
 	}
 
 	return nil
 }
 
-func (c *Conversations) handleMentions(bot *bots.Bot, post *model.Post, postingUser *model.User, channel *model.Channel) error {
+func (c *Conversations) handleMentions(ctx context.Context, bot *bots.Bot, post *model.Post, postingUser *model.User, channel *model.Channel) error {
 	if err := c.bots.CheckUsageRestrictions(postingUser.Id, bot, channel); err != nil {
 		return err
 	}
 
-	stream, err := c.ProcessUserRequest(bot, postingUser, channel, post)
+	if err := c.checkRateLimits(bot, postingUser, channel, post); err != nil {
+		return err
+	}
+
+	stream, err := c.ProcessUserRequest(ctx, bot, postingUser, channel, post)
 	if err != nil {
 		return fmt.Errorf("unable to process bot mention: %w", err)
 	}
@@ -109,19 +114,23 @@ func (c *Conversations) handleMentions(bot *bots.Bot, post *model.Post, postingU
 		ChannelId: channel.Id,
 		RootId:    responseRootID,
 	}
-	if err := c.streamingService.StreamToNewPost(context.Background(), bot.GetMMBot().UserId, postingUser.Id, stream, responsePost, post.Id); err != nil {
+	if err := c.streamingService.StreamToNewPost(ctx, bot.GetMMBot().UserId, postingUser.Id, stream, responsePost, post.Id); err != nil {
 		return fmt.Errorf("unable to stream response: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Conversations) handleDMs(bot *bots.Bot, channel *model.Channel, postingUser *model.User, post *model.Post) error {
+func (c *Conversations) handleDMs(ctx context.Context, bot *bots.Bot, channel *model.Channel, postingUser *model.User, post *model.Post) error {
 	if err := c.bots.CheckUsageRestrictionsForUser(bot, postingUser.Id); err != nil {
 		return err
 	}
 
-	stream, err := c.ProcessUserRequest(bot, postingUser, channel, post)
+	if err := c.checkRateLimits(bot, postingUser, channel, post); err != nil {
+		return err
+	}
+
+	stream, err := c.ProcessUserRequest(ctx, bot, postingUser, channel, post)
 	if err != nil {
 		return fmt.Errorf("unable to process bot mention: %w", err)
 	}
@@ -135,9 +144,33 @@ func (c *Conversations) handleDMs(bot *bots.Bot, channel *model.Channel, posting
 		ChannelId: channel.Id,
 		RootId:    responseRootID,
 	}
-	if err := c.streamingService.StreamToNewPost(context.Background(), bot.GetMMBot().UserId, postingUser.Id, stream, responsePost, post.Id); err != nil {
+	if err := c.streamingService.StreamToNewPost(ctx, bot.GetMMBot().UserId, postingUser.Id, stream, responsePost, post.Id); err != nil {
 		return fmt.Errorf("unable to stream response: %w", err)
 	}
 
 	return nil
 }
+
+// checkRateLimits lets the user know in the thread when they have reached one of the bot's rate limits.
+func (c *Conversations) checkRateLimits(bot *bots.Bot, postingUser *model.User, channel *model.Channel, post *model.Post) error {
+	err := c.bots.CheckRateLimits(bot, postingUser.Id, channel.TeamId)
+	var rateLimitErr *bots.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		return err
+	}
+
+	responseRootID := post.Id
+	if post.RootId != "" {
+		responseRootID = post.RootId
+	}
+	responsePost := &model.Post{
+		ChannelId: channel.Id,
+		RootId:    responseRootID,
+		Message:   i18n.FormatRateLimitMessage(c.i18n, postingUser.Locale, rateLimitErr.Scope),
+	}
+	if createErr := c.BotCreateNonResponsePost(bot.GetMMBot().UserId, postingUser.Id, responsePost); createErr != nil {
+		return fmt.Errorf("unable to reply to rate limited user: %w", createErr)
+	}
+
+	return fmt.Errorf("user reached %s rate limit: %w", rateLimitErr.Scope, ErrNoResponse)
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package conversations
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost-plugin-ai/mmapi/mocks"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostToAIPostDocuments(t *testing.T) {
+	client := mocks.NewMockClient(t)
+	c := &Conversations{mmClient: client, bots: &bots.MMBots{}}
+	bot := bots.NewBot(llm.BotConfig{Service: llm.ServiceConfig{Type: llm.ServiceTypeOpenAICompatible}}, &model.Bot{UserId: "bot1"})
+
+	client.On("GetFileInfo", "pdf1").Return(&model.FileInfo{Id: "pdf1", Name: "report.pdf", MimeType: "application/pdf", Size: 1024, Content: "report text"}, nil)
+
+	// The mock fails the test if the PDF is downloaded for a model that only reads its extracted text.
+	post := c.PostToAIPost(bot, &model.Post{UserId: "user1", Message: "Summarize", FileIds: []string{"pdf1"}})
+
+	require.Len(t, post.Files, 1)
+	assert.Equal(t, llm.FileKindDocument, post.Files[0].Kind)
+	assert.Equal(t, "report text", post.Files[0].Text)
+	assert.Nil(t, post.Files[0].Reader)
+}
@@ -23,7 +23,7 @@ const (
 )
 
 // HandleRegenerate handles post regeneration requests
-func (c *Conversations) HandleRegenerate(userID string, post *model.Post, channel *model.Channel) error {
+func (c *Conversations) HandleRegenerate(ctx context.Context, userID string, post *model.Post, channel *model.Channel) error {
 	bot := c.bots.GetBotByID(post.UserId)
 	if bot == nil {
 		return fmt.Errorf("unable to get bot")
@@ -42,7 +42,11 @@ func (c *Conversations) HandleRegenerate(userID string, post *model.Post, channe
 		return fmt.Errorf("unable to get user to regen post: %w", err)
 	}
 
-	ctx, err := c.streamingService.GetStreamingContext(context.Background(), post.Id)
+	if err = c.bots.CheckRateLimits(bot, userID, channel.TeamId); err != nil {
+		return err
+	}
+
+	ctx, err = c.streamingService.GetStreamingContext(ctx, post.Id)
 	if err != nil {
 		return fmt.Errorf("unable to get post streaming context: %w", err)
 	}
@@ -53,6 +57,8 @@ func (c *Conversations) HandleRegenerate(userID string, post *model.Post, channe
 	referenceRecordingFileIDProp := post.GetProp(ReferencedRecordingFileID)
 	referencedTranscriptPostProp := post.GetProp(ReferencedTranscriptPostID)
 	post.DelProp(streaming.ToolCallProp)
+	post.DelProp(streaming.ReasoningProp)
+	post.DelProp(streaming.ReasoningBlocksProp)
 	var result *llm.TextStreamResult
 	switch {
 	case threadIDProp != nil:
@@ -80,11 +86,11 @@ func (c *Conversations) HandleRegenerate(userID string, post *model.Post, channe
 		analyzer := threads.New(bot.LLM(), c.prompts, c.mmClient)
 		switch analysisType {
 		case "summarize_thread":
-			result, err = analyzer.Summarize(threadID, llmContext)
+			result, err = analyzer.Summarize(ctx, threadID, llmContext)
 		case "action_items":
-			result, err = analyzer.FindActionItems(threadID, llmContext)
+			result, err = analyzer.FindActionItems(ctx, threadID, llmContext)
 		case "open_questions":
-			result, err = analyzer.FindOpenQuestions(threadID, llmContext)
+			result, err = analyzer.FindOpenQuestions(ctx, threadID, llmContext)
 		default:
 			return fmt.Errorf("invalid analysis type: %s", analysisType)
 		}
@@ -126,7 +132,7 @@ func (c *Conversations) HandleRegenerate(userID string, post *model.Post, channe
 			c.contextBuilder.WithLLMContextDefaultTools(bot, originalFileChannel.Type == model.ChannelTypeDirect),
 		)
 		var summaryErr error
-		result, summaryErr = c.meetingsService.SummarizeTranscription(bot, transcription, context)
+		result, summaryErr = c.meetingsService.SummarizeTranscription(ctx, bot, transcription, context)
 		if summaryErr != nil {
 			return fmt.Errorf("could not summarize transcription on regen: %w", summaryErr)
 		}
@@ -159,7 +165,7 @@ func (c *Conversations) HandleRegenerate(userID string, post *model.Post, channe
 			c.contextBuilder.WithLLMContextDefaultTools(bot, mmapi.IsDMWith(bot.GetMMBot().UserId, channel)),
 		)
 		var summaryErr error
-		result, summaryErr = c.meetingsService.SummarizeTranscription(bot, transcription, context)
+		result, summaryErr = c.meetingsService.SummarizeTranscription(ctx, bot, transcription, context)
 		if summaryErr != nil {
 			return fmt.Errorf("unable to summarize transcription: %w", summaryErr)
 		}
@@ -186,7 +192,7 @@ func (c *Conversations) HandleRegenerate(userID string, post *model.Post, channe
 
 		// Process the user request with the context that has the callback
 		var processErr error
-		result, processErr = c.ProcessUserRequestWithContext(bot, user, channel, respondingToPost, contextWithCallback)
+		result, processErr = c.ProcessUserRequestWithContext(ctx, bot, user, channel, respondingToPost, contextWithCallback)
 		if processErr != nil {
 			return fmt.Errorf("could not continue conversation on regen: %w", processErr)
 		}
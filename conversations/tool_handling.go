@@ -17,7 +17,7 @@ import (
 )
 
 // HandleToolCall handles tool call approval/rejection
-func (c *Conversations) HandleToolCall(userID string, post *model.Post, channel *model.Channel, acceptedToolIDs []string) error {
+func (c *Conversations) HandleToolCall(ctx context.Context, userID string, post *model.Post, channel *model.Channel, acceptedToolIDs []string) error {
 	bot := c.bots.GetBotByID(post.UserId)
 	if bot == nil {
 		return fmt.Errorf("unable to get bot")
@@ -28,6 +28,10 @@ func (c *Conversations) HandleToolCall(userID string, post *model.Post, channel
 		return err
 	}
 
+	if err = c.bots.CheckRateLimits(bot, userID, channel.TeamId); err != nil {
+		return err
+	}
+
 	toolsJSON := post.GetProp(streaming.ToolCallProp)
 	if toolsJSON == nil {
 		return errors.New("post missing pending tool calls")
@@ -101,10 +105,12 @@ func (c *Conversations) HandleToolCall(userID string, post *model.Post, channel
 	}
 
 	completionRequest := llm.CompletionRequest{
-		Posts:   posts,
-		Context: llmContext,
+		Posts:          posts,
+		Context:        llmContext,
+		Feature:        llm.FeatureConversation,
+		ConversationID: responseRootID,
 	}
-	result, err := bot.LLM().ChatCompletion(completionRequest)
+	result, err := bot.LLM().ChatCompletion(ctx, completionRequest)
 	if err != nil {
 		return fmt.Errorf("failed to get chat completion: %w", err)
 	}
@@ -112,8 +118,10 @@ func (c *Conversations) HandleToolCall(userID string, post *model.Post, channel
 	responsePost := &model.Post{
 		ChannelId: channel.Id,
 		RootId:    responseRootID,
+		// Files uploaded by the tools, such as generated images
+		FileIds: llmContext.FileIDs,
 	}
-	if err := c.streamingService.StreamToNewPost(context.Background(), bot.GetMMBot().UserId, user.Id, result, responsePost, post.Id); err != nil {
+	if err := c.streamingService.StreamToNewPost(ctx, bot.GetMMBot().UserId, user.Id, result, responsePost, post.Id); err != nil {
 		return fmt.Errorf("failed to stream result to new post: %w", err)
 	}
 
@@ -0,0 +1,130 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package conversations
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost-plugin-ai/streaming"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	voiceReplySettingsKeyPrefix = "voice_reply_settings_"
+	// VoiceReplyFileIDProp holds the ID of the audio file attached to a post, replaced when the post is regenerated.
+	VoiceReplyFileIDProp = "voice_reply_file_id"
+	VoiceReplyFileName   = "voice_reply.mp3"
+)
+
+// VoiceReplySettings are chosen by each user, bots only reply with voice to users who opted in.
+type VoiceReplySettings struct {
+	Enabled bool `json:"enabled"`
+	// Voice overrides the voice configured for the bot when set.
+	Voice string `json:"voice"`
+}
+
+// GetVoiceReplySettings returns the voice reply settings of the user, disabled if never saved.
+func (c *Conversations) GetVoiceReplySettings(userID string) (VoiceReplySettings, error) {
+	var settings VoiceReplySettings
+	if err := c.mmClient.KVGet(voiceReplySettingsKeyPrefix+userID, &settings); err != nil {
+		return VoiceReplySettings{}, fmt.Errorf("failed to get voice reply settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SaveVoiceReplySettings saves the voice reply settings of the user.
+func (c *Conversations) SaveVoiceReplySettings(userID string, settings VoiceReplySettings) error {
+	if err := c.mmClient.KVSet(voiceReplySettingsKeyPrefix+userID, settings); err != nil {
+		return fmt.Errorf("failed to save voice reply settings: %w", err)
+	}
+	return nil
+}
+
+// HandleVoiceReply attaches a spoken version of a bot's answer to its post when the user it answered opted in.
+// It is called by the streaming service once the answer is complete.
+func (c *Conversations) HandleVoiceReply(ctx context.Context, post *model.Post) {
+	bot := c.bots.GetBotByID(post.UserId)
+	if bot == nil || !bot.GetConfig().TextToSpeech.Enabled {
+		return
+	}
+
+	requesterID, _ := post.GetProp(streaming.LLMRequesterUserID).(string)
+	if requesterID == "" {
+		return
+	}
+	settings, err := c.GetVoiceReplySettings(requesterID)
+	if err != nil {
+		c.mmClient.LogError("Failed to get voice reply settings", "error", err)
+		return
+	}
+	if !settings.Enabled {
+		return
+	}
+
+	synthesizer := c.bots.GetSynthesizer(bot)
+	if synthesizer == nil {
+		return
+	}
+
+	ttsConfig := bot.GetConfig().TextToSpeech
+	voice := ttsConfig.Voice
+	if settings.Voice != "" {
+		voice = settings.Voice
+	}
+	if err := c.attachVoiceReply(ctx, synthesizer, llm.SpeechRequest{Model: ttsConfig.Model, Voice: voice}, post); err != nil {
+		c.mmClient.LogError("Failed to attach voice reply", "error", err, "post_id", post.Id)
+	}
+}
+
+// attachVoiceReply synthesizes the message of the post and attaches the audio to it, replacing the audio of
+// a previous generation of the post.
+func (c *Conversations) attachVoiceReply(ctx context.Context, synthesizer bots.Synthesizer, request llm.SpeechRequest, post *model.Post) error {
+	text := []rune(post.Message)
+	if len(text) > llm.MaxSpeechInputLength {
+		text = text[:llm.MaxSpeechInputLength]
+	}
+	request.Text = string(text)
+
+	audio, err := synthesizer.Synthesize(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := c.mmClient.UploadFile(audio, post.ChannelId, VoiceReplyFileName)
+	if err != nil {
+		return fmt.Errorf("failed to upload voice reply: %w", err)
+	}
+
+	// Files uploaded by plugins are not attached to any post, they only show with the post once linked to it.
+	if c.db != nil {
+		if _, err := c.db.ExecBuilder(c.db.Builder().
+			Update("FileInfo").
+			Set("PostId", post.Id).
+			Set("ChannelId", post.ChannelId).
+			Where(sq.And{
+				sq.Eq{"Id": fileInfo.Id},
+				sq.Eq{"PostId": ""},
+			})); err != nil {
+			return fmt.Errorf("unable to update file info: %w", err)
+		}
+	}
+
+	if previousFileID, ok := post.GetProp(VoiceReplyFileIDProp).(string); ok {
+		post.FileIds = slices.DeleteFunc(slices.Clone(post.FileIds), func(fileID string) bool {
+			return fileID == previousFileID
+		})
+	}
+	post.FileIds = append(post.FileIds, fileInfo.Id)
+	post.AddProp(VoiceReplyFileIDProp, fileInfo.Id)
+	if err := c.mmClient.UpdatePost(post); err != nil {
+		return fmt.Errorf("failed to update post with voice reply: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package conversations
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost-plugin-ai/mmapi/mocks"
+	"github.com/mattermost/mattermost-plugin-ai/streaming"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSynthesizer struct {
+	requests []llm.SpeechRequest
+}
+
+func (f *fakeSynthesizer) Synthesize(ctx context.Context, request llm.SpeechRequest) ([]byte, error) {
+	f.requests = append(f.requests, request)
+	return []byte("mp3"), nil
+}
+
+func TestVoiceReplySettings(t *testing.T) {
+	client := mocks.NewMockClient(t)
+	c := &Conversations{mmClient: client}
+
+	client.On("KVGet", "voice_reply_settings_user1", mock.AnythingOfType("*conversations.VoiceReplySettings")).Run(func(args mock.Arguments) {
+		*args.Get(1).(*VoiceReplySettings) = VoiceReplySettings{Enabled: true, Voice: "nova"}
+	}).Return(nil)
+	settings, err := c.GetVoiceReplySettings("user1")
+	require.NoError(t, err)
+	assert.Equal(t, VoiceReplySettings{Enabled: true, Voice: "nova"}, settings)
+
+	client.On("KVSet", "voice_reply_settings_user1", VoiceReplySettings{Voice: "echo"}).Return(nil)
+	require.NoError(t, c.SaveVoiceReplySettings("user1", VoiceReplySettings{Voice: "echo"}))
+}
+
+func TestAttachVoiceReply(t *testing.T) {
+	t.Run("attaches the audio to the post", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		c := &Conversations{mmClient: client}
+		synthesizer := &fakeSynthesizer{}
+		post := &model.Post{Id: "post1", ChannelId: "channel1", Message: "The answer is 42.", FileIds: []string{"image1"}}
+
+		client.On("UploadFile", []byte("mp3"), "channel1", VoiceReplyFileName).Return(&model.FileInfo{Id: "audio1"}, nil)
+		client.On("UpdatePost", post).Return(nil)
+
+		err := c.attachVoiceReply(context.Background(), synthesizer, llm.SpeechRequest{Model: "tts-1", Voice: "nova"}, post)
+		require.NoError(t, err)
+		assert.Equal(t, []llm.SpeechRequest{{Text: "The answer is 42.", Model: "tts-1", Voice: "nova"}}, synthesizer.requests)
+		assert.Equal(t, model.StringArray{"image1", "audio1"}, post.FileIds)
+		assert.Equal(t, "audio1", post.GetProp(VoiceReplyFileIDProp))
+	})
+
+	t.Run("replaces the audio of a regenerated post", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		c := &Conversations{mmClient: client}
+		post := &model.Post{Id: "post1", ChannelId: "channel1", Message: "A new answer.", FileIds: []string{"audio1"}}
+		post.AddProp(VoiceReplyFileIDProp, "audio1")
+
+		client.On("UploadFile", []byte("mp3"), "channel1", VoiceReplyFileName).Return(&model.FileInfo{Id: "audio2"}, nil)
+		client.On("UpdatePost", post).Return(nil)
+
+		require.NoError(t, c.attachVoiceReply(context.Background(), &fakeSynthesizer{}, llm.SpeechRequest{}, post))
+		assert.Equal(t, model.StringArray{"audio2"}, post.FileIds)
+		assert.Equal(t, "audio2", post.GetProp(VoiceReplyFileIDProp))
+	})
+
+	t.Run("long answers are cut", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		c := &Conversations{mmClient: client}
+		synthesizer := &fakeSynthesizer{}
+		post := &model.Post{Id: "post1", ChannelId: "channel1", Message: strings.Repeat("é", llm.MaxSpeechInputLength+10)}
+
+		client.On("UploadFile", []byte("mp3"), "channel1", VoiceReplyFileName).Return(&model.FileInfo{Id: "audio1"}, nil)
+		client.On("UpdatePost", post).Return(nil)
+
+		require.NoError(t, c.attachVoiceReply(context.Background(), synthesizer, llm.SpeechRequest{}, post))
+		require.Len(t, synthesizer.requests, 1)
+		assert.Equal(t, strings.Repeat("é", llm.MaxSpeechInputLength), synthesizer.requests[0].Text)
+	})
+}
+
+func TestHandleVoiceReply(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "bot1", ChannelId: "channel1", Message: "The answer is 42."}
+	post.AddProp(streaming.LLMRequesterUserID, "user1")
+
+	t.Run("bots without voice replies do nothing", func(t *testing.T) {
+		env := SetupTestEnvironment(t)
+		defer env.Cleanup(t)
+		env.bots.SetBotsForTesting([]*bots.Bot{bots.NewBot(llm.BotConfig{}, &model.Bot{UserId: "bot1"})})
+
+		// The mock client fails the test on any call, the settings of the user are not even read.
+		env.conversations.HandleVoiceReply(context.Background(), post)
+	})
+
+	t.Run("users who did not opt in get no voice reply", func(t *testing.T) {
+		env := SetupTestEnvironment(t)
+		defer env.Cleanup(t)
+		cfg := llm.BotConfig{TextToSpeech: llm.TextToSpeechConfig{Enabled: true, APIURL: "http://localhost"}}
+		env.bots.SetBotsForTesting([]*bots.Bot{bots.NewBot(cfg, &model.Bot{UserId: "bot1"})})
+
+		client := env.conversations.mmClient.(*mocks.MockClient)
+		client.On("KVGet", "voice_reply_settings_user1", mock.AnythingOfType("*conversations.VoiceReplySettings")).Return(nil)
+
+		env.conversations.HandleVoiceReply(context.Background(), post)
+	})
+}
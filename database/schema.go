@@ -15,6 +15,10 @@ func SetupTables(db *sqlx.DB) error {
 		return fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	if err := createLLMUsageTable(db); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+
 	if err := migrateOldTables(db); err != nil {
 		return fmt.Errorf("failed to migrate old tables: %w", err)
 	}
@@ -36,6 +40,34 @@ func createLLMPostMetaTable(db *sqlx.DB) error {
 	return nil
 }
 
+// createLLMUsageTable creates the LLM_Usage table holding one row of token usage per LLM request
+func createLLMUsageTable(db *sqlx.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS LLM_Usage (
+			ID TEXT NOT NULL PRIMARY KEY,
+			CreateAt BIGINT NOT NULL,
+			BotID TEXT NOT NULL,
+			UserID TEXT NOT NULL,
+			ChannelID TEXT NOT NULL,
+			TeamID TEXT NOT NULL,
+			Model TEXT NOT NULL,
+			Feature TEXT NOT NULL,
+			InputTokens BIGINT NOT NULL,
+			OutputTokens BIGINT NOT NULL,
+			CachedTokens BIGINT NOT NULL,
+			CacheWriteTokens BIGINT NOT NULL
+		);
+	`); err != nil {
+		return fmt.Errorf("can't create llm usage table: %w", err)
+	}
+
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_llm_usage_teamid_createat ON LLM_Usage(TeamID, CreateAt);`); err != nil {
+		return fmt.Errorf("can't create llm usage index: %w", err)
+	}
+
+	return nil
+}
+
 // migrateOldTables handles migration from older table structures
 func migrateOldTables(db *sqlx.DB) error {
 	// This fixes data retention issues when a post is deleted for an older version of the postmeta table.
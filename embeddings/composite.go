@@ -5,6 +5,7 @@ package embeddings
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/mattermost/mattermost-plugin-ai/chunking"
 )
@@ -14,6 +15,11 @@ type CompositeSearch struct {
 	store    VectorStore
 	provider EmbeddingProvider
 	options  chunking.Options
+	hybrid   HybridConfig
+	reranker Reranker
+	// candidates is how many results are retrieved for the reranker
+	candidates int
+	logger     Logger
 }
 
 // NewCompositeSearch creates a new CompositeSearch with required chunking options
@@ -30,7 +36,25 @@ func (c *CompositeSearch) SetChunkingOptions(options chunking.Options) {
 	c.options = options
 }
 
-// Store chunks documents, generates embeddings, and stores them
+// SetHybridConfig updates how keyword and vector search are combined
+func (c *CompositeSearch) SetHybridConfig(config HybridConfig) {
+	c.hybrid = config
+}
+
+// SetReranker sets the reranker reordering the results of every search, nil disabling reranking.
+// candidates is how many results are retrieved to be reranked, defaulting to a multiple of the search limit.
+func (c *CompositeSearch) SetReranker(reranker Reranker, candidates int) {
+	c.reranker = reranker
+	c.candidates = candidates
+}
+
+// SetLogger sets the logger reporting reranking failures, nil discarding them.
+func (c *CompositeSearch) SetLogger(logger Logger) {
+	c.logger = logger
+}
+
+// Store chunks documents, generates embeddings, and stores them.
+// Documents of the same post, such as its message and attachments, are stored as chunks of the post.
 func (c *CompositeSearch) Store(ctx context.Context, docs []PostDocument) error {
 	// Apply chunking to each document
 	var chunkedDocs []PostDocument
@@ -46,11 +70,15 @@ func (c *CompositeSearch) Store(ctx context.Context, docs []PostDocument) error
 			chunkedDocs = append(chunkedDocs, chunkDoc)
 		}
 	}
+	numberPostChunks(chunkedDocs)
 
-	// Extract texts for embedding
+	// Extract texts for embedding, with the context of the documents
 	texts := make([]string, len(chunkedDocs))
 	for i, doc := range chunkedDocs {
 		texts[i] = doc.Content
+		if doc.Context != "" {
+			texts[i] = doc.Context + "\n\n" + doc.Content
+		}
 	}
 
 	// Generate embeddings for all chunks
@@ -63,8 +91,121 @@ func (c *CompositeSearch) Store(ctx context.Context, docs []PostDocument) error
 	return c.store.Store(ctx, chunkedDocs, embeddings)
 }
 
-// Search performs a semantic search and merges results from chunks of the same document
+// numberPostChunks numbers the chunks of every post in order across the documents of the post
+func numberPostChunks(docs []PostDocument) {
+	totals := map[string]int{}
+	for _, doc := range docs {
+		totals[doc.PostID]++
+	}
+
+	indexes := map[string]int{}
+	for i := range docs {
+		total := totals[docs[i].PostID]
+		if total == 1 {
+			continue
+		}
+		docs[i].ChunkInfo = chunking.ChunkInfo{
+			IsChunk:     true,
+			ChunkIndex:  indexes[docs[i].PostID],
+			TotalChunks: total,
+		}
+		indexes[docs[i].PostID]++
+	}
+}
+
+// Search performs a vector, keyword or hybrid search depending on the mode of the options, reranks the results
+// when a reranker is set and merges results from chunks of the same post, keeping the best scoring one
 func (c *CompositeSearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	candidateOpts := opts
+	candidateOpts.Limit = c.candidateLimit(opts.Limit)
+	results, err := c.retrieve(ctx, query, candidateOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.reranker != nil && len(results) > 0 {
+		// Reranking only improves the order, the results are kept in retrieval order when it fails.
+		reranked, rerankErr := c.reranker.Rerank(ctx, query, results, candidateOpts)
+		switch {
+		case rerankErr == nil:
+			results = reranked
+		case c.logger != nil:
+			c.logger.LogWarn("Failed to rerank search results, keeping the retrieval order", "error", rerankErr)
+		}
+	}
+
+	results = mergeChunks(results)
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// candidateLimit returns how many results to retrieve for a search returning at most limit posts
+func (c *CompositeSearch) candidateLimit(limit int) int {
+	if c.reranker != nil {
+		return rerankCandidates(c.candidates, limit)
+	}
+	return limit * mergeCandidatesFactor
+}
+
+// GetChunks returns the documents stored for a post ordered by chunk index
+func (c *CompositeSearch) GetChunks(ctx context.Context, postID string) ([]PostDocument, error) {
+	getter, ok := c.store.(ChunkGetter)
+	if !ok {
+		return nil, fmt.Errorf("the vector store does not support getting the chunks of a post")
+	}
+	return getter.GetChunks(ctx, postID)
+}
+
+// retrieve performs a vector, keyword or hybrid search depending on the mode of the options
+func (c *CompositeSearch) retrieve(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	mode := opts.Mode
+	if mode == "" {
+		mode = SearchModeVector
+		if c.hybrid.Enabled {
+			mode = SearchModeHybrid
+		}
+	}
+
+	if mode == SearchModeVector {
+		return c.vectorSearch(ctx, query, opts)
+	}
+
+	lexical, ok := c.store.(LexicalSearcher)
+	if !ok {
+		return nil, fmt.Errorf("the vector store does not support %s search", mode)
+	}
+
+	switch mode {
+	case SearchModeKeyword:
+		return lexical.SearchText(ctx, query, opts)
+	case SearchModeHybrid:
+		candidateOpts := opts
+		if opts.Limit > 0 {
+			candidateOpts.Limit = opts.Limit * hybridCandidatesFactor
+		}
+
+		vectorResults, err := c.vectorSearch(ctx, query, candidateOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		// Keyword scores are not comparable to similarities, so the minimum score only filters vector results.
+		candidateOpts.MinScore = 0
+		lexicalResults, err := lexical.SearchText(ctx, query, candidateOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		return fuseResults(c.hybrid, opts.Limit, vectorResults, lexicalResults), nil
+	}
+
+	return nil, fmt.Errorf("unsupported search mode: %s", mode)
+}
+
+// vectorSearch finds the chunks closest in meaning to the query
+func (c *CompositeSearch) vectorSearch(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
 	// Generate embedding for the query
 	embedding, err := c.provider.CreateEmbedding(ctx, query)
 	if err != nil {
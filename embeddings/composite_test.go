@@ -0,0 +1,355 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/chunking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct{}
+
+func (fakeProvider) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0}, nil
+}
+
+func (fakeProvider) BatchCreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i := range texts {
+		embeddings[i] = []float32{1, 0}
+	}
+	return embeddings, nil
+}
+
+func (fakeProvider) Dimensions() int {
+	return 2
+}
+
+// recordingProvider records the texts it creates embeddings for.
+type recordingProvider struct {
+	fakeProvider
+	texts []string
+}
+
+func (r *recordingProvider) BatchCreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	r.texts = append(r.texts, texts...)
+	return r.fakeProvider.BatchCreateEmbeddings(ctx, texts)
+}
+
+// fakeStore returns fixed vector and keyword results, recording the options it was searched with
+// and the documents stored.
+type fakeStore struct {
+	stored         []PostDocument
+	vectorResults  []SearchResult
+	lexicalResults []SearchResult
+	vectorOpts     []SearchOptions
+	lexicalOpts    []SearchOptions
+}
+
+func (f *fakeStore) Store(ctx context.Context, docs []PostDocument, embeddings [][]float32) error {
+	f.stored = append(f.stored, docs...)
+	return nil
+}
+
+func (f *fakeStore) Search(ctx context.Context, embedding []float32, opts SearchOptions) ([]SearchResult, error) {
+	f.vectorOpts = append(f.vectorOpts, opts)
+	return f.vectorResults, nil
+}
+
+func (f *fakeStore) SearchText(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	f.lexicalOpts = append(f.lexicalOpts, opts)
+	return f.lexicalResults, nil
+}
+
+func (f *fakeStore) Delete(ctx context.Context, postIDs []string) error {
+	return nil
+}
+
+func (f *fakeStore) Clear(ctx context.Context) error {
+	return nil
+}
+
+// vectorOnlyStore hides the text search of the fake store.
+type vectorOnlyStore struct {
+	VectorStore
+}
+
+// fakeReranker reverses the order of the results, recording what it was asked to rerank.
+type fakeLogger struct {
+	warnings []string
+}
+
+func (f *fakeLogger) LogWarn(msg string, keyValuePairs ...any) {
+	f.warnings = append(f.warnings, msg)
+}
+
+func (f *fakeLogger) LogError(msg string, keyValuePairs ...any) {}
+
+type fakeReranker struct {
+	err        error
+	candidates [][]SearchResult
+	opts       []SearchOptions
+}
+
+func (f *fakeReranker) Rerank(ctx context.Context, query string, results []SearchResult, opts SearchOptions) ([]SearchResult, error) {
+	f.candidates = append(f.candidates, results)
+	f.opts = append(f.opts, opts)
+	if f.err != nil {
+		return nil, f.err
+	}
+	reranked := make([]SearchResult, 0, len(results))
+	for i := len(results) - 1; i >= 0; i-- {
+		reranked = append(reranked, results[i])
+	}
+	return reranked, nil
+}
+
+func result(postID string, score float32) SearchResult {
+	return SearchResult{Document: PostDocument{PostID: postID}, Score: score}
+}
+
+func postIDs(results []SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Document.PostID
+	}
+	return ids
+}
+
+func TestCompositeSearchModes(t *testing.T) {
+	newStore := func() *fakeStore {
+		return &fakeStore{
+			vectorResults:  []SearchResult{result("semantic", 0.9), result("both", 0.8)},
+			lexicalResults: []SearchResult{result("both", 0.5), result("exact", 0.4)},
+		}
+	}
+
+	t.Run("vector search by default", func(t *testing.T) {
+		store := newStore()
+		search := NewCompositeSearch(store, fakeProvider{}, chunking.DefaultOptions())
+
+		results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 2, UserID: "user1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"semantic", "both"}, postIDs(results))
+		assert.Empty(t, store.lexicalOpts)
+	})
+
+	t.Run("hybrid search when enabled", func(t *testing.T) {
+		store := newStore()
+		search := NewCompositeSearch(store, fakeProvider{}, chunking.DefaultOptions())
+		search.SetHybridConfig(HybridConfig{Enabled: true})
+
+		results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 2, MinScore: 0.3, UserID: "user1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"both", "semantic"}, postIDs(results))
+
+		// Both searches are asked for more candidates than needed to fuse and merge chunks,
+		// only vector results are filtered by score.
+		require.Len(t, store.vectorOpts, 1)
+		assert.Equal(t, SearchOptions{Limit: 12, MinScore: 0.3, UserID: "user1"}, store.vectorOpts[0])
+		require.Len(t, store.lexicalOpts, 1)
+		assert.Equal(t, SearchOptions{Limit: 12, UserID: "user1"}, store.lexicalOpts[0])
+	})
+
+	t.Run("mode of the request wins", func(t *testing.T) {
+		store := newStore()
+		search := NewCompositeSearch(store, fakeProvider{}, chunking.DefaultOptions())
+		search.SetHybridConfig(HybridConfig{Enabled: true})
+
+		results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 2, UserID: "user1", Mode: SearchModeKeyword})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"both", "exact"}, postIDs(results))
+		assert.Empty(t, store.vectorOpts)
+
+		results, err = search.Search(context.Background(), "query", SearchOptions{Limit: 2, UserID: "user1", Mode: SearchModeVector})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"semantic", "both"}, postIDs(results))
+	})
+
+	t.Run("stores without text search", func(t *testing.T) {
+		search := NewCompositeSearch(vectorOnlyStore{newStore()}, fakeProvider{}, chunking.DefaultOptions())
+
+		_, err := search.Search(context.Background(), "query", SearchOptions{UserID: "user1", Mode: SearchModeHybrid})
+		require.Error(t, err)
+
+		_, err = search.Search(context.Background(), "query", SearchOptions{UserID: "user1", Mode: "fuzzy"})
+		require.Error(t, err)
+	})
+}
+
+func TestCompositeSearchReranking(t *testing.T) {
+	newStore := func() *fakeStore {
+		return &fakeStore{
+			vectorResults: []SearchResult{result("a", 0.9), result("b", 0.8), result("c", 0.7), result("d", 0.6)},
+		}
+	}
+
+	t.Run("candidates are retrieved and reranked", func(t *testing.T) {
+		store := newStore()
+		reranker := &fakeReranker{}
+		search := NewCompositeSearch(store, fakeProvider{}, chunking.DefaultOptions())
+		search.SetReranker(reranker, 0)
+
+		results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 2, UserID: "user1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"d", "c"}, postIDs(results))
+
+		// The store is asked for more candidates than needed, all of them being reranked.
+		require.Len(t, store.vectorOpts, 1)
+		assert.Equal(t, 8, store.vectorOpts[0].Limit)
+		require.Len(t, reranker.candidates, 1)
+		assert.Len(t, reranker.candidates[0], 4)
+		assert.Equal(t, SearchOptions{Limit: 8, UserID: "user1"}, reranker.opts[0])
+	})
+
+	t.Run("configured number of candidates", func(t *testing.T) {
+		store := newStore()
+		search := NewCompositeSearch(store, fakeProvider{}, chunking.DefaultOptions())
+		search.SetReranker(&fakeReranker{}, 3)
+
+		results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 2, UserID: "user1"})
+		require.NoError(t, err)
+		assert.Len(t, results, 2)
+		assert.Equal(t, 3, store.vectorOpts[0].Limit)
+
+		// Never fewer candidates than results.
+		_, err = search.Search(context.Background(), "query", SearchOptions{Limit: 5, UserID: "user1"})
+		require.NoError(t, err)
+		assert.Equal(t, 5, store.vectorOpts[1].Limit)
+	})
+
+	t.Run("hybrid results are reranked", func(t *testing.T) {
+		store := newStore()
+		store.lexicalResults = []SearchResult{result("e", 2)}
+		reranker := &fakeReranker{}
+		search := NewCompositeSearch(store, fakeProvider{}, chunking.DefaultOptions())
+		search.SetHybridConfig(HybridConfig{Enabled: true})
+		search.SetReranker(reranker, 0)
+
+		results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 1, UserID: "user1"})
+		require.NoError(t, err)
+		// The four best fused results are a, e, b and c.
+		assert.Equal(t, []string{"a", "e", "b", "c"}, postIDs(reranker.candidates[0]))
+		assert.Equal(t, []string{"c"}, postIDs(results))
+	})
+
+	t.Run("no candidates", func(t *testing.T) {
+		reranker := &fakeReranker{}
+		search := NewCompositeSearch(&fakeStore{}, fakeProvider{}, chunking.DefaultOptions())
+		search.SetReranker(reranker, 0)
+
+		results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 2, UserID: "user1"})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+		assert.Empty(t, reranker.candidates)
+	})
+
+	t.Run("reranker errors keep the retrieval order", func(t *testing.T) {
+		logger := &fakeLogger{}
+		search := NewCompositeSearch(newStore(), fakeProvider{}, chunking.DefaultOptions())
+		search.SetReranker(&fakeReranker{err: errors.New("unavailable")}, 0)
+		search.SetLogger(logger)
+
+		results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 2, UserID: "user1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, postIDs(results))
+		assert.Len(t, logger.warnings, 1)
+	})
+}
+
+func TestCompositeSearchStore(t *testing.T) {
+	store := &fakeStore{}
+	provider := &recordingProvider{}
+	search := NewCompositeSearch(store, provider, chunking.DefaultOptions())
+
+	err := search.Store(context.Background(), []PostDocument{
+		{PostID: "reply", Content: "yes, do that", Context: "should we upgrade the database?"},
+		{PostID: "reply", Content: "upgrade_plan.pdf\nStep one: back up the database."},
+		{PostID: "other", Content: "a single chunk"},
+	})
+	require.NoError(t, err)
+
+	// The documents of a post are numbered as chunks of the post, a post with a single document isn't chunked.
+	require.Len(t, store.stored, 3)
+	assert.Equal(t, chunking.ChunkInfo{IsChunk: true, ChunkIndex: 0, TotalChunks: 2}, store.stored[0].ChunkInfo)
+	assert.Equal(t, chunking.ChunkInfo{IsChunk: true, ChunkIndex: 1, TotalChunks: 2}, store.stored[1].ChunkInfo)
+	assert.Equal(t, chunking.ChunkInfo{IsChunk: false, ChunkIndex: 0, TotalChunks: 1}, store.stored[2].ChunkInfo)
+
+	// The context is embedded without being stored.
+	assert.Equal(t, "yes, do that", store.stored[0].Content)
+	assert.Equal(t, []string{
+		"should we upgrade the database?\n\nyes, do that",
+		"upgrade_plan.pdf\nStep one: back up the database.",
+		"a single chunk",
+	}, provider.texts)
+}
+
+func TestCompositeSearchMergesChunks(t *testing.T) {
+	chunk := func(postID string, index int, score float32) SearchResult {
+		return SearchResult{
+			Document: PostDocument{PostID: postID, Content: fmt.Sprintf("%s %d", postID, index), ChunkInfo: chunking.ChunkInfo{IsChunk: true, ChunkIndex: index, TotalChunks: 3}},
+			Score:    score,
+		}
+	}
+	store := &fakeStore{
+		vectorResults: []SearchResult{chunk("a", 1, 0.9), chunk("a", 0, 0.8), chunk("b", 2, 0.7), chunk("a", 2, 0.6), chunk("c", 0, 0.5)},
+	}
+	search := NewCompositeSearch(store, fakeProvider{}, chunking.DefaultOptions())
+
+	results, err := search.Search(context.Background(), "query", SearchOptions{Limit: 2, UserID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, postIDs(results))
+	assert.Equal(t, "a 1", results[0].Document.Content)
+	assert.Equal(t, 4, store.vectorOpts[0].Limit)
+
+	t.Run("the best scoring chunk wins", func(t *testing.T) {
+		// Results are usually ordered by score, the best scoring chunk wins whatever the order.
+		merged := mergeChunks([]SearchResult{chunk("a", 0, 0.2), chunk("b", 0, 0.5), chunk("a", 1, 0.9)})
+		assert.Equal(t, []string{"a", "b"}, postIDs(merged))
+		assert.Equal(t, 1, merged[0].Document.ChunkIndex)
+	})
+}
+
+func TestFuseResults(t *testing.T) {
+	vectorResults := []SearchResult{result("a", 0.9), result("b", 0.8), result("c", 0.7)}
+	lexicalResults := []SearchResult{result("c", 3), result("d", 2)}
+
+	t.Run("equal weights", func(t *testing.T) {
+		results := fuseResults(HybridConfig{}, 0, vectorResults, lexicalResults)
+		// b and d are both second once, ties keep the vector search order.
+		assert.Equal(t, []string{"c", "a", "b", "d"}, postIDs(results))
+
+		// c is third for vector search and first for keyword search.
+		assert.InDelta(t, (1.0/63+1.0/61)/(2.0/61), results[0].Score, 0.0001)
+	})
+
+	t.Run("a document first in both searches scores 1", func(t *testing.T) {
+		results := fuseResults(HybridConfig{}, 1, []SearchResult{result("a", 0.9)}, []SearchResult{result("a", 2)})
+		require.Len(t, results, 1)
+		assert.InDelta(t, 1, results[0].Score, 0.0001)
+	})
+
+	t.Run("weights favour a search", func(t *testing.T) {
+		// A small rank constant makes the difference between ranks count.
+		results := fuseResults(HybridConfig{VectorWeight: 1, LexicalWeight: 3, RankConstant: 1}, 2, vectorResults, lexicalResults)
+		assert.Equal(t, []string{"c", "d"}, postIDs(results))
+
+		results = fuseResults(HybridConfig{VectorWeight: 3, LexicalWeight: 1, RankConstant: 1}, 2, vectorResults, lexicalResults)
+		assert.Equal(t, []string{"a", "c"}, postIDs(results))
+	})
+
+	t.Run("chunks of a post are different documents", func(t *testing.T) {
+		chunk := func(index int) SearchResult {
+			return SearchResult{Document: PostDocument{PostID: "a", ChunkInfo: chunking.ChunkInfo{IsChunk: true, ChunkIndex: index, TotalChunks: 2}}}
+		}
+		results := fuseResults(HybridConfig{}, 0, []SearchResult{chunk(0)}, []SearchResult{chunk(1)})
+		assert.Len(t, results, 2)
+	})
+}
@@ -19,6 +19,14 @@ const (
 // Vector store types
 const (
 	VectorStoreTypePGVector = "pgvector"
+	// VectorStoreTypeFlat searches in memory, for databases without the pgvector extension
+	VectorStoreTypeFlat = "flat"
+)
+
+// Reranker types
+const (
+	RerankerTypeCrossEncoder = "cross-encoder"
+	RerankerTypeLLM          = "llm"
 )
 
 // Search types
@@ -26,6 +34,45 @@ const (
 	SearchTypeComposite = "composite"
 )
 
+// Search modes
+const (
+	// SearchModeVector finds documents similar in meaning to the query.
+	SearchModeVector = "vector"
+	// SearchModeKeyword finds documents containing the words of the query, such as identifiers and error codes.
+	SearchModeKeyword = "keyword"
+	// SearchModeHybrid combines the results of vector and keyword search.
+	SearchModeHybrid = "hybrid"
+)
+
+// Result expansion modes, replacing the content of a matching chunk before it is used
+const (
+	// ExpansionNone keeps the content of the matching chunk.
+	ExpansionNone = ""
+	// ExpansionNeighbors adds the chunks around the matching chunk of the post.
+	ExpansionNeighbors = "neighbors"
+	// ExpansionPost uses every chunk indexed for the post, its full message followed by its indexed attachments.
+	ExpansionPost = "post"
+	// ExpansionThread uses every chunk indexed for the post preceded by the indexed root post of its thread.
+	ExpansionThread = "thread"
+)
+
+// Content rule actions
+const (
+	// ContentRuleRedact replaces the text matching the pattern before it is indexed.
+	ContentRuleRedact = "redact"
+	// ContentRuleSkip keeps posts containing text matching the pattern out of the index.
+	ContentRuleSkip = "skip"
+)
+
+// IsValidSearchMode reports whether mode is a search mode, empty meaning the configured default.
+func IsValidSearchMode(mode string) bool {
+	switch mode {
+	case "", SearchModeVector, SearchModeKeyword, SearchModeHybrid:
+		return true
+	}
+	return false
+}
+
 // PostDocument represents a Mattermost post with its metadata
 type PostDocument struct {
 	PostID    string // ID of the Mattermost post
@@ -34,6 +81,9 @@ type PostDocument struct {
 	ChannelID string
 	UserID    string
 	Content   string
+	// Context is embedded along with every chunk of the content without being stored, such as the root post
+	// of a reply, so that short replies are found by what they answer
+	Context string
 
 	// Embed chunk info to track if this is a chunk
 	chunking.ChunkInfo
@@ -52,8 +102,11 @@ type SearchOptions struct {
 	TeamID        string
 	ChannelID     string
 	UserID        string // User ID for permission checks
+	BotID         string // Bot the search runs for, whose language model LLM rerankers use
 	CreatedAfter  int64
 	CreatedBefore int64
+	// Mode is one of the search modes, empty uses hybrid search when enabled and vector search otherwise.
+	Mode string
 }
 
 // EmbeddingSearch defines the high-level interface for storing and searching using embeddings
@@ -86,6 +139,30 @@ type VectorStore interface {
 	Clear(ctx context.Context) error
 }
 
+// LexicalSearcher is implemented by vector stores that can also search the text of the documents they store.
+type LexicalSearcher interface {
+	// SearchText performs a full text search for the words of the query
+	SearchText(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error)
+}
+
+// Reranker reorders search results by their relevance to the query.
+type Reranker interface {
+	// Rerank orders the results by relevance to the query, most relevant first
+	Rerank(ctx context.Context, query string, results []SearchResult, opts SearchOptions) ([]SearchResult, error)
+}
+
+// Logger reports failures that don't fail the operation they happen in, it is implemented by the plugin API.
+type Logger interface {
+	LogWarn(msg string, keyValuePairs ...any)
+	LogError(msg string, keyValuePairs ...any)
+}
+
+// ChunkGetter is implemented by vector stores that can return the documents stored for a post.
+type ChunkGetter interface {
+	// GetChunks returns the documents of the post ordered by chunk index, without checking permissions
+	GetChunks(ctx context.Context, postID string) ([]PostDocument, error)
+}
+
 // EmbeddingProvider defines the interface for embedding generation
 type EmbeddingProvider interface {
 	// CreateEmbedding generates embedding for the given text
@@ -112,4 +189,71 @@ type EmbeddingSearchConfig struct {
 	Parameters        json.RawMessage  `json:"parameters"`
 	Dimensions        int              `json:"dimensions"`
 	ChunkingOptions   chunking.Options `json:"chunkingOptions"`
+	Hybrid            HybridConfig     `json:"hybrid"`
+	Reranker          RerankerConfig   `json:"reranker"`
+	Expansion         ExpansionConfig  `json:"expansion"`
+	Indexing          IndexingConfig   `json:"indexing"`
+	IndexingPolicy    IndexingPolicy   `json:"indexingPolicy"`
+}
+
+// HybridConfig combines full text search with vector search using reciprocal rank fusion.
+// Zero weights and rank constant use the defaults.
+type HybridConfig struct {
+	Enabled       bool    `json:"enabled"`
+	VectorWeight  float32 `json:"vectorWeight"`
+	LexicalWeight float32 `json:"lexicalWeight"`
+	// RankConstant dampens the advantage of the top ranked results of each search.
+	RankConstant int `json:"rankConstant"`
+}
+
+// RerankerConfig reorders the results of a search with a cross-encoder rerank API or the language model of a bot.
+// An empty type disables reranking.
+type RerankerConfig struct {
+	Type string `json:"type"`
+	// APIURL, APIKey and Model configure the rerank API of cross-encoder rerankers.
+	APIURL string `json:"apiURL"`
+	APIKey string `json:"apiKey"`
+	Model  string `json:"model"`
+	// Candidates is how many results are retrieved to be reranked, four times the limit of the search when zero.
+	Candidates int `json:"candidates"`
+}
+
+// ExpansionConfig sets how much context around the matching chunks is given to the language model,
+// with one of the expansion modes for search answers and for the SearchServer tool.
+type ExpansionConfig struct {
+	Answers string `json:"answers"`
+	Tool    string `json:"tool"`
+	// NeighborChunks is how many chunks on each side of the matching chunk are added, one when zero.
+	NeighborChunks int `json:"neighborChunks"`
+}
+
+// IndexingConfig sets what is indexed along with the message of a post.
+type IndexingConfig struct {
+	// Attachments indexes the text extracted from the files attached to posts and the text of message
+	// attachments as extra chunks of the post.
+	Attachments bool `json:"attachments"`
+	// MaxAttachmentLength is how many characters of each attachment are indexed, 20000 when zero.
+	MaxAttachmentLength int `json:"maxAttachmentLength"`
+	// ThreadContext embeds the root post of the thread along with replies.
+	ThreadContext bool `json:"threadContext"`
+}
+
+// IndexingPolicy keeps posts from being sent to the embedding provider. Posts excluded by the policy are not indexed,
+// and the posts already indexed are removed from the index when the policy changes.
+type IndexingPolicy struct {
+	ExcludedUserIDs    []string `json:"excludedUserIDs"`
+	ExcludedTeamIDs    []string `json:"excludedTeamIDs"`
+	ExcludedChannelIDs []string `json:"excludedChannelIDs"`
+	// ExcludeDirectMessages excludes direct and group messages.
+	ExcludeDirectMessages  bool `json:"excludeDirectMessages"`
+	ExcludePrivateChannels bool `json:"excludePrivateChannels"`
+	// ContentRules redact or skip the text of posts matching their pattern, including attachments.
+	ContentRules []ContentRule `json:"contentRules"`
+}
+
+// ContentRule matches the text of posts with a regular expression in Go syntax.
+type ContentRule struct {
+	Pattern string `json:"pattern"`
+	// Action is one of the content rule actions.
+	Action string `json:"action"`
 }
@@ -0,0 +1,523 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Generation statuses
+const (
+	// GenerationStatusBuilding is the status of a generation being filled by a reindex.
+	GenerationStatusBuilding = "building"
+	// GenerationStatusActive is the status of the generation searches use.
+	GenerationStatusActive = "active"
+	// GenerationStatusRetired is the status of a replaced or discarded generation waiting to be garbage collected.
+	GenerationStatusRetired = "retired"
+)
+
+const (
+	// GenerationsKey is the KV store key of the generations of the index, shared by the servers of a cluster
+	GenerationsKey = "embedding_generations"
+	// GenerationRetention is how long a retired generation is kept before it is garbage collected, so that servers
+	// of a cluster that haven't noticed the switch to the next generation yet can keep using it.
+	GenerationRetention = 5 * time.Minute
+	// generationRefreshInterval is how often the generations are reloaded to notice switches made by other servers
+	generationRefreshInterval = 30 * time.Second
+	// generationUpdateAttempts is how often a change of the generations is retried when other servers of a cluster
+	// change them at the same time
+	generationUpdateAttempts = 5
+)
+
+// Generation is a complete index of the posts, built with one embedding model. A reindex builds a new generation
+// next to the active one and switches to it once it is complete.
+type Generation struct {
+	ID          int    `json:"id"`
+	Status      string `json:"status"`
+	Provider    string `json:"provider"`
+	Model       string `json:"model"`
+	Dimensions  int    `json:"dimensions"`
+	VectorStore string `json:"vector_store"`
+	CreatedAt   int64  `json:"created_at"`
+	ActivatedAt int64  `json:"activated_at,omitempty"`
+	RetiredAt   int64  `json:"retired_at,omitempty"`
+}
+
+// GenerationConfig is the configuration a generation is built with. It is kept with the generation so that the
+// generation can still be searched after the configuration changed, until a reindex replaces it. It holds no
+// credentials, every generation is searched with the credentials of the configured embedding provider.
+type GenerationConfig struct {
+	// Provider is the type of the embedding provider
+	Provider string `json:"provider"`
+	// Model is the embedding model of the provider
+	Model string `json:"model"`
+	// EmbeddingDimensions are the dimensions requested from the provider, zero for the default of the model
+	EmbeddingDimensions int    `json:"embeddingDimensions,omitempty"`
+	VectorStore         string `json:"vectorStore"`
+	Dimensions          int    `json:"dimensions"`
+}
+
+// GenerationBackend opens the search of each generation and removes the data of retired ones.
+type GenerationBackend interface {
+	// Open creates the search of a generation, creating its storage if needed
+	Open(generation Generation, config GenerationConfig) (EmbeddingSearch, error)
+	// Drop removes the storage of a generation
+	Drop(ctx context.Context, generation Generation) error
+}
+
+// KVStore persists values shared by the servers of a cluster.
+type KVStore interface {
+	KVGet(key string, value interface{}) error
+	// KVCompareAndSet sets the value of key if it still holds oldValue, a nil oldValue requiring the key to be unset
+	KVCompareAndSet(key string, oldValue, newValue interface{}) (bool, error)
+}
+
+// GenerationManager is implemented by searches keeping generations of the index, so that a reindex can build
+// a new generation while searches keep using the active one.
+type GenerationManager interface {
+	// BeginGeneration creates a generation with the current configuration and returns the search filling it
+	BeginGeneration(ctx context.Context) (Generation, EmbeddingSearch, error)
+	// ResumeGeneration returns the search filling a generation being built, to resume an interrupted reindex
+	ResumeGeneration(ctx context.Context, id int) (EmbeddingSearch, error)
+	// ActivateGeneration switches searches to a generation being built, retiring the active one
+	ActivateGeneration(ctx context.Context, id int) error
+	// DiscardGeneration retires a generation being built without switching to it
+	DiscardGeneration(ctx context.Context, id int) error
+	// CollectGenerations removes the generations retired for longer than the retention period
+	CollectGenerations(ctx context.Context) error
+	// ListGenerations returns the generations of the index, oldest first
+	ListGenerations(ctx context.Context) ([]Generation, error)
+}
+
+// generationRecord is a generation as persisted
+type generationRecord struct {
+	Generation
+	Config GenerationConfig `json:"config"`
+}
+
+type generationsState struct {
+	LastID      int                `json:"last_id"`
+	Generations []generationRecord `json:"generations"`
+}
+
+func (s *generationsState) withStatus(status string) *generationRecord {
+	for i := range s.Generations {
+		if s.Generations[i].Status == status {
+			return &s.Generations[i]
+		}
+	}
+	return nil
+}
+
+func (s *generationsState) byID(id int) *generationRecord {
+	for i := range s.Generations {
+		if s.Generations[i].ID == id {
+			return &s.Generations[i]
+		}
+	}
+	return nil
+}
+
+// Generations implements EmbeddingSearch over the generations of the index. Searches use the active generation,
+// while stored and deleted documents are applied to the generation being built as well, so that it is up to date
+// when it replaces the active one.
+type Generations struct {
+	backend GenerationBackend
+	kv      KVStore
+	config  GenerationConfig
+	now     func() time.Time
+
+	mu    sync.Mutex
+	state generationsState
+	// stored is the persisted value state was loaded from, compared with the one found when saving changes
+	stored      []byte
+	searches    map[int]EmbeddingSearch
+	refreshedAt time.Time
+}
+
+// NewGenerations loads the generations of the index, with config used for new generations. An index built before
+// generations were recorded becomes the first generation, assumed to have been built with config.
+func NewGenerations(backend GenerationBackend, kv KVStore, config GenerationConfig) (*Generations, error) {
+	g := &Generations{
+		backend:  backend,
+		kv:       kv,
+		config:   config,
+		now:      time.Now,
+		searches: map[int]EmbeddingSearch{},
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	err := g.update(func(state *generationsState) bool {
+		if state.withStatus(GenerationStatusActive) != nil {
+			return false
+		}
+		record := g.newRecord(state, GenerationStatusActive)
+		record.ActivatedAt = record.CreatedAt
+		state.Generations = append(state.Generations, record)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := g.openSearches(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func (g *Generations) load() error {
+	var stored []byte
+	if err := g.kv.KVGet(GenerationsKey, &stored); err != nil {
+		return fmt.Errorf("failed to get index generations: %w", err)
+	}
+	var state generationsState
+	if len(stored) > 0 {
+		if err := json.Unmarshal(stored, &state); err != nil {
+			return fmt.Errorf("failed to decode index generations: %w", err)
+		}
+	}
+	g.state = state
+	g.stored = stored
+	g.refreshedAt = g.now()
+	return nil
+}
+
+// refresh reloads the generations and opens the searches of the ones in use
+func (g *Generations) refresh() error {
+	if err := g.load(); err != nil {
+		return err
+	}
+	return g.openSearches()
+}
+
+// update reloads the generations and saves the changes change makes to them, unless it reports none. Changes
+// are saved only if no other server saved the generations in the meantime, otherwise they are reloaded and
+// change is applied again.
+func (g *Generations) update(change func(state *generationsState) bool) error {
+	for range generationUpdateAttempts {
+		if err := g.load(); err != nil {
+			return err
+		}
+		state := generationsState{
+			LastID:      g.state.LastID,
+			Generations: slices.Clone(g.state.Generations),
+		}
+		if !change(&state) {
+			return nil
+		}
+
+		data, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("failed to encode index generations: %w", err)
+		}
+		saved, err := g.kv.KVCompareAndSet(GenerationsKey, g.stored, data)
+		if err != nil {
+			return fmt.Errorf("failed to save index generations: %w", err)
+		}
+		if saved {
+			g.state = state
+			g.stored = data
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to save index generations: changed by other servers %d times", generationUpdateAttempts)
+}
+
+func (g *Generations) newRecord(state *generationsState, status string) generationRecord {
+	state.LastID++
+	return generationRecord{
+		Generation: Generation{
+			ID:          state.LastID,
+			Status:      status,
+			Provider:    g.config.Provider,
+			Model:       g.config.Model,
+			Dimensions:  g.config.Dimensions,
+			VectorStore: g.config.VectorStore,
+			CreatedAt:   g.now().UnixMilli(),
+		},
+		Config: g.config,
+	}
+}
+
+// openSearches opens the searches of the active generation and the one being built, forgetting the others
+func (g *Generations) openSearches() error {
+	open := map[int]bool{}
+	for _, record := range g.state.Generations {
+		if record.Status == GenerationStatusRetired {
+			continue
+		}
+		open[record.ID] = true
+		if _, ok := g.searches[record.ID]; ok {
+			continue
+		}
+		search, err := g.backend.Open(record.Generation, record.Config)
+		if err != nil {
+			return fmt.Errorf("failed to open index generation %d: %w", record.ID, err)
+		}
+		g.searches[record.ID] = search
+	}
+
+	for id := range g.searches {
+		if !open[id] {
+			delete(g.searches, id)
+		}
+	}
+	return nil
+}
+
+// current returns the search of the active generation and the one of the generation being built, if any,
+// reloading the generations when another server may have switched them.
+func (g *Generations) current() (EmbeddingSearch, EmbeddingSearch, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.now().Sub(g.refreshedAt) >= generationRefreshInterval {
+		if err := g.refresh(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	active := g.state.withStatus(GenerationStatusActive)
+	if active == nil {
+		return nil, nil, fmt.Errorf("no active index generation")
+	}
+	var building EmbeddingSearch
+	if record := g.state.withStatus(GenerationStatusBuilding); record != nil {
+		building = g.searches[record.ID]
+	}
+	return g.searches[active.ID], building, nil
+}
+
+func (g *Generations) Store(ctx context.Context, docs []PostDocument) error {
+	active, building, err := g.current()
+	if err != nil {
+		return err
+	}
+	if err := active.Store(ctx, docs); err != nil {
+		return err
+	}
+	if building != nil {
+		return building.Store(ctx, docs)
+	}
+	return nil
+}
+
+func (g *Generations) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	active, _, err := g.current()
+	if err != nil {
+		return nil, err
+	}
+	return active.Search(ctx, query, opts)
+}
+
+func (g *Generations) Delete(ctx context.Context, postIDs []string) error {
+	active, building, err := g.current()
+	if err != nil {
+		return err
+	}
+	if err := active.Delete(ctx, postIDs); err != nil {
+		return err
+	}
+	if building != nil {
+		return building.Delete(ctx, postIDs)
+	}
+	return nil
+}
+
+func (g *Generations) Clear(ctx context.Context) error {
+	active, building, err := g.current()
+	if err != nil {
+		return err
+	}
+	if err := active.Clear(ctx); err != nil {
+		return err
+	}
+	if building != nil {
+		return building.Clear(ctx)
+	}
+	return nil
+}
+
+// GetChunks returns the documents stored for a post in the active generation
+func (g *Generations) GetChunks(ctx context.Context, postID string) ([]PostDocument, error) {
+	active, _, err := g.current()
+	if err != nil {
+		return nil, err
+	}
+	getter, ok := active.(ChunkGetter)
+	if !ok {
+		return nil, fmt.Errorf("the active index generation does not support getting the chunks of a post")
+	}
+	return getter.GetChunks(ctx, postID)
+}
+
+// BeginGeneration creates a generation with the current configuration and returns the search filling it.
+// A generation left building by an interrupted reindex is retired.
+func (g *Generations) BeginGeneration(ctx context.Context) (Generation, EmbeddingSearch, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.collect(ctx); err != nil {
+		return Generation{}, nil, err
+	}
+
+	var record generationRecord
+	err := g.update(func(state *generationsState) bool {
+		now := g.now().UnixMilli()
+		for i := range state.Generations {
+			if state.Generations[i].Status == GenerationStatusBuilding {
+				state.Generations[i].Status = GenerationStatusRetired
+				state.Generations[i].RetiredAt = now
+			}
+		}
+		record = g.newRecord(state, GenerationStatusBuilding)
+		state.Generations = append(state.Generations, record)
+		return true
+	})
+	if err != nil {
+		return Generation{}, nil, err
+	}
+	if err := g.openSearches(); err != nil {
+		// The generation is discarded so that no server keeps trying to open it.
+		if discardErr := g.retire(record.ID, false); discardErr != nil {
+			return Generation{}, nil, fmt.Errorf("%w, and failed to discard it: %w", err, discardErr)
+		}
+		return Generation{}, nil, err
+	}
+
+	return record.Generation, g.searches[record.ID], nil
+}
+
+// ResumeGeneration returns the search filling a generation being built, so that an interrupted reindex can
+// resume filling it.
+func (g *Generations) ResumeGeneration(_ context.Context, id int) (EmbeddingSearch, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.refresh(); err != nil {
+		return nil, err
+	}
+	record := g.state.byID(id)
+	if record == nil || record.Status != GenerationStatusBuilding {
+		return nil, fmt.Errorf("index generation %d is not being built", id)
+	}
+	return g.searches[id], nil
+}
+
+// ActivateGeneration switches searches to a generation being built and retires the active one. Other servers
+// of a cluster switch when they next reload the generations.
+func (g *Generations) ActivateGeneration(_ context.Context, id int) error {
+	return g.retireGeneration(id, true)
+}
+
+// DiscardGeneration retires a generation being built, searches keeping using the active one.
+func (g *Generations) DiscardGeneration(_ context.Context, id int) error {
+	return g.retireGeneration(id, false)
+}
+
+// retireGeneration ends the build of a generation, switching to it when activate is true
+func (g *Generations) retireGeneration(id int, activate bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.retire(id, activate); err != nil {
+		return err
+	}
+	return g.openSearches()
+}
+
+func (g *Generations) retire(id int, activate bool) error {
+	building := true
+	err := g.update(func(state *generationsState) bool {
+		record := state.byID(id)
+		if record == nil || record.Status != GenerationStatusBuilding {
+			building = false
+			return false
+		}
+
+		now := g.now().UnixMilli()
+		if activate {
+			if active := state.withStatus(GenerationStatusActive); active != nil {
+				active.Status = GenerationStatusRetired
+				active.RetiredAt = now
+			}
+			record.Status = GenerationStatusActive
+			record.ActivatedAt = now
+		} else {
+			record.Status = GenerationStatusRetired
+			record.RetiredAt = now
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !building {
+		return fmt.Errorf("index generation %d is not being built", id)
+	}
+	return nil
+}
+
+// CollectGenerations removes the data of the generations retired for longer than the retention period
+func (g *Generations) CollectGenerations(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.collect(ctx); err != nil {
+		return err
+	}
+	return g.openSearches()
+}
+
+// collect drops the data of the expired generations before forgetting them, so that the data of a generation
+// that failed to be dropped is dropped by the next collection.
+func (g *Generations) collect(ctx context.Context) error {
+	var dropErr error
+	err := g.update(func(state *generationsState) bool {
+		expired := g.now().Add(-GenerationRetention).UnixMilli()
+		kept := make([]generationRecord, 0, len(state.Generations))
+		for _, record := range state.Generations {
+			if record.Status != GenerationStatusRetired || record.RetiredAt > expired {
+				kept = append(kept, record)
+				continue
+			}
+			if err := g.backend.Drop(ctx, record.Generation); err != nil {
+				dropErr = fmt.Errorf("failed to drop index generation %d: %w", record.ID, err)
+				return false
+			}
+		}
+		if len(kept) == len(state.Generations) {
+			return false
+		}
+		state.Generations = kept
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return dropErr
+}
+
+// ListGenerations returns the generations of the index, oldest first
+func (g *Generations) ListGenerations(_ context.Context) ([]Generation, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.refresh(); err != nil {
+		return nil, err
+	}
+	generations := make([]Generation, len(g.state.Generations))
+	for i, record := range g.state.Generations {
+		generations[i] = record.Generation
+	}
+	return generations, nil
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKV keeps values as JSON like the KV store of the server. beforeSet, if set, is called once before the next
+// compare and set, to change the values in the meantime.
+type fakeKV struct {
+	values    map[string][]byte
+	beforeSet func()
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{values: map[string][]byte{}}
+}
+
+func (f *fakeKV) KVGet(key string, value interface{}) error {
+	data, ok := f.values[key]
+	if !ok {
+		return nil
+	}
+	if out, ok := value.(*[]byte); ok {
+		*out = data
+		return nil
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (f *fakeKV) KVCompareAndSet(key string, oldValue, newValue interface{}) (bool, error) {
+	if beforeSet := f.beforeSet; beforeSet != nil {
+		f.beforeSet = nil
+		beforeSet()
+	}
+
+	current, ok := f.values[key]
+	if old := oldValue.([]byte); (old == nil && ok) || (old != nil && !bytes.Equal(old, current)) {
+		return false, nil
+	}
+	f.values[key] = newValue.([]byte)
+	return true, nil
+}
+
+// generationSearch records the documents stored in a generation.
+type generationSearch struct {
+	id     int
+	stored []string
+}
+
+func (s *generationSearch) Store(ctx context.Context, docs []PostDocument) error {
+	for _, doc := range docs {
+		s.stored = append(s.stored, doc.PostID)
+	}
+	return nil
+}
+
+func (s *generationSearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	return []SearchResult{result(query, 1)}, nil
+}
+
+func (s *generationSearch) Delete(ctx context.Context, postIDs []string) error {
+	return nil
+}
+
+func (s *generationSearch) Clear(ctx context.Context) error {
+	return nil
+}
+
+type fakeGenerationBackend struct {
+	opened  map[int]*generationSearch
+	configs map[int]GenerationConfig
+	dropped []int
+}
+
+func newFakeGenerationBackend() *fakeGenerationBackend {
+	return &fakeGenerationBackend{opened: map[int]*generationSearch{}, configs: map[int]GenerationConfig{}}
+}
+
+func (f *fakeGenerationBackend) Open(generation Generation, config GenerationConfig) (EmbeddingSearch, error) {
+	search := &generationSearch{id: generation.ID}
+	f.opened[generation.ID] = search
+	f.configs[generation.ID] = config
+	return search, nil
+}
+
+func (f *fakeGenerationBackend) Drop(ctx context.Context, generation Generation) error {
+	f.dropped = append(f.dropped, generation.ID)
+	return nil
+}
+
+func TestGenerations(t *testing.T) {
+	ctx := context.Background()
+	kv := newFakeKV()
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	oldConfig := GenerationConfig{Provider: ProviderTypeOpenAI, Model: "small", VectorStore: VectorStoreTypePGVector, Dimensions: 2}
+	backend := newFakeGenerationBackend()
+	generations, err := NewGenerations(backend, kv, oldConfig)
+	require.NoError(t, err)
+	generations.now = clock
+
+	list, err := generations.ListGenerations(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, Generation{
+		ID:          1,
+		Status:      GenerationStatusActive,
+		Provider:    ProviderTypeOpenAI,
+		Model:       "small",
+		Dimensions:  2,
+		VectorStore: VectorStoreTypePGVector,
+		CreatedAt:   list[0].CreatedAt,
+		ActivatedAt: list[0].CreatedAt,
+	}, list[0], "an existing index becomes the first generation")
+
+	// After a configuration change, the active generation keeps the configuration it was built with.
+	newConfig := GenerationConfig{Provider: ProviderTypeOpenAI, Model: "large", EmbeddingDimensions: 3, VectorStore: VectorStoreTypePGVector, Dimensions: 3}
+	backend = newFakeGenerationBackend()
+	generations, err = NewGenerations(backend, kv, newConfig)
+	require.NoError(t, err)
+	generations.now = clock
+	assert.Equal(t, oldConfig, backend.configs[1])
+
+	generation, builder, err := generations.BeginGeneration(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, generation.ID)
+	assert.Equal(t, GenerationStatusBuilding, generation.Status)
+	assert.Equal(t, "large", generation.Model)
+	assert.Equal(t, 3, generation.Dimensions)
+	assert.Equal(t, newConfig, backend.configs[2])
+
+	// While building, searches use the active generation and new posts go to both.
+	require.NoError(t, builder.Store(ctx, []PostDocument{{PostID: "old"}}))
+	require.NoError(t, generations.Store(ctx, []PostDocument{{PostID: "new"}}))
+	assert.Equal(t, []string{"new"}, backend.opened[1].stored)
+	assert.Equal(t, []string{"old", "new"}, backend.opened[2].stored)
+
+	// Other servers notice the switch when they reload the generations.
+	otherBackend := newFakeGenerationBackend()
+	otherServer, err := NewGenerations(otherBackend, kv, newConfig)
+	require.NoError(t, err)
+	otherServer.now = clock
+
+	require.NoError(t, generations.ActivateGeneration(ctx, generation.ID))
+	require.NoError(t, generations.Store(ctx, []PostDocument{{PostID: "after"}}))
+	assert.Equal(t, []string{"new"}, backend.opened[1].stored)
+	assert.Equal(t, []string{"old", "new", "after"}, backend.opened[2].stored)
+
+	require.NoError(t, otherServer.Store(ctx, []PostDocument{{PostID: "stale"}}))
+	assert.Equal(t, []string{"stale"}, otherBackend.opened[1].stored, "the switch is not noticed before the refresh interval")
+	assert.Equal(t, []string{"stale"}, otherBackend.opened[2].stored)
+
+	now = now.Add(generationRefreshInterval + time.Second)
+	require.NoError(t, otherServer.Store(ctx, []PostDocument{{PostID: "refreshed"}}))
+	assert.Equal(t, []string{"stale"}, otherBackend.opened[1].stored)
+	assert.Equal(t, []string{"stale", "refreshed"}, otherBackend.opened[2].stored)
+
+	list, err = generations.ListGenerations(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, GenerationStatusRetired, list[0].Status)
+	assert.Equal(t, GenerationStatusActive, list[1].Status)
+
+	// Retired generations are kept for the retention period.
+	require.NoError(t, generations.CollectGenerations(ctx))
+	assert.Empty(t, backend.dropped)
+
+	now = now.Add(GenerationRetention)
+	require.NoError(t, generations.CollectGenerations(ctx))
+	assert.Equal(t, []int{1}, backend.dropped)
+
+	list, err = generations.ListGenerations(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, 2, list[0].ID)
+}
+
+func TestDiscardGeneration(t *testing.T) {
+	ctx := context.Background()
+	config := GenerationConfig{Provider: ProviderTypeOpenAI, Model: "small", VectorStore: VectorStoreTypeFlat, Dimensions: 2}
+	backend := newFakeGenerationBackend()
+	generations, err := NewGenerations(backend, newFakeKV(), config)
+	require.NoError(t, err)
+
+	generation, _, err := generations.BeginGeneration(ctx)
+	require.NoError(t, err)
+	require.NoError(t, generations.DiscardGeneration(ctx, generation.ID))
+	assert.Error(t, generations.ActivateGeneration(ctx, generation.ID), "a discarded generation can't be activated")
+
+	results, err := generations.Search(ctx, "query", SearchOptions{})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	_, err = generations.ResumeGeneration(ctx, generation.ID)
+	assert.Error(t, err, "a discarded generation can't be resumed")
+
+	// A generation left building by an interrupted reindex can be resumed, or is retired by the next one.
+	interrupted, _, err := generations.BeginGeneration(ctx)
+	require.NoError(t, err)
+	resumed, err := generations.ResumeGeneration(ctx, interrupted.ID)
+	require.NoError(t, err)
+	assert.Same(t, backend.opened[interrupted.ID], resumed)
+	next, _, err := generations.BeginGeneration(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, interrupted.ID+1, next.ID)
+
+	list, err := generations.ListGenerations(ctx)
+	require.NoError(t, err)
+	statuses := map[int]string{}
+	for _, generation := range list {
+		statuses[generation.ID] = generation.Status
+	}
+	assert.Equal(t, map[int]string{
+		1: GenerationStatusActive,
+		2: GenerationStatusRetired,
+		3: GenerationStatusRetired,
+		4: GenerationStatusBuilding,
+	}, statuses)
+}
+
+func TestGenerationsConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	kv := newFakeKV()
+	config := GenerationConfig{Provider: ProviderTypeOpenAI, Model: "small", VectorStore: VectorStoreTypeFlat, Dimensions: 2}
+	generations, err := NewGenerations(newFakeGenerationBackend(), kv, config)
+	require.NoError(t, err)
+	otherServer, err := NewGenerations(newFakeGenerationBackend(), kv, config)
+	require.NoError(t, err)
+
+	// Another server begins a generation while this one saves its own, which is then saved over the other one.
+	kv.beforeSet = func() {
+		_, _, beginErr := otherServer.BeginGeneration(ctx)
+		require.NoError(t, beginErr)
+	}
+	generation, search, err := generations.BeginGeneration(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, generation.ID)
+	assert.NotNil(t, search)
+
+	list, err := generations.ListGenerations(ctx)
+	require.NoError(t, err)
+	statuses := map[int]string{}
+	for _, generation := range list {
+		statuses[generation.ID] = generation.Status
+	}
+	assert.Equal(t, map[int]string{
+		1: GenerationStatusActive,
+		2: GenerationStatusRetired,
+		3: GenerationStatusBuilding,
+	}, statuses)
+
+	// Changes are given up when the generations keep changing.
+	var change func()
+	change = func() {
+		kv.values[GenerationsKey] = append(kv.values[GenerationsKey], ' ')
+		kv.beforeSet = change
+	}
+	kv.beforeSet = change
+	err = generations.DiscardGeneration(ctx, 3)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "changed by other servers")
+}
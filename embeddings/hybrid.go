@@ -0,0 +1,97 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package embeddings
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	DefaultHybridWeight       = 1.0
+	DefaultHybridRankConstant = 60
+	// hybridCandidatesFactor is how many more results than requested each search contributes to the fusion,
+	// so that documents ranked low by one search but high by the other can make it into the results.
+	hybridCandidatesFactor = 3
+)
+
+func (c HybridConfig) vectorWeight() float32 {
+	if c.VectorWeight <= 0 {
+		return DefaultHybridWeight
+	}
+	return c.VectorWeight
+}
+
+func (c HybridConfig) lexicalWeight() float32 {
+	if c.LexicalWeight <= 0 {
+		return DefaultHybridWeight
+	}
+	return c.LexicalWeight
+}
+
+func (c HybridConfig) rankConstant() int {
+	if c.RankConstant <= 0 {
+		return DefaultHybridRankConstant
+	}
+	return c.RankConstant
+}
+
+// documentKey identifies a stored document, chunks of the same post being different documents.
+func documentKey(doc PostDocument) string {
+	if doc.IsChunk {
+		return fmt.Sprintf("%s_chunk_%d", doc.PostID, doc.ChunkIndex)
+	}
+	return doc.PostID
+}
+
+// fuseResults merges the results of vector and keyword search with weighted reciprocal rank fusion:
+// each document scores weight / (rank constant + rank) in every search it was found by.
+// Scores are scaled so that a document ranked first by both searches scores 1.
+func fuseResults(config HybridConfig, limit int, vectorResults, lexicalResults []SearchResult) []SearchResult {
+	k := float32(config.rankConstant())
+	type fused struct {
+		result SearchResult
+		score  float32
+	}
+
+	var ordered []*fused
+	byKey := map[string]*fused{}
+	add := func(results []SearchResult, weight float32) {
+		for rank, result := range results {
+			key := documentKey(result.Document)
+			entry, ok := byKey[key]
+			if !ok {
+				entry = &fused{result: result}
+				byKey[key] = entry
+				ordered = append(ordered, entry)
+			}
+			entry.score += weight / (k + float32(rank+1))
+		}
+	}
+	add(vectorResults, config.vectorWeight())
+	add(lexicalResults, config.lexicalWeight())
+
+	// Stable so that ties keep the vector search order.
+	slices.SortStableFunc(ordered, func(a, b *fused) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+
+	if limit > 0 && len(ordered) > limit {
+		ordered = ordered[:limit]
+	}
+
+	maxScore := (config.vectorWeight() + config.lexicalWeight()) / (k + 1)
+	results := make([]SearchResult, 0, len(ordered))
+	for _, entry := range ordered {
+		entry.result.Score = entry.score / maxScore
+		results = append(results, entry.result)
+	}
+	return results
+}
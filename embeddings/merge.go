@@ -0,0 +1,26 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package embeddings
+
+// mergeCandidatesFactor is how many more results than requested are retrieved, so that enough posts are left
+// once the chunks of the same post are merged.
+const mergeCandidatesFactor = 2
+
+// mergeChunks keeps a single result per post, the best scoring chunk taking the place of the first one found.
+func mergeChunks(results []SearchResult) []SearchResult {
+	merged := make([]SearchResult, 0, len(results))
+	byPostID := map[string]int{}
+	for _, result := range results {
+		index, ok := byPostID[result.Document.PostID]
+		if !ok {
+			byPostID[result.Document.PostID] = len(merged)
+			merged = append(merged, result)
+			continue
+		}
+		if result.Score > merged[index].Score {
+			merged[index] = result
+		}
+	}
+	return merged
+}
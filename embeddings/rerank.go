@@ -0,0 +1,19 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package embeddings
+
+// rerankCandidatesFactor is how many more results than requested are retrieved for the reranker by default,
+// so that relevant documents ranked low by retrieval can make it into the results.
+const rerankCandidatesFactor = 4
+
+// rerankCandidates returns how many results to retrieve for a reranked search returning at most limit results.
+func rerankCandidates(candidates, limit int) int {
+	if limit <= 0 {
+		return candidates
+	}
+	if candidates <= 0 {
+		return limit * rerankCandidatesFactor
+	}
+	return max(candidates, limit)
+}
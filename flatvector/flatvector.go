@@ -0,0 +1,412 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+// Package flatvector implements a vector store searching every document in memory, for installs without the
+// pgvector extension and for tests.
+package flatvector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+)
+
+// Persistence saves the documents of the index so that it survives restarts and is shared by the servers of a
+// cluster. Every change of the stored documents increments their version, and returns it.
+type Persistence interface {
+	// Load returns every stored document with its embedding, and the version of the documents
+	Load(ctx context.Context) ([]embeddings.PostDocument, [][]float32, int64, error)
+	// Version returns the version of the stored documents
+	Version(ctx context.Context) (int64, error)
+	Store(ctx context.Context, docs []embeddings.PostDocument, embeddings [][]float32) (int64, error)
+	Delete(ctx context.Context, postIDs []string) (int64, error)
+	Clear(ctx context.Context) (int64, error)
+}
+
+// refreshInterval is how often a FlatVector checks whether other servers of the cluster changed the documents.
+const refreshInterval = 5 * time.Second
+
+// ChannelAccess tells which channels a user can search.
+type ChannelAccess interface {
+	// SearchableChannels returns the IDs of the channels the user is a member of, excluding deleted channels
+	SearchableChannels(ctx context.Context, userID string) ([]string, error)
+}
+
+// FlatVector is an exact nearest neighbor index held in memory. Every search compares the query with all
+// documents, which is fast enough for small installs. Each server keeps its own copy of the documents, reloading
+// it when searching after another server of a cluster changed them.
+type FlatVector struct {
+	config      FlatVectorConfig
+	persistence Persistence
+	channels    ChannelAccess
+	// refreshInterval is how often searches check the version of the stored documents
+	refreshInterval time.Duration
+
+	mu sync.RWMutex
+	// version is the version of the stored documents held in memory
+	version   int64
+	checkedAt time.Time
+	entries   map[string]*entry
+	// documentFrequency counts the documents containing each term, to weigh rare terms higher in keyword search
+	documentFrequency map[string]int
+}
+
+type FlatVectorConfig struct {
+	Dimensions int `json:"dimensions"`
+}
+
+type entry struct {
+	doc       embeddings.PostDocument
+	embedding []float32
+	terms     map[string]int
+}
+
+// New creates a FlatVector loading the documents saved by persistence, nil keeping documents in memory only.
+func New(config FlatVectorConfig, persistence Persistence, channels ChannelAccess) (*FlatVector, error) {
+	fv := &FlatVector{
+		config:            config,
+		persistence:       persistence,
+		channels:          channels,
+		refreshInterval:   refreshInterval,
+		entries:           map[string]*entry{},
+		documentFrequency: map[string]int{},
+	}
+
+	if persistence != nil {
+		if err := fv.load(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return fv, nil
+}
+
+// load replaces the documents in memory with the stored ones. The lock must be held.
+func (fv *FlatVector) load(ctx context.Context) error {
+	docs, vectors, version, err := fv.persistence.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load vectors: %w", err)
+	}
+
+	fv.entries = map[string]*entry{}
+	fv.documentFrequency = map[string]int{}
+	for i, doc := range docs {
+		// Documents embedded with other dimensions can't be compared, they are replaced by reindexing.
+		if len(vectors[i]) != fv.config.Dimensions {
+			continue
+		}
+		fv.add(doc, vectors[i])
+	}
+	fv.version = version
+	fv.checkedAt = time.Now()
+	return nil
+}
+
+// refresh reloads the documents when another server changed them, checking at most once per refresh interval.
+func (fv *FlatVector) refresh(ctx context.Context) error {
+	if fv.persistence == nil {
+		return nil
+	}
+
+	fv.mu.RLock()
+	checked := time.Since(fv.checkedAt) < fv.refreshInterval
+	fv.mu.RUnlock()
+	if checked {
+		return nil
+	}
+
+	version, err := fv.persistence.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check the version of the vectors: %w", err)
+	}
+
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+	fv.checkedAt = time.Now()
+	if version == fv.version {
+		return nil
+	}
+	return fv.load(ctx)
+}
+
+// changed records the version of the documents after a change made by this server, which already applied it in
+// memory. Changes made by other servers since are picked up by reloading the documents. The lock must be held.
+func (fv *FlatVector) changed(ctx context.Context, version int64) error {
+	if version == fv.version+1 {
+		fv.version = version
+		return nil
+	}
+	return fv.load(ctx)
+}
+
+// documentID identifies a stored document, chunks of the same post being different documents
+func documentID(doc embeddings.PostDocument) string {
+	if doc.IsChunk {
+		return fmt.Sprintf("%s_chunk_%d", doc.PostID, doc.ChunkIndex)
+	}
+	return doc.PostID
+}
+
+// add stores a document in memory, replacing the document with the same ID. The lock must be held.
+func (fv *FlatVector) add(doc embeddings.PostDocument, embedding []float32) {
+	id := documentID(doc)
+	fv.remove(id)
+
+	e := &entry{doc: doc, embedding: embedding, terms: termFrequencies(doc.Content)}
+	for term := range e.terms {
+		fv.documentFrequency[term]++
+	}
+	fv.entries[id] = e
+}
+
+// remove deletes a document from memory. The lock must be held.
+func (fv *FlatVector) remove(id string) {
+	e, ok := fv.entries[id]
+	if !ok {
+		return
+	}
+	for term := range e.terms {
+		fv.documentFrequency[term]--
+		if fv.documentFrequency[term] <= 0 {
+			delete(fv.documentFrequency, term)
+		}
+	}
+	delete(fv.entries, id)
+}
+
+func (fv *FlatVector) Store(ctx context.Context, docs []embeddings.PostDocument, embeddings [][]float32) error {
+	if len(docs) != len(embeddings) {
+		return fmt.Errorf("got %d embeddings for %d documents", len(embeddings), len(docs))
+	}
+	for _, embedding := range embeddings {
+		if len(embedding) != fv.config.Dimensions {
+			return fmt.Errorf("embedding has %d dimensions, expected %d", len(embedding), fv.config.Dimensions)
+		}
+	}
+
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	var version int64
+	if fv.persistence != nil {
+		var err error
+		if version, err = fv.persistence.Store(ctx, docs, embeddings); err != nil {
+			return fmt.Errorf("failed to save vectors: %w", err)
+		}
+	}
+
+	for i, doc := range docs {
+		fv.add(doc, embeddings[i])
+	}
+	if fv.persistence != nil {
+		return fv.changed(ctx, version)
+	}
+	return nil
+}
+
+// candidates returns the documents the user can search matching the filters of the options. The read lock must be held.
+func (fv *FlatVector) candidates(ctx context.Context, opts embeddings.SearchOptions) ([]*entry, error) {
+	if opts.UserID == "" {
+		return nil, fmt.Errorf("user ID is required to validate permissions")
+	}
+
+	channelIDs, err := fv.channels.SearchableChannels(ctx, opts.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels of the user: %w", err)
+	}
+	searchable := make(map[string]bool, len(channelIDs))
+	for _, channelID := range channelIDs {
+		searchable[channelID] = true
+	}
+
+	var candidates []*entry
+	for _, e := range fv.entries {
+		doc := e.doc
+		switch {
+		case !searchable[doc.ChannelID]:
+		case opts.TeamID != "" && doc.TeamID != opts.TeamID:
+		case opts.ChannelID != "" && doc.ChannelID != opts.ChannelID:
+		case opts.CreatedAfter != 0 && doc.CreateAt <= opts.CreatedAfter:
+		case opts.CreatedBefore != 0 && doc.CreateAt >= opts.CreatedBefore:
+		default:
+			candidates = append(candidates, e)
+		}
+	}
+	return candidates, nil
+}
+
+// Search returns the documents closest to the embedding, scored like PGVector with the L2 metric: 1 / (1 + distance)
+func (fv *FlatVector) Search(ctx context.Context, embedding []float32, opts embeddings.SearchOptions) ([]embeddings.SearchResult, error) {
+	if len(embedding) != fv.config.Dimensions {
+		return nil, fmt.Errorf("embedding has %d dimensions, expected %d", len(embedding), fv.config.Dimensions)
+	}
+	if err := fv.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	fv.mu.RLock()
+	defer fv.mu.RUnlock()
+
+	candidates, err := fv.candidates(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]embeddings.SearchResult, 0, len(candidates))
+	for _, e := range candidates {
+		score := 1 / (1 + distance(embedding, e.embedding))
+		if score < opts.MinScore {
+			continue
+		}
+		results = append(results, embeddings.SearchResult{Document: e.doc, Score: score})
+	}
+
+	return sortResults(results, opts.Limit), nil
+}
+
+// SearchText performs a keyword search matching any of the words of the query, rare words counting more
+func (fv *FlatVector) SearchText(ctx context.Context, query string, opts embeddings.SearchOptions) ([]embeddings.SearchResult, error) {
+	terms := termFrequencies(query)
+	if err := fv.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	fv.mu.RLock()
+	defer fv.mu.RUnlock()
+
+	candidates, err := fv.candidates(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []embeddings.SearchResult
+	for _, e := range candidates {
+		var rank float64
+		for term := range terms {
+			frequency := e.terms[term]
+			if frequency == 0 {
+				continue
+			}
+			idf := math.Log(1 + float64(len(fv.entries))/float64(fv.documentFrequency[term]))
+			rank += idf * float64(frequency) / float64(frequency+1)
+		}
+		if rank == 0 {
+			continue
+		}
+
+		// Like PGVector, the unbounded rank is mapped to a score between 0 and 1.
+		score := float32(rank / (rank + 1))
+		if score < opts.MinScore {
+			continue
+		}
+		results = append(results, embeddings.SearchResult{Document: e.doc, Score: score})
+	}
+
+	return sortResults(results, opts.Limit), nil
+}
+
+// sortResults orders results by decreasing score, then by post and chunk so that searches are deterministic
+func sortResults(results []embeddings.SearchResult, limit int) []embeddings.SearchResult {
+	slices.SortFunc(results, func(a, b embeddings.SearchResult) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		case a.Document.PostID != b.Document.PostID:
+			if a.Document.PostID < b.Document.PostID {
+				return -1
+			}
+			return 1
+		}
+		return a.Document.ChunkIndex - b.Document.ChunkIndex
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// distance returns the Euclidean distance between two embeddings of the same dimensions
+func distance(a, b []float32) float32 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i] - b[i])
+		sum += d * d
+	}
+	return float32(math.Sqrt(sum))
+}
+
+// GetChunks returns the documents stored for a post ordered by chunk index, without checking permissions
+func (fv *FlatVector) GetChunks(ctx context.Context, postID string) ([]embeddings.PostDocument, error) {
+	if err := fv.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	fv.mu.RLock()
+	defer fv.mu.RUnlock()
+
+	var docs []embeddings.PostDocument
+	for _, e := range fv.entries {
+		if e.doc.PostID == postID {
+			docs = append(docs, e.doc)
+		}
+	}
+	slices.SortFunc(docs, func(a, b embeddings.PostDocument) int {
+		return a.ChunkIndex - b.ChunkIndex
+	})
+	return docs, nil
+}
+
+func (fv *FlatVector) Delete(ctx context.Context, postIDs []string) error {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	var version int64
+	if fv.persistence != nil {
+		var err error
+		if version, err = fv.persistence.Delete(ctx, postIDs); err != nil {
+			return fmt.Errorf("failed to delete vectors: %w", err)
+		}
+	}
+
+	deleted := make(map[string]bool, len(postIDs))
+	for _, postID := range postIDs {
+		deleted[postID] = true
+	}
+	for id, e := range fv.entries {
+		if deleted[e.doc.PostID] {
+			fv.remove(id)
+		}
+	}
+	if fv.persistence != nil {
+		return fv.changed(ctx, version)
+	}
+	return nil
+}
+
+func (fv *FlatVector) Clear(ctx context.Context) error {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	var version int64
+	if fv.persistence != nil {
+		var err error
+		if version, err = fv.persistence.Clear(ctx); err != nil {
+			return fmt.Errorf("failed to clear vectors: %w", err)
+		}
+	}
+
+	fv.entries = map[string]*entry{}
+	fv.documentFrequency = map[string]int{}
+	if fv.persistence != nil {
+		return fv.changed(ctx, version)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package flatvector
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/chunking"
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChannelAccess maps users to the channels they can search.
+type fakeChannelAccess map[string][]string
+
+func (f fakeChannelAccess) SearchableChannels(ctx context.Context, userID string) ([]string, error) {
+	return f[userID], nil
+}
+
+// memoryPersistence keeps saved documents in memory.
+type memoryPersistence struct {
+	docs    []embeddings.PostDocument
+	vectors [][]float32
+	version int64
+}
+
+func (m *memoryPersistence) Load(ctx context.Context) ([]embeddings.PostDocument, [][]float32, int64, error) {
+	return m.docs, m.vectors, m.version, nil
+}
+
+func (m *memoryPersistence) Version(ctx context.Context) (int64, error) {
+	return m.version, nil
+}
+
+func (m *memoryPersistence) Store(ctx context.Context, docs []embeddings.PostDocument, embeddings [][]float32) (int64, error) {
+	m.docs = append(m.docs, docs...)
+	m.vectors = append(m.vectors, embeddings...)
+	m.version++
+	return m.version, nil
+}
+
+func (m *memoryPersistence) Delete(ctx context.Context, postIDs []string) (int64, error) {
+	for i := len(m.docs) - 1; i >= 0; i-- {
+		if slices.Contains(postIDs, m.docs[i].PostID) {
+			m.docs = slices.Delete(m.docs, i, i+1)
+			m.vectors = slices.Delete(m.vectors, i, i+1)
+		}
+	}
+	m.version++
+	return m.version, nil
+}
+
+func (m *memoryPersistence) Clear(ctx context.Context) (int64, error) {
+	m.docs, m.vectors = nil, nil
+	m.version++
+	return m.version, nil
+}
+
+func postIDs(results []embeddings.SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Document.PostID
+	}
+	return ids
+}
+
+func setupStore(t *testing.T) *FlatVector {
+	fv, err := New(FlatVectorConfig{Dimensions: 3}, nil, fakeChannelAccess{
+		"user1": {"channel1", "channel2"},
+		"user2": {"channel3"},
+	})
+	require.NoError(t, err)
+
+	docs := []embeddings.PostDocument{
+		{PostID: "post1", CreateAt: 1000, TeamID: "team1", ChannelID: "channel1", UserID: "user1", Content: "Deploy to db-01.prod.example.com failed with ERR_4012"},
+		{PostID: "post2", CreateAt: 2000, TeamID: "team1", ChannelID: "channel2", UserID: "user1", Content: "The database is slow today"},
+		{PostID: "post3", CreateAt: 3000, TeamID: "team2", ChannelID: "channel3", UserID: "user2", Content: "ERR_4012 again in another team"},
+		{PostID: "post4", CreateAt: 4000, TeamID: "team1", ChannelID: "channel1", UserID: "user1", Content: "Lunch is at noon"},
+	}
+	vectors := [][]float32{{1, 0, 0}, {0.9, 0.1, 0}, {1, 0, 0}, {0, 0, 1}}
+	require.NoError(t, fv.Store(context.Background(), docs, vectors))
+	return fv
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	fv := setupStore(t)
+
+	t.Run("closest documents of the channels of the user", func(t *testing.T) {
+		results, err := fv.Search(ctx, []float32{1, 0, 0}, embeddings.SearchOptions{UserID: "user1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"post1", "post2", "post4"}, postIDs(results))
+		assert.Equal(t, float32(1), results[0].Score)
+		assert.InDelta(t, 1/(1+math.Sqrt2), results[2].Score, 0.0001)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		query := []float32{1, 0, 0}
+
+		results, err := fv.Search(ctx, query, embeddings.SearchOptions{UserID: "user1", Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"post1"}, postIDs(results))
+
+		results, err = fv.Search(ctx, query, embeddings.SearchOptions{UserID: "user1", ChannelID: "channel2"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"post2"}, postIDs(results))
+
+		results, err = fv.Search(ctx, query, embeddings.SearchOptions{UserID: "user1", TeamID: "team2"})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+
+		results, err = fv.Search(ctx, query, embeddings.SearchOptions{UserID: "user1", CreatedAfter: 1000, CreatedBefore: 4000})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"post2"}, postIDs(results))
+
+		results, err = fv.Search(ctx, query, embeddings.SearchOptions{UserID: "user1", MinScore: 0.5})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"post1", "post2"}, postIDs(results))
+	})
+
+	t.Run("permissions are required", func(t *testing.T) {
+		_, err := fv.Search(ctx, []float32{1, 0, 0}, embeddings.SearchOptions{})
+		require.Error(t, err)
+
+		results, err := fv.Search(ctx, []float32{1, 0, 0}, embeddings.SearchOptions{UserID: "user3"})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	})
+
+	t.Run("embeddings of other dimensions", func(t *testing.T) {
+		_, err := fv.Search(ctx, []float32{1, 0}, embeddings.SearchOptions{UserID: "user1"})
+		require.Error(t, err)
+		require.Error(t, fv.Store(ctx, []embeddings.PostDocument{{PostID: "post5"}}, [][]float32{{1, 0}}))
+	})
+}
+
+func TestSearchText(t *testing.T) {
+	ctx := context.Background()
+	fv := setupStore(t)
+
+	results, err := fv.SearchText(ctx, "what does ERR_4012 mean", embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"post1"}, postIDs(results))
+	assert.Greater(t, results[0].Score, float32(0))
+	assert.Less(t, results[0].Score, float32(1))
+
+	results, err = fv.SearchText(ctx, "DB-01.prod.example.com?", embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"post1"}, postIDs(results))
+
+	// Documents matching more terms rank higher.
+	results, err = fv.SearchText(ctx, "slow database ERR_4012", embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"post2", "post1"}, postIDs(results))
+
+	// Rare terms count more than common ones, "is" is in two documents and "failed" in one.
+	results, err = fv.SearchText(ctx, "is failed", embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"post1", "post2", "post4"}, postIDs(results))
+
+	results, err = fv.SearchText(ctx, "ERR_4012", embeddings.SearchOptions{UserID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"post3"}, postIDs(results))
+}
+
+func TestChunks(t *testing.T) {
+	ctx := context.Background()
+	fv, err := New(FlatVectorConfig{Dimensions: 1}, nil, fakeChannelAccess{"user1": {"channel1"}})
+	require.NoError(t, err)
+
+	chunk := func(index int, content string) embeddings.PostDocument {
+		return embeddings.PostDocument{PostID: "post1", ChannelID: "channel1", Content: content, ChunkInfo: chunking.ChunkInfo{IsChunk: true, ChunkIndex: index, TotalChunks: 2}}
+	}
+	require.NoError(t, fv.Store(ctx, []embeddings.PostDocument{chunk(1, "second"), chunk(0, "first")}, [][]float32{{1}, {0.5}}))
+
+	chunks, err := fv.GetChunks(ctx, "post1")
+	require.NoError(t, err)
+	assert.Equal(t, []embeddings.PostDocument{chunk(0, "first"), chunk(1, "second")}, chunks)
+
+	// Storing a chunk again replaces it.
+	require.NoError(t, fv.Store(ctx, []embeddings.PostDocument{chunk(1, "updated")}, [][]float32{{1}}))
+	results, err := fv.SearchText(ctx, "second", embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	require.NoError(t, fv.Delete(ctx, []string{"post1"}))
+	chunks, err = fv.GetChunks(ctx, "post1")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+	assert.Empty(t, fv.documentFrequency)
+}
+
+func TestPersistence(t *testing.T) {
+	ctx := context.Background()
+	persistence := &memoryPersistence{}
+	channels := fakeChannelAccess{"user1": {"channel1"}}
+
+	fv, err := New(FlatVectorConfig{Dimensions: 2}, persistence, channels)
+	require.NoError(t, err)
+	require.NoError(t, fv.Store(ctx, []embeddings.PostDocument{{PostID: "post1", ChannelID: "channel1", Content: "hello"}}, [][]float32{{1, 0}}))
+
+	// Documents of other dimensions are ignored when loading.
+	persistence.docs = append(persistence.docs, embeddings.PostDocument{PostID: "post2", ChannelID: "channel1"})
+	persistence.vectors = append(persistence.vectors, []float32{1, 0, 0})
+
+	loaded, err := New(FlatVectorConfig{Dimensions: 2}, persistence, channels)
+	require.NoError(t, err)
+	results, err := loaded.Search(ctx, []float32{1, 0}, embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"post1"}, postIDs(results))
+
+	require.NoError(t, loaded.Clear(ctx))
+	assert.Empty(t, persistence.docs)
+	results, err = loaded.Search(ctx, []float32{1, 0}, embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestClusterRefresh(t *testing.T) {
+	ctx := context.Background()
+	persistence := &memoryPersistence{}
+	channels := fakeChannelAccess{"user1": {"channel1"}}
+	search := func(fv *FlatVector) []string {
+		results, err := fv.Search(ctx, []float32{1, 0}, embeddings.SearchOptions{UserID: "user1"})
+		require.NoError(t, err)
+		return postIDs(results)
+	}
+
+	// Two servers of a cluster sharing the stored documents.
+	server1, err := New(FlatVectorConfig{Dimensions: 2}, persistence, channels)
+	require.NoError(t, err)
+	server2, err := New(FlatVectorConfig{Dimensions: 2}, persistence, channels)
+	require.NoError(t, err)
+	server2.refreshInterval = 0
+
+	require.NoError(t, server1.Store(ctx, []embeddings.PostDocument{
+		{PostID: "post1", ChannelID: "channel1"},
+		{PostID: "post2", ChannelID: "channel1"},
+	}, [][]float32{{1, 0}, {0, 1}}))
+	assert.Equal(t, []string{"post1", "post2"}, search(server2))
+
+	// Deleted documents are no longer found by the other server.
+	require.NoError(t, server1.Delete(ctx, []string{"post1"}))
+	assert.Equal(t, []string{"post2"}, search(server2))
+
+	// A server writing after another one did picks up the change of the other server.
+	require.NoError(t, server2.Store(ctx, []embeddings.PostDocument{{PostID: "post3", ChannelID: "channel1"}}, [][]float32{{1, 0}}))
+	require.NoError(t, server1.Store(ctx, []embeddings.PostDocument{{PostID: "post4", ChannelID: "channel1"}}, [][]float32{{0, 1}}))
+	server1.mu.RLock()
+	assert.Len(t, server1.entries, 3)
+	server1.mu.RUnlock()
+
+	// Searches within the refresh interval don't check for changes.
+	require.NoError(t, server2.Delete(ctx, []string{"post2", "post3", "post4"}))
+	assert.Equal(t, []string{"post3", "post2", "post4"}, search(server1))
+}
+
+func TestEncodeEmbedding(t *testing.T) {
+	embedding := []float32{0.25, -1.5, 3}
+	assert.Equal(t, embedding, decodeEmbedding(encodeEmbedding(embedding)))
+}
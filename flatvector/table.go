@@ -0,0 +1,278 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package flatvector
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattermost/mattermost-plugin-ai/chunking"
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+)
+
+// TablePersistence saves documents in a plain table, embeddings being stored as bytes so that no extension is needed.
+// The version of the documents is kept in a table of its own, incremented in the transaction of every change.
+type TablePersistence struct {
+	db           *sqlx.DB
+	table        string
+	versionTable string
+}
+
+// vectorsTable returns the table of a generation of the index, the first one using the original table
+func vectorsTable(generation int) string {
+	if generation <= 1 {
+		return "llm_posts_vectors"
+	}
+	return fmt.Sprintf("llm_posts_vectors_%d", generation)
+}
+
+// versionTable returns the table holding the version of the documents of a vectors table
+func versionTable(table string) string {
+	return table + "_version"
+}
+
+// NewTablePersistence creates the table of the generation of the index if it doesn't exist.
+func NewTablePersistence(db *sqlx.DB, generation int) (*TablePersistence, error) {
+	table := vectorsTable(generation)
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + table + ` (
+			id TEXT PRIMARY KEY,             								-- Post ID or chunk ID (post_id_chunk_N)
+			post_id TEXT NOT NULL REFERENCES Posts(Id) ON DELETE CASCADE,   -- Original post ID (same as id for non-chunks)
+			team_id TEXT NOT NULL,
+			channel_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			content TEXT NOT NULL,
+			embedding BYTEA NOT NULL,       -- Little endian float32 values
+			created_at BIGINT NOT NULL,
+			is_chunk BOOLEAN NOT NULL DEFAULT FALSE,
+			chunk_index INTEGER NOT NULL DEFAULT 0,
+			total_chunks INTEGER NOT NULL DEFAULT 0
+		)`); err != nil {
+		return nil, fmt.Errorf("failed to create %s table: %w", table, err)
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS " + table + "_post_id_idx ON " + table + "(post_id)"); err != nil {
+		return nil, fmt.Errorf("failed to create index: %w", err)
+	}
+
+	version := versionTable(table)
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + version + ` (
+			id INTEGER PRIMARY KEY,
+			version BIGINT NOT NULL
+		)`); err != nil {
+		return nil, fmt.Errorf("failed to create %s table: %w", version, err)
+	}
+	if _, err := db.Exec("INSERT INTO " + version + " (id, version) VALUES (1, 0) ON CONFLICT (id) DO NOTHING"); err != nil {
+		return nil, fmt.Errorf("failed to initialize %s table: %w", version, err)
+	}
+
+	return &TablePersistence{db: db, table: table, versionTable: version}, nil
+}
+
+type vectorRow struct {
+	ID          string `db:"id"`
+	PostID      string `db:"post_id"`
+	TeamID      string `db:"team_id"`
+	ChannelID   string `db:"channel_id"`
+	UserID      string `db:"user_id"`
+	Content     string `db:"content"`
+	Embedding   []byte `db:"embedding"`
+	CreatedAt   int64  `db:"created_at"`
+	IsChunk     bool   `db:"is_chunk"`
+	ChunkIndex  int    `db:"chunk_index"`
+	TotalChunks int    `db:"total_chunks"`
+}
+
+func (tp *TablePersistence) Load(ctx context.Context) ([]embeddings.PostDocument, [][]float32, int64, error) {
+	// The documents and their version are read from the same snapshot.
+	tx, err := tp.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var version int64
+	if err := tx.GetContext(ctx, &version, "SELECT version FROM "+tp.versionTable+" WHERE id = 1"); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to get version of vectors: %w", err)
+	}
+	var rows []vectorRow
+	if err := tx.SelectContext(ctx, &rows, "SELECT * FROM "+tp.table); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to load vectors: %w", err)
+	}
+
+	docs := make([]embeddings.PostDocument, len(rows))
+	vectors := make([][]float32, len(rows))
+	for i, row := range rows {
+		docs[i] = embeddings.PostDocument{
+			PostID:    row.PostID,
+			CreateAt:  row.CreatedAt,
+			TeamID:    row.TeamID,
+			ChannelID: row.ChannelID,
+			UserID:    row.UserID,
+			Content:   row.Content,
+			ChunkInfo: chunking.ChunkInfo{
+				IsChunk:     row.IsChunk,
+				ChunkIndex:  row.ChunkIndex,
+				TotalChunks: row.TotalChunks,
+			},
+		}
+		vectors[i] = decodeEmbedding(row.Embedding)
+	}
+	return docs, vectors, version, nil
+}
+
+func (tp *TablePersistence) Version(ctx context.Context) (int64, error) {
+	var version int64
+	if err := tp.db.GetContext(ctx, &version, "SELECT version FROM "+tp.versionTable+" WHERE id = 1"); err != nil {
+		return 0, fmt.Errorf("failed to get version of vectors: %w", err)
+	}
+	return version, nil
+}
+
+// change runs fn in a transaction incrementing the version of the documents and returns the new version.
+// The version row is locked first, so that versions follow the order in which changes are committed.
+func (tp *TablePersistence) change(ctx context.Context, fn func(tx *sqlx.Tx) error) (int64, error) {
+	tx, err := tp.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var version int64
+	if err := tx.GetContext(ctx, &version, "UPDATE "+tp.versionTable+" SET version = version + 1 WHERE id = 1 RETURNING version"); err != nil {
+		return 0, fmt.Errorf("failed to update version of vectors: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return version, nil
+}
+
+func (tp *TablePersistence) Store(ctx context.Context, docs []embeddings.PostDocument, embeddings [][]float32) (int64, error) {
+	return tp.change(ctx, func(tx *sqlx.Tx) error {
+		return tp.store(ctx, tx, docs, embeddings)
+	})
+}
+
+func (tp *TablePersistence) store(ctx context.Context, tx *sqlx.Tx, docs []embeddings.PostDocument, embeddings [][]float32) error {
+	for i, doc := range docs {
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO `+tp.table+` (
+				id, post_id, team_id, channel_id, user_id, content, embedding, created_at,
+				is_chunk, chunk_index, total_chunks
+			)
+			VALUES (
+				:id, :post_id, :team_id, :channel_id, :user_id, :content, :embedding, :created_at,
+				:is_chunk, :chunk_index, :total_chunks
+			)
+			ON CONFLICT (id) DO UPDATE SET
+				content = EXCLUDED.content,
+				embedding = EXCLUDED.embedding,
+				is_chunk = EXCLUDED.is_chunk,
+				chunk_index = EXCLUDED.chunk_index,
+				total_chunks = EXCLUDED.total_chunks`,
+			vectorRow{
+				ID:          documentID(doc),
+				PostID:      doc.PostID,
+				TeamID:      doc.TeamID,
+				ChannelID:   doc.ChannelID,
+				UserID:      doc.UserID,
+				Content:     doc.Content,
+				Embedding:   encodeEmbedding(embeddings[i]),
+				CreatedAt:   doc.CreateAt,
+				IsChunk:     doc.IsChunk,
+				ChunkIndex:  doc.ChunkIndex,
+				TotalChunks: doc.TotalChunks,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert vector: %w", err)
+		}
+	}
+	return nil
+}
+
+func (tp *TablePersistence) Delete(ctx context.Context, postIDs []string) (int64, error) {
+	query, args, err := sq.
+		Delete(tp.table).
+		Where(sq.Eq{"post_id": postIDs}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create query: %w", err)
+	}
+	return tp.change(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to delete vectors: %w", err)
+		}
+		return nil
+	})
+}
+
+func (tp *TablePersistence) Clear(ctx context.Context) (int64, error) {
+	return tp.change(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "TRUNCATE TABLE "+tp.table); err != nil {
+			return fmt.Errorf("failed to clear vectors: %w", err)
+		}
+		return nil
+	})
+}
+
+// DropGeneration removes the tables of a generation of the index
+func DropGeneration(ctx context.Context, db *sqlx.DB, generation int) error {
+	table := vectorsTable(generation)
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table+", "+versionTable(table)); err != nil {
+		return fmt.Errorf("failed to drop index generation %d: %w", generation, err)
+	}
+	return nil
+}
+
+func encodeEmbedding(embedding []float32) []byte {
+	encoded := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(encoded[4*i:], math.Float32bits(value))
+	}
+	return encoded
+}
+
+func decodeEmbedding(encoded []byte) []float32 {
+	embedding := make([]float32, len(encoded)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(encoded[4*i:]))
+	}
+	return embedding
+}
+
+// DBChannelAccess reads channel memberships from the Mattermost database.
+type DBChannelAccess struct {
+	db *sqlx.DB
+}
+
+func NewDBChannelAccess(db *sqlx.DB) *DBChannelAccess {
+	return &DBChannelAccess{db: db}
+}
+
+func (a *DBChannelAccess) SearchableChannels(ctx context.Context, userID string) ([]string, error) {
+	var channelIDs []string
+	if err := a.db.SelectContext(ctx, &channelIDs, `
+		SELECT cm.ChannelId FROM ChannelMembers cm
+		JOIN Channels c ON cm.ChannelId = c.Id
+		WHERE cm.UserId = $1 AND c.DeleteAt = 0`, userID); err != nil {
+		return nil, fmt.Errorf("failed to get channel memberships: %w", err)
+	}
+	return channelIDs, nil
+}
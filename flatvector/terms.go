@@ -0,0 +1,25 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package flatvector
+
+import (
+	"strings"
+	"unicode"
+)
+
+// termFrequencies counts the terms of a text. Terms are lowercase and keep the punctuation joining identifiers,
+// so that ticket IDs, error codes and hostnames match exactly.
+func termFrequencies(text string) map[string]int {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !strings.ContainsRune("_-./:@", r)
+	})
+
+	terms := map[string]int{}
+	for _, word := range words {
+		if term := strings.Trim(word, "-./:@"); term != "" {
+			terms[term]++
+		}
+	}
+	return terms
+}
@@ -22,41 +22,46 @@ func ThreadData(data *mmapi.ThreadData) string {
 }
 
 func PostBody(post *model.Post) string {
+	return post.Message + PostAttachments(post)
+}
+
+// PostAttachments renders the text of the message attachments of a post, each starting on a new line
+func PostAttachments(post *model.Post) string {
 	attachments := post.Attachments()
-	if len(attachments) > 0 {
-		result := strings.Builder{}
-		result.WriteString(post.Message)
-		for _, attachment := range attachments {
+	if len(attachments) == 0 {
+		return ""
+	}
+
+	result := strings.Builder{}
+	for _, attachment := range attachments {
+		result.WriteString("\n")
+		if attachment.Pretext != "" {
+			result.WriteString(attachment.Pretext)
 			result.WriteString("\n")
-			if attachment.Pretext != "" {
-				result.WriteString(attachment.Pretext)
-				result.WriteString("\n")
-			}
-			if attachment.Title != "" {
-				result.WriteString(attachment.Title)
-				result.WriteString("\n")
-			}
-			if attachment.Text != "" {
-				result.WriteString(attachment.Text)
-				result.WriteString("\n")
-			}
-			for _, field := range attachment.Fields {
-				value, err := json.Marshal(field.Value)
-				if err != nil {
-					continue
-				}
-				result.WriteString(field.Title)
-				result.WriteString(": ")
-				result.Write(value)
-				result.WriteString("\n")
+		}
+		if attachment.Title != "" {
+			result.WriteString(attachment.Title)
+			result.WriteString("\n")
+		}
+		if attachment.Text != "" {
+			result.WriteString(attachment.Text)
+			result.WriteString("\n")
+		}
+		for _, field := range attachment.Fields {
+			value, err := json.Marshal(field.Value)
+			if err != nil {
+				continue
 			}
+			result.WriteString(field.Title)
+			result.WriteString(": ")
+			result.Write(value)
+			result.WriteString("\n")
+		}
 
-			if attachment.Footer != "" {
-				result.WriteString(attachment.Footer)
-				result.WriteString("\n")
-			}
+		if attachment.Footer != "" {
+			result.WriteString(attachment.Footer)
+			result.WriteString("\n")
 		}
-		return result.String()
 	}
-	return post.Message
+	return result.String()
 }
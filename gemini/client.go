@@ -0,0 +1,254 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+)
+
+const DefaultAPIURL = "https://generativelanguage.googleapis.com/v1beta"
+
+const (
+	RoleUser  = "user"
+	RoleModel = "model"
+)
+
+type Content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []Part `json:"parts"`
+}
+
+// Part is one piece of a Content, exactly one of its fields other than Thought is set.
+type Part struct {
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"`
+	InlineData       *Blob             `json:"inlineData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type Blob struct {
+	MimeType string `json:"mimeType"`
+	// Data is base64 encoded.
+	Data string `json:"data"`
+}
+
+type FunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type FunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type FunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// ParametersJSONSchema takes a full JSON schema, unlike the OpenAPI subset accepted by parameters.
+	ParametersJSONSchema any `json:"parametersJsonSchema,omitempty"`
+}
+
+type Tool struct {
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations"`
+}
+
+type SafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+type ThinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget,omitempty"`
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
+}
+
+type GenerationConfig struct {
+	MaxOutputTokens  int             `json:"maxOutputTokens,omitempty"`
+	Temperature      *float32        `json:"temperature,omitempty"`
+	TopP             *float32        `json:"topP,omitempty"`
+	StopSequences    []string        `json:"stopSequences,omitempty"`
+	Seed             *int64          `json:"seed,omitempty"`
+	ResponseMimeType string          `json:"responseMimeType,omitempty"`
+	ResponseSchema   any             `json:"responseJsonSchema,omitempty"`
+	ThinkingConfig   *ThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type GenerateContentRequest struct {
+	Contents          []Content        `json:"contents"`
+	SystemInstruction *Content         `json:"systemInstruction,omitempty"`
+	Tools             []Tool           `json:"tools,omitempty"`
+	SafetySettings    []SafetySetting  `json:"safetySettings,omitempty"`
+	GenerationConfig  GenerationConfig `json:"generationConfig"`
+}
+
+type Candidate struct {
+	Content      Content `json:"content"`
+	FinishReason string  `json:"finishReason,omitempty"`
+}
+
+type PromptFeedback struct {
+	BlockReason string `json:"blockReason,omitempty"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount        int64 `json:"promptTokenCount"`
+	CandidatesTokenCount    int64 `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int64 `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int64 `json:"cachedContentTokenCount"`
+}
+
+type GenerateContentResponse struct {
+	Candidates     []Candidate     `json:"candidates"`
+	PromptFeedback *PromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  *UsageMetadata  `json:"usageMetadata,omitempty"`
+}
+
+// Model describes a model as listed by the API.
+type Model struct {
+	// Name is models/<model ID>.
+	Name                       string   `json:"name"`
+	InputTokenLimit            int      `json:"inputTokenLimit"`
+	OutputTokenLimit           int      `json:"outputTokenLimit"`
+	SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+	Thinking                   *bool    `json:"thinking,omitempty"`
+}
+
+type listModelsResponse struct {
+	Models        []Model `json:"models"`
+	NextPageToken string  `json:"nextPageToken"`
+}
+
+type apiErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+type Client struct {
+	apiKey     string
+	apiURL     string
+	httpClient *http.Client
+}
+
+func NewClient(apiKey string, httpClient *http.Client, apiURL string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+
+	return &Client{
+		apiKey:     apiKey,
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// ListModels returns every model available to the API key.
+func (c *Client) ListModels(ctx context.Context) ([]Model, error) {
+	var models []Model
+	pageToken := ""
+	for {
+		query := url.Values{"pageSize": {"1000"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+"/models?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("x-goog-api-key", c.apiKey)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page listModelsResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("gemini returned %s", resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode models: %w", err)
+		}
+
+		models = append(models, page.Models...)
+		if page.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// StreamGenerateContent sends the request and calls handle with every chunk of the response as it arrives.
+// Error responses are returned as an *llm.ProviderError.
+func (c *Client) StreamGenerateContent(ctx context.Context, model string, request GenerateContentRequest, handle func(GenerateContentResponse) error) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", c.apiURL, url.PathEscape(model))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		message := string(responseBody)
+		var apiErr apiErrorResponse
+		if json.Unmarshal(responseBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = apiErr.Error.Message
+		}
+		return &llm.ProviderError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: llm.RetryAfterFromHeader(resp.Header),
+			Err:        fmt.Errorf("gemini returned %s: %s", resp.Status, message),
+		}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Chunks carrying function call arguments or images can exceed the default token size.
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var chunk GenerateContentResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk); err != nil {
+			return fmt.Errorf("failed to parse response chunk: %w", err)
+		}
+		if err := handle(chunk); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
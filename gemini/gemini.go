@@ -0,0 +1,411 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+// Package gemini implements a language model backed by the Google Gemini API.
+package gemini
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+)
+
+const (
+	DefaultMaxTokens       = 8192
+	DefaultInputTokenLimit = 1000000
+	// MaxInlineDataSize is the largest image that can be sent inline with a request.
+	MaxInlineDataSize = 20 * 1024 * 1024
+)
+
+// safetyCategories are the harm categories the configured safety threshold is applied to.
+var safetyCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+// blockedFinishReasons are the reasons Gemini gives for stopping when it refuses to produce the response.
+var blockedFinishReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+	"IMAGE_SAFETY":       true,
+}
+
+type Gemini struct {
+	client           *Client
+	defaultModel     string
+	inputTokenLimit  int
+	outputTokenLimit int
+	safetyThreshold  string
+}
+
+func New(llmService llm.ServiceConfig, httpClient *http.Client) *Gemini {
+	wrappedHTTPClient := llm.WrapHTTPClientWithCustomHeaders(httpClient, llmService.CustomHeaders)
+
+	return &Gemini{
+		client:           NewClient(llmService.APIKey, wrappedHTTPClient, llmService.APIURL),
+		defaultModel:     llmService.DefaultModel,
+		inputTokenLimit:  llmService.InputTokenLimit,
+		outputTokenLimit: llmService.OutputTokenLimit,
+		safetyThreshold:  llmService.SafetyThreshold,
+	}
+}
+
+func isValidImageType(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/webp", "image/heic", "image/heif":
+		return true
+	}
+	return false
+}
+
+// conversationToContents creates the system instruction and the contents of a request from conversation posts.
+func conversationToContents(posts []llm.Post) (*Content, []Content) {
+	var systemParts []Part
+	contents := make([]Content, 0, len(posts))
+
+	// Consecutive posts of the same role are merged into a single content.
+	appendParts := func(role string, parts ...Part) {
+		if len(parts) == 0 {
+			return
+		}
+		if len(contents) > 0 && contents[len(contents)-1].Role == role {
+			contents[len(contents)-1].Parts = append(contents[len(contents)-1].Parts, parts...)
+			return
+		}
+		contents = append(contents, Content{Role: role, Parts: parts})
+	}
+
+	for _, post := range posts {
+		role := RoleUser
+		switch post.Role {
+		case llm.PostRoleSystem:
+			systemParts = append(systemParts, Part{Text: post.Message})
+			continue
+		case llm.PostRoleBot:
+			role = RoleModel
+		case llm.PostRoleUser:
+		default:
+			continue
+		}
+
+		var parts []Part
+		if post.Message != "" {
+			parts = append(parts, Part{Text: post.Message})
+		}
+
+		for _, file := range post.Files {
+			if file.Kind == llm.FileKindDocument {
+				parts = append(parts, Part{Text: file.DocumentText()})
+				continue
+			}
+			if !isValidImageType(file.MimeType) {
+				parts = append(parts, Part{Text: fmt.Sprintf("[Unsupported image type: %s]", file.MimeType)})
+				continue
+			}
+			if file.Size > MaxInlineDataSize {
+				parts = append(parts, Part{Text: "[Image larger than 20MB was not included]"})
+				continue
+			}
+			data, err := io.ReadAll(file.Reader)
+			if err != nil {
+				parts = append(parts, Part{Text: "[Error reading image data]"})
+				continue
+			}
+			parts = append(parts, Part{InlineData: &Blob{
+				MimeType: file.MimeType,
+				Data:     base64.StdEncoding.EncodeToString(data),
+			}})
+		}
+
+		for _, tool := range post.ToolUse {
+			parts = append(parts, Part{FunctionCall: &FunctionCall{
+				ID:   tool.ID,
+				Name: tool.Name,
+				Args: json.RawMessage(tool.Arguments),
+			}})
+		}
+		appendParts(role, parts...)
+
+		// Results of the function calls are given back by the user.
+		if len(post.ToolUse) > 0 {
+			resultParts := make([]Part, 0, len(post.ToolUse))
+			for _, tool := range post.ToolUse {
+				response := map[string]any{"output": tool.Result}
+				if tool.Status != llm.ToolCallStatusSuccess {
+					response = map[string]any{"error": tool.Result}
+				}
+				resultParts = append(resultParts, Part{FunctionResponse: &FunctionResponse{
+					ID:       tool.ID,
+					Name:     tool.Name,
+					Response: response,
+				}})
+			}
+			appendParts(RoleUser, resultParts...)
+		}
+	}
+
+	if len(systemParts) == 0 {
+		return nil, contents
+	}
+	return &Content{Parts: systemParts}, contents
+}
+
+func convertTools(tools []llm.Tool) []Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	declarations := make([]FunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		declarations = append(declarations, FunctionDeclaration{
+			Name:                 tool.Name,
+			Description:          tool.Description,
+			ParametersJSONSchema: tool.Schema,
+		})
+	}
+	return []Tool{{FunctionDeclarations: declarations}}
+}
+
+func (g *Gemini) GetDefaultConfig() llm.LanguageModelConfig {
+	config := llm.LanguageModelConfig{
+		Model:              g.defaultModel,
+		MaxGeneratedTokens: DefaultMaxTokens,
+	}
+	if g.outputTokenLimit > 0 {
+		config.MaxGeneratedTokens = g.outputTokenLimit
+	}
+	return config
+}
+
+func (g *Gemini) createConfig(opts []llm.LanguageModelOption) llm.LanguageModelConfig {
+	cfg := g.GetDefaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+func (g *Gemini) requestFromConfig(cfg llm.LanguageModelConfig, request llm.CompletionRequest) GenerateContentRequest {
+	systemInstruction, contents := conversationToContents(request.Posts)
+	geminiRequest := GenerateContentRequest{
+		Contents:          contents,
+		SystemInstruction: systemInstruction,
+		GenerationConfig: GenerationConfig{
+			MaxOutputTokens: cfg.MaxGeneratedTokens,
+			Temperature:     cfg.Temperature,
+			TopP:            cfg.TopP,
+			StopSequences:   cfg.StopSequences,
+			Seed:            cfg.Seed,
+		},
+	}
+
+	if cfg.ThinkingBudgetTokens > 0 {
+		geminiRequest.GenerationConfig.ThinkingConfig = &ThinkingConfig{
+			ThinkingBudget:  cfg.ThinkingBudgetTokens,
+			IncludeThoughts: true,
+		}
+	}
+
+	if g.safetyThreshold != "" {
+		for _, category := range safetyCategories {
+			geminiRequest.SafetySettings = append(geminiRequest.SafetySettings, SafetySetting{
+				Category:  category,
+				Threshold: g.safetyThreshold,
+			})
+		}
+	}
+
+	if cfg.JSONOutputFormat != nil {
+		// Function calling can't be combined with a response schema.
+		geminiRequest.GenerationConfig.ResponseMimeType = "application/json"
+		geminiRequest.GenerationConfig.ResponseSchema = cfg.JSONOutputFormat
+	} else if request.Context != nil && request.Context.Tools != nil {
+		geminiRequest.Tools = convertTools(request.Context.Tools.GetTools())
+	}
+
+	return geminiRequest
+}
+
+func (g *Gemini) streamToChannel(ctx context.Context, cfg llm.LanguageModelConfig, request GenerateContentRequest, output chan<- llm.TextStreamEvent) {
+	var jsonOutput strings.Builder
+	var pendingToolCalls []llm.ToolCall
+	var usage *UsageMetadata
+	var blockedReason string
+
+	err := g.client.StreamGenerateContent(ctx, cfg.Model, request, func(chunk GenerateContentResponse) error {
+		if chunk.UsageMetadata != nil {
+			usage = chunk.UsageMetadata
+		}
+		if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+			blockedReason = chunk.PromptFeedback.BlockReason
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+
+		candidate := chunk.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				id := part.FunctionCall.ID
+				if id == "" {
+					// Older models don't identify their function calls.
+					id = fmt.Sprintf("call_%d", len(pendingToolCalls))
+				}
+				arguments := part.FunctionCall.Args
+				if len(arguments) == 0 {
+					arguments = json.RawMessage("{}")
+				}
+				pendingToolCalls = append(pendingToolCalls, llm.ToolCall{
+					ID:        id,
+					Name:      part.FunctionCall.Name,
+					Arguments: arguments,
+				})
+			case part.Text == "":
+			case part.Thought:
+				output <- llm.TextStreamEvent{
+					Type:  llm.EventTypeReasoning,
+					Value: part.Text,
+				}
+			case cfg.JSONOutputFormat != nil:
+				// Structured output is only sent once it has been validated.
+				jsonOutput.WriteString(part.Text)
+			default:
+				output <- llm.TextStreamEvent{
+					Type:  llm.EventTypeText,
+					Value: part.Text,
+				}
+			}
+		}
+
+		if blockedFinishReasons[candidate.FinishReason] {
+			blockedReason = candidate.FinishReason
+		}
+		return nil
+	})
+	if err != nil {
+		output <- llm.TextStreamEvent{
+			Type:  llm.EventTypeError,
+			Value: fmt.Errorf("error from gemini stream: %w", err),
+		}
+		return
+	}
+
+	if usage != nil {
+		// Thinking is billed as output. Cached tokens are already part of the prompt count.
+		output <- llm.TextStreamEvent{
+			Type: llm.EventTypeUsage,
+			Value: llm.TokenUsage{
+				InputTokens:  usage.PromptTokenCount,
+				OutputTokens: usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+				CachedTokens: usage.CachedContentTokenCount,
+			},
+		}
+	}
+
+	if blockedReason != "" {
+		output <- llm.TextStreamEvent{
+			Type:  llm.EventTypeError,
+			Value: fmt.Errorf("gemini blocked the response: %s", blockedReason),
+		}
+		return
+	}
+
+	if cfg.JSONOutputFormat != nil {
+		if err := llm.ValidateJSONOutput(cfg.JSONOutputFormat, jsonOutput.String()); err != nil {
+			output <- llm.TextStreamEvent{
+				Type:  llm.EventTypeError,
+				Value: err,
+			}
+			return
+		}
+		output <- llm.TextStreamEvent{
+			Type:  llm.EventTypeText,
+			Value: jsonOutput.String(),
+		}
+	}
+
+	if len(pendingToolCalls) > 0 {
+		output <- llm.TextStreamEvent{
+			Type:  llm.EventTypeToolCalls,
+			Value: pendingToolCalls,
+		}
+	}
+
+	output <- llm.TextStreamEvent{
+		Type:  llm.EventTypeEnd,
+		Value: nil,
+	}
+}
+
+func (g *Gemini) ChatCompletion(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	cfg := g.createConfig(opts)
+	if cfg.Model == "" {
+		return nil, errors.New("no model configured")
+	}
+	geminiRequest := g.requestFromConfig(cfg, request)
+
+	eventStream := make(chan llm.TextStreamEvent)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer close(eventStream)
+		defer cancel()
+		g.streamToChannel(ctx, cfg, geminiRequest, eventStream)
+	}()
+
+	return &llm.TextStreamResult{Stream: eventStream, Cancel: cancel}, nil
+}
+
+func (g *Gemini) ChatCompletionNoStream(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (string, error) {
+	result, err := g.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.ReadAll()
+}
+
+// ListModels returns the models that can generate content with their token limits and whether they think.
+func (g *Gemini) ListModels(ctx context.Context) ([]llm.ModelCapabilitiesOverride, error) {
+	models, err := g.client.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+
+	overrides := make([]llm.ModelCapabilitiesOverride, 0, len(models))
+	for _, model := range models {
+		if !slices.Contains(model.SupportedGenerationMethods, "generateContent") {
+			continue
+		}
+		overrides = append(overrides, llm.ModelCapabilitiesOverride{
+			Model:           model.Name,
+			ContextWindow:   model.InputTokenLimit,
+			MaxOutputTokens: model.OutputTokenLimit,
+			Reasoning:       model.Thinking,
+		})
+	}
+	return overrides, nil
+}
+
+func (g *Gemini) CountTokens(text string) int {
+	return llm.TokenizerForModel(g.defaultModel).CountTokens(text)
+}
+
+func (g *Gemini) InputTokenLimit() int {
+	if g.inputTokenLimit > 0 {
+		return g.inputTokenLimit
+	}
+	return DefaultInputTokenLimit
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+)
+
+// newTestProvider returns a provider whose requests are answered with the given chunks as server-sent events.
+// The path and body of the last request are recorded in the returned request.
+func newTestProvider(t *testing.T, config llm.ServiceConfig, chunks []string) (*Gemini, *recordedRequest) {
+	recorded := &recordedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorded.path = r.URL.Path
+		recorded.query = r.URL.RawQuery
+		recorded.apiKey = r.Header.Get("x-goog-api-key")
+		recorded.body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&recorded.body))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\r\n\r\n", chunk)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config.APIURL = server.URL
+	if config.DefaultModel == "" {
+		config.DefaultModel = "gemini-test"
+	}
+	return New(config, &http.Client{}), recorded
+}
+
+type recordedRequest struct {
+	path   string
+	query  string
+	apiKey string
+	body   map[string]any
+}
+
+func readEvents(t *testing.T, result *llm.TextStreamResult) []llm.TextStreamEvent {
+	var events []llm.TextStreamEvent
+	for event := range result.Stream {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestStreaming(t *testing.T) {
+	provider, recorded := newTestProvider(t, llm.ServiceConfig{APIKey: "key", SafetyThreshold: "BLOCK_ONLY_HIGH"}, []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":" there"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":3,"thoughtsTokenCount":5,"cachedContentTokenCount":8}}`,
+	})
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts: []llm.Post{
+			{Role: llm.PostRoleSystem, Message: "Be brief."},
+			{Role: llm.PostRoleUser, Message: "Hi"},
+		},
+		Context: llm.NewContext(),
+	}, llm.WithTemperature(0))
+	require.NoError(t, err)
+
+	events := readEvents(t, result)
+	require.Len(t, events, 4)
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeText, Value: "Hello"}, events[0])
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeText, Value: " there"}, events[1])
+	assert.Equal(t, llm.TokenUsage{InputTokens: 12, OutputTokens: 8, CachedTokens: 8}, events[2].Value)
+	assert.Equal(t, llm.EventTypeEnd, events[3].Type)
+
+	assert.Equal(t, "/models/gemini-test:streamGenerateContent", recorded.path)
+	assert.Equal(t, "alt=sse", recorded.query)
+	assert.Equal(t, "key", recorded.apiKey)
+	assert.Equal(t, map[string]any{"parts": []any{map[string]any{"text": "Be brief."}}}, recorded.body["systemInstruction"])
+	assert.Equal(t, []any{map[string]any{"role": "user", "parts": []any{map[string]any{"text": "Hi"}}}}, recorded.body["contents"])
+	generationConfig := recorded.body["generationConfig"].(map[string]any)
+	assert.Equal(t, float64(DefaultMaxTokens), generationConfig["maxOutputTokens"])
+	assert.Equal(t, float64(0), generationConfig["temperature"])
+	assert.Len(t, recorded.body["safetySettings"], len(safetyCategories))
+}
+
+func TestFunctionCalling(t *testing.T) {
+	provider, recorded := newTestProvider(t, llm.ServiceConfig{APIKey: "key"}, []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Thinking about it","thought":true},{"functionCall":{"name":"search","args":{"query":"x"}}}]},"finishReason":"STOP"}]}`,
+	})
+
+	tools := llm.NewToolStore(nil, false)
+	tools.AddTools([]llm.Tool{{
+		Name:        "search",
+		Description: "Search for things",
+		Schema: llm.NewJSONSchemaFromStruct[struct {
+			Query string `json:"query" jsonschema:"what to search for"`
+		}](),
+	}})
+	llmContext := llm.NewContext()
+	llmContext.Tools = tools
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts: []llm.Post{
+			{Role: llm.PostRoleUser, Message: "Find x", Files: []llm.File{{MimeType: "image/png", Size: 3, Reader: bytes.NewReader([]byte("png"))}}},
+			{Role: llm.PostRoleBot, ToolUse: []llm.ToolCall{{ID: "call_0", Name: "search", Arguments: []byte(`{"query":"y"}`), Result: "nothing", Status: llm.ToolCallStatusSuccess}}},
+			{Role: llm.PostRoleUser, Message: "Try x"},
+		},
+		Context: llmContext,
+	}, llm.WithThinkingBudget(1024))
+	require.NoError(t, err)
+
+	events := readEvents(t, result)
+	require.Len(t, events, 3)
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeReasoning, Value: "Thinking about it"}, events[0])
+	require.Equal(t, llm.EventTypeToolCalls, events[1].Type)
+	toolCalls := events[1].Value.([]llm.ToolCall)
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, "search", toolCalls[0].Name)
+	assert.NotEmpty(t, toolCalls[0].ID)
+	assert.JSONEq(t, `{"query":"x"}`, string(toolCalls[0].Arguments))
+
+	declarations := recorded.body["tools"].([]any)[0].(map[string]any)["functionDeclarations"].([]any)
+	require.Len(t, declarations, 1)
+	declaration := declarations[0].(map[string]any)
+	assert.Equal(t, "search", declaration["name"])
+	properties := declaration["parametersJsonSchema"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, "what to search for", properties["query"].(map[string]any)["description"], "the full schema must be sent")
+
+	contents := recorded.body["contents"].([]any)
+	require.Len(t, contents, 3)
+	userParts := contents[0].(map[string]any)["parts"].([]any)
+	assert.Equal(t, map[string]any{"mimeType": "image/png", "data": "cG5n"}, userParts[1].(map[string]any)["inlineData"])
+	assert.Equal(t, "model", contents[1].(map[string]any)["role"])
+	assert.Equal(t, map[string]any{"id": "call_0", "name": "search", "args": map[string]any{"query": "y"}}, contents[1].(map[string]any)["parts"].([]any)[0].(map[string]any)["functionCall"])
+	// The function response and the following message are both from the user.
+	resultParts := contents[2].(map[string]any)["parts"].([]any)
+	require.Len(t, resultParts, 2)
+	assert.Equal(t, map[string]any{"id": "call_0", "name": "search", "response": map[string]any{"output": "nothing"}}, resultParts[0].(map[string]any)["functionResponse"])
+	assert.Equal(t, "Try x", resultParts[1].(map[string]any)["text"])
+
+	generationConfig := recorded.body["generationConfig"].(map[string]any)
+	assert.Equal(t, map[string]any{"thinkingBudget": float64(1024), "includeThoughts": true}, generationConfig["thinkingConfig"])
+}
+
+type gradeOutput struct {
+	Pass  bool `json:"pass"`
+	Score int  `json:"score"`
+}
+
+func TestJSONOutput(t *testing.T) {
+	request := llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Grade this"}},
+		Context: llm.NewContext(),
+	}
+
+	t.Run("valid output", func(t *testing.T) {
+		provider, recorded := newTestProvider(t, llm.ServiceConfig{APIKey: "key"}, []string{
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"{\"pass\":true,"}]}}]}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"\"score\":3}"}]},"finishReason":"STOP"}]}`,
+		})
+
+		output, err := provider.ChatCompletionNoStream(context.Background(), request, llm.WithJSONOutput[gradeOutput]())
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"pass":true,"score":3}`, output)
+
+		generationConfig := recorded.body["generationConfig"].(map[string]any)
+		assert.Equal(t, "application/json", generationConfig["responseMimeType"])
+		assert.Equal(t, "object", generationConfig["responseJsonSchema"].(map[string]any)["type"])
+		assert.NotContains(t, recorded.body, "tools")
+	})
+
+	t.Run("output not matching the schema", func(t *testing.T) {
+		provider, _ := newTestProvider(t, llm.ServiceConfig{APIKey: "key"}, []string{
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"{\"pass\":\"yes\"}"}]},"finishReason":"STOP"}]}`,
+		})
+
+		_, err := provider.ChatCompletionNoStream(context.Background(), request, llm.WithJSONOutput[gradeOutput]())
+		assert.ErrorIs(t, err, llm.ErrStructuredOutput)
+	})
+}
+
+func TestBlockedResponse(t *testing.T) {
+	provider, _ := newTestProvider(t, llm.ServiceConfig{APIKey: "key"}, []string{
+		`{"promptFeedback":{"blockReason":"SAFETY"},"usageMetadata":{"promptTokenCount":5}}`,
+	})
+
+	_, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	})
+	assert.ErrorContains(t, err, "SAFETY")
+}
+
+func TestProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`)
+	}))
+	defer server.Close()
+
+	provider := New(llm.ServiceConfig{APIKey: "key", APIURL: server.URL, DefaultModel: "gemini-test"}, &http.Client{})
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	})
+	require.NoError(t, err)
+
+	event := <-result.Stream
+	require.Equal(t, llm.EventTypeError, event.Type)
+	var providerErr *llm.ProviderError
+	require.ErrorAs(t, event.Value.(error), &providerErr)
+	assert.Equal(t, http.StatusTooManyRequests, providerErr.StatusCode)
+	assert.ErrorContains(t, providerErr, "Resource has been exhausted")
+	assert.True(t, llm.IsRetryableError(providerErr))
+}
+
+func TestListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-goog-api-key"))
+		if r.URL.Query().Get("pageToken") == "" {
+			fmt.Fprint(w, `{"models":[{"name":"models/gemini-2.5-flash","inputTokenLimit":1048576,"outputTokenLimit":65536,
+				"supportedGenerationMethods":["generateContent","countTokens"],"thinking":true}],"nextPageToken":"next"}`)
+			return
+		}
+		fmt.Fprint(w, `{"models":[{"name":"models/text-embedding-004","inputTokenLimit":2048,"outputTokenLimit":1,
+			"supportedGenerationMethods":["embedContent"]}]}`)
+	}))
+	defer server.Close()
+
+	provider := New(llm.ServiceConfig{APIURL: server.URL, APIKey: "test-key"}, &http.Client{})
+	models, err := provider.ListModels(context.Background())
+	require.NoError(t, err)
+
+	thinking := true
+	assert.Equal(t, []llm.ModelCapabilitiesOverride{
+		{Model: "models/gemini-2.5-flash", ContextWindow: 1048576, MaxOutputTokens: 65536, Reasoning: &thinking},
+	}, models)
+}
@@ -17,3 +17,18 @@ func FormatAnalysisPostMessage(bundle *Bundle, locale string, postIDToAnalyze st
 		return T("agents.analyze_thread", "Sure, I will analyze this thread: %s/_redirect/pl/%s\n", siteURL, postIDToAnalyze)
 	}
 }
+
+// FormatRateLimitMessage formats the reply to a user who reached one of a bot's rate limits, identified by its scope
+func FormatRateLimitMessage(bundle *Bundle, locale string, scope string) string {
+	T := LocalizerFunc(bundle, locale)
+	switch scope {
+	case "user_requests":
+		return T("agents.rate_limit_user_requests", "You are sending requests too quickly. Please wait a minute and try again.")
+	case "user_tokens":
+		return T("agents.rate_limit_user_tokens", "You have reached your daily usage limit for this bot. Please try again tomorrow.")
+	case "team_tokens":
+		return T("agents.rate_limit_team_tokens", "This team has reached its daily usage limit for this bot. Please try again tomorrow.")
+	default:
+		return T("agents.rate_limit_bot_tokens", "This bot has reached its daily usage limit. Please try again tomorrow.")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package indexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	"github.com/mattermost/mattermost-plugin-ai/format"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// defaultMaxAttachmentLength is how many characters of each attachment are indexed when not configured
+	defaultMaxAttachmentLength = 20000
+	// maxThreadContextLength is how many characters of the root post are embedded along with replies
+	maxThreadContextLength = 1000
+)
+
+// FileRecord represents the text extracted from a file attached to a post
+type FileRecord struct {
+	PostID  string `db:"postid"`
+	Name    string `db:"name"`
+	Content string `db:"content"`
+}
+
+// SetIndexingConfig sets what is indexed along with the message of posts
+func (s *Indexer) SetIndexingConfig(config embeddings.IndexingConfig) {
+	s.indexing.Store(&config)
+}
+
+// indexingConfig returns what is indexed along with the message of posts, nothing when it was not set
+func (s *Indexer) indexingConfig() embeddings.IndexingConfig {
+	if config := s.indexing.Load(); config != nil {
+		return *config
+	}
+	return embeddings.IndexingConfig{}
+}
+
+// hasContent returns whether a post has content to index, attachments counting when they are indexed
+func (s *Indexer) hasContent(post *model.Post) bool {
+	if post.Message != "" {
+		return true
+	}
+	return s.indexingConfig().Attachments && (len(post.FileIds) > 0 || len(post.Attachments()) > 0)
+}
+
+// contentFilter is the SQL condition selecting the posts with content to index
+func (s *Indexer) contentFilter() string {
+	if s.indexingConfig().Attachments {
+		return "(Posts.Message != '' OR Posts.FileIds != '[]' OR Posts.Props->>'attachments' IS NOT NULL)"
+	}
+	return "Posts.Message != ''"
+}
+
+// postDocuments returns the documents indexed for a post: its message, then the text of its message attachments
+// and of its files when attachments are indexed. Replies embed the message of the root post when thread context
+// is enabled. The documents are stored together as chunks of the post.
+func (s *Indexer) postDocuments(post *model.Post, teamID string, files []FileRecord, rootMessage string) []embeddings.PostDocument {
+	indexing := s.indexingConfig()
+	doc := embeddings.PostDocument{
+		PostID:    post.Id,
+		CreateAt:  post.CreateAt,
+		TeamID:    teamID,
+		ChannelID: post.ChannelId,
+		UserID:    post.UserId,
+	}
+	if indexing.ThreadContext && post.RootId != "" && rootMessage != "" {
+		doc.Context = "In reply to: " + truncate(rootMessage, maxThreadContextLength)
+	}
+
+	var docs []embeddings.PostDocument
+	addDocument := func(content string) {
+		if strings.TrimSpace(content) == "" {
+			return
+		}
+		contentDoc := doc
+		contentDoc.Content = content
+		docs = append(docs, contentDoc)
+	}
+
+	addDocument(post.Message)
+	if !indexing.Attachments {
+		return docs
+	}
+
+	maxLength := indexing.MaxAttachmentLength
+	if maxLength <= 0 {
+		maxLength = defaultMaxAttachmentLength
+	}
+	addDocument(truncate(strings.TrimSpace(format.PostAttachments(post)), maxLength))
+	for _, file := range files {
+		if strings.TrimSpace(file.Content) == "" {
+			continue
+		}
+		addDocument(file.Name + "\n" + truncate(file.Content, maxLength))
+	}
+	return docs
+}
+
+// postFiles returns the text extracted from the files attached to a post
+func (s *Indexer) postFiles(post *model.Post) []FileRecord {
+	if !s.indexingConfig().Attachments {
+		return nil
+	}
+
+	files := make([]FileRecord, 0, len(post.FileIds))
+	for _, fileID := range post.FileIds {
+		fileInfo, err := s.pluginAPI.GetFileInfo(fileID)
+		if err != nil {
+			s.pluginAPI.LogWarn("Failed to get file info for indexing", "file_id", fileID, "error", err)
+			continue
+		}
+		files = append(files, FileRecord{
+			PostID:  post.Id,
+			Name:    fileInfo.Name,
+			Content: fileInfo.Content,
+		})
+	}
+	return files
+}
+
+// rootMessage returns the message of the root post of a reply when thread context is enabled, nothing when the
+// author of the root post is excluded by the policy or opted out of indexing
+func (s *Indexer) rootMessage(post *model.Post, policy *indexingPolicy) string {
+	if !s.indexingConfig().ThreadContext || post.RootId == "" {
+		return ""
+	}
+
+	root, err := s.pluginAPI.GetPost(post.RootId)
+	if err != nil {
+		s.pluginAPI.LogWarn("Failed to get thread root for indexing", "post_id", post.Id, "error", err)
+		return ""
+	}
+	if policy.excludes(root.UserId, nil) || s.isOptedOut(root.UserId) {
+		return ""
+	}
+	return root.Message
+}
+
+// batchFiles returns the text extracted from the files attached to a batch of posts, by post ID
+func (s *Indexer) batchFiles(posts []PostRecord) (map[string][]FileRecord, error) {
+	if !s.indexingConfig().Attachments {
+		return nil, nil
+	}
+
+	var postIDs []string
+	for _, post := range posts {
+		if post.FileIDs != "" && post.FileIDs != "[]" {
+			postIDs = append(postIDs, post.ID)
+		}
+	}
+	if len(postIDs) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT PostId as postid, Name as name, COALESCE(Content, '') as content
+		FROM FileInfo
+		WHERE PostId IN (?) AND DeleteAt = 0
+		ORDER BY CreateAt ASC, Id ASC`, postIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build file query: %w", err)
+	}
+
+	var files []FileRecord
+	if err := s.db.Select(&files, s.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to fetch files: %w", err)
+	}
+
+	filesByPost := make(map[string][]FileRecord, len(postIDs))
+	for _, file := range files {
+		filesByPost[file.PostID] = append(filesByPost[file.PostID], file)
+	}
+	return filesByPost, nil
+}
+
+// truncate cuts text to at most maxLength characters
+func truncate(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+	return string(runes[:maxLength])
+}
+
+// documentPostIDs returns the IDs of the posts of the documents, once each
+func documentPostIDs(docs []embeddings.PostDocument) []string {
+	postIDs := make([]string, 0, len(docs))
+	for i, doc := range docs {
+		if i == 0 || docs[i-1].PostID != doc.PostID {
+			postIDs = append(postIDs, doc.PostID)
+		}
+	}
+	return postIDs
+}
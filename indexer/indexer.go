@@ -5,7 +5,10 @@ package indexer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -13,13 +16,22 @@ import (
 	"github.com/mattermost/mattermost-plugin-ai/embeddings"
 	"github.com/mattermost/mattermost-plugin-ai/mmapi"
 	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
 )
 
+// ErrJobRunning is returned when starting a reindex job while one is running
+var ErrJobRunning = errors.New("job already running")
+
 type Indexer struct {
 	search    embeddings.EmbeddingSearch
 	pluginAPI mmapi.Client
 	bots      *bots.MMBots
 	db        *sqlx.DB
+	mutexAPI  cluster.MutexPluginAPI
+	indexing  atomic.Pointer[embeddings.IndexingConfig]
+	policy    atomic.Pointer[indexingPolicy]
+	// repliesMu serializes indexing the replies of edited root posts, so that quick edits don't store them twice
+	repliesMu sync.Mutex
 }
 
 func New(
@@ -27,37 +39,92 @@ func New(
 	pluginAPI mmapi.Client,
 	bots *bots.MMBots,
 	db *sqlx.DB,
+	mutexAPI cluster.MutexPluginAPI,
 ) *Indexer {
 	return &Indexer{
 		search:    search,
 		pluginAPI: pluginAPI,
 		bots:      bots,
 		db:        db,
+		mutexAPI:  mutexAPI,
 	}
 }
 
 // IndexPost indexes a post if it meets the criteria
 func (s *Indexer) IndexPost(ctx context.Context, post *model.Post, channel *model.Channel) error {
-	if !s.shouldIndexPost(post, channel) {
+	if s.search == nil {
+		return nil // Search not configured
+	}
+
+	// Content meant to be excluded is never indexed while the indexing policy is invalid
+	policy := s.currentPolicy()
+	if policy.err != nil {
+		return fmt.Errorf("invalid indexing policy: %w", policy.err)
+	}
+
+	if !s.shouldIndexPost(post, channel) || s.isOptedOut(post.UserId) {
 		return nil
 	}
 
-	if s.search == nil {
-		return nil // Search not configured
+	// Create the documents of the message and attachments, redacted by the indexing policy
+	docs, _ := policy.applyContentRules(s.postDocuments(post, channel.TeamId, s.postFiles(post), s.rootMessage(post, policy)))
+	if len(docs) == 0 {
+		return nil
 	}
 
-	// Create document
-	doc := embeddings.PostDocument{
-		PostID:    post.Id,
-		CreateAt:  post.CreateAt,
-		TeamID:    channel.TeamId,
-		ChannelID: post.ChannelId,
-		UserID:    post.UserId,
-		Content:   post.Message,
+	// Store the documents
+	return s.search.Store(ctx, docs)
+}
+
+// IndexReplies indexes the replies of a thread again after its root post was edited, so that the thread context
+// they are indexed with follows the edit. Nothing is done when replies are indexed without thread context.
+func (s *Indexer) IndexReplies(ctx context.Context, root *model.Post) error {
+	if s.search == nil || root.RootId != "" || !s.indexingConfig().ThreadContext {
+		return nil
 	}
+	s.repliesMu.Lock()
+	defer s.repliesMu.Unlock()
 
-	// Store the document
-	return s.search.Store(ctx, []embeddings.PostDocument{doc})
+	// Content meant to be excluded is never indexed while the indexing policy is invalid
+	policy := s.currentPolicy()
+	if policy.err != nil {
+		return fmt.Errorf("invalid indexing policy: %w", policy.err)
+	}
+
+	return s.indexReplies(ctx, policy, func(lastCreateAt int64, lastPostID string) ([]PostRecord, error) {
+		return s.fetchReplies(root.Id, lastCreateAt, lastPostID)
+	})
+}
+
+// indexReplies indexes again the replies fetched in batches by fetch, replacing their indexed documents
+func (s *Indexer) indexReplies(ctx context.Context, policy *indexingPolicy, fetch func(lastCreateAt int64, lastPostID string) ([]PostRecord, error)) error {
+	var lastCreateAt int64
+	var lastPostID string
+	for {
+		posts, err := fetch(lastCreateAt, lastPostID)
+		if err != nil {
+			return err
+		}
+		if len(posts) == 0 {
+			return nil
+		}
+		lastCreateAt = posts[len(posts)-1].CreateAt
+		lastPostID = posts[len(posts)-1].ID
+
+		docs, err := s.batchDocuments(posts, policy)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		if err := s.search.Delete(ctx, documentPostIDs(docs)); err != nil {
+			return fmt.Errorf("failed to delete replies: %w", err)
+		}
+		if err := s.search.Store(ctx, docs); err != nil {
+			return fmt.Errorf("failed to store replies: %w", err)
+		}
+	}
 }
 
 // DeletePost deletes a post from the index
@@ -69,8 +136,8 @@ func (s *Indexer) DeletePost(ctx context.Context, postID string) error {
 	return s.search.Delete(ctx, []string{postID})
 }
 
-// StartReindexJob starts a post reindexing job
-func (s *Indexer) StartReindexJob() (JobStatus, error) {
+// StartReindexJob starts a post reindexing job on this server, which holds the reindex lease until the job ends
+func (s *Indexer) StartReindexJob(options ReindexOptions) (JobStatus, error) {
 	// Check if search is initialized
 	if s.search == nil {
 		return JobStatus{}, fmt.Errorf("search functionality is not configured")
@@ -82,46 +149,67 @@ func (s *Indexer) StartReindexJob() (JobStatus, error) {
 	if err != nil && err.Error() != "not found" {
 		return JobStatus{}, fmt.Errorf("failed to check job status: %w", err)
 	}
+	s.failStaleJob(&jobStatus)
 
 	// If we have a valid job status and it's running, return conflict
 	if jobStatus.Status == JobStatusRunning {
-		return jobStatus, fmt.Errorf("job already running")
+		return jobStatus, ErrJobRunning
+	}
+
+	lease, err := s.tryLease(reindexLeaseKey, leaseTimeout)
+	if err != nil {
+		return jobStatus, err
 	}
 
 	// Get an estimate of total posts for progress tracking
 	var count int64
-	dbErr := s.db.Get(&count, `SELECT COUNT(*) FROM Posts WHERE DeleteAt = 0 AND Message != '' AND Type = ''`)
+	dbErr := s.db.Get(&count, `SELECT COUNT(*) FROM Posts WHERE DeleteAt = 0 AND `+s.contentFilter()+` AND Type = '' AND CreateAt >= $1`, options.Since)
 	if dbErr != nil {
 		s.pluginAPI.LogWarn("Failed to get post count for progress tracking", "error", dbErr)
 		count = 0 // Continue with zero estimate
 	}
 
-	// Create initial job status
+	// Create initial job status, the cursor starting before the first post to index
+	now := time.Now()
 	newJobStatus := JobStatus{
-		Status:    JobStatusRunning,
-		StartedAt: time.Now(),
-		TotalRows: count,
+		ID:           model.NewId(),
+		Status:       JobStatusRunning,
+		StartedAt:    now,
+		UpdatedAt:    now,
+		TotalRows:    count,
+		Since:        options.Since,
+		LastCreateAt: options.Since,
 	}
 
 	// Save initial job status
 	err = s.pluginAPI.KVSet(ReindexJobKey, newJobStatus)
 	if err != nil {
+		lease.Unlock()
 		return JobStatus{}, fmt.Errorf("failed to save job status: %w", err)
 	}
 
 	// Start the reindexing job in background
-	go s.runReindexJob(&newJobStatus)
+	go s.runReindexJob(lease, &newJobStatus, false)
 
 	return newJobStatus, nil
 }
 
-// GetJobStatus gets the status of the reindex job
+// GetJobStatus gets the status of the reindex job along with the generations of the index.
+// A running job that stopped responding is failed.
 func (s *Indexer) GetJobStatus() (JobStatus, error) {
 	var jobStatus JobStatus
 	err := s.pluginAPI.KVGet(ReindexJobKey, &jobStatus)
 	if err != nil {
 		return JobStatus{}, err
 	}
+	s.failStaleJob(&jobStatus)
+
+	if generations, ok := s.search.(embeddings.GenerationManager); ok {
+		jobStatus.Generations, err = generations.ListGenerations(context.Background())
+		if err != nil {
+			return JobStatus{}, fmt.Errorf("failed to list index generations: %w", err)
+		}
+	}
 	return jobStatus, nil
 }
 
@@ -153,7 +241,7 @@ func (s *Indexer) CancelJob() (JobStatus, error) {
 // shouldIndexPost returns whether a post should be indexed based on consistent criteria
 func (s *Indexer) shouldIndexPost(post *model.Post, channel *model.Channel) bool {
 	// Skip posts that don't have content
-	if post.Message == "" {
+	if !s.hasContent(post) {
 		return false
 	}
 
@@ -177,5 +265,10 @@ func (s *Indexer) shouldIndexPost(post *model.Post, channel *model.Channel) bool
 		return false
 	}
 
+	// Skip posts excluded by the indexing policy
+	if s.currentPolicy().excludes(post.UserId, channel) {
+		return false
+	}
+
 	return true
 }
@@ -5,11 +5,14 @@ package indexer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/mattermost/mattermost-plugin-ai/embeddings"
 	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
 )
 
 const (
@@ -22,6 +25,20 @@ const (
 
 	// KV store keys
 	ReindexJobKey = "reindex_job_status"
+
+	// reindexLeaseKey names the cluster mutex held by the server running the reindex job
+	reindexLeaseKey = "ai_reindex_job"
+	// leaseTimeout is how long starting a job waits for the lease, which is only held while a job runs
+	leaseTimeout = 2 * time.Second
+	// resumeLeaseTimeout is how long resuming a job waits for the lease, longer than the lease of a stopped
+	// server takes to expire
+	resumeLeaseTimeout = time.Minute
+	// staleJobTimeout is how long a running job can go without saving its progress before it is failed,
+	// when no server holds the lease
+	staleJobTimeout = 10 * time.Minute
+	// maxJobResumes is how many times a job is resumed before it is failed, so that posts crashing the server
+	// don't keep restarting it
+	maxJobResumes = 3
 )
 
 // PostRecord represents a post record from the database
@@ -35,80 +52,256 @@ type PostRecord struct {
 	ChannelID   string `db:"channelid"`
 	ChannelName string `db:"channelname"`
 	ChannelType string `db:"channeltype"`
+
+	RootID      string `db:"rootid"`
+	RootUserID  string `db:"rootuserid"`
+	RootMessage string `db:"rootmessage"`
+	Props       string `db:"props"`
+	FileIDs     string `db:"fileids"`
+}
+
+// rootMessage returns the message of the thread root to embed with the post, nothing when the author of the root
+// post is excluded by the policy or opted out of indexing
+func (p PostRecord) rootMessage(policy *indexingPolicy, optedOut map[string]bool) string {
+	if p.RootUserID == "" || policy.excludes(p.RootUserID, nil) || optedOut[p.RootUserID] {
+		return ""
+	}
+	return p.RootMessage
+}
+
+// toModel returns the post and its channel with the fields needed to index the post
+func (p PostRecord) toModel() (*model.Post, *model.Channel) {
+	post := &model.Post{
+		Id:        p.ID,
+		ChannelId: p.ChannelID,
+		UserId:    p.UserID,
+		RootId:    p.RootID,
+		Message:   p.Message,
+		CreateAt:  p.CreateAt,
+		Type:      model.PostTypeDefault, // We already filter out non-default post types in the SQL query
+		DeleteAt:  0,                     // We already filter deleted posts in the SQL query
+	}
+	// Props and file IDs that fail to parse leave the post without attachments
+	var props model.StringInterface
+	if err := json.Unmarshal([]byte(p.Props), &props); err == nil {
+		post.SetProps(props)
+	}
+	_ = json.Unmarshal([]byte(p.FileIDs), &post.FileIds)
+
+	// Create a minimal channel object with necessary fields for filtering
+	channel := &model.Channel{
+		Id:     p.ChannelID,
+		TeamId: p.TeamID,
+		Name:   p.ChannelName,
+		Type:   model.ChannelType(p.ChannelType),
+	}
+	return post, channel
+}
+
+// ReindexOptions configures a reindex job
+type ReindexOptions struct {
+	// Since only indexes the posts created since this time in milliseconds, adding them to the index instead
+	// of rebuilding it. Zero reindexes all posts.
+	Since int64 `json:"since"`
 }
 
 // JobStatus represents the status of a reindex job
 type JobStatus struct {
+	// ID identifies a run of the job, so that a job replaced after going stale stops
+	ID            string    `json:"id"`
 	Status        string    `json:"status"`
 	Error         string    `json:"error,omitempty"`
 	StartedAt     time.Time `json:"started_at"`
 	CompletedAt   time.Time `json:"completed_at,omitempty"`
 	ProcessedRows int64     `json:"processed_rows"`
 	TotalRows     int64     `json:"total_rows"`
+	// Since is the creation time of the oldest posts indexed by an incremental job, zero when reindexing all posts
+	Since int64 `json:"since,omitempty"`
+	// LastCreateAt and LastPostID are the cursor of the job, the last post processed, from which it resumes
+	LastCreateAt int64  `json:"last_create_at"`
+	LastPostID   string `json:"last_post_id"`
+	// UpdatedAt is when the job last saved its progress, to detect jobs that stopped
+	UpdatedAt time.Time `json:"updated_at"`
+	// Resumes is how many times the job was resumed after the server running it stopped
+	Resumes int `json:"resumes,omitempty"`
+	// Generation is the generation of the index built by the job, zero when the index is cleared and rebuilt
+	// or when the job is incremental
+	Generation int `json:"generation,omitempty"`
+	// Generations are the generations of the index, only set when the status is requested
+	Generations []embeddings.Generation `json:"generations,omitempty"`
+}
+
+// isStale returns whether a running job stopped saving its progress
+func (j JobStatus) isStale(now time.Time) bool {
+	return j.Status == JobStatusRunning && now.Sub(j.UpdatedAt) > staleJobTimeout
+}
+
+// tryLease acquires a lease allowing a single server of the cluster to run a job, such as the reindex job
+func (s *Indexer) tryLease(key string, timeout time.Duration) (*cluster.Mutex, error) {
+	lease, err := cluster.NewMutex(s.mutexAPI, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s lease: %w", key, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := lease.LockWithContext(ctx); err != nil {
+		return nil, ErrJobRunning
+	}
+	return lease, nil
+}
+
+// ResumeJob resumes the reindex job interrupted by the restart of the server running it, if any.
+// It is called when the plugin starts, the server getting the lease first resuming the job.
+func (s *Indexer) ResumeJob() {
+	if s.search == nil {
+		return
+	}
+
+	var jobStatus JobStatus
+	if err := s.pluginAPI.KVGet(ReindexJobKey, &jobStatus); err != nil {
+		s.pluginAPI.LogError("Failed to get reindex job status", "error", err)
+		return
+	}
+	if jobStatus.Status != JobStatusRunning {
+		return
+	}
+
+	lease, err := s.tryLease(reindexLeaseKey, resumeLeaseTimeout)
+	if err != nil {
+		// Another server is running the job.
+		return
+	}
+
+	// The job may have been resumed by another server or stopped while waiting for the lease.
+	jobStatus = JobStatus{}
+	if err := s.pluginAPI.KVGet(ReindexJobKey, &jobStatus); err != nil || jobStatus.Status != JobStatusRunning {
+		lease.Unlock()
+		return
+	}
+
+	if jobStatus.Resumes >= maxJobResumes {
+		jobStatus.Error = fmt.Sprintf("Job was interrupted %d times", jobStatus.Resumes+1)
+		s.failJob(context.Background(), &jobStatus)
+		lease.Unlock()
+		return
+	}
+
+	jobStatus.Resumes++
+	jobStatus.UpdatedAt = time.Now()
+	s.saveJobStatus(&jobStatus)
+	s.pluginAPI.LogWarn("Resuming reindex job", "processed", jobStatus.ProcessedRows, "resumes", jobStatus.Resumes)
+
+	go s.runReindexJob(lease, &jobStatus, true)
 }
 
-// runReindexJob runs the reindexing process
-func (s *Indexer) runReindexJob(jobStatus *JobStatus) {
+// failStaleJob fails a running job that stopped saving its progress and isn't run by any server
+func (s *Indexer) failStaleJob(jobStatus *JobStatus) {
+	if !jobStatus.isStale(time.Now()) {
+		return
+	}
+
+	lease, err := s.tryLease(reindexLeaseKey, leaseTimeout)
+	if err != nil {
+		// A server is still running the job.
+		return
+	}
+	defer lease.Unlock()
+
+	jobStatus.Error = "Job stopped responding"
+	s.failJob(context.Background(), jobStatus)
+}
+
+// failJob marks a job that isn't running anymore as failed, discarding the generation it was building
+func (s *Indexer) failJob(ctx context.Context, jobStatus *JobStatus) {
+	jobStatus.Status = JobStatusFailed
+	jobStatus.CompletedAt = time.Now()
+	s.saveJobStatus(jobStatus)
+
+	generations, ok := s.search.(embeddings.GenerationManager)
+	if !ok || jobStatus.Generation == 0 {
+		return
+	}
+	if err := generations.DiscardGeneration(ctx, jobStatus.Generation); err != nil {
+		s.pluginAPI.LogError("Failed to discard index generation", "generation", jobStatus.Generation, "error", err)
+	}
+	s.collectGenerationsLater(generations)
+}
+
+// reindexTarget returns the search the job stores posts in. Incremental jobs add posts to the index, others build
+// a new generation of the index while searches keep using the active one, or clear the index when the search
+// doesn't keep generations. Resumed jobs continue filling the index they started.
+func (s *Indexer) reindexTarget(ctx context.Context, jobStatus *JobStatus, resume bool) (embeddings.EmbeddingSearch, error) {
+	if jobStatus.Since != 0 {
+		return s.search, nil
+	}
+
+	generations, ok := s.search.(embeddings.GenerationManager)
+	if !ok {
+		if resume {
+			return s.search, nil
+		}
+		if err := s.search.Clear(ctx); err != nil {
+			return nil, fmt.Errorf("failed to clear search index: %w", err)
+		}
+		return s.search, nil
+	}
+
+	if resume && jobStatus.Generation != 0 {
+		target, err := generations.ResumeGeneration(ctx, jobStatus.Generation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resume index generation: %w", err)
+		}
+		return target, nil
+	}
+
+	generation, target, err := generations.BeginGeneration(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index generation: %w", err)
+	}
+	jobStatus.Generation = generation.ID
+	s.saveJobStatus(jobStatus)
+	return target, nil
+}
+
+// runReindexJob runs the reindexing process from the cursor of the job, holding the lease until it ends
+func (s *Indexer) runReindexJob(lease *cluster.Mutex, jobStatus *JobStatus, resume bool) {
+	defer lease.Unlock()
+
+	ctx := context.Background()
+	generations, hasGenerations := s.search.(embeddings.GenerationManager)
+
 	defer func() {
 		if r := recover(); r != nil {
 			s.pluginAPI.LogError("Reindex job panicked", "panic", r)
-			jobStatus.Status = JobStatusFailed
 			jobStatus.Error = fmt.Sprintf("Job panicked: %v", r)
-			jobStatus.CompletedAt = time.Now()
-			s.saveJobStatus(jobStatus)
+			s.failJob(ctx, jobStatus)
 		}
 	}()
 
-	ctx := context.Background()
+	target, err := s.reindexTarget(ctx, jobStatus, resume)
+	if err != nil {
+		jobStatus.Error = err.Error()
+		s.failJob(ctx, jobStatus)
+		return
+	}
 
-	// Clear the existing index
-	if err := s.search.Clear(ctx); err != nil {
-		jobStatus.Status = JobStatusFailed
-		jobStatus.Error = fmt.Sprintf("Failed to clear search index: %s", err)
-		jobStatus.CompletedAt = time.Now()
-		s.saveJobStatus(jobStatus)
+	// Content meant to be excluded is never indexed while the indexing policy is invalid
+	policy := s.currentPolicy()
+	if policy.err != nil {
+		jobStatus.Error = fmt.Sprintf("Invalid indexing policy: %s", policy.err)
+		s.failJob(ctx, jobStatus)
 		return
 	}
 
-	var posts []PostRecord
-	lastCreateAt := int64(0)
-	lastID := ""
-	processedCount := int64(0)
-	lastSavedCount := int64(0) // Track when we last saved status
+	lastSavedCount := jobStatus.ProcessedRows // Track when we last logged progress
 
 	for {
-		// Check if the job was canceled
-		var currentStatus JobStatus
-		if err := s.pluginAPI.KVGet(ReindexJobKey, &currentStatus); err == nil {
-			if currentStatus.Status == JobStatusCanceled {
-				s.pluginAPI.LogWarn("Reindex job was canceled")
-				return
-			}
-		}
-
 		// Run a batch of indexing
-		query := `SELECT
-			Posts.Id as id,
-			Posts.Message as message,
-			Posts.UserId as userid,
-			Posts.ChannelId as channelid,
-			Posts.CreateAt as createat,
-			Channels.TeamId as teamid,
-			Channels.Name as channelname,
-			Channels.Type as channeltype
-		FROM Posts
-		LEFT JOIN Channels ON Posts.ChannelId = Channels.Id
-		WHERE Posts.DeleteAt = 0 AND Posts.Message != '' AND Posts.Type = ''
-			AND (Posts.CreateAt, Posts.Id) > ($1, $2)
-		ORDER BY Posts.CreateAt ASC, Posts.Id ASC
-		LIMIT $3`
-
-		err := s.db.Select(&posts, query, lastCreateAt, lastID, defaultBatchSize)
+		posts, err := s.fetchPosts(jobStatus.LastCreateAt, jobStatus.LastPostID)
 		if err != nil {
-			jobStatus.Status = JobStatusFailed
-			jobStatus.Error = fmt.Sprintf("Failed to fetch posts: %s", err)
-			jobStatus.CompletedAt = time.Now()
-			s.saveJobStatus(jobStatus)
+			jobStatus.Error = err.Error()
+			s.failJob(ctx, jobStatus)
 			return
 		}
 
@@ -116,77 +309,166 @@ func (s *Indexer) runReindexJob(jobStatus *JobStatus) {
 			break
 		}
 
-		// Process batch and index posts
-		docs := make([]embeddings.PostDocument, 0, len(posts))
-		for _, post := range posts {
-			modelPost := &model.Post{
-				Id:        post.ID,
-				ChannelId: post.ChannelID,
-				UserId:    post.UserID,
-				Message:   post.Message,
-				Type:      model.PostTypeDefault, // We already filter out non-default post types in the SQL query
-				DeleteAt:  0,                     // We already filter deleted posts in the SQL query
-			}
-
-			// Create a minimal channel object with necessary fields for filtering
-			channel := &model.Channel{
-				Id:     post.ChannelID,
-				TeamId: post.TeamID,
-				Name:   post.ChannelName,
-				Type:   model.ChannelType(post.ChannelType),
-			}
-
-			// Apply same indexing rules as indexPost
-			if !s.shouldIndexPost(modelPost, channel) {
-				continue
-			}
-
-			docs = append(docs, embeddings.PostDocument{
-				PostID:    modelPost.Id,
-				CreateAt:  modelPost.CreateAt,
-				TeamID:    post.TeamID,
-				ChannelID: post.ChannelID,
-				UserID:    post.UserID,
-				Content:   post.Message,
-			})
+		docs, err := s.batchDocuments(posts, policy)
+		if err != nil {
+			jobStatus.Error = err.Error()
+			s.failJob(ctx, jobStatus)
+			return
 		}
 
-		// Store the batch
+		// Store the batch, incremental jobs first removing the chunks of posts already indexed, which may be
+		// numbered differently
 		if len(docs) > 0 {
-			if err := s.search.Store(ctx, docs); err != nil {
-				jobStatus.Status = JobStatusFailed
+			if jobStatus.Since != 0 {
+				if err := target.Delete(ctx, documentPostIDs(docs)); err != nil {
+					jobStatus.Error = fmt.Sprintf("Failed to delete documents: %s", err)
+					s.failJob(ctx, jobStatus)
+					return
+				}
+			}
+			if err := target.Store(ctx, docs); err != nil {
 				jobStatus.Error = fmt.Sprintf("Failed to store documents: %s", err)
-				jobStatus.CompletedAt = time.Now()
-				s.saveJobStatus(jobStatus)
+				s.failJob(ctx, jobStatus)
 				return
 			}
 		}
 
-		// Update progress
-		processedCount += int64(len(posts))
-		jobStatus.ProcessedRows = processedCount
+		// Stop if the job was canceled, or failed as stale while the batch was being stored
+		if !s.isCurrentJob(jobStatus.ID) {
+			s.pluginAPI.LogWarn("Reindex job was stopped")
+			if hasGenerations && jobStatus.Generation != 0 {
+				if err := generations.DiscardGeneration(ctx, jobStatus.Generation); err != nil {
+					s.pluginAPI.LogWarn("Failed to discard index generation", "generation", jobStatus.Generation, "error", err)
+				}
+				s.collectGenerationsLater(generations)
+			}
+			return
+		}
 
-		// Update cursors for next batch
+		// Save progress and the cursor, from which the job resumes after a restart
 		lastPost := posts[len(posts)-1]
-		lastCreateAt = lastPost.CreateAt
-		lastID = lastPost.ID
+		jobStatus.ProcessedRows += int64(len(posts))
+		jobStatus.LastCreateAt = lastPost.CreateAt
+		jobStatus.LastPostID = lastPost.ID
+		jobStatus.UpdatedAt = time.Now()
+		s.saveJobStatus(jobStatus)
 
-		// Save progress every 500 additional processed records
-		if processedCount >= lastSavedCount+500 {
-			s.saveJobStatus(jobStatus)
+		// Log progress every 500 additional processed records
+		if jobStatus.ProcessedRows >= lastSavedCount+500 {
 			s.pluginAPI.LogWarn("Reindexing progress",
-				"processed", processedCount,
+				"processed", jobStatus.ProcessedRows,
 				"estimated_total", jobStatus.TotalRows)
-			lastSavedCount = processedCount
+			lastSavedCount = jobStatus.ProcessedRows
+		}
+	}
+
+	// Switch searches to the new generation
+	if hasGenerations && jobStatus.Generation != 0 {
+		if err := generations.ActivateGeneration(ctx, jobStatus.Generation); err != nil {
+			jobStatus.Error = fmt.Sprintf("Failed to activate index generation: %s", err)
+			s.failJob(ctx, jobStatus)
+			return
 		}
+		s.collectGenerationsLater(generations)
 	}
 
 	// Completed successfully
 	jobStatus.Status = JobStatusCompleted
 	jobStatus.CompletedAt = time.Now()
+	jobStatus.UpdatedAt = jobStatus.CompletedAt
 	s.saveJobStatus(jobStatus)
 
-	s.pluginAPI.LogWarn("Reindexing completed", "processed_posts", processedCount)
+	s.pluginAPI.LogWarn("Reindexing completed", "processed_posts", jobStatus.ProcessedRows)
+}
+
+// batchDocuments returns the documents to index for a batch of posts, applying the same rules as IndexPost
+func (s *Indexer) batchDocuments(posts []PostRecord, policy *indexingPolicy) ([]embeddings.PostDocument, error) {
+	// Fetch the text extracted from the files of the batch
+	files, err := s.batchFiles(posts)
+	if err != nil {
+		return nil, err
+	}
+	optedOut := s.optedOutAuthors(posts)
+
+	docs := make([]embeddings.PostDocument, 0, len(posts))
+	for _, post := range posts {
+		modelPost, channel := post.toModel()
+		if !s.shouldIndexPost(modelPost, channel) || optedOut[post.UserID] {
+			continue
+		}
+
+		postDocs, _ := policy.applyContentRules(s.postDocuments(modelPost, post.TeamID, files[post.ID], post.rootMessage(policy, optedOut)))
+		docs = append(docs, postDocs...)
+	}
+	return docs, nil
+}
+
+// fetchPosts returns the next batch of posts with content to index, created after the cursor
+func (s *Indexer) fetchPosts(lastCreateAt int64, lastPostID string) ([]PostRecord, error) {
+	return s.selectPosts(`(Posts.CreateAt, Posts.Id) > ($1, $2)`, lastCreateAt, lastPostID)
+}
+
+// fetchReplies returns the next batch of replies of a thread with content to index, created after the cursor
+func (s *Indexer) fetchReplies(rootID string, lastCreateAt int64, lastPostID string) ([]PostRecord, error) {
+	return s.selectPosts(`(Posts.CreateAt, Posts.Id) > ($1, $2) AND Posts.RootId = $3`, lastCreateAt, lastPostID, rootID)
+}
+
+// fetchRepliesTo returns the next batch of replies to the threads started by a user with content to index,
+// created after the cursor
+func (s *Indexer) fetchRepliesTo(userID string, lastCreateAt int64, lastPostID string) ([]PostRecord, error) {
+	return s.selectPosts(`(Posts.CreateAt, Posts.Id) > ($1, $2) AND Roots.UserId = $3`, lastCreateAt, lastPostID, userID)
+}
+
+// selectPosts returns a batch of the posts with content to index matching the condition, in the order they
+// were created. The batch size is the argument following the ones of the condition.
+func (s *Indexer) selectPosts(condition string, args ...any) ([]PostRecord, error) {
+	query := `SELECT
+		Posts.Id as id,
+		Posts.Message as message,
+		Posts.UserId as userid,
+		Posts.ChannelId as channelid,
+		Posts.CreateAt as createat,
+		Channels.TeamId as teamid,
+		Channels.Name as channelname,
+		Channels.Type as channeltype,
+		Posts.RootId as rootid,
+		COALESCE(Roots.UserId, '') as rootuserid,
+		COALESCE(Roots.Message, '') as rootmessage,
+		COALESCE(Posts.Props::text, '{}') as props,
+		COALESCE(Posts.FileIds, '[]') as fileids
+	FROM Posts
+	LEFT JOIN Channels ON Posts.ChannelId = Channels.Id
+	LEFT JOIN Posts Roots ON Posts.RootId != '' AND Roots.Id = Posts.RootId
+	WHERE Posts.DeleteAt = 0 AND ` + s.contentFilter() + ` AND Posts.Type = ''
+		AND ` + condition + `
+	ORDER BY Posts.CreateAt ASC, Posts.Id ASC
+	LIMIT $` + strconv.Itoa(len(args)+1)
+
+	var posts []PostRecord
+	if err := s.db.Select(&posts, query, append(args, defaultBatchSize)...); err != nil {
+		return nil, fmt.Errorf("failed to fetch posts: %w", err)
+	}
+	return posts, nil
+}
+
+// isCurrentJob returns whether the job is still the running job, not canceled or replaced
+func (s *Indexer) isCurrentJob(jobID string) bool {
+	var currentStatus JobStatus
+	if err := s.pluginAPI.KVGet(ReindexJobKey, &currentStatus); err != nil {
+		// Keep running rather than abandoning the work done on a transient error.
+		return true
+	}
+	return currentStatus.Status == JobStatusRunning && currentStatus.ID == jobID
+}
+
+// collectGenerationsLater garbage collects the retired generations of the index once the servers of the cluster
+// stopped using them
+func (s *Indexer) collectGenerationsLater(generations embeddings.GenerationManager) {
+	time.AfterFunc(embeddings.GenerationRetention, func() {
+		if err := generations.CollectGenerations(context.Background()); err != nil {
+			s.pluginAPI.LogError("Failed to garbage collect index generations", "error", err)
+		}
+	})
 }
 
 // saveJobStatus saves the job status to KV store
@@ -0,0 +1,215 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package indexer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	embeddingsmocks "github.com/mattermost/mattermost-plugin-ai/embeddings/mocks"
+	"github.com/mattermost/mattermost-plugin-ai/mmapi/mocks"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMutexAPI holds cluster mutexes in memory.
+type fakeMutexAPI struct {
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+func (f *fakeMutexAPI) KVSetWithOptions(key string, value []byte, options model.PluginKVSetOptions) (bool, *model.AppError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.locked == nil {
+		f.locked = map[string]bool{}
+	}
+	if value == nil {
+		delete(f.locked, key)
+		return true, nil
+	}
+	if options.Atomic && options.OldValue == nil && f.locked[key] {
+		return false, nil
+	}
+	f.locked[key] = true
+	return true, nil
+}
+
+func (f *fakeMutexAPI) LogError(msg string, keyValuePairs ...any) {}
+
+func mockJobStatus(client *mocks.MockClient, status JobStatus) {
+	client.On("KVGet", ReindexJobKey, mock.AnythingOfType("*indexer.JobStatus")).Run(func(args mock.Arguments) {
+		*args.Get(1).(*JobStatus) = status
+	}).Return(nil)
+}
+
+func TestGetJobStatusFailsStaleJobs(t *testing.T) {
+	t.Run("a job that stopped saving its progress is failed", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		indexer := New(embeddingsmocks.NewMockEmbeddingSearch(t), client, nil, nil, &fakeMutexAPI{})
+
+		mockJobStatus(client, JobStatus{ID: "job1", Status: JobStatusRunning, UpdatedAt: time.Now().Add(-staleJobTimeout - time.Minute)})
+		client.On("KVSet", ReindexJobKey, mock.MatchedBy(func(status *JobStatus) bool {
+			return status.ID == "job1" && status.Status == JobStatusFailed
+		})).Return(nil).Once()
+
+		jobStatus, err := indexer.GetJobStatus()
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusFailed, jobStatus.Status)
+		assert.Equal(t, "Job stopped responding", jobStatus.Error)
+	})
+
+	t.Run("a job saving its progress keeps running", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		indexer := New(embeddingsmocks.NewMockEmbeddingSearch(t), client, nil, nil, &fakeMutexAPI{})
+
+		mockJobStatus(client, JobStatus{ID: "job1", Status: JobStatusRunning, UpdatedAt: time.Now().Add(-time.Minute)})
+
+		jobStatus, err := indexer.GetJobStatus()
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusRunning, jobStatus.Status)
+	})
+
+	t.Run("a job holding the lease keeps running", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		mutexAPI := &fakeMutexAPI{locked: map[string]bool{"mutex_" + reindexLeaseKey: true}}
+		indexer := New(embeddingsmocks.NewMockEmbeddingSearch(t), client, nil, nil, mutexAPI)
+
+		mockJobStatus(client, JobStatus{ID: "job1", Status: JobStatusRunning, UpdatedAt: time.Now().Add(-staleJobTimeout - time.Minute)})
+
+		jobStatus, err := indexer.GetJobStatus()
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusRunning, jobStatus.Status)
+	})
+}
+
+func TestResumeJob(t *testing.T) {
+	t.Run("finished jobs are not resumed", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		indexer := New(embeddingsmocks.NewMockEmbeddingSearch(t), client, nil, nil, &fakeMutexAPI{})
+
+		mockJobStatus(client, JobStatus{ID: "job1", Status: JobStatusCompleted})
+		indexer.ResumeJob()
+	})
+
+	t.Run("jobs interrupted too many times are failed", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		mutexAPI := &fakeMutexAPI{}
+		indexer := New(embeddingsmocks.NewMockEmbeddingSearch(t), client, nil, nil, mutexAPI)
+
+		mockJobStatus(client, JobStatus{ID: "job1", Status: JobStatusRunning, Resumes: maxJobResumes})
+		client.On("KVSet", ReindexJobKey, mock.MatchedBy(func(status *JobStatus) bool {
+			return status.Status == JobStatusFailed && status.Error == "Job was interrupted 4 times"
+		})).Return(nil).Once()
+
+		indexer.ResumeJob()
+		assert.Empty(t, mutexAPI.locked, "the lease is released")
+	})
+}
+
+func mockIndexingSettings(client *mocks.MockClient, userID string, settings IndexingSettings) {
+	client.On("KVGet", indexingSettingsKeyPrefix+userID, mock.AnythingOfType("*indexer.IndexingSettings")).Run(func(args mock.Arguments) {
+		*args.Get(1).(*IndexingSettings) = settings
+	}).Return(nil)
+}
+
+// testBots returns a bots service without any bot
+func testBots() *bots.MMBots {
+	return bots.New(nil, pluginapi.NewClient(&plugintest.API{}, nil), nil, nil, nil, nil, nil, nil)
+}
+
+func TestIndexPost(t *testing.T) {
+	channel := &model.Channel{Id: "channel1", TeamId: "team1", Type: model.ChannelTypeOpen}
+	reply := func() *model.Post {
+		post := &model.Post{
+			Id:        "post1",
+			ChannelId: "channel1",
+			UserId:    "user1",
+			RootId:    "root1",
+			Message:   "yes, do that",
+			CreateAt:  1000,
+			FileIds:   model.StringArray{"file1"},
+		}
+		post.AddProp(model.PostPropsAttachments, []*model.SlackAttachment{{Title: "Build failed", Text: "error 42"}})
+		return post
+	}
+	doc := func(content, threadContext string) embeddings.PostDocument {
+		return embeddings.PostDocument{
+			PostID:    "post1",
+			CreateAt:  1000,
+			TeamID:    "team1",
+			ChannelID: "channel1",
+			UserID:    "user1",
+			Content:   content,
+			Context:   threadContext,
+		}
+	}
+
+	t.Run("only the message is indexed by default", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		search := embeddingsmocks.NewMockEmbeddingSearch(t)
+		indexer := New(search, client, testBots(), nil, &fakeMutexAPI{})
+		mockIndexingSettings(client, "user1", IndexingSettings{})
+
+		search.On("Store", mock.Anything, []embeddings.PostDocument{doc("yes, do that", "")}).Return(nil).Once()
+		require.NoError(t, indexer.IndexPost(context.Background(), reply(), channel))
+	})
+
+	t.Run("attachments and thread context are indexed when enabled", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		search := embeddingsmocks.NewMockEmbeddingSearch(t)
+		indexer := New(search, client, testBots(), nil, &fakeMutexAPI{})
+		mockIndexingSettings(client, "user1", IndexingSettings{})
+		indexer.SetIndexingConfig(embeddings.IndexingConfig{Attachments: true, ThreadContext: true})
+
+		client.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "plan.pdf", Content: "Step one: back up the database."}, nil)
+		mockIndexingSettings(client, "user2", IndexingSettings{})
+		client.On("GetPost", "root1").Return(&model.Post{Id: "root1", UserId: "user2", Message: "Should we upgrade the database?"}, nil)
+		threadContext := "In reply to: Should we upgrade the database?"
+		search.On("Store", mock.Anything, []embeddings.PostDocument{
+			doc("yes, do that", threadContext),
+			doc("Build failed\nerror 42", threadContext),
+			doc("plan.pdf\nStep one: back up the database.", threadContext),
+		}).Return(nil).Once()
+		require.NoError(t, indexer.IndexPost(context.Background(), reply(), channel))
+	})
+
+	t.Run("replies are not indexed again without thread context", func(t *testing.T) {
+		indexer := New(embeddingsmocks.NewMockEmbeddingSearch(t), mocks.NewMockClient(t), testBots(), nil, &fakeMutexAPI{})
+
+		require.NoError(t, indexer.IndexReplies(context.Background(), &model.Post{Id: "root1", Message: "Should we upgrade?"}))
+		indexer.SetIndexingConfig(embeddings.IndexingConfig{ThreadContext: true})
+		require.NoError(t, indexer.IndexReplies(context.Background(), reply()), "replies have no replies")
+	})
+
+	t.Run("posts with only files are skipped unless attachments are indexed", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		search := embeddingsmocks.NewMockEmbeddingSearch(t)
+		indexer := New(search, client, testBots(), nil, &fakeMutexAPI{})
+		mockIndexingSettings(client, "user1", IndexingSettings{})
+
+		post := &model.Post{Id: "post1", ChannelId: "channel1", UserId: "user1", FileIds: model.StringArray{"file1"}}
+		require.NoError(t, indexer.IndexPost(context.Background(), post, channel))
+
+		indexer.SetIndexingConfig(embeddings.IndexingConfig{Attachments: true, MaxAttachmentLength: 4})
+		client.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "notes.txt", Content: "long file content"}, nil)
+		search.On("Store", mock.Anything, []embeddings.PostDocument{{
+			PostID:    "post1",
+			TeamID:    "team1",
+			ChannelID: "channel1",
+			UserID:    "user1",
+			Content:   "notes.txt\nlong",
+		}}).Return(nil).Once()
+		require.NoError(t, indexer.IndexPost(context.Background(), post, channel))
+	})
+}
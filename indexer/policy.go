@@ -0,0 +1,417 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// redactedText replaces the text matching redaction rules
+	redactedText = "[REDACTED]"
+
+	// indexingSettingsKeyPrefix prefixes the KV keys of the indexing settings of each user
+	indexingSettingsKeyPrefix = "indexing_settings_"
+	// appliedPolicyKey holds the indexing policy the index was last purged with
+	appliedPolicyKey = "indexing_policy"
+	// purgeLeaseKey names the cluster mutex held by the server purging the index
+	purgeLeaseKey = "ai_index_purge"
+)
+
+// IndexingSettings are chosen by each user, the posts of users who opted out are not indexed.
+type IndexingSettings struct {
+	OptOut bool `json:"optOut"`
+}
+
+// indexingPolicy is the compiled form of the indexing policy of the configuration
+type indexingPolicy struct {
+	config           embeddings.IndexingPolicy
+	excludedUsers    map[string]bool
+	excludedTeams    map[string]bool
+	excludedChannels map[string]bool
+	redact           []*regexp.Regexp
+	skip             []*regexp.Regexp
+	// err is set when the policy is invalid, nothing being indexed until it is fixed
+	err error
+}
+
+// compilePolicy compiles the content rules of the policy
+func compilePolicy(config embeddings.IndexingPolicy) (*indexingPolicy, error) {
+	policy := &indexingPolicy{
+		config:           config,
+		excludedUsers:    toSet(config.ExcludedUserIDs),
+		excludedTeams:    toSet(config.ExcludedTeamIDs),
+		excludedChannels: toSet(config.ExcludedChannelIDs),
+	}
+
+	for i, rule := range config.ContentRules {
+		// An empty pattern matches every post.
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("empty pattern of content rule %d", i+1)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of content rule %d: %w", i+1, err)
+		}
+		switch rule.Action {
+		case embeddings.ContentRuleRedact:
+			policy.redact = append(policy.redact, pattern)
+		case embeddings.ContentRuleSkip:
+			policy.skip = append(policy.skip, pattern)
+		default:
+			return nil, fmt.Errorf("unsupported action of content rule %d: %q", i+1, rule.Action)
+		}
+	}
+	return policy, nil
+}
+
+// ValidatePolicy returns an error when the indexing policy can't be applied
+func ValidatePolicy(config embeddings.IndexingPolicy) error {
+	_, err := compilePolicy(config)
+	return err
+}
+
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// excludes returns whether the policy keeps the posts of the user in the channel out of the index
+func (p *indexingPolicy) excludes(userID string, channel *model.Channel) bool {
+	if p.excludedUsers[userID] {
+		return true
+	}
+	if channel == nil {
+		return false
+	}
+	if p.excludedTeams[channel.TeamId] || p.excludedChannels[channel.Id] {
+		return true
+	}
+	if p.config.ExcludeDirectMessages && channel.IsGroupOrDirect() {
+		return true
+	}
+	return p.config.ExcludePrivateChannels && channel.Type == model.ChannelTypePrivate
+}
+
+// applyContentRules redacts the documents of a post, returning no documents when a skip rule matches.
+// A thread context matching a skip rule is left out rather than skipping the reply.
+// changed reports whether the documents were redacted or skipped.
+func (p *indexingPolicy) applyContentRules(docs []embeddings.PostDocument) ([]embeddings.PostDocument, bool) {
+	if len(p.redact) == 0 && len(p.skip) == 0 {
+		return docs, false
+	}
+
+	for _, doc := range docs {
+		if matchesAny(p.skip, doc.Content) {
+			return nil, true
+		}
+	}
+
+	changed := false
+	result := make([]embeddings.PostDocument, len(docs))
+	for i, doc := range docs {
+		if doc.Context != "" && matchesAny(p.skip, doc.Context) {
+			doc.Context = ""
+			changed = true
+		}
+		for _, pattern := range p.redact {
+			content := pattern.ReplaceAllLiteralString(doc.Content, redactedText)
+			docContext := pattern.ReplaceAllLiteralString(doc.Context, redactedText)
+			if content != doc.Content || docContext != doc.Context {
+				changed = true
+			}
+			doc.Content = content
+			doc.Context = docContext
+		}
+		result[i] = doc
+	}
+	return result, changed
+}
+
+func matchesAny(patterns []*regexp.Regexp, text string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// samePolicy returns whether two policies exclude the same posts
+func samePolicy(a, b embeddings.IndexingPolicy) bool {
+	return slices.Equal(a.ExcludedUserIDs, b.ExcludedUserIDs) &&
+		slices.Equal(a.ExcludedTeamIDs, b.ExcludedTeamIDs) &&
+		slices.Equal(a.ExcludedChannelIDs, b.ExcludedChannelIDs) &&
+		a.ExcludeDirectMessages == b.ExcludeDirectMessages &&
+		a.ExcludePrivateChannels == b.ExcludePrivateChannels &&
+		slices.Equal(a.ContentRules, b.ContentRules)
+}
+
+// SetIndexingPolicy sets the indexing policy applied to new posts and reindexing. An invalid policy stops
+// indexing until it is fixed, so that content meant to be excluded is never sent to the embedding provider.
+func (s *Indexer) SetIndexingPolicy(config embeddings.IndexingPolicy) error {
+	policy, err := compilePolicy(config)
+	if err != nil {
+		policy = &indexingPolicy{config: config, err: err}
+	}
+	s.policy.Store(policy)
+	return err
+}
+
+// currentPolicy returns the indexing policy, excluding nothing when none was set
+func (s *Indexer) currentPolicy() *indexingPolicy {
+	if policy := s.policy.Load(); policy != nil {
+		return policy
+	}
+	return &indexingPolicy{}
+}
+
+// ApplyIndexingPolicy removes the posts excluded by the indexing policy from the index when the policy changed
+// since it was last applied, and redacts the indexed posts matching redaction rules. A single server of the
+// cluster purges the index.
+func (s *Indexer) ApplyIndexingPolicy() {
+	if s.search == nil {
+		return
+	}
+	policy := s.currentPolicy()
+	if policy.err != nil {
+		return
+	}
+
+	if changed, err := s.policyChanged(policy.config); err != nil || !changed {
+		return
+	}
+
+	lease, err := s.tryLease(purgeLeaseKey, leaseTimeout)
+	if err != nil {
+		// Another server is applying the policy.
+		return
+	}
+	defer lease.Unlock()
+
+	for {
+		// The policy may have been applied by another server while waiting for the lease.
+		if changed, err := s.policyChanged(policy.config); err != nil || !changed {
+			return
+		}
+
+		s.pluginAPI.LogWarn("Removing posts excluded by the indexing policy from the index")
+		purged, err := s.purgeExcludedPosts(context.Background(), policy)
+		if err != nil {
+			s.pluginAPI.LogError("Failed to apply the indexing policy", "error", err, "purged_posts", purged)
+			return
+		}
+		if err := s.pluginAPI.KVSet(appliedPolicyKey, policy.config); err != nil {
+			s.pluginAPI.LogError("Failed to save the applied indexing policy", "error", err)
+			return
+		}
+		s.pluginAPI.LogWarn("Applied the indexing policy to the index", "purged_posts", purged)
+
+		// A policy set while purging couldn't be applied without the lease, so it is applied now.
+		next := s.currentPolicy()
+		if next.err != nil || samePolicy(next.config, policy.config) {
+			return
+		}
+		policy = next
+	}
+}
+
+// policyChanged returns whether the index must be purged for the policy, saving a policy excluding nothing
+// without purging
+func (s *Indexer) policyChanged(config embeddings.IndexingPolicy) (bool, error) {
+	var applied embeddings.IndexingPolicy
+	if err := s.pluginAPI.KVGet(appliedPolicyKey, &applied); err != nil {
+		s.pluginAPI.LogError("Failed to get the applied indexing policy", "error", err)
+		return false, err
+	}
+	if samePolicy(applied, config) {
+		return false, nil
+	}
+
+	// Nothing to remove when the policy excludes nothing.
+	if samePolicy(embeddings.IndexingPolicy{}, config) {
+		if err := s.pluginAPI.KVSet(appliedPolicyKey, config); err != nil {
+			return false, fmt.Errorf("failed to save the applied indexing policy: %w", err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// purgeExcludedPosts goes through the indexed posts, removing the posts excluded by the policy or matching
+// skip rules and indexing the redacted documents of the posts matching redaction rules.
+// It returns how many posts were removed or redacted.
+func (s *Indexer) purgeExcludedPosts(ctx context.Context, policy *indexingPolicy) (int64, error) {
+	var purged int64
+	var lastCreateAt int64
+	var lastPostID string
+	for {
+		posts, err := s.fetchPosts(lastCreateAt, lastPostID)
+		if err != nil {
+			return purged, err
+		}
+		if len(posts) == 0 {
+			return purged, nil
+		}
+		lastCreateAt = posts[len(posts)-1].CreateAt
+		lastPostID = posts[len(posts)-1].ID
+
+		purgedIDs, redacted, err := s.purgedDocuments(posts, policy)
+		if err != nil {
+			return purged, err
+		}
+		if len(purgedIDs) == 0 {
+			continue
+		}
+		if err := s.search.Delete(ctx, purgedIDs); err != nil {
+			return purged, fmt.Errorf("failed to delete posts: %w", err)
+		}
+		if len(redacted) > 0 {
+			if err := s.search.Store(ctx, redacted); err != nil {
+				return purged, fmt.Errorf("failed to store redacted posts: %w", err)
+			}
+		}
+		purged += int64(len(purgedIDs))
+	}
+}
+
+// purgedDocuments returns the posts of a batch to remove from the index, and the documents indexed in place of
+// the posts that are redacted or lose the thread context of a root post whose author is excluded or opted out
+func (s *Indexer) purgedDocuments(posts []PostRecord, policy *indexingPolicy) ([]string, []embeddings.PostDocument, error) {
+	files, err := s.batchFiles(posts)
+	if err != nil {
+		return nil, nil, err
+	}
+	optedOut := s.optedOutAuthors(posts)
+	threadContext := s.indexingConfig().ThreadContext
+
+	var purgedIDs []string
+	var redacted []embeddings.PostDocument
+	for _, record := range posts {
+		post, channel := record.toModel()
+		if policy.excludes(post.UserId, channel) || optedOut[post.UserId] {
+			purgedIDs = append(purgedIDs, post.Id)
+			continue
+		}
+		if !s.shouldIndexPost(post, channel) {
+			continue
+		}
+
+		rootMessage := record.rootMessage(policy, optedOut)
+		contextDropped := threadContext && record.RootMessage != "" && rootMessage == ""
+		docs, changed := policy.applyContentRules(s.postDocuments(post, record.TeamID, files[record.ID], rootMessage))
+		if changed || contextDropped {
+			purgedIDs = append(purgedIDs, post.Id)
+			redacted = append(redacted, docs...)
+		}
+	}
+	return purgedIDs, redacted, nil
+}
+
+// GetIndexingSettings returns the indexing settings of the user, indexed if never saved
+func (s *Indexer) GetIndexingSettings(userID string) (IndexingSettings, error) {
+	var settings IndexingSettings
+	if err := s.pluginAPI.KVGet(indexingSettingsKeyPrefix+userID, &settings); err != nil {
+		return IndexingSettings{}, fmt.Errorf("failed to get indexing settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SaveIndexingSettings saves the indexing settings of the user. The posts of a user opting out are removed from
+// the index in the background, along with the thread context of the replies to them. Opting back in only indexes
+// new posts until the next reindex.
+func (s *Indexer) SaveIndexingSettings(userID string, settings IndexingSettings) error {
+	if err := s.pluginAPI.KVSet(indexingSettingsKeyPrefix+userID, settings); err != nil {
+		return fmt.Errorf("failed to save indexing settings: %w", err)
+	}
+
+	if settings.OptOut && s.search != nil {
+		go func() {
+			if err := s.purgeUserPosts(context.Background(), userID); err != nil {
+				s.pluginAPI.LogError("Failed to remove the posts of a user who opted out from the index", "user_id", userID, "error", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// isOptedOut returns whether the user opted out of indexing. Users whose settings can't be read are considered
+// opted out.
+func (s *Indexer) isOptedOut(userID string) bool {
+	settings, err := s.GetIndexingSettings(userID)
+	if err != nil {
+		s.pluginAPI.LogWarn("Failed to check whether a user opted out of indexing", "user_id", userID, "error", err)
+		return true
+	}
+	return settings.OptOut
+}
+
+// optedOutAuthors returns the authors of the posts and of their thread roots who opted out of indexing
+func (s *Indexer) optedOutAuthors(posts []PostRecord) map[string]bool {
+	optedOut := map[string]bool{}
+	checked := map[string]bool{}
+	for _, post := range posts {
+		for _, userID := range []string{post.UserID, post.RootUserID} {
+			if userID == "" || checked[userID] {
+				continue
+			}
+			checked[userID] = true
+			if s.isOptedOut(userID) {
+				optedOut[userID] = true
+			}
+		}
+	}
+	return optedOut
+}
+
+// purgeUserPosts removes the posts of the user from the index, then indexes the replies to them again without
+// their thread context
+func (s *Indexer) purgeUserPosts(ctx context.Context, userID string) error {
+	var lastCreateAt int64
+	var lastPostID string
+	for {
+		var posts []PostRecord
+		err := s.db.Select(&posts, `SELECT Id as id, CreateAt as createat
+			FROM Posts
+			WHERE UserId = $1 AND (CreateAt, Id) > ($2, $3)
+			ORDER BY CreateAt ASC, Id ASC
+			LIMIT $4`, userID, lastCreateAt, lastPostID, defaultBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch posts: %w", err)
+		}
+		if len(posts) == 0 {
+			break
+		}
+
+		postIDs := make([]string, len(posts))
+		for i, post := range posts {
+			postIDs[i] = post.ID
+		}
+		if err := s.search.Delete(ctx, postIDs); err != nil {
+			return fmt.Errorf("failed to delete posts: %w", err)
+		}
+		lastCreateAt = posts[len(posts)-1].CreateAt
+		lastPostID = posts[len(posts)-1].ID
+	}
+
+	if !s.indexingConfig().ThreadContext {
+		return nil
+	}
+	policy := s.currentPolicy()
+	if policy.err != nil {
+		return fmt.Errorf("failed to index the replies to the posts again: invalid indexing policy: %w", policy.err)
+	}
+	return s.indexReplies(ctx, policy, func(lastCreateAt int64, lastPostID string) ([]PostRecord, error) {
+		return s.fetchRepliesTo(userID, lastCreateAt, lastPostID)
+	})
+}
@@ -67,6 +67,17 @@ type SimpleCompletionRequest struct {
 
 	// Parameters allows customizing the completion behavior
 	Parameters map[string]interface{} `json:"parameters,omitempty"`
+
+	// Sampling overrides the bot's sampling settings for this request (optional)
+	Sampling *SamplingParameters `json:"sampling,omitempty"`
+}
+
+// SamplingParameters controls how the model samples its response. Unset fields keep the bot's settings.
+type SamplingParameters struct {
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopP          *float32 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+	Seed          *int64   `json:"seed,omitempty"`
 }
 
 // CompletionResponse represents the response from an interplugin completion request
@@ -4,16 +4,97 @@
 package llm
 
 import (
+	"bytes"
 	"fmt"
 	"io"
-	"slices"
+	"sort"
 	"strings"
 )
 
+// FileKind tells how a file attached to a post is given to the model.
+type FileKind int
+
+const (
+	FileKindImage FileKind = iota
+	// FileKindDocument files are sent as documents to providers that read them natively, the others are given Text.
+	FileKindDocument
+)
+
+// MaxDocumentSize is the largest document sent natively, the limit of both Anthropic and OpenAI.
+const MaxDocumentSize = 32 * 1024 * 1024
+
 type File struct {
+	Kind     FileKind
+	Name     string
 	MimeType string
 	Size     int64
-	Reader   io.Reader
+	// Reader is nil for documents that were too large to send natively.
+	Reader io.Reader
+	// Text is the text extracted from a document.
+	Text string
+}
+
+// SendNatively reports whether a document can be sent to a provider that reads documents of its MIME type.
+func (f File) SendNatively() bool {
+	return f.Kind == FileKindDocument && f.Reader != nil && f.Size <= MaxDocumentSize
+}
+
+// bufferedReader reads a file that was read into memory so the request carrying it can be sent more than once.
+type bufferedReader struct {
+	*bytes.Reader
+	data []byte
+}
+
+// Replayable reads the files of the request into memory once, so that it can be sent again by retries and failover
+// after the provider consumed the readers. Each call of the returned function gives the request with fresh readers.
+func (r CompletionRequest) Replayable() (func() CompletionRequest, error) {
+	buffered := make(map[[2]int][]byte)
+	for i, post := range r.Posts {
+		for j, file := range post.Files {
+			if file.Reader == nil {
+				continue
+			}
+			if reader, ok := file.Reader.(*bufferedReader); ok {
+				buffered[[2]int{i, j}] = reader.data
+				continue
+			}
+			data, err := io.ReadAll(file.Reader)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file %s: %w", file.Name, err)
+			}
+			buffered[[2]int{i, j}] = data
+		}
+	}
+	if len(buffered) == 0 {
+		return func() CompletionRequest { return r }, nil
+	}
+
+	return func() CompletionRequest {
+		request := r
+		request.Posts = make([]Post, len(r.Posts))
+		for i, post := range r.Posts {
+			request.Posts[i] = post
+			if len(post.Files) == 0 {
+				continue
+			}
+			request.Posts[i].Files = make([]File, len(post.Files))
+			for j, file := range post.Files {
+				if data, ok := buffered[[2]int{i, j}]; ok {
+					file.Reader = &bufferedReader{Reader: bytes.NewReader(data), data: data}
+				}
+				request.Posts[i].Files[j] = file
+			}
+		}
+		return request
+	}, nil
+}
+
+// DocumentText returns the text given in place of a document to providers that can't read it.
+func (f File) DocumentText() string {
+	if f.Text == "" {
+		return fmt.Sprintf("[The text of document %s could not be extracted]", f.Name)
+	}
+	return fmt.Sprintf("File Name: %s\nContent: %s", f.Name, f.Text)
 }
 
 type PostRole int
@@ -29,37 +110,25 @@ type Post struct {
 	Message string
 	Files   []File
 	ToolUse []ToolCall
+	// Reasoning is the model's reasoning that led to ToolUse, for providers that require it back.
+	Reasoning []ReasoningBlock
 }
 
 type CompletionRequest struct {
 	Posts   []Post
 	Context *Context
+	// Feature identifies the product feature making the request for usage accounting.
+	Feature Feature
+	// ConversationID identifies the conversation, usually by its root post ID, so per conversation state can be cached. Optional.
+	ConversationID string
 }
 
+// Truncate drops the oldest posts until the request fits in maxTokens, reporting whether anything was removed.
+// System posts are always kept and posts with tool calls are kept or dropped whole.
 func (b *CompletionRequest) Truncate(maxTokens int, countTokens func(string) int) bool {
-	oldPosts := b.Posts
-	b.Posts = make([]Post, 0, len(oldPosts))
-	var totalTokens int
-	for i := len(oldPosts) - 1; i >= 0; i-- {
-		post := oldPosts[i]
-		if totalTokens >= maxTokens {
-			slices.Reverse(b.Posts)
-			return true
-		}
-		postTokens := countTokens(post.Message)
-		if (totalTokens + postTokens) > maxTokens {
-			charactersToCut := (postTokens - (maxTokens - totalTokens)) * 4
-			post.Message = strings.TrimSpace(post.Message[charactersToCut:])
-			b.Posts = append(b.Posts, post)
-			slices.Reverse(b.Posts)
-			return true
-		}
-		totalTokens += postTokens
-		b.Posts = append(b.Posts, post)
-	}
-
-	slices.Reverse(b.Posts)
-	return false
+	kept, dropped, trimmed := fitPosts(b.Posts, maxTokens, countTokens)
+	b.Posts = kept
+	return len(dropped) > 0 || trimmed
 }
 
 // ExtractSystemMessage extracts the system message from the conversation.
@@ -94,3 +163,21 @@ func (b CompletionRequest) String() string {
 
 	return result.String()
 }
+
+// longestSuffixWithin returns the longest suffix of text, starting on a rune boundary, that fits within maxTokens.
+func longestSuffixWithin(text string, maxTokens int, countTokens func(string) int) string {
+	starts := make([]int, 0, len(text))
+	for i := range text {
+		starts = append(starts, i)
+	}
+
+	// Token counts shrink with the suffix, so binary search for the earliest start that fits.
+	first := sort.Search(len(starts), func(i int) bool {
+		return countTokens(text[starts[i]:]) <= maxTokens
+	})
+	if first == len(starts) {
+		return ""
+	}
+
+	return text[starts[first]:]
+}
@@ -3,6 +3,8 @@
 
 package llm
 
+import "slices"
+
 type ServiceConfig struct {
 	Name          string            `json:"name"`
 	Type          string            `json:"type"`
@@ -19,6 +21,27 @@ type ServiceConfig struct {
 
 	// Otherwise known as maxTokens
 	OutputTokenLimit int `json:"outputTokenLimit"`
+
+	// EnablePromptCaching marks the stable parts of requests for caching, for providers that only cache when asked to.
+	EnablePromptCaching bool `json:"enablePromptCaching"`
+	// SafetyThreshold is the level of harm at which Gemini blocks content, one of its HarmBlockThreshold values.
+	// Empty leaves the model's default.
+	SafetyThreshold string `json:"safetyThreshold"`
+
+	// Region is the AWS region Bedrock requests are sent to.
+	Region string `json:"region"`
+	// AccessKeyID and SecretAccessKey sign Bedrock requests. When empty, credentials come from the
+	// standard AWS environment variables or the role of the EC2 instance the server runs on.
+	AccessKeyID     string `json:"accessKeyID"`
+	SecretAccessKey string `json:"secretAccessKey"`
+
+	// StreamUsage asks OpenAI compatible servers to report token usage at the end of streamed responses.
+	// Some servers reject the option, without it no usage is recorded for the service.
+	StreamUsage bool `json:"streamUsage"`
+
+	// FetchModelCapabilities asks the provider which models it serves and what they support,
+	// for providers able to tell. Configured overrides still take precedence.
+	FetchModelCapabilities bool `json:"fetchModelCapabilities"`
 }
 
 type ChannelAccessLevel int
@@ -53,6 +76,71 @@ type BotConfig struct {
 	UserIDs            []string           `json:"userIDs"`
 	TeamIDs            []string           `json:"teamIDs"`
 	MaxFileSize        int64              `json:"maxFileSize"`
+	TruncationStrategy string             `json:"truncationStrategy"`
+	// FallbackServices are tried in order when Service fails with an error another service may not have.
+	FallbackServices []ServiceConfig `json:"fallbackServices"`
+	RateLimits       RateLimitConfig `json:"rateLimits"`
+	// ReasoningEffort is sent to models that support a reasoning effort, empty leaves it to the provider.
+	ReasoningEffort string `json:"reasoningEffort"`
+	// ThinkingBudgetTokens enables extended thinking on models that support it, zero disables it.
+	ThinkingBudgetTokens int                   `json:"thinkingBudgetTokens"`
+	Sampling             SamplingConfig        `json:"sampling"`
+	ImageGeneration      ImageGenerationConfig `json:"imageGeneration"`
+	TextToSpeech         TextToSpeechConfig    `json:"textToSpeech"`
+}
+
+// ImageGenerationConfig gives the bot a tool generating images, for services that can generate them.
+// Empty Model and Size use the service's defaults.
+type ImageGenerationConfig struct {
+	Enabled bool   `json:"enabled"`
+	Model   string `json:"model"`
+	Size    string `json:"size"`
+}
+
+// ImageSizes are the sizes images can be generated in, not every model supports all of them.
+var ImageSizes = []string{"256x256", "512x512", "1024x1024", "1792x1024", "1024x1792", "1536x1024", "1024x1536"}
+
+func (c ImageGenerationConfig) IsValid() bool {
+	return c.Size == "" || slices.Contains(ImageSizes, c.Size)
+}
+
+// TextToSpeechConfig lets users opt in to voice replies from the bot, read aloud from its answers.
+// Speech is synthesized through the OpenAI compatible API at APIURL, or through the bot's service when empty.
+// Empty Model and Voice use the service's defaults.
+type TextToSpeechConfig struct {
+	Enabled bool   `json:"enabled"`
+	APIURL  string `json:"apiURL"`
+	APIKey  string `json:"apiKey"`
+	Model   string `json:"model"`
+	Voice   string `json:"voice"`
+}
+
+// RateLimitConfig limits how much a bot can be used. Zero means unlimited.
+// Token limits are per UTC day and count input and output tokens as reported by the provider.
+type RateLimitConfig struct {
+	UserRequestsPerMinute int   `json:"userRequestsPerMinute"`
+	UserTokensPerDay      int64 `json:"userTokensPerDay"`
+	TeamTokensPerDay      int64 `json:"teamTokensPerDay"`
+	BotTokensPerDay       int64 `json:"botTokensPerDay"`
+}
+
+// HasTokenLimits reports whether any daily token limit is configured, which requires counting the tokens used.
+func (c RateLimitConfig) HasTokenLimits() bool {
+	return c.UserTokensPerDay > 0 || c.TeamTokensPerDay > 0 || c.BotTokensPerDay > 0
+}
+
+func (c RateLimitConfig) IsValid() bool {
+	return c.UserRequestsPerMinute >= 0 && c.UserTokensPerDay >= 0 && c.TeamTokensPerDay >= 0 && c.BotTokensPerDay >= 0
+}
+
+// Services returns the primary service of the bot followed by its fallbacks.
+func (c *BotConfig) Services() []ServiceConfig {
+	return append([]ServiceConfig{c.Service}, c.FallbackServices...)
+}
+
+// ReadsDocuments reports whether the service's provider is given PDFs as documents rather than their extracted text.
+func (c ServiceConfig) ReadsDocuments() bool {
+	return c.Type == ServiceTypeOpenAI || c.Type == ServiceTypeAnthropic
 }
 
 func (c *BotConfig) IsValid() bool {
@@ -69,20 +157,62 @@ func (c *BotConfig) IsValid() bool {
 		return false
 	}
 
+	switch c.TruncationStrategy {
+	case "", TruncationStrategyDropOldest, TruncationStrategySummarize:
+	default:
+		return false
+	}
+
+	if !c.RateLimits.IsValid() {
+		return false
+	}
+
+	switch c.ReasoningEffort {
+	case "", ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh:
+	default:
+		return false
+	}
+	if c.ThinkingBudgetTokens != 0 && c.ThinkingBudgetTokens < MinThinkingBudgetTokens {
+		return false
+	}
+
+	if !c.Sampling.IsValid() {
+		return false
+	}
+
+	if !c.ImageGeneration.IsValid() {
+		return false
+	}
+
+	for _, fallback := range c.FallbackServices {
+		if !fallback.IsValid() {
+			return false
+		}
+	}
+
+	return c.Service.IsValid()
+}
+
+func (c *ServiceConfig) IsValid() bool {
 	// Service-specific validation
-	switch c.Service.Type {
+	switch c.Type {
 	case ServiceTypeOpenAI:
-		return c.Service.APIKey != ""
+		return c.APIKey != ""
 	case ServiceTypeOpenAICompatible:
-		return c.Service.APIURL != ""
+		return c.APIURL != ""
 	case ServiceTypeAzure:
-		return c.Service.APIKey != "" && c.Service.APIURL != ""
+		return c.APIKey != "" && c.APIURL != ""
 	case ServiceTypeAnthropic:
-		return c.Service.APIKey != ""
+		return c.APIKey != ""
 	case ServiceTypeASage:
-		return c.Service.APIKey != ""
+		return c.APIKey != ""
 	case ServiceTypeCohere:
-		return c.Service.APIKey != ""
+		return c.APIKey != ""
+	case ServiceTypeGemini:
+		return c.APIKey != ""
+	case ServiceTypeBedrock:
+		// Keys are optional, but a partial pair can't sign anything.
+		return c.Region != "" && (c.AccessKeyID == "") == (c.SecretAccessKey == "")
 	default:
 		return false
 	}
@@ -24,6 +24,9 @@ func TestBotConfig_IsValid(t *testing.T) {
 		UserIDs            []string
 		TeamIDs            []string
 		MaxFileSize        int64
+
+		ReasoningEffort      string
+		ThinkingBudgetTokens int
 	}
 	tests := []struct {
 		name   string
@@ -263,6 +266,154 @@ func TestBotConfig_IsValid(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "Unknown reasoning effort",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Name:                    "Agents",
+					Type:                    "anthropic",
+					APIKey:                  "sk-xyz",
+					DefaultModel:            "claude",
+					InputTokenLimit:         100,
+					OutputTokenLimit:        4096,
+					StreamingTimeoutSeconds: 60,
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+				ReasoningEffort:    "extreme", // bad
+			},
+			want: false,
+		},
+		{
+			name: "Thinking budget below the minimum",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Name:                    "Agents",
+					Type:                    "anthropic",
+					APIKey:                  "sk-xyz",
+					DefaultModel:            "claude",
+					InputTokenLimit:         100,
+					OutputTokenLimit:        4096,
+					StreamingTimeoutSeconds: 60,
+				},
+				ChannelAccessLevel:   ChannelAccessLevelAll,
+				UserAccessLevel:      UserAccessLevelAll,
+				ThinkingBudgetTokens: 512, // bad
+			},
+			want: false,
+		},
+		{
+			name: "Valid thinking budget",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Name:                    "Agents",
+					Type:                    "anthropic",
+					APIKey:                  "sk-xyz",
+					DefaultModel:            "claude",
+					InputTokenLimit:         100,
+					OutputTokenLimit:        4096,
+					StreamingTimeoutSeconds: 60,
+				},
+				ChannelAccessLevel:   ChannelAccessLevelAll,
+				UserAccessLevel:      UserAccessLevelAll,
+				ThinkingBudgetTokens: 2048,
+			},
+			want: true,
+		},
+		{
+			name: "Gemini service requires API Key to be set",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Name:         "Agents",
+					Type:         "gemini",
+					APIKey:       "", // bad
+					DefaultModel: "gemini-2.5-flash",
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+			},
+			want: false,
+		},
+		{
+			name: "Valid Gemini configuration",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Name:         "Agents",
+					Type:         "gemini",
+					APIKey:       "key",
+					DefaultModel: "gemini-2.5-flash",
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+			},
+			want: true,
+		},
+		{
+			name: "Bedrock service requires a region",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Name:         "Agents",
+					Type:         "bedrock",
+					DefaultModel: "anthropic.claude-sonnet-4-20250514-v1:0",
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+			},
+			want: false,
+		},
+		{
+			name: "Bedrock service requires both keys when one is set",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Name:         "Agents",
+					Type:         "bedrock",
+					DefaultModel: "anthropic.claude-sonnet-4-20250514-v1:0",
+					Region:       "us-east-1",
+					AccessKeyID:  "AKIDEXAMPLE", // bad, no secret
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+			},
+			want: false,
+		},
+		{
+			name: "Valid Bedrock configuration using the instance role",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Name:         "Agents",
+					Type:         "bedrock",
+					DefaultModel: "anthropic.claude-sonnet-4-20250514-v1:0",
+					Region:       "us-east-1",
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+			},
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -280,6 +431,9 @@ func TestBotConfig_IsValid(t *testing.T) {
 				UserIDs:            tt.fields.UserIDs,
 				TeamIDs:            tt.fields.TeamIDs,
 				MaxFileSize:        tt.fields.MaxFileSize,
+
+				ReasoningEffort:      tt.fields.ReasoningEffort,
+				ThinkingBudgetTokens: tt.fields.ThinkingBudgetTokens,
 			}
 			assert.Equalf(t, tt.want, c.IsValid(), "IsValid() for test case %q", tt.name)
 		})
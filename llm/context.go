@@ -35,6 +35,9 @@ type Context struct {
 
 	Tools      *ToolStore
 	Parameters map[string]interface{}
+
+	// FileIDs are the files uploaded by tools, to be attached to the response.
+	FileIDs []string
 }
 
 // ContextOption defines a function that configures a Context
@@ -0,0 +1,46 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import "net/http"
+
+// customHeadersTransport wraps an http.RoundTripper to add custom headers to every request
+type customHeadersTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *customHeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Clone the request to avoid modifying the original
+	newReq := req.Clone(req.Context())
+
+	// Add custom headers
+	for key, value := range t.headers {
+		newReq.Header.Set(key, value)
+	}
+
+	return t.base.RoundTrip(newReq)
+}
+
+// WrapHTTPClientWithCustomHeaders wraps an http.Client to add the custom headers of a service to all requests
+func WrapHTTPClientWithCustomHeaders(baseClient *http.Client, customHeaders map[string]string) *http.Client {
+	if len(customHeaders) == 0 {
+		return baseClient
+	}
+
+	transport := baseClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &http.Client{
+		Transport: &customHeadersTransport{
+			base:    transport,
+			headers: customHeaders,
+		},
+		CheckRedirect: baseClient.CheckRedirect,
+		Jar:           baseClient.Jar,
+		Timeout:       baseClient.Timeout,
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomHeadersTransport(t *testing.T) {
+	// Create a test server that captures request headers
+	var capturedHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedHeaders = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id":"test","object":"chat.completion","choices":[{"message":{"content":"test response"}}]}`))
+	}))
+	defer server.Close()
+
+	// Create custom headers
+	customHeaders := map[string]string{
+		"X-Custom-Header-1": "value1",
+		"X-Custom-Header-2": "value2",
+		"Authorization":     "Bearer custom-token", // This should override any existing auth
+	}
+
+	// Create a base HTTP client
+	baseClient := &http.Client{}
+
+	// Wrap it with custom headers
+	wrappedClient := WrapHTTPClientWithCustomHeaders(baseClient, customHeaders)
+
+	// Make a request
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader("test body"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := wrappedClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Verify the response
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Verify custom headers were added
+	assert.Equal(t, "value1", capturedHeaders.Get("X-Custom-Header-1"))
+	assert.Equal(t, "value2", capturedHeaders.Get("X-Custom-Header-2"))
+	assert.Equal(t, "Bearer custom-token", capturedHeaders.Get("Authorization"))
+	assert.Equal(t, "application/json", capturedHeaders.Get("Content-Type"))
+}
+
+func TestCustomHeadersTransportNoHeaders(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Create a base HTTP client
+	baseClient := &http.Client{}
+
+	// Wrap it with no custom headers
+	wrappedClient := WrapHTTPClientWithCustomHeaders(baseClient, nil)
+
+	// Should return the same client when no headers are provided
+	assert.Equal(t, baseClient, wrappedClient)
+
+	// Test with empty map too
+	wrappedClient2 := WrapHTTPClientWithCustomHeaders(baseClient, map[string]string{})
+	assert.Equal(t, baseClient, wrappedClient2)
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import "context"
+
+// DefaultOptionsWrapper applies options to every request before the options given by the caller, so callers can override them.
+type DefaultOptionsWrapper struct {
+	wrapped LanguageModel
+	options []LanguageModelOption
+}
+
+func NewDefaultOptionsWrapper(wrapped LanguageModel, options ...LanguageModelOption) *DefaultOptionsWrapper {
+	return &DefaultOptionsWrapper{
+		wrapped: wrapped,
+		options: options,
+	}
+}
+
+func (w *DefaultOptionsWrapper) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	return w.wrapped.ChatCompletion(ctx, request, w.withDefaults(opts)...)
+}
+
+func (w *DefaultOptionsWrapper) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	return w.wrapped.ChatCompletionNoStream(ctx, request, w.withDefaults(opts)...)
+}
+
+func (w *DefaultOptionsWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *DefaultOptionsWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
+
+func (w *DefaultOptionsWrapper) withDefaults(opts []LanguageModelOption) []LanguageModelOption {
+	return append(append(make([]LanguageModelOption, 0, len(w.options)+len(opts)), w.options...), opts...)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+)
+
+// FailoverService is one of the services a FailoverWrapper can send requests to.
+type FailoverService struct {
+	Name  string
+	Model LanguageModel
+}
+
+// FailoverWrapper sends requests to the first of its services, moving on to the next when one fails before producing output.
+type FailoverWrapper struct {
+	services   []FailoverService
+	onFailover func(from, to string, err error)
+}
+
+// NewFailoverWrapper creates a failover chain over services in order of preference.
+// onFailover is called each time a request moves on to the next service and may be nil.
+func NewFailoverWrapper(services []FailoverService, onFailover func(from, to string, err error)) *FailoverWrapper {
+	return &FailoverWrapper{
+		services:   services,
+		onFailover: onFailover,
+	}
+}
+
+// ShouldFailOver reports whether a request that failed with err may succeed against a different service:
+// retryable provider errors, and network errors reaching the service. Other errors, such as client errors
+// or cancellation, would fail the same way anywhere.
+func ShouldFailOver(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return IsRetryableError(err)
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (w *FailoverWrapper) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	serviceRequest, err := request.Replayable()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, service := range w.services {
+		result, err := startStream(service.Model.ChatCompletion(ctx, serviceRequest(), opts...))
+		isLast := i == len(w.services)-1
+		if err == nil || isLast || !ShouldFailOver(err) || ctx.Err() != nil {
+			return result, returnedError(result, err)
+		}
+
+		if result != nil {
+			result.Close()
+		}
+		if w.onFailover != nil {
+			w.onFailover(service.Name, w.services[i+1].Name, err)
+		}
+	}
+
+	return nil, errors.New("no services configured")
+}
+
+func (w *FailoverWrapper) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	result, err := w.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.ReadAll()
+}
+
+// CountTokens counts with the primary service, requests are sized for it.
+func (w *FailoverWrapper) CountTokens(text string) int {
+	return w.services[0].Model.CountTokens(text)
+}
+
+// InputTokenLimit is the smallest limit in the chain so that any service can take over a request.
+func (w *FailoverWrapper) InputTokenLimit() int {
+	limit := w.services[0].Model.InputTokenLimit()
+	for _, service := range w.services[1:] {
+		limit = min(limit, service.Model.InputTokenLimit())
+	}
+	return limit
+}
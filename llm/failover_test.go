@@ -0,0 +1,104 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverWrapper(t *testing.T) {
+	unavailable := &ProviderError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")}
+	unauthorized := &ProviderError{StatusCode: http.StatusUnauthorized, Err: errors.New("unauthorized")}
+
+	t.Run("fails over in order", func(t *testing.T) {
+		primary := &scriptedModel{errs: []error{unavailable}, text: "primary"}
+		secondary := &scriptedModel{errs: []error{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, text: "secondary"}
+		tertiary := &scriptedModel{text: "tertiary"}
+
+		var failovers []string
+		wrapper := NewFailoverWrapper([]FailoverService{
+			{Name: "azure", Model: primary},
+			{Name: "openai", Model: secondary},
+			{Name: "local", Model: tertiary},
+		}, func(from, to string, err error) {
+			failovers = append(failovers, from+">"+to)
+		})
+
+		result, err := wrapper.ChatCompletionNoStream(context.Background(), CompletionRequest{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "tertiary", result)
+		assert.Equal(t, []string{"azure>openai", "openai>local"}, failovers)
+	})
+
+	t.Run("does not fail over client errors", func(t *testing.T) {
+		primary := &scriptedModel{errs: []error{unauthorized}, text: "primary"}
+		secondary := &scriptedModel{text: "secondary"}
+
+		wrapper := NewFailoverWrapper([]FailoverService{
+			{Name: "azure", Model: primary},
+			{Name: "openai", Model: secondary},
+		}, nil)
+
+		_, err := wrapper.ChatCompletionNoStream(context.Background(), CompletionRequest{})
+
+		assert.ErrorIs(t, err, unauthorized)
+		assert.Equal(t, 0, secondary.calls)
+	})
+
+	t.Run("does not fail over errors unrelated to the service", func(t *testing.T) {
+		for _, failure := range []error{context.Canceled, errors.New("failed to format prompt")} {
+			primary := &scriptedModel{errs: []error{failure}, text: "primary"}
+			secondary := &scriptedModel{text: "secondary"}
+
+			wrapper := NewFailoverWrapper([]FailoverService{
+				{Name: "azure", Model: primary},
+				{Name: "openai", Model: secondary},
+			}, nil)
+
+			_, err := wrapper.ChatCompletionNoStream(context.Background(), CompletionRequest{})
+
+			assert.ErrorIs(t, err, failure)
+			assert.Equal(t, 0, secondary.calls)
+		}
+	})
+
+	t.Run("sends attachments to the next service", func(t *testing.T) {
+		primary := &scriptedModel{errs: []error{unavailable}, text: "primary"}
+		secondary := &scriptedModel{text: "secondary"}
+		wrapper := NewFailoverWrapper([]FailoverService{
+			{Name: "azure", Model: NewRetryWrapper(primary, RetryConfig{})},
+			{Name: "openai", Model: NewRetryWrapper(secondary, RetryConfig{})},
+		}, nil)
+		request := CompletionRequest{Posts: []Post{{
+			Role:  PostRoleUser,
+			Files: []File{{Kind: FileKindDocument, Name: "report.pdf", MimeType: "application/pdf", Reader: strings.NewReader("%PDF-1.7")}},
+		}}}
+
+		result, err := wrapper.ChatCompletionNoStream(context.Background(), request)
+		require.NoError(t, err)
+
+		assert.Equal(t, "secondary", result)
+		assert.Equal(t, [][]string{{"%PDF-1.7"}}, primary.files)
+		assert.Equal(t, [][]string{{"%PDF-1.7"}}, secondary.files)
+	})
+
+	t.Run("uses the smallest input token limit", func(t *testing.T) {
+		wrapper := NewFailoverWrapper([]FailoverService{
+			{Name: "big", Model: &scriptedModel{}},
+			{Name: "small", Model: NewLLMTruncationWrapper(&fakeSummaryModel{}, nil)},
+		}, nil)
+
+		assert.Equal(t, 1000, wrapper.InputTokenLimit())
+	})
+}
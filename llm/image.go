@@ -0,0 +1,25 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+// ImageRequest asks for an image generated from a text prompt. Empty Model and Size use the service's defaults.
+type ImageRequest struct {
+	Prompt string
+	Model  string
+	Size   string
+	// Context is who the image is generated for and where, recorded with its usage. It may be nil.
+	Context *Context
+}
+
+// GeneratedImage is an image generated from a prompt.
+type GeneratedImage struct {
+	Data     []byte
+	MimeType string
+	// RevisedPrompt is what the service rewrote the prompt into, empty if it used the prompt as is.
+	RevisedPrompt string
+	// Model is the model that generated the image.
+	Model string
+	// Usage is nil for models that don't report the tokens an image used, such as DALL-E.
+	Usage *TokenUsage
+}
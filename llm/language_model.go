@@ -21,12 +21,17 @@
 package llm
 
 import (
+	"context"
+
 	"github.com/modelcontextprotocol/go-sdk/jsonschema"
 )
 
+// LanguageModel is implemented by every LLM provider and wrapper.
+// The context passed to the completion methods governs the upstream request:
+// cancelling it aborts the request, including a stream that is still being read.
 type LanguageModel interface {
-	ChatCompletion(conversation CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error)
-	ChatCompletionNoStream(conversation CompletionRequest, opts ...LanguageModelOption) (string, error)
+	ChatCompletion(ctx context.Context, conversation CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error)
+	ChatCompletionNoStream(ctx context.Context, conversation CompletionRequest, opts ...LanguageModelOption) (string, error)
 
 	CountTokens(text string) int
 	InputTokenLimit() int
@@ -37,6 +42,18 @@ type LanguageModelConfig struct {
 	MaxGeneratedTokens int
 	EnableVision       bool
 	JSONOutputFormat   *jsonschema.Schema
+	// ReasoningEffort is used by models that reason at a chosen effort, one of the ReasoningEffort constants.
+	ReasoningEffort string
+	// ThinkingBudgetTokens is used by models that reason within a token budget, zero disables thinking.
+	ThinkingBudgetTokens int
+	// ReasoningModel is set for models known to reason. OpenAI's reasoning models always reason, and reject
+	// sampling parameters even without a reasoning effort.
+	ReasoningModel bool
+	// Temperature, TopP and Seed are nil when left to the provider's defaults.
+	Temperature   *float32
+	TopP          *float32
+	StopSequences []string
+	Seed          *int64
 }
 
 type LanguageModelOption func(*LanguageModelConfig)
@@ -57,4 +74,41 @@ func WithJSONOutput[T any]() LanguageModelOption {
 	}
 }
 
+func WithReasoningEffort(effort string) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.ReasoningEffort = effort
+	}
+}
+func WithThinkingBudget(budgetTokens int) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.ThinkingBudgetTokens = budgetTokens
+	}
+}
+func WithReasoningModel() LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.ReasoningModel = true
+	}
+}
+
+func WithTemperature(temperature float32) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.Temperature = &temperature
+	}
+}
+func WithTopP(topP float32) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.TopP = &topP
+	}
+}
+func WithStopSequences(stopSequences []string) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.StopSequences = stopSequences
+	}
+}
+func WithSeed(seed int64) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.Seed = &seed
+	}
+}
+
 type LanguageModelWrapper func(LanguageModel) LanguageModel
@@ -0,0 +1,253 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ModelCapabilities describes what a model accepts and produces.
+type ModelCapabilities struct {
+	// ContextWindow and MaxOutputTokens are zero when unknown.
+	ContextWindow   int  `json:"contextWindow"`
+	MaxOutputTokens int  `json:"maxOutputTokens"`
+	Vision          bool `json:"vision"`
+	Tools           bool `json:"tools"`
+	JSONSchema      bool `json:"jsonSchema"`
+	Reasoning       bool `json:"reasoning"`
+}
+
+// unknownModelCapabilities are assumed for models nothing is known about, so that they are never rejected.
+var unknownModelCapabilities = ModelCapabilities{Vision: true, Tools: true, JSONSchema: true, Reasoning: true}
+
+// ModelCapabilitiesOverride changes the capabilities of the models whose ID starts with Model.
+// Unset fields keep the value known from other sources.
+type ModelCapabilitiesOverride struct {
+	Model           string `json:"model"`
+	ContextWindow   int    `json:"contextWindow,omitempty"`
+	MaxOutputTokens int    `json:"maxOutputTokens,omitempty"`
+	Vision          *bool  `json:"vision,omitempty"`
+	Tools           *bool  `json:"tools,omitempty"`
+	JSONSchema      *bool  `json:"jsonSchema,omitempty"`
+	Reasoning       *bool  `json:"reasoning,omitempty"`
+}
+
+func (o ModelCapabilitiesOverride) apply(capabilities ModelCapabilities) ModelCapabilities {
+	if o.ContextWindow > 0 {
+		capabilities.ContextWindow = o.ContextWindow
+	}
+	if o.MaxOutputTokens > 0 {
+		capabilities.MaxOutputTokens = o.MaxOutputTokens
+	}
+	if o.Vision != nil {
+		capabilities.Vision = *o.Vision
+	}
+	if o.Tools != nil {
+		capabilities.Tools = *o.Tools
+	}
+	if o.JSONSchema != nil {
+		capabilities.JSONSchema = *o.JSONSchema
+	}
+	if o.Reasoning != nil {
+		capabilities.Reasoning = *o.Reasoning
+	}
+	return capabilities
+}
+
+// ModelLister is implemented by providers that can describe the models they serve.
+// Only the capabilities the provider reports are set on the returned overrides.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelCapabilitiesOverride, error)
+}
+
+// ModelRegistry resolves the capabilities of models from, in increasing precedence,
+// the built-in data, what providers reported about their models and the overrides configured by admins.
+type ModelRegistry struct {
+	mu         sync.RWMutex
+	builtin    map[string]ModelCapabilities
+	discovered map[string]ModelCapabilitiesOverride
+	overrides  []ModelCapabilitiesOverride
+}
+
+func NewModelRegistry() *ModelRegistry {
+	return &ModelRegistry{
+		builtin:    builtinModelCapabilities,
+		discovered: map[string]ModelCapabilitiesOverride{},
+	}
+}
+
+// SetOverrides replaces the overrides configured by admins.
+func (r *ModelRegistry) SetOverrides(overrides []ModelCapabilitiesOverride) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overrides = overrides
+}
+
+// WithOverrides returns a copy of the registry using overrides in place of the current ones.
+func (r *ModelRegistry) WithOverrides(overrides []ModelCapabilitiesOverride) *ModelRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	discovered := make(map[string]ModelCapabilitiesOverride, len(r.discovered))
+	for id, override := range r.discovered {
+		discovered[id] = override
+	}
+	return &ModelRegistry{
+		builtin:    r.builtin,
+		discovered: discovered,
+		overrides:  overrides,
+	}
+}
+
+// AddDiscovered records what a provider reported about its models.
+func (r *ModelRegistry) AddDiscovered(models []ModelCapabilitiesOverride) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, model := range models {
+		r.discovered[normalizeModelID(model.Model)] = model
+	}
+}
+
+// Lookup returns the capabilities of model and whether anything is known about it.
+func (r *ModelRegistry) Lookup(model string) (ModelCapabilities, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id := normalizeModelID(model)
+	longest := ""
+	for prefix := range r.builtin {
+		if len(prefix) > len(longest) && strings.HasPrefix(id, prefix) {
+			longest = prefix
+		}
+	}
+	capabilities, known := r.builtin[longest]
+	if !known {
+		capabilities = unknownModelCapabilities
+	}
+
+	if discovered, ok := r.discovered[id]; ok {
+		capabilities = discovered.apply(capabilities)
+		known = true
+	}
+
+	var override *ModelCapabilitiesOverride
+	for i := range r.overrides {
+		if prefix := normalizeModelID(r.overrides[i].Model); prefix != "" && strings.HasPrefix(id, prefix) {
+			if override == nil || len(prefix) > len(normalizeModelID(override.Model)) {
+				override = &r.overrides[i]
+			}
+		}
+	}
+	if override != nil {
+		capabilities = override.apply(capabilities)
+		known = true
+	}
+
+	return capabilities, known
+}
+
+// InputTokenLimit returns the input token limit of the service, its context window when not configured.
+func (r *ModelRegistry) InputTokenLimit(service ServiceConfig) int {
+	if service.InputTokenLimit > 0 {
+		return service.InputTokenLimit
+	}
+	capabilities, _ := r.Lookup(service.DefaultModel)
+	return capabilities.ContextWindow
+}
+
+// SupportsTools reports whether every service of the bot can be given tools.
+func (r *ModelRegistry) SupportsTools(bot BotConfig) bool {
+	for _, service := range bot.Services() {
+		if capabilities, _ := r.Lookup(service.DefaultModel); !capabilities.Tools {
+			return false
+		}
+	}
+	return true
+}
+
+// SupportsJSONSchema reports whether the model of the service can be asked for output matching a JSON schema.
+func (r *ModelRegistry) SupportsJSONSchema(service ServiceConfig) bool {
+	capabilities, _ := r.Lookup(service.DefaultModel)
+	return capabilities.JSONSchema
+}
+
+// IsReasoningModel reports whether the model of the service is known to reason.
+// Unknown models are not, so that they are sent every setting.
+func (r *ModelRegistry) IsReasoningModel(service ServiceConfig) bool {
+	capabilities, known := r.Lookup(service.DefaultModel)
+	return known && capabilities.Reasoning
+}
+
+// ReadsDocuments reports whether a service of the bot reads PDFs given as documents.
+// Providers read their pages like images, so only models with vision can.
+func (r *ModelRegistry) ReadsDocuments(bot BotConfig) bool {
+	for _, service := range bot.Services() {
+		if !service.ReadsDocuments() {
+			continue
+		}
+		if capabilities, _ := r.Lookup(service.DefaultModel); capabilities.Vision {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateBot returns an error for every setting of the bot its models are known not to support.
+// Tools are not validated, they are left out for models that can't use them.
+func (r *ModelRegistry) ValidateBot(bot BotConfig) error {
+	var errs []error
+	for _, service := range bot.Services() {
+		capabilities, known := r.Lookup(service.DefaultModel)
+		if !known {
+			continue
+		}
+
+		if bot.EnableVision && !capabilities.Vision {
+			errs = append(errs, fmt.Errorf("vision is enabled but model %s of service %s does not accept images", service.DefaultModel, service.Name))
+		}
+		if (bot.ReasoningEffort != "" || bot.ThinkingBudgetTokens > 0) && !capabilities.Reasoning {
+			errs = append(errs, fmt.Errorf("reasoning is configured but model %s of service %s does not reason", service.DefaultModel, service.Name))
+		}
+		if capabilities.ContextWindow > 0 && service.InputTokenLimit > capabilities.ContextWindow {
+			errs = append(errs, fmt.Errorf("input token limit %d of service %s exceeds the %d token context window of model %s", service.InputTokenLimit, service.Name, capabilities.ContextWindow, service.DefaultModel))
+		}
+		if capabilities.MaxOutputTokens > 0 && service.OutputTokenLimit > capabilities.MaxOutputTokens {
+			errs = append(errs, fmt.Errorf("output token limit %d of service %s exceeds the %d tokens model %s can generate", service.OutputTokenLimit, service.Name, capabilities.MaxOutputTokens, service.DefaultModel))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("bot %s: %w", bot.Name, err)
+	}
+	return nil
+}
+
+// bedrockRegionPrefixes are the prefixes of Bedrock cross-region inference profile IDs.
+var bedrockRegionPrefixes = []string{"us.", "eu.", "apac.", "us-gov.", "global."}
+
+// bedrockVendorPrefixes are the prefixes of Bedrock model IDs naming the model's vendor.
+var bedrockVendorPrefixes = []string{"anthropic.", "cohere.", "meta.", "mistral.", "amazon."}
+
+// normalizeModelID reduces the model IDs providers use for the same model to a common form:
+// Gemini lists models as models/<id> and Bedrock prefixes them with a region and a vendor.
+func normalizeModelID(model string) string {
+	id := strings.ToLower(strings.TrimSpace(model))
+	id = strings.TrimPrefix(id, "models/")
+	for _, prefix := range bedrockRegionPrefixes {
+		if rest, found := strings.CutPrefix(id, prefix); found {
+			id = rest
+			break
+		}
+	}
+	for _, prefix := range bedrockVendorPrefixes {
+		if rest, found := strings.CutPrefix(id, prefix); found {
+			return rest
+		}
+	}
+	return id
+}
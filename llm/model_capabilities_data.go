@@ -0,0 +1,54 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+// builtinModelCapabilities are keyed by model ID prefix, the longest prefix matching a model applies.
+// Variants of a model that differ from it, such as larger context windows or vision previews, need their own entry.
+// Structured output is listed for every Anthropic model with tools, as it is produced through a tool call.
+var builtinModelCapabilities = map[string]ModelCapabilities{
+	// OpenAI
+	"gpt-3.5-turbo":          {ContextWindow: 16385, MaxOutputTokens: 4096, Tools: true},
+	"gpt-3.5-turbo-instruct": {ContextWindow: 4096, MaxOutputTokens: 4096},
+	"gpt-4":                  {ContextWindow: 8192, MaxOutputTokens: 8192, Tools: true},
+	"gpt-4-32k":              {ContextWindow: 32768, MaxOutputTokens: 32768, Tools: true},
+	"gpt-4-0125-preview":     {ContextWindow: 128000, MaxOutputTokens: 4096, Tools: true},
+	"gpt-4-1106-preview":     {ContextWindow: 128000, MaxOutputTokens: 4096, Tools: true},
+	"gpt-4-vision-preview":   {ContextWindow: 128000, MaxOutputTokens: 4096, Vision: true},
+	"gpt-4-1106-vision":      {ContextWindow: 128000, MaxOutputTokens: 4096, Vision: true},
+	"gpt-4-turbo":            {ContextWindow: 128000, MaxOutputTokens: 4096, Vision: true, Tools: true},
+	"gpt-4-turbo-preview":    {ContextWindow: 128000, MaxOutputTokens: 4096, Tools: true},
+	"gpt-4o":                 {ContextWindow: 128000, MaxOutputTokens: 16384, Vision: true, Tools: true, JSONSchema: true},
+	"gpt-4o-2024-05-13":      {ContextWindow: 128000, MaxOutputTokens: 4096, Vision: true, Tools: true},
+	"gpt-4.1":                {ContextWindow: 1047576, MaxOutputTokens: 32768, Vision: true, Tools: true, JSONSchema: true},
+	"gpt-4.5":                {ContextWindow: 128000, MaxOutputTokens: 16384, Vision: true, Tools: true, JSONSchema: true},
+	"gpt-5":                  {ContextWindow: 400000, MaxOutputTokens: 128000, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+	"gpt-5-chat":             {ContextWindow: 128000, MaxOutputTokens: 16384, Vision: true, JSONSchema: true},
+	"o1":                     {ContextWindow: 200000, MaxOutputTokens: 100000, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+	"o1-mini":                {ContextWindow: 128000, MaxOutputTokens: 65536, Reasoning: true},
+	"o1-preview":             {ContextWindow: 128000, MaxOutputTokens: 32768, Reasoning: true},
+	"o3":                     {ContextWindow: 200000, MaxOutputTokens: 100000, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+	"o3-mini":                {ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, JSONSchema: true, Reasoning: true},
+	"o4-mini":                {ContextWindow: 200000, MaxOutputTokens: 100000, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+
+	// Anthropic
+	"claude-3-haiku":    {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true, JSONSchema: true},
+	"claude-3-opus":     {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true, JSONSchema: true},
+	"claude-3-5-haiku":  {ContextWindow: 200000, MaxOutputTokens: 8192, Vision: true, Tools: true, JSONSchema: true},
+	"claude-3-5-sonnet": {ContextWindow: 200000, MaxOutputTokens: 8192, Vision: true, Tools: true, JSONSchema: true},
+	"claude-3-7-sonnet": {ContextWindow: 200000, MaxOutputTokens: 64000, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+	"claude-sonnet-4":   {ContextWindow: 200000, MaxOutputTokens: 64000, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+	"claude-opus-4":     {ContextWindow: 200000, MaxOutputTokens: 32000, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+	"claude-haiku-4":    {ContextWindow: 200000, MaxOutputTokens: 64000, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+
+	// Google
+	"gemini-1.5-flash": {ContextWindow: 1048576, MaxOutputTokens: 8192, Vision: true, Tools: true, JSONSchema: true},
+	"gemini-1.5-pro":   {ContextWindow: 2097152, MaxOutputTokens: 8192, Vision: true, Tools: true, JSONSchema: true},
+	"gemini-2.0-flash": {ContextWindow: 1048576, MaxOutputTokens: 8192, Vision: true, Tools: true, JSONSchema: true},
+	"gemini-2.5-flash": {ContextWindow: 1048576, MaxOutputTokens: 65536, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+	"gemini-2.5-pro":   {ContextWindow: 1048576, MaxOutputTokens: 65536, Vision: true, Tools: true, JSONSchema: true, Reasoning: true},
+
+	// Cohere
+	"command-r": {ContextWindow: 128000, MaxOutputTokens: 4000, Tools: true, JSONSchema: true},
+	"command-a": {ContextWindow: 256000, MaxOutputTokens: 8000, Tools: true, JSONSchema: true},
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRegistryLookup(t *testing.T) {
+	registry := NewModelRegistry()
+
+	tests := []struct {
+		name          string
+		model         string
+		known         bool
+		contextWindow int
+		vision        bool
+		tools         bool
+	}{
+		{name: "exact", model: "gpt-4o", known: true, contextWindow: 128000, vision: true, tools: true},
+		{name: "longest prefix", model: "gpt-4-turbo-2024-04-09", known: true, contextWindow: 128000, vision: true, tools: true},
+		{name: "shorter prefix", model: "gpt-4-0613", known: true, contextWindow: 8192, tools: true},
+		{name: "larger context variant", model: "gpt-4-32k-0613", known: true, contextWindow: 32768, tools: true},
+		{name: "vision variant", model: "gpt-4-vision-preview", known: true, contextWindow: 128000, vision: true},
+		{name: "newer version", model: "gpt-4.5-preview", known: true, contextWindow: 128000, vision: true, tools: true},
+		{name: "case insensitive", model: "GPT-3.5-Turbo", known: true, contextWindow: 16385, tools: true},
+		{name: "bedrock inference profile", model: "us.anthropic.claude-3-5-sonnet-20241022-v2:0", known: true, contextWindow: 200000, vision: true, tools: true},
+		{name: "gemini model name", model: "models/gemini-2.5-pro", known: true, contextWindow: 1048576, vision: true, tools: true},
+		{name: "unknown", model: "llama3", vision: true, tools: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			capabilities, known := registry.Lookup(tc.model)
+			assert.Equal(t, tc.known, known)
+			assert.Equal(t, tc.contextWindow, capabilities.ContextWindow)
+			assert.Equal(t, tc.vision, capabilities.Vision)
+			assert.Equal(t, tc.tools, capabilities.Tools)
+		})
+	}
+}
+
+func TestModelRegistrySupportsJSONSchema(t *testing.T) {
+	registry := NewModelRegistry()
+
+	assert.True(t, registry.SupportsJSONSchema(ServiceConfig{DefaultModel: "gpt-4o-2024-08-06"}))
+	assert.False(t, registry.SupportsJSONSchema(ServiceConfig{DefaultModel: "gpt-4o-2024-05-13"}))
+	assert.False(t, registry.SupportsJSONSchema(ServiceConfig{DefaultModel: "gpt-3.5-turbo"}))
+	assert.True(t, registry.SupportsJSONSchema(ServiceConfig{DefaultModel: "llama3"}), "unknown models are not restricted")
+}
+
+func TestModelRegistryIsReasoningModel(t *testing.T) {
+	registry := NewModelRegistry()
+
+	assert.True(t, registry.IsReasoningModel(ServiceConfig{DefaultModel: "o3-mini"}))
+	assert.True(t, registry.IsReasoningModel(ServiceConfig{DefaultModel: "gpt-5-mini"}))
+	assert.False(t, registry.IsReasoningModel(ServiceConfig{DefaultModel: "gpt-5-chat-latest"}))
+	assert.False(t, registry.IsReasoningModel(ServiceConfig{DefaultModel: "gpt-4o"}))
+	assert.False(t, registry.IsReasoningModel(ServiceConfig{DefaultModel: "llama3"}), "unknown models are sent sampling parameters")
+}
+
+func TestModelRegistryReadsDocuments(t *testing.T) {
+	registry := NewModelRegistry()
+	bot := func(serviceType, model string) BotConfig {
+		return BotConfig{Service: ServiceConfig{Type: serviceType, DefaultModel: model}}
+	}
+
+	assert.True(t, registry.ReadsDocuments(bot(ServiceTypeOpenAI, "gpt-4o")))
+	assert.True(t, registry.ReadsDocuments(bot(ServiceTypeAnthropic, "claude-sonnet-4-20250514")))
+	assert.False(t, registry.ReadsDocuments(bot(ServiceTypeOpenAI, "gpt-3.5-turbo")), "models without vision can't read documents")
+	assert.False(t, registry.ReadsDocuments(bot(ServiceTypeOpenAICompatible, "gpt-4o")), "compatible services are given the extracted text")
+
+	withFallback := bot(ServiceTypeOpenAICompatible, "llama3")
+	withFallback.FallbackServices = []ServiceConfig{{Type: ServiceTypeAnthropic, DefaultModel: "claude-3-5-sonnet-latest"}}
+	assert.True(t, registry.ReadsDocuments(withFallback))
+}
+
+func TestModelRegistryPrecedence(t *testing.T) {
+	yes, no := true, false
+	registry := NewModelRegistry()
+	registry.AddDiscovered([]ModelCapabilitiesOverride{
+		{Model: "gpt-4o", ContextWindow: 64000},
+		{Model: "llama3", ContextWindow: 8192, Tools: &no},
+	})
+	registry.SetOverrides([]ModelCapabilitiesOverride{
+		{Model: "gpt-4o", Vision: &no},
+		{Model: "gpt-4o-mini", Vision: &yes, MaxOutputTokens: 1000},
+	})
+
+	capabilities, known := registry.Lookup("gpt-4o")
+	assert.True(t, known)
+	assert.Equal(t, ModelCapabilities{ContextWindow: 64000, MaxOutputTokens: 16384, Tools: true, JSONSchema: true}, capabilities)
+
+	// The longest matching override applies.
+	capabilities, _ = registry.Lookup("gpt-4o-mini")
+	assert.Equal(t, 128000, capabilities.ContextWindow)
+	assert.Equal(t, 1000, capabilities.MaxOutputTokens)
+	assert.True(t, capabilities.Vision)
+
+	capabilities, known = registry.Lookup("llama3")
+	assert.True(t, known)
+	assert.Equal(t, 8192, capabilities.ContextWindow)
+	assert.False(t, capabilities.Tools)
+
+	// Copies don't affect the original registry.
+	capabilities, _ = registry.WithOverrides(nil).Lookup("gpt-4o")
+	assert.True(t, capabilities.Vision)
+	capabilities, _ = registry.Lookup("gpt-4o")
+	assert.False(t, capabilities.Vision)
+}
+
+func TestModelRegistryInputTokenLimit(t *testing.T) {
+	registry := NewModelRegistry()
+	assert.Equal(t, 1000, registry.InputTokenLimit(ServiceConfig{DefaultModel: "gpt-4o", InputTokenLimit: 1000}))
+	assert.Equal(t, 200000, registry.InputTokenLimit(ServiceConfig{DefaultModel: "claude-sonnet-4-20250514"}))
+	assert.Equal(t, 0, registry.InputTokenLimit(ServiceConfig{DefaultModel: "llama3"}))
+}
+
+func TestModelRegistryValidateBot(t *testing.T) {
+	registry := NewModelRegistry()
+
+	t.Run("supported", func(t *testing.T) {
+		bot := BotConfig{
+			Name:         "ai",
+			EnableVision: true,
+			Service:      ServiceConfig{Name: "openai", DefaultModel: "gpt-4o", InputTokenLimit: 100000, OutputTokenLimit: 4000},
+		}
+		assert.NoError(t, registry.ValidateBot(bot))
+	})
+
+	t.Run("unknown models are not validated", func(t *testing.T) {
+		bot := BotConfig{
+			Name:            "ai",
+			EnableVision:    true,
+			ReasoningEffort: "high",
+			Service:         ServiceConfig{Name: "local", DefaultModel: "llama3", InputTokenLimit: 1000000},
+		}
+		assert.NoError(t, registry.ValidateBot(bot))
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		bot := BotConfig{
+			Name:            "ai",
+			EnableVision:    true,
+			ReasoningEffort: "high",
+			Service:         ServiceConfig{Name: "openai", DefaultModel: "gpt-4o"},
+			FallbackServices: []ServiceConfig{
+				{Name: "legacy", DefaultModel: "gpt-3.5-turbo", InputTokenLimit: 32000, OutputTokenLimit: 8000},
+			},
+		}
+		err := registry.ValidateBot(bot)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bot ai:")
+		assert.Contains(t, err.Error(), "model gpt-4o of service openai does not reason")
+		assert.Contains(t, err.Error(), "model gpt-3.5-turbo of service legacy does not accept images")
+		assert.Contains(t, err.Error(), "input token limit 32000 of service legacy")
+		assert.Contains(t, err.Error(), "output token limit 8000 of service legacy")
+	})
+}
+
+func TestModelRegistrySupportsTools(t *testing.T) {
+	registry := NewModelRegistry()
+	assert.True(t, registry.SupportsTools(BotConfig{Service: ServiceConfig{DefaultModel: "gpt-4o"}}))
+	assert.True(t, registry.SupportsTools(BotConfig{Service: ServiceConfig{DefaultModel: "llama3"}}))
+	assert.False(t, registry.SupportsTools(BotConfig{
+		Service:          ServiceConfig{DefaultModel: "gpt-4o"},
+		FallbackServices: []ServiceConfig{{DefaultModel: "o1-mini"}},
+	}))
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+const (
+	ReasoningEffortLow    = "low"
+	ReasoningEffortMedium = "medium"
+	ReasoningEffortHigh   = "high"
+)
+
+// MinThinkingBudgetTokens is the smallest thinking budget providers accept.
+const MinThinkingBudgetTokens = 1024
+
+// ReasoningBlock is a piece of reasoning as the provider returned it, including what it needs to verify it when sent back.
+type ReasoningBlock struct {
+	Text      string `json:"text,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// RedactedData holds reasoning the provider returned encrypted, in place of Text or, for OpenAI, next to its summary.
+	RedactedData string `json:"redacted_data,omitempty"`
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ProviderError is an error response from an LLM provider's API.
+type ProviderError struct {
+	StatusCode int
+	// RetryAfter is how long the provider asked clients to wait before retrying, zero if it didn't say.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterFromHeader reads how long to wait before retrying from the headers of a failed response.
+func RetryAfterFromHeader(header http.Header) time.Duration {
+	// Not standard, but sent by OpenAI and Anthropic with more precision than Retry-After.
+	if milliseconds, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && milliseconds > 0 {
+		return time.Duration(milliseconds * float64(time.Millisecond))
+	}
+
+	retryAfter := header.Get("Retry-After")
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(retryAfter, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+// IsRetryableError reports whether a request that failed with err may succeed if repeated against the same service.
+func IsRetryableError(err error) bool {
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		return false
+	}
+
+	switch {
+	case providerErr.StatusCode == http.StatusRequestTimeout,
+		providerErr.StatusCode == http.StatusTooManyRequests,
+		providerErr.StatusCode >= http.StatusInternalServerError:
+		return true
+	}
+
+	return false
+}
+
+type RetryConfig struct {
+	// MaxRetries is the number of attempts after the first one.
+	MaxRetries     int
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts, a longer Retry-After from the provider ends the retries.
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryConfig = RetryConfig{
+	MaxRetries:     3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// RetryWrapper repeats requests that fail with a retryable error before any output was streamed.
+type RetryWrapper struct {
+	wrapped LanguageModel
+	config  RetryConfig
+	sleep   func(ctx context.Context, duration time.Duration) error
+}
+
+func NewRetryWrapper(wrapped LanguageModel, config RetryConfig) *RetryWrapper {
+	return &RetryWrapper{
+		wrapped: wrapped,
+		config:  config,
+		sleep:   sleepContext,
+	}
+}
+
+func (w *RetryWrapper) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	attemptRequest, err := request.Replayable()
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		result, err := startStream(w.wrapped.ChatCompletion(ctx, attemptRequest(), opts...))
+		if err == nil || attempt >= w.config.MaxRetries || !IsRetryableError(err) {
+			return result, returnedError(result, err)
+		}
+
+		backoff, ok := w.backoff(attempt, err)
+		if !ok {
+			return result, returnedError(result, err)
+		}
+		if result != nil {
+			result.Close()
+		}
+		if sleepErr := w.sleep(ctx, backoff); sleepErr != nil {
+			return nil, sleepErr
+		}
+	}
+}
+
+func (w *RetryWrapper) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	result, err := w.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.ReadAll()
+}
+
+func (w *RetryWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *RetryWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
+
+// backoff returns how long to wait before the next attempt, or false if the provider asked for longer than MaxBackoff.
+func (w *RetryWrapper) backoff(attempt int, err error) (time.Duration, bool) {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) && providerErr.RetryAfter > 0 {
+		return providerErr.RetryAfter, providerErr.RetryAfter <= w.config.MaxBackoff
+	}
+
+	// Exponential backoff with full jitter so concurrent requests don't retry in lockstep.
+	backoff := min(w.config.InitialBackoff<<attempt, w.config.MaxBackoff)
+	if backoff <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int64N(int64(backoff))) + 1, true
+}
+
+// startStream waits for the first event of a result so that errors raised before any output can be acted on.
+// The returned result still delivers every event, including that first one.
+func startStream(result *TextStreamResult, err error) (*TextStreamResult, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	first, ok := <-result.Stream
+	if !ok {
+		return result, nil
+	}
+
+	replay := make(chan TextStreamEvent)
+	go func() {
+		defer close(replay)
+		replay <- first
+		for event := range result.Stream {
+			replay <- event
+		}
+	}()
+	started := &TextStreamResult{Stream: replay, Cancel: result.Cancel}
+
+	if first.Type == EventTypeError {
+		if streamErr, isErr := first.Value.(error); isErr {
+			return started, streamErr
+		}
+		return started, fmt.Errorf("%v", first.Value)
+	}
+
+	return started, nil
+}
+
+// returnedError decides how a failure reaches the caller: errors from starting the request are returned,
+// errors delivered through the stream stay there as they always have.
+func returnedError(result *TextStreamResult, err error) error {
+	if result != nil {
+		return nil
+	}
+	return err
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedModel answers each request with the next error in its script, or with its text once the script runs out.
+type scriptedModel struct {
+	errs  []error
+	text  string
+	calls int
+	// files is what was read from the files of each request, like a provider uploading them.
+	files [][]string
+}
+
+func (m *scriptedModel) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	m.calls++
+	var files []string
+	for _, post := range request.Posts {
+		for _, file := range post.Files {
+			data, err := io.ReadAll(file.Reader)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, string(data))
+		}
+	}
+	m.files = append(m.files, files)
+
+	stream := make(chan TextStreamEvent)
+	go func() {
+		defer close(stream)
+		if m.calls <= len(m.errs) {
+			stream <- TextStreamEvent{Type: EventTypeError, Value: m.errs[m.calls-1]}
+			return
+		}
+		stream <- TextStreamEvent{Type: EventTypeText, Value: m.text}
+		stream <- TextStreamEvent{Type: EventTypeEnd}
+	}()
+	return &TextStreamResult{Stream: stream}, nil
+}
+
+func (m *scriptedModel) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	result, err := m.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.ReadAll()
+}
+
+func (m *scriptedModel) CountTokens(text string) int {
+	return len(text) / 4
+}
+
+func (m *scriptedModel) InputTokenLimit() int {
+	return 1000
+}
+
+func newTestRetryWrapper(model LanguageModel, sleeps *[]time.Duration) *RetryWrapper {
+	wrapper := NewRetryWrapper(model, RetryConfig{MaxRetries: 2, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second})
+	wrapper.sleep = func(_ context.Context, duration time.Duration) error {
+		*sleeps = append(*sleeps, duration)
+		return nil
+	}
+	return wrapper
+}
+
+func TestRetryWrapper(t *testing.T) {
+	rateLimited := &ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: 3 * time.Second, Err: errors.New("rate limited")}
+	unavailable := &ProviderError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")}
+	badRequest := &ProviderError{StatusCode: http.StatusBadRequest, Err: errors.New("bad request")}
+
+	t.Run("retries until success honoring Retry-After", func(t *testing.T) {
+		var sleeps []time.Duration
+		model := &scriptedModel{errs: []error{rateLimited, unavailable}, text: "hello"}
+
+		result, err := newTestRetryWrapper(model, &sleeps).ChatCompletionNoStream(context.Background(), CompletionRequest{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "hello", result)
+		assert.Equal(t, 3, model.calls)
+		require.Len(t, sleeps, 2)
+		assert.Equal(t, 3*time.Second, sleeps[0])
+		assert.LessOrEqual(t, sleeps[1], 2*time.Second, "second backoff is exponential")
+	})
+
+	t.Run("sends attachments again on retries", func(t *testing.T) {
+		var sleeps []time.Duration
+		model := &scriptedModel{errs: []error{unavailable}, text: "a chart"}
+		request := CompletionRequest{Posts: []Post{{
+			Role:    PostRoleUser,
+			Message: "What is in this image?",
+			Files:   []File{{Kind: FileKindImage, Name: "chart.png", MimeType: "image/png", Reader: strings.NewReader("image bytes")}},
+		}}}
+
+		result, err := newTestRetryWrapper(model, &sleeps).ChatCompletionNoStream(context.Background(), request)
+		require.NoError(t, err)
+
+		assert.Equal(t, "a chart", result)
+		assert.Equal(t, [][]string{{"image bytes"}, {"image bytes"}}, model.files)
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		var sleeps []time.Duration
+		model := &scriptedModel{errs: []error{badRequest}, text: "hello"}
+
+		_, err := newTestRetryWrapper(model, &sleeps).ChatCompletionNoStream(context.Background(), CompletionRequest{})
+
+		assert.ErrorIs(t, err, badRequest)
+		assert.Equal(t, 1, model.calls)
+		assert.Empty(t, sleeps)
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		var sleeps []time.Duration
+		model := &scriptedModel{errs: []error{unavailable, unavailable, unavailable}, text: "hello"}
+
+		result, err := newTestRetryWrapper(model, &sleeps).ChatCompletion(context.Background(), CompletionRequest{})
+		require.NoError(t, err, "errors from the stream stay in the stream")
+
+		_, err = result.ReadAll()
+		assert.ErrorIs(t, err, unavailable)
+		assert.Equal(t, 3, model.calls)
+	})
+
+	t.Run("does not wait longer than the max backoff", func(t *testing.T) {
+		var sleeps []time.Duration
+		tooLong := &ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour, Err: errors.New("come back later")}
+		model := &scriptedModel{errs: []error{tooLong}, text: "hello"}
+
+		_, err := newTestRetryWrapper(model, &sleeps).ChatCompletionNoStream(context.Background(), CompletionRequest{})
+
+		assert.ErrorIs(t, err, tooLong)
+		assert.Equal(t, 1, model.calls)
+	})
+}
+
+func TestRetryAfterFromHeader(t *testing.T) {
+	header := http.Header{}
+	assert.Equal(t, time.Duration(0), RetryAfterFromHeader(header))
+
+	header.Set("Retry-After", "2")
+	assert.Equal(t, 2*time.Second, RetryAfterFromHeader(header))
+
+	header.Set("Retry-After-Ms", "1500")
+	assert.Equal(t, 1500*time.Millisecond, RetryAfterFromHeader(header))
+
+	header = http.Header{}
+	header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Minute, RetryAfterFromHeader(header), float64(2*time.Second))
+}
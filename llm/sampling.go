@@ -0,0 +1,47 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+// SamplingConfig controls how a bot's model samples its output. Unset fields are left to the provider's defaults.
+type SamplingConfig struct {
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopP          *float32 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+	// Seed asks providers that support it to sample deterministically.
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+func (c SamplingConfig) IsValid() bool {
+	if c.Temperature != nil && (*c.Temperature < 0 || *c.Temperature > 2) {
+		return false
+	}
+	if c.TopP != nil && (*c.TopP < 0 || *c.TopP > 1) {
+		return false
+	}
+	return true
+}
+
+// Options returns the options that apply the configured parameters to a request.
+func (c SamplingConfig) Options() []LanguageModelOption {
+	var options []LanguageModelOption
+	if c.Temperature != nil {
+		options = append(options, WithTemperature(*c.Temperature))
+	}
+	if c.TopP != nil {
+		options = append(options, WithTopP(*c.TopP))
+	}
+	var stopSequences []string
+	for _, sequence := range c.StopSequences {
+		if sequence != "" {
+			stopSequences = append(stopSequences, sequence)
+		}
+	}
+	if len(stopSequences) > 0 {
+		options = append(options, WithStopSequences(stopSequences))
+	}
+	if c.Seed != nil {
+		options = append(options, WithSeed(*c.Seed))
+	}
+	return options
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// configRecorder records the configuration each request resolves to.
+type configRecorder struct {
+	fakeSummaryModel
+	configs []LanguageModelConfig
+}
+
+func (r *configRecorder) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	var cfg LanguageModelConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	r.configs = append(r.configs, cfg)
+	return "", nil
+}
+
+func TestSamplingConfig(t *testing.T) {
+	temperature := float32(0)
+	topP := float32(0.9)
+	seed := int64(42)
+	sampling := SamplingConfig{
+		Temperature:   &temperature,
+		TopP:          &topP,
+		StopSequences: []string{"END", ""},
+		Seed:          &seed,
+	}
+	require.True(t, sampling.IsValid())
+
+	recorder := &configRecorder{}
+	model := NewDefaultOptionsWrapper(recorder, sampling.Options()...)
+
+	_, err := model.ChatCompletionNoStream(context.Background(), CompletionRequest{})
+	require.NoError(t, err)
+	_, err = model.ChatCompletionNoStream(context.Background(), CompletionRequest{}, WithTemperature(0.7), WithStopSequences(nil))
+	require.NoError(t, err)
+
+	require.Len(t, recorder.configs, 2)
+	defaults := recorder.configs[0]
+	require.NotNil(t, defaults.Temperature)
+	assert.Equal(t, float32(0), *defaults.Temperature, "a zero temperature must be kept, not treated as unset")
+	assert.Equal(t, float32(0.9), *defaults.TopP)
+	assert.Equal(t, []string{"END"}, defaults.StopSequences)
+	assert.Equal(t, int64(42), *defaults.Seed)
+
+	overridden := recorder.configs[1]
+	assert.Equal(t, float32(0.7), *overridden.Temperature)
+	assert.Nil(t, overridden.StopSequences)
+	assert.Equal(t, int64(42), *overridden.Seed)
+
+	t.Run("unset parameters add no options", func(t *testing.T) {
+		assert.Empty(t, SamplingConfig{}.Options())
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		tooHot := float32(2.5)
+		assert.False(t, SamplingConfig{Temperature: &tooHot}.IsValid())
+		negative := float32(-0.1)
+		assert.False(t, SamplingConfig{TopP: &negative}.IsValid())
+	})
+}
@@ -10,4 +10,6 @@ const (
 	ServiceTypeASage            = "asage"
 	ServiceTypeAnthropic        = "anthropic"
 	ServiceTypeCohere           = "cohere"
+	ServiceTypeGemini           = "gemini"
+	ServiceTypeBedrock          = "bedrock"
 )
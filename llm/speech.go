@@ -0,0 +1,17 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+// MaxSpeechInputLength is the longest text synthesized into speech, longer texts are cut.
+const MaxSpeechInputLength = 4096
+
+// SpeechVoices are the voices offered to users, compatible servers may accept others.
+var SpeechVoices = []string{"alloy", "ash", "ballad", "coral", "echo", "fable", "nova", "onyx", "sage", "shimmer", "verse"}
+
+// SpeechRequest asks for text to be read aloud. Empty Model and Voice use the service's defaults.
+type SpeechRequest struct {
+	Text  string
+	Model string
+	Voice string
+}
@@ -3,7 +3,10 @@
 
 package llm
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // EventType represents the type of event in the text stream
 type EventType int
@@ -17,6 +20,13 @@ const (
 	EventTypeError
 	// EventTypeToolCalls represents a tool call event
 	EventTypeToolCalls
+	// EventTypeUsage represents a token usage report, the value is a TokenUsage
+	EventTypeUsage
+	// EventTypeReasoning represents a chunk of the model's reasoning, the value is a string
+	EventTypeReasoning
+	// EventTypeReasoningBlocks carries the complete reasoning that must be sent back with the tool results
+	// of the tool calls that follow it, the value is a []ReasoningBlock
+	EventTypeReasoningBlocks
 )
 
 // TextStreamEvent represents an event in the text stream
@@ -28,9 +38,37 @@ type TextStreamEvent struct {
 // TextStreamResult represents a stream of text events
 type TextStreamResult struct {
 	Stream <-chan TextStreamEvent
+
+	// Cancel aborts the upstream request producing the stream. May be nil.
+	Cancel context.CancelFunc
+}
+
+// Close aborts the upstream request producing the stream and discards any
+// events that are still pending so the producer can exit.
+// It is safe to call after the stream has been fully consumed.
+func (t *TextStreamResult) Close() {
+	if t.Cancel != nil {
+		t.Cancel()
+	}
+	if t.Stream == nil {
+		return
+	}
+	go func() {
+		for range t.Stream { //nolint:revive
+		}
+	}()
 }
 
 func NewStreamFromString(text string) *TextStreamResult {
+	return newStreamFromString(text, nil)
+}
+
+// NewStreamFromStringWithUsage is NewStreamFromString for providers that can report token usage but do not stream.
+func NewStreamFromStringWithUsage(text string, usage TokenUsage) *TextStreamResult {
+	return newStreamFromString(text, &usage)
+}
+
+func newStreamFromString(text string, usage *TokenUsage) *TextStreamResult {
 	stream := make(chan TextStreamEvent)
 
 	go func() {
@@ -40,6 +78,13 @@ func NewStreamFromString(text string) *TextStreamResult {
 			Value: text,
 		}
 
+		if usage != nil {
+			stream <- TextStreamEvent{
+				Type:  EventTypeUsage,
+				Value: *usage,
+			}
+		}
+
 		// Send end event
 		stream <- TextStreamEvent{
 			Type:  EventTypeEnd,
@@ -0,0 +1,139 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+)
+
+// ErrStructuredOutput is wrapped by every StructuredOutputError.
+var ErrStructuredOutput = errors.New("structured output failed")
+
+// StructuredOutputError is returned when a provider can't produce output matching the JSON schema requested with WithJSONOutput.
+type StructuredOutputError struct {
+	// Output is what the model produced, empty if it produced nothing.
+	Output string
+	Err    error
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrStructuredOutput, e.Err)
+}
+
+func (e *StructuredOutputError) Unwrap() []error {
+	return []error{ErrStructuredOutput, e.Err}
+}
+
+// ValidateJSONOutput returns a StructuredOutputError if output is not a JSON document matching schema.
+func ValidateJSONOutput(schema *jsonschema.Schema, output string) error {
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		return &StructuredOutputError{Output: output, Err: fmt.Errorf("invalid schema: %w", err)}
+	}
+
+	var instance any
+	if err := json.Unmarshal([]byte(output), &instance); err != nil {
+		return &StructuredOutputError{Output: output, Err: fmt.Errorf("output is not valid JSON: %w", err)}
+	}
+
+	if err := resolved.Validate(instance); err != nil {
+		return &StructuredOutputError{Output: output, Err: fmt.Errorf("output does not match schema: %w", err)}
+	}
+
+	return nil
+}
+
+// JSONOutputToolName is the tool that providers without a JSON output mode make the model call to produce structured output.
+// The input the model gives the tool is the output.
+const JSONOutputToolName = "json_output"
+
+// JSONOutputToolDescription tells the model what the JSON output tool is for.
+const JSONOutputToolDescription = "Respond with structured output by calling this tool. Its input is your response."
+
+// CheckJSONOutputToolSchema returns an error if schema can't be the input schema of the JSON output tool, which must be an object.
+func CheckJSONOutputToolSchema(schema *jsonschema.Schema) error {
+	if schema.Type != "object" {
+		return errors.New("structured output requires an object at the root of the schema")
+	}
+	return nil
+}
+
+// SendJSONToolOutput sends the input the model gave the JSON output tool as the text of the response, once it matches schema.
+// An empty input means the model did not call the tool, stopReason is the reason the provider gave for stopping.
+func SendJSONToolOutput(output chan<- TextStreamEvent, schema *jsonschema.Schema, input string, stopReason string) {
+	if input == "" {
+		output <- TextStreamEvent{
+			Type:  EventTypeError,
+			Value: &StructuredOutputError{Err: fmt.Errorf("model did not produce structured output, stop reason %q", stopReason)},
+		}
+		return
+	}
+
+	if err := ValidateJSONOutput(schema, input); err != nil {
+		output <- TextStreamEvent{
+			Type:  EventTypeError,
+			Value: err,
+		}
+		return
+	}
+
+	output <- TextStreamEvent{
+		Type:  EventTypeText,
+		Value: input,
+	}
+	output <- TextStreamEvent{
+		Type:  EventTypeEnd,
+		Value: nil,
+	}
+}
+
+// JSONOutputUnsupportedWrapper fails requests for structured output with a StructuredOutputError
+// instead of sending them to a model known not to support it.
+type JSONOutputUnsupportedWrapper struct {
+	wrapped LanguageModel
+}
+
+func NewJSONOutputUnsupportedWrapper(wrapped LanguageModel) *JSONOutputUnsupportedWrapper {
+	return &JSONOutputUnsupportedWrapper{
+		wrapped: wrapped,
+	}
+}
+
+func (w *JSONOutputUnsupportedWrapper) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	if err := checkNoJSONOutput(opts); err != nil {
+		return nil, err
+	}
+	return w.wrapped.ChatCompletion(ctx, request, opts...)
+}
+
+func (w *JSONOutputUnsupportedWrapper) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	if err := checkNoJSONOutput(opts); err != nil {
+		return "", err
+	}
+	return w.wrapped.ChatCompletionNoStream(ctx, request, opts...)
+}
+
+func (w *JSONOutputUnsupportedWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *JSONOutputUnsupportedWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
+
+func checkNoJSONOutput(opts []LanguageModelOption) error {
+	var cfg LanguageModelConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.JSONOutputFormat != nil {
+		return &StructuredOutputError{Err: errors.New("the model does not support structured output")}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type gradeOutput struct {
+	Reasoning string `json:"reasoning"`
+	Pass      bool   `json:"pass"`
+	Score     int    `json:"score"`
+}
+
+func TestValidateJSONOutput(t *testing.T) {
+	schema := NewJSONSchemaFromStruct[gradeOutput]()
+
+	t.Run("matching output", func(t *testing.T) {
+		assert.NoError(t, ValidateJSONOutput(schema, `{"reasoning":"good","pass":true,"score":3}`))
+	})
+
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"not JSON", `The answer passes.`},
+		{"missing property", `{"reasoning":"good","pass":true}`},
+		{"wrong type", `{"reasoning":"good","pass":"yes","score":3}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSONOutput(schema, tt.output)
+
+			var structuredErr *StructuredOutputError
+			require.ErrorAs(t, err, &structuredErr)
+			assert.Equal(t, tt.output, structuredErr.Output)
+			assert.True(t, errors.Is(err, ErrStructuredOutput))
+		})
+	}
+}
+
+func TestSendJSONToolOutput(t *testing.T) {
+	schema := NewJSONSchemaFromStruct[gradeOutput]()
+	send := func(input string) []TextStreamEvent {
+		output := make(chan TextStreamEvent, 2)
+		SendJSONToolOutput(output, schema, input, "end_turn")
+		close(output)
+		var events []TextStreamEvent
+		for event := range output {
+			events = append(events, event)
+		}
+		return events
+	}
+
+	events := send(`{"reasoning":"good","pass":true,"score":3}`)
+	require.Len(t, events, 2)
+	assert.Equal(t, TextStreamEvent{Type: EventTypeText, Value: `{"reasoning":"good","pass":true,"score":3}`}, events[0])
+	assert.Equal(t, EventTypeEnd, events[1].Type)
+
+	events = send("")
+	require.Len(t, events, 1)
+	require.Equal(t, EventTypeError, events[0].Type)
+	assert.ErrorContains(t, events[0].Value.(error), `stop reason "end_turn"`)
+	assert.ErrorIs(t, events[0].Value.(error), ErrStructuredOutput)
+
+	events = send(`{"pass":true}`)
+	require.Len(t, events, 1)
+	assert.ErrorIs(t, events[0].Value.(error), ErrStructuredOutput)
+
+	assert.Error(t, CheckJSONOutputToolSchema(NewJSONSchemaFromStruct[[]string]()))
+}
+
+func TestJSONOutputUnsupportedWrapper(t *testing.T) {
+	model := NewJSONOutputUnsupportedWrapper(&scriptedModel{text: "plain"})
+	request := CompletionRequest{Posts: []Post{{Role: PostRoleUser, Message: "Hi"}}}
+
+	_, err := model.ChatCompletionNoStream(context.Background(), request, WithJSONOutput[gradeOutput]())
+	assert.ErrorIs(t, err, ErrStructuredOutput)
+
+	output, err := model.ChatCompletionNoStream(context.Background(), request, WithMaxGeneratedTokens(10))
+	require.NoError(t, err)
+	assert.Equal(t, "plain", output)
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Tokenizer counts the tokens a model sees for a piece of text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// EstimatingTokenizer approximates token counts from character and word counts.
+// It is used for model families without a public vocabulary, or when the vocabulary is not available.
+type EstimatingTokenizer struct {
+	CharsPerToken float64
+	TokensPerWord float64
+}
+
+func (t EstimatingTokenizer) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	byChars := float64(len(text)) / t.CharsPerToken
+	byWords := float64(len(strings.Fields(text))) * t.TokensPerWord
+
+	// Average the two estimates, they err in opposite directions for code and for prose.
+	return int(math.Ceil((byChars + byWords) / 2))
+}
+
+// BPETokenizer counts tokens exactly using a byte pair encoding vocabulary.
+type BPETokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+func (t *BPETokenizer) CountTokens(text string) int {
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+const (
+	EncodingO200kBase  = "o200k_base"
+	EncodingCl100kBase = "cl100k_base"
+)
+
+// tokenizerFamily maps model name prefixes to a vocabulary and the estimator used when it can't be loaded.
+type tokenizerFamily struct {
+	prefixes  []string
+	encoding  string
+	estimator EstimatingTokenizer
+}
+
+// Estimators lean towards over-counting so that truncation stays on the safe side of the real limit.
+var (
+	defaultEstimator = EstimatingTokenizer{CharsPerToken: 3.8, TokensPerWord: 1.4}
+	claudeEstimator  = EstimatingTokenizer{CharsPerToken: 3.4, TokensPerWord: 1.5}
+)
+
+var tokenizerFamilies = []tokenizerFamily{
+	{
+		prefixes:  []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "chatgpt-4o", "o1", "o3", "o4"},
+		encoding:  EncodingO200kBase,
+		estimator: defaultEstimator,
+	},
+	{
+		prefixes:  []string{"gpt-4", "gpt-3.5", "text-embedding-3", "text-embedding-ada-002"},
+		encoding:  EncodingCl100kBase,
+		estimator: defaultEstimator,
+	},
+	{
+		// Anthropic does not publish its vocabulary.
+		prefixes:  []string{"claude"},
+		estimator: claudeEstimator,
+	},
+}
+
+// tokenizerVocabularyChecksums lists the SHA-256 of each vocabulary file in sha256sum format.
+// The bundle step checks downloaded files against it too, so both always agree on the files shipped.
+//
+//go:embed tokenizer_vocabularies.sha256
+var tokenizerVocabularyChecksums string
+
+// vocabularyChecksums maps vocabulary file names to their expected SHA-256.
+var vocabularyChecksums = parseChecksums(tokenizerVocabularyChecksums)
+
+func parseChecksums(list string) map[string]string {
+	checksums := make(map[string]string)
+	for _, line := range strings.Split(list, "\n") {
+		checksum, name, found := strings.Cut(strings.TrimSpace(line), "  ")
+		if found {
+			checksums[name] = checksum
+		}
+	}
+	return checksums
+}
+
+var (
+	vocabularyDir   string
+	encodingsLock   sync.Mutex
+	loadedEncodings = map[string]*BPETokenizer{}
+)
+
+// vocabularyLoader resolves the vocabulary URLs known to tiktoken to files in vocabularyDir so nothing is fetched at runtime.
+type vocabularyLoader struct{}
+
+func (vocabularyLoader) LoadTiktokenBpe(tiktokenBpeFile string) (map[string]int, error) {
+	if vocabularyDir == "" {
+		return nil, errors.New("tokenizer vocabulary directory not set")
+	}
+
+	name := path.Base(tiktokenBpeFile)
+	contents, err := os.ReadFile(filepath.Join(vocabularyDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer vocabulary: %w", err)
+	}
+
+	// A truncated or different vocabulary would silently miscount tokens.
+	checksum := sha256.Sum256(contents)
+	if expected, ok := vocabularyChecksums[name]; !ok || hex.EncodeToString(checksum[:]) != expected {
+		return nil, fmt.Errorf("tokenizer vocabulary %s does not match its checksum", name)
+	}
+
+	// Each line is a base64 encoded token followed by its rank.
+	ranks := make(map[string]int)
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line == "" {
+			continue
+		}
+		token, rank, found := strings.Cut(line, " ")
+		if !found {
+			return nil, fmt.Errorf("malformed tokenizer vocabulary line: %q", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("malformed tokenizer vocabulary token: %w", err)
+		}
+		rankValue, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("malformed tokenizer vocabulary rank: %w", err)
+		}
+		ranks[string(decoded)] = rankValue
+	}
+
+	return ranks, nil
+}
+
+// SetTokenizerVocabularyDir sets the directory holding the *.tiktoken vocabulary files shipped with the plugin.
+// Until it is called every model uses its estimator.
+func SetTokenizerVocabularyDir(dir string) {
+	encodingsLock.Lock()
+	defer encodingsLock.Unlock()
+
+	vocabularyDir = dir
+	loadedEncodings = map[string]*BPETokenizer{}
+	tiktoken.SetBpeLoader(vocabularyLoader{})
+}
+
+// TokenizerForModel returns the most accurate tokenizer available for the model.
+func TokenizerForModel(model string) Tokenizer {
+	family := findTokenizerFamily(model)
+	if family.encoding == "" {
+		return family.estimator
+	}
+
+	if tokenizer := loadEncoding(family.encoding); tokenizer != nil {
+		return tokenizer
+	}
+
+	return family.estimator
+}
+
+func findTokenizerFamily(model string) tokenizerFamily {
+	model = strings.ToLower(model)
+
+	// Prefer the longest matching prefix so that gpt-4o is not mistaken for gpt-4.
+	best := tokenizerFamily{estimator: defaultEstimator}
+	bestLen := 0
+	for _, family := range tokenizerFamilies {
+		for _, prefix := range family.prefixes {
+			if strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+				best = family
+				bestLen = len(prefix)
+			}
+		}
+	}
+
+	return best
+}
+
+// loadEncoding loads a vocabulary once, remembering failures so a missing file is not retried on every call.
+func loadEncoding(name string) *BPETokenizer {
+	encodingsLock.Lock()
+	defer encodingsLock.Unlock()
+
+	if tokenizer, ok := loadedEncodings[name]; ok {
+		return tokenizer
+	}
+
+	var tokenizer *BPETokenizer
+	if vocabularyDir != "" {
+		if encoding, err := tiktoken.GetEncoding(name); err == nil {
+			tokenizer = &BPETokenizer{encoding: encoding}
+		}
+	}
+	loadedEncodings[name] = tokenizer
+
+	return tokenizer
+}
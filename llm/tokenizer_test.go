@@ -0,0 +1,111 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimatingTokenizer(t *testing.T) {
+	tokenizer := EstimatingTokenizer{CharsPerToken: 4, TokensPerWord: 1}
+
+	assert.Equal(t, 0, tokenizer.CountTokens(""))
+	// 16 chars / 4 = 4, 4 words * 1 = 4
+	assert.Equal(t, 4, tokenizer.CountTokens("aaa bbb ccc dddd"))
+	// Rounds up so a short string is never free
+	assert.Equal(t, 1, tokenizer.CountTokens("a"))
+}
+
+func TestFindTokenizerFamily(t *testing.T) {
+	tests := []struct {
+		model    string
+		encoding string
+	}{
+		{model: "gpt-4o-mini", encoding: EncodingO200kBase},
+		{model: "GPT-4o", encoding: EncodingO200kBase},
+		{model: "gpt-4.1", encoding: EncodingO200kBase},
+		{model: "o3-mini", encoding: EncodingO200kBase},
+		{model: "gpt-4-turbo", encoding: EncodingCl100kBase},
+		{model: "gpt-3.5-turbo", encoding: EncodingCl100kBase},
+		{model: "claude-3-7-sonnet-latest", encoding: ""},
+		{model: "llama3", encoding: ""},
+		{model: "", encoding: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.model, func(t *testing.T) {
+			assert.Equal(t, test.encoding, findTokenizerFamily(test.model).encoding)
+		})
+	}
+
+	assert.Equal(t, claudeEstimator, findTokenizerFamily("claude-sonnet-4").estimator)
+}
+
+func TestTokenizerForModelFallsBackWithoutVocabulary(t *testing.T) {
+	SetTokenizerVocabularyDir(t.TempDir())
+	t.Cleanup(func() { SetTokenizerVocabularyDir("") })
+
+	assert.Equal(t, defaultEstimator, TokenizerForModel("gpt-4o"))
+	assert.Equal(t, claudeEstimator, TokenizerForModel("claude-3-5-haiku"))
+}
+
+func TestTokenizerForModelLoadsVocabulary(t *testing.T) {
+	// A minimal vocabulary with every single byte plus one merge of "ab".
+	var vocabulary strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&vocabulary, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	fmt.Fprintf(&vocabulary, "%s %d\n", base64.StdEncoding.EncodeToString([]byte("ab")), 256)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cl100k_base.tiktoken"), []byte(vocabulary.String()), 0600))
+	SetTokenizerVocabularyDir(dir)
+	t.Cleanup(func() { SetTokenizerVocabularyDir("") })
+
+	t.Run("a vocabulary not matching its checksum is not used", func(t *testing.T) {
+		assert.Equal(t, defaultEstimator, TokenizerForModel("gpt-4-turbo"))
+	})
+
+	checksum := sha256.Sum256([]byte(vocabulary.String()))
+	expected := vocabularyChecksums["cl100k_base.tiktoken"]
+	vocabularyChecksums["cl100k_base.tiktoken"] = hex.EncodeToString(checksum[:])
+	t.Cleanup(func() { vocabularyChecksums["cl100k_base.tiktoken"] = expected })
+	SetTokenizerVocabularyDir(dir)
+
+	tokenizer := TokenizerForModel("gpt-4-turbo")
+	require.IsType(t, &BPETokenizer{}, tokenizer)
+	assert.Equal(t, 2, tokenizer.CountTokens("abab"))
+	assert.Equal(t, 2, tokenizer.CountTokens("abc"))
+}
+
+func TestVocabularyChecksums(t *testing.T) {
+	for _, encoding := range []string{EncodingCl100kBase, EncodingO200kBase} {
+		assert.Len(t, vocabularyChecksums[encoding+".tiktoken"], 64, encoding)
+	}
+}
+
+func TestBundledVocabularies(t *testing.T) {
+	dir := filepath.Join("..", "assets", "tokenizers")
+	if _, err := os.Stat(filepath.Join(dir, "cl100k_base.tiktoken")); err != nil {
+		t.Skip("run make tokenizer-vocabularies to test the bundled vocabularies")
+	}
+	SetTokenizerVocabularyDir(dir)
+	t.Cleanup(func() { SetTokenizerVocabularyDir("") })
+
+	for _, model := range []string{"gpt-4-turbo", "gpt-4o"} {
+		tokenizer := TokenizerForModel(model)
+		require.IsType(t, &BPETokenizer{}, tokenizer, model)
+		assert.Equal(t, 2, tokenizer.CountTokens("hello world"), model)
+	}
+}
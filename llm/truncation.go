@@ -4,6 +4,9 @@
 package llm
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"math"
 )
 
@@ -12,25 +15,56 @@ const TokenLimitBufferSize = 0.9
 const MinTokens = 100
 
 type TruncationWrapper struct {
-	wrapped LanguageModel
+	wrapped  LanguageModel
+	strategy TruncationStrategy
 }
 
-func NewLLMTruncationWrapper(llm LanguageModel) *TruncationWrapper {
+// NewLLMTruncationWrapper truncates requests to the model's input token limit using strategy, DropOldestTruncation if nil.
+func NewLLMTruncationWrapper(llm LanguageModel, strategy TruncationStrategy) *TruncationWrapper {
+	if strategy == nil {
+		strategy = DropOldestTruncation{}
+	}
 	return &TruncationWrapper{
-		wrapped: llm,
+		wrapped:  llm,
+		strategy: strategy,
+	}
+}
+
+func (w *TruncationWrapper) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	if _, err := w.strategy.Truncate(ctx, w.wrapped, &request, w.tokenLimit(request)); err != nil {
+		return nil, fmt.Errorf("failed to truncate request: %w", err)
+	}
+	return w.wrapped.ChatCompletion(ctx, request, opts...)
+}
+
+func (w *TruncationWrapper) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	if _, err := w.strategy.Truncate(ctx, w.wrapped, &request, w.tokenLimit(request)); err != nil {
+		return "", fmt.Errorf("failed to truncate request: %w", err)
 	}
+	return w.wrapped.ChatCompletionNoStream(ctx, request, opts...)
 }
 
-func (w *TruncationWrapper) ChatCompletion(request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
-	tokenLimit := int(math.Max(math.Floor(float64(w.wrapped.InputTokenLimit()-FunctionsTokenBudget)*TokenLimitBufferSize), MinTokens))
-	request.Truncate(tokenLimit, w.wrapped.CountTokens)
-	return w.wrapped.ChatCompletion(request, opts...)
+// tokenLimit is the budget left for the conversation after reserving room for the tool definitions sent with it.
+func (w *TruncationWrapper) tokenLimit(request CompletionRequest) int {
+	functionsTokens := FunctionsTokenBudget
+	if request.Context != nil && request.Context.Tools != nil {
+		functionsTokens = max(functionsTokens, w.countToolTokens(request.Context.Tools.GetTools()))
+	}
+
+	return int(math.Max(math.Floor(float64(w.wrapped.InputTokenLimit()-functionsTokens)*TokenLimitBufferSize), MinTokens))
 }
 
-func (w *TruncationWrapper) ChatCompletionNoStream(request CompletionRequest, opts ...LanguageModelOption) (string, error) {
-	tokenLimit := int(math.Max(math.Floor(float64(w.wrapped.InputTokenLimit()-FunctionsTokenBudget)*TokenLimitBufferSize), MinTokens))
-	request.Truncate(tokenLimit, w.wrapped.CountTokens)
-	return w.wrapped.ChatCompletionNoStream(request, opts...)
+func (w *TruncationWrapper) countToolTokens(tools []Tool) int {
+	total := 0
+	for _, tool := range tools {
+		total += w.wrapped.CountTokens(tool.Name) + w.wrapped.CountTokens(tool.Description)
+		if tool.Schema != nil {
+			if schema, err := json.Marshal(tool.Schema); err == nil {
+				total += w.wrapped.CountTokens(string(schema))
+			}
+		}
+	}
+	return total
 }
 
 func (w *TruncationWrapper) CountTokens(text string) int {
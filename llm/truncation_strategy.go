@@ -0,0 +1,370 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TruncationStrategyDropOldest = "drop_oldest"
+	TruncationStrategySummarize  = "summarize"
+)
+
+// MaxHistorySummaryTokens caps the part of the context window given to the summary of removed history.
+const MaxHistorySummaryTokens = 1000
+
+// historySummaryTimeout bounds the background requests summarizing a conversation.
+const historySummaryTimeout = 5 * time.Minute
+
+// TruncationStrategy shortens requests that do not fit in the model's context window.
+// Implementations must keep system posts and must never separate a post from its tool calls and results.
+type TruncationStrategy interface {
+	// Truncate fits the request within maxTokens as counted by model, reporting whether anything was removed.
+	Truncate(ctx context.Context, model LanguageModel, request *CompletionRequest, maxTokens int) (bool, error)
+}
+
+// DropOldestTruncation removes the oldest posts that do not fit.
+type DropOldestTruncation struct{}
+
+func (DropOldestTruncation) Truncate(_ context.Context, model LanguageModel, request *CompletionRequest, maxTokens int) (bool, error) {
+	return request.Truncate(maxTokens, model.CountTokens), nil
+}
+
+// HistorySummary is a summary of the oldest posts of a conversation.
+type HistorySummary struct {
+	// PostCount is the number of oldest non-system posts covered by the summary.
+	PostCount int `json:"post_count"`
+	// Fingerprint identifies the covered posts so that edits and deletions invalidate the summary.
+	Fingerprint string `json:"fingerprint"`
+	Summary     string `json:"summary"`
+}
+
+// HistorySummaryCache stores the rolling summary of each conversation.
+type HistorySummaryCache interface {
+	GetSummary(conversationID string) (*HistorySummary, error)
+	SaveSummary(conversationID string, summary HistorySummary) error
+}
+
+// SummarizeTruncation replaces the posts that do not fit with a summary written by the model.
+// Summaries are written in the background and cached per conversation, so that requests never wait for them:
+// a request uses the cached summary and drops the posts it doesn't cover yet. Summaries are extended as the
+// conversation grows rather than rewritten.
+type SummarizeTruncation struct {
+	prompts    *Prompts
+	promptName string
+	cache      HistorySummaryCache
+	log        WarnLog
+
+	// summarizing holds the conversations being summarized, so that each is only summarized once at a time.
+	summarizing sync.Map
+	running     sync.WaitGroup
+}
+
+type WarnLog interface {
+	Warn(message string, keyValuePairs ...any)
+}
+
+// NewSummarizeTruncation creates a summarizing strategy using the named prompt template as the summarizer's system prompt.
+// Without a cache, or for requests without a conversation ID, there is nowhere to keep summaries and the oldest
+// posts are dropped instead.
+func NewSummarizeTruncation(prompts *Prompts, promptName string, cache HistorySummaryCache, log WarnLog) *SummarizeTruncation {
+	return &SummarizeTruncation{
+		prompts:    prompts,
+		promptName: promptName,
+		cache:      cache,
+		log:        log,
+	}
+}
+
+func (s *SummarizeTruncation) Truncate(ctx context.Context, model LanguageModel, request *CompletionRequest, maxTokens int) (bool, error) {
+	countTokens := model.CountTokens
+	if postsTokens(request.Posts, countTokens) <= maxTokens {
+		return false, nil
+	}
+
+	// Reserve part of the budget for the summary, the rest holds the most recent posts verbatim.
+	summaryBudget := min(MaxHistorySummaryTokens, maxTokens/4)
+	kept, dropped, trimmed := fitPosts(request.Posts, maxTokens-summaryBudget, countTokens)
+	if len(dropped) == 0 {
+		request.Posts = kept
+		return trimmed, nil
+	}
+
+	if s.cache == nil || request.ConversationID == "" {
+		return DropOldestTruncation{}.Truncate(ctx, model, request, maxTokens)
+	}
+
+	summary, covered := s.cachedSummary(request.ConversationID, dropped)
+	if covered < len(dropped) {
+		s.summarizeInBackground(ctx, model, *request, dropped, summaryBudget)
+	}
+	if summary == "" {
+		// Until the first summary is written, the history is dropped.
+		return DropOldestTruncation{}.Truncate(ctx, model, request, maxTokens)
+	}
+
+	summaryPost := Post{
+		Role:    PostRoleSystem,
+		Message: "Summary of the earlier part of this conversation, which was removed to fit the context window:\n" + summary,
+	}
+
+	// Place the summary after the leading system posts, where the removed history used to start.
+	insertAt := 0
+	for insertAt < len(kept) && kept[insertAt].Role == PostRoleSystem {
+		insertAt++
+	}
+	posts := make([]Post, 0, len(kept)+1)
+	posts = append(posts, kept[:insertAt]...)
+	posts = append(posts, summaryPost)
+	posts = append(posts, kept[insertAt:]...)
+	request.Posts = posts
+
+	return true, nil
+}
+
+// cachedSummary returns the cached summary of the conversation and how many of the dropped posts it covers.
+// A summary covering posts that were since edited or deleted is not used.
+func (s *SummarizeTruncation) cachedSummary(conversationID string, dropped []Post) (string, int) {
+	cached, err := s.cache.GetSummary(conversationID)
+	if err != nil {
+		s.log.Warn("Failed to get cached conversation summary", "error", err)
+		return "", 0
+	}
+	if cached == nil || cached.PostCount > len(dropped) || cached.Fingerprint != fingerprintPosts(dropped[:cached.PostCount]) {
+		return "", 0
+	}
+	return cached.Summary, cached.PostCount
+}
+
+// summarizeInBackground brings the cached summary up to date with dropped for the next requests.
+// It outlives the request, keeping its values but not its cancellation.
+func (s *SummarizeTruncation) summarizeInBackground(ctx context.Context, model LanguageModel, request CompletionRequest, dropped []Post, maxTokens int) {
+	if _, running := s.summarizing.LoadOrStore(request.ConversationID, true); running {
+		return
+	}
+
+	// The caller may keep using its context once the request is done.
+	if request.Context != nil {
+		copied := *request.Context
+		request.Context = &copied
+	}
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		defer s.summarizing.Delete(request.ConversationID)
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), historySummaryTimeout)
+		defer cancel()
+		if err := s.summarize(ctx, model, request, dropped, maxTokens); err != nil {
+			// The history keeps being dropped until a summary is written.
+			s.log.Warn("Failed to summarize conversation history", "error", err)
+		}
+	}()
+}
+
+// summarize caches a summary of dropped, extending the cached summary when it covers a prefix of them.
+func (s *SummarizeTruncation) summarize(ctx context.Context, model LanguageModel, request CompletionRequest, dropped []Post, maxTokens int) error {
+	if s.prompts == nil {
+		return fmt.Errorf("no prompts available")
+	}
+
+	previous, covered := s.cachedSummary(request.ConversationID, dropped)
+	pending := dropped[covered:]
+	if len(pending) == 0 {
+		return nil
+	}
+
+	summaryContext := NewContext()
+	if request.Context != nil {
+		copied := *request.Context
+		summaryContext = &copied
+	}
+	// The summarizer only reads the conversation, it must not call tools.
+	summaryContext.Tools = nil
+
+	systemPrompt, err := s.prompts.Format(s.promptName, summaryContext)
+	if err != nil {
+		return fmt.Errorf("failed to format summary prompt: %w", err)
+	}
+
+	// Summarize in chunks small enough for the model, folding each one into the summary so far.
+	chunkBudget := max(model.InputTokenLimit()/2-maxTokens-model.CountTokens(systemPrompt), MinTokens)
+	summary := previous
+	for _, chunk := range chunkTranscript(pending, chunkBudget, model.CountTokens) {
+		var message strings.Builder
+		if summary != "" {
+			message.WriteString("Summary of the conversation so far:\n")
+			message.WriteString(summary)
+			message.WriteString("\n\n")
+		}
+		message.WriteString("Messages to add to the summary:\n")
+		message.WriteString(chunk)
+
+		summary, err = model.ChatCompletionNoStream(ctx, CompletionRequest{
+			Posts: []Post{
+				{Role: PostRoleSystem, Message: systemPrompt},
+				{Role: PostRoleUser, Message: message.String()},
+			},
+			Context: summaryContext,
+			Feature: FeatureHistorySummary,
+		}, WithMaxGeneratedTokens(maxTokens))
+		if err != nil {
+			return fmt.Errorf("failed to summarize conversation history: %w", err)
+		}
+		summary = strings.TrimSpace(summary)
+	}
+
+	if err := s.cache.SaveSummary(request.ConversationID, HistorySummary{
+		PostCount:   len(dropped),
+		Fingerprint: fingerprintPosts(dropped),
+		Summary:     summary,
+	}); err != nil {
+		return fmt.Errorf("failed to cache conversation summary: %w", err)
+	}
+
+	return nil
+}
+
+// fitPosts keeps the system posts and as many of the newest other posts as fit in maxTokens, in their original order.
+// Posts with tool calls are kept or dropped whole, the oldest kept post may be cut short instead.
+func fitPosts(posts []Post, maxTokens int, countTokens func(string) int) (kept []Post, dropped []Post, trimmed bool) {
+	budget := maxTokens
+	keep := make([]bool, len(posts))
+	for i, post := range posts {
+		if post.Role == PostRoleSystem {
+			keep[i] = true
+			budget -= postTokens(post, countTokens)
+		}
+	}
+
+	cutIndex := -1
+	var cut Post
+	for i := len(posts) - 1; i >= 0; i-- {
+		if keep[i] {
+			continue
+		}
+		tokens := postTokens(posts[i], countTokens)
+		if tokens <= budget {
+			keep[i] = true
+			budget -= tokens
+			continue
+		}
+		if len(posts[i].ToolUse) == 0 && budget > 0 {
+			cut = posts[i]
+			cut.Message = strings.TrimSpace(longestSuffixWithin(cut.Message, budget, countTokens))
+			// The message takes the whole budget, leaving no room for documents.
+			cut.Files = slices.DeleteFunc(slices.Clone(cut.Files), func(file File) bool { return file.Kind == FileKindDocument })
+			cutIndex = i
+			keep[i] = true
+			trimmed = true
+		}
+		break
+	}
+
+	for i, post := range posts {
+		switch {
+		case !keep[i]:
+			dropped = append(dropped, post)
+		case i == cutIndex:
+			kept = append(kept, cut)
+		default:
+			kept = append(kept, post)
+		}
+	}
+
+	return kept, dropped, trimmed
+}
+
+func postTokens(post Post, countTokens func(string) int) int {
+	tokens := countTokens(post.Message)
+	for _, file := range post.Files {
+		if file.Kind == FileKindDocument {
+			tokens += countTokens(file.Text)
+		}
+	}
+	for _, tool := range post.ToolUse {
+		tokens += countTokens(tool.Name) + countTokens(string(tool.Arguments)) + countTokens(tool.Result)
+	}
+	return tokens
+}
+
+func postsTokens(posts []Post, countTokens func(string) int) int {
+	total := 0
+	for _, post := range posts {
+		total += postTokens(post, countTokens)
+	}
+	return total
+}
+
+// fingerprintPosts hashes the parts of posts that end up in a summary.
+func fingerprintPosts(posts []Post) string {
+	hash := sha256.New()
+	for _, post := range posts {
+		fmt.Fprintf(hash, "%d\x00%s\x00", post.Role, post.Message)
+		for _, tool := range post.ToolUse {
+			fmt.Fprintf(hash, "%s\x00%s\x00%s\x00", tool.ID, tool.Arguments, tool.Result)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// chunkTranscript renders posts as a plain text transcript split into chunks of at most maxTokens.
+func chunkTranscript(posts []Post, maxTokens int, countTokens func(string) int) []string {
+	var chunks []string
+	var current strings.Builder
+	currentTokens := 0
+	for _, post := range posts {
+		entry := transcriptEntry(post)
+		entryTokens := countTokens(entry)
+		if entryTokens > maxTokens {
+			entry = longestSuffixWithin(entry, maxTokens, countTokens)
+			entryTokens = countTokens(entry)
+		}
+		if currentTokens+entryTokens > maxTokens && current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentTokens = 0
+		}
+		current.WriteString(entry)
+		currentTokens += entryTokens
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+
+	return chunks
+}
+
+func transcriptEntry(post Post) string {
+	var entry strings.Builder
+	role := "User"
+	if post.Role == PostRoleBot {
+		role = "Assistant"
+	}
+	entry.WriteString(role)
+	entry.WriteString(": ")
+	entry.WriteString(post.Message)
+	entry.WriteString("\n")
+	for _, file := range post.Files {
+		if file.Kind == FileKindDocument {
+			entry.WriteString(file.DocumentText())
+			entry.WriteString("\n")
+		}
+	}
+	for _, tool := range post.ToolUse {
+		fmt.Fprintf(&entry, "[Assistant called tool %s with %s, result: %s]\n", tool.Name, tool.Arguments, tool.Result)
+	}
+	entry.WriteString("\n")
+
+	return entry.String()
+}
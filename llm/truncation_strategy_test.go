@@ -0,0 +1,280 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSummaryModel struct {
+	requests []CompletionRequest
+	err      error
+}
+
+func (f *fakeSummaryModel) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	result, err := f.ChatCompletionNoStream(ctx, request, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamFromString(result), nil
+}
+
+func (f *fakeSummaryModel) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	f.requests = append(f.requests, request)
+	if f.err != nil {
+		return "", f.err
+	}
+	return fmt.Sprintf("summary %d", len(f.requests)), nil
+}
+
+func (f *fakeSummaryModel) CountTokens(text string) int {
+	return len(text) / 4
+}
+
+func (f *fakeSummaryModel) InputTokenLimit() int {
+	return 10000
+}
+
+type memorySummaryCache struct {
+	summaries map[string]HistorySummary
+}
+
+func (c *memorySummaryCache) GetSummary(conversationID string) (*HistorySummary, error) {
+	summary, ok := c.summaries[conversationID]
+	if !ok {
+		return nil, nil
+	}
+	return &summary, nil
+}
+
+func (c *memorySummaryCache) SaveSummary(conversationID string, summary HistorySummary) error {
+	c.summaries[conversationID] = summary
+	return nil
+}
+
+type discardLog struct{}
+
+func (discardLog) Warn(message string, keyValuePairs ...any) {}
+
+// conversation returns a system post followed by count alternating user and bot posts of 40 tokens each.
+func conversation(count int) []Post {
+	posts := []Post{{Role: PostRoleSystem, Message: "You are a helpful assistant."}}
+	for i := 0; i < count; i++ {
+		role := PostRoleUser
+		if i%2 == 1 {
+			role = PostRoleBot
+		}
+		message := fmt.Sprintf("message %03d ", i)
+		posts = append(posts, Post{Role: role, Message: message + strings.Repeat("x", 160-len(message))})
+	}
+	return posts
+}
+
+func TestDropOldestTruncation(t *testing.T) {
+	model := &fakeSummaryModel{}
+
+	t.Run("keeps the system post", func(t *testing.T) {
+		request := CompletionRequest{Posts: conversation(10)}
+
+		// Room for the system post and exactly two others
+		truncated, err := DropOldestTruncation{}.Truncate(context.Background(), model, &request, 87)
+		require.NoError(t, err)
+
+		assert.True(t, truncated)
+		require.Len(t, request.Posts, 3)
+		assert.Equal(t, PostRoleSystem, request.Posts[0].Role)
+		assert.True(t, strings.HasPrefix(request.Posts[1].Message, "message 008"))
+		assert.True(t, strings.HasPrefix(request.Posts[2].Message, "message 009"))
+	})
+
+	t.Run("keeps tool calls with their post", func(t *testing.T) {
+		posts := conversation(2)
+		posts[2].ToolUse = []ToolCall{{ID: "1", Name: "search", Arguments: []byte(`{}`), Result: strings.Repeat("r", 400)}}
+		posts = append(posts, Post{Role: PostRoleUser, Message: "thanks"})
+		request := CompletionRequest{Posts: posts}
+
+		truncated, err := DropOldestTruncation{}.Truncate(context.Background(), model, &request, 100)
+		require.NoError(t, err)
+
+		// The tool post does not fit, it must be dropped whole rather than cut.
+		assert.True(t, truncated)
+		for _, post := range request.Posts {
+			assert.Empty(t, post.ToolUse)
+		}
+		assert.Equal(t, "thanks", request.Posts[len(request.Posts)-1].Message)
+	})
+
+	t.Run("counts the text of documents", func(t *testing.T) {
+		posts := conversation(2)
+		posts = append(posts, Post{
+			Role:    PostRoleUser,
+			Message: "summarize this",
+			Files: []File{
+				{Kind: FileKindImage, MimeType: "image/png"},
+				{Kind: FileKindDocument, Name: "report.pdf", MimeType: "application/pdf", Text: strings.Repeat("d", 800)},
+			},
+		})
+		request := CompletionRequest{Posts: posts}
+
+		truncated, err := DropOldestTruncation{}.Truncate(context.Background(), model, &request, 100)
+		require.NoError(t, err)
+
+		// The document doesn't fit, only the message of its post is kept.
+		assert.True(t, truncated)
+		require.Len(t, request.Posts, 2)
+		assert.Equal(t, "summarize this", request.Posts[1].Message)
+		assert.Equal(t, []File{{Kind: FileKindImage, MimeType: "image/png"}}, request.Posts[1].Files)
+		assert.Len(t, posts[3].Files, 2)
+	})
+}
+
+func TestSummarizeTruncation(t *testing.T) {
+	prompts, err := NewPrompts(fstest.MapFS{
+		"summarize.tmpl": &fstest.MapFile{Data: []byte("Summarize the conversation with {{.BotName}}.")},
+	})
+	require.NoError(t, err)
+
+	t.Run("no truncation needed", func(t *testing.T) {
+		model := &fakeSummaryModel{}
+		strategy := NewSummarizeTruncation(prompts, "summarize", nil, discardLog{})
+		request := CompletionRequest{Posts: conversation(2)}
+
+		truncated, err := strategy.Truncate(context.Background(), model, &request, 1000)
+		require.NoError(t, err)
+
+		assert.False(t, truncated)
+		assert.Len(t, request.Posts, 3)
+		assert.Empty(t, model.requests)
+	})
+
+	t.Run("drops history without a conversation to cache the summary for", func(t *testing.T) {
+		model := &fakeSummaryModel{}
+		strategy := NewSummarizeTruncation(prompts, "summarize", &memorySummaryCache{summaries: map[string]HistorySummary{}}, discardLog{})
+		request := CompletionRequest{Posts: conversation(10)}
+
+		truncated, err := strategy.Truncate(context.Background(), model, &request, 200)
+		require.NoError(t, err)
+		strategy.running.Wait()
+
+		assert.True(t, truncated)
+		assert.Empty(t, model.requests)
+		assert.NotEqual(t, PostRoleSystem, request.Posts[1].Role)
+	})
+
+	t.Run("summarizes dropped history in the background", func(t *testing.T) {
+		model := &fakeSummaryModel{}
+		cache := &memorySummaryCache{summaries: map[string]HistorySummary{}}
+		strategy := NewSummarizeTruncation(prompts, "summarize", cache, discardLog{})
+		request := CompletionRequest{
+			Posts:          conversation(10),
+			Context:        &Context{BotName: "Copilot", Tools: NewToolStore(nil, false)},
+			ConversationID: "thread",
+		}
+
+		// The first request doesn't wait for the summary and drops the history.
+		truncated, err := strategy.Truncate(context.Background(), model, &request, 200)
+		require.NoError(t, err)
+		assert.True(t, truncated)
+		assert.NotEqual(t, PostRoleSystem, request.Posts[1].Role)
+		strategy.running.Wait()
+
+		require.Len(t, model.requests, 1)
+		summaryRequest := model.requests[0]
+		assert.Equal(t, "Summarize the conversation with Copilot.", summaryRequest.Posts[0].Message)
+		assert.Contains(t, summaryRequest.Posts[1].Message, "message 000")
+		assert.NotContains(t, summaryRequest.Posts[1].Message, "message 009")
+		assert.Nil(t, summaryRequest.Context.Tools, "the summarizer must not be given tools")
+		assert.Equal(t, FeatureHistorySummary, summaryRequest.Feature, "summaries are recorded apart from the conversation")
+
+		// The next request uses it.
+		request = CompletionRequest{Posts: conversation(10), ConversationID: "thread"}
+		truncated, err = strategy.Truncate(context.Background(), model, &request, 200)
+		require.NoError(t, err)
+		strategy.running.Wait()
+
+		assert.True(t, truncated)
+		require.Len(t, model.requests, 1, "a summary covering the dropped history is reused")
+		assert.Equal(t, PostRoleSystem, request.Posts[0].Role)
+		assert.Equal(t, PostRoleSystem, request.Posts[1].Role)
+		assert.Contains(t, request.Posts[1].Message, "summary 1")
+		assert.True(t, strings.HasPrefix(request.Posts[len(request.Posts)-1].Message, "message 009"))
+		assert.LessOrEqual(t, postsTokens(request.Posts, model.CountTokens), 200)
+	})
+
+	t.Run("extends the cached summary", func(t *testing.T) {
+		model := &fakeSummaryModel{}
+		cache := &memorySummaryCache{summaries: map[string]HistorySummary{}}
+		strategy := NewSummarizeTruncation(prompts, "summarize", cache, discardLog{})
+
+		request := CompletionRequest{Posts: conversation(10), ConversationID: "thread"}
+		_, err := strategy.Truncate(context.Background(), model, &request, 200)
+		require.NoError(t, err)
+		strategy.running.Wait()
+		require.Len(t, model.requests, 1)
+		firstCount := cache.summaries["thread"].PostCount
+		assert.Greater(t, firstCount, 0)
+
+		// Two more posts use the previous summary right away, and only summarize what was newly dropped on top of it.
+		request = CompletionRequest{Posts: conversation(12), ConversationID: "thread"}
+		_, err = strategy.Truncate(context.Background(), model, &request, 200)
+		require.NoError(t, err)
+		strategy.running.Wait()
+		assert.Contains(t, request.Posts[1].Message, "summary 1")
+		require.Len(t, model.requests, 2)
+		update := model.requests[1].Posts[1].Message
+		assert.Contains(t, update, "summary 1")
+		assert.NotContains(t, update, "message 000")
+		assert.Contains(t, update, fmt.Sprintf("message %03d", firstCount))
+		assert.Equal(t, firstCount+2, cache.summaries["thread"].PostCount)
+		assert.Equal(t, "summary 2", cache.summaries["thread"].Summary)
+	})
+
+	t.Run("edited history invalidates the cached summary", func(t *testing.T) {
+		model := &fakeSummaryModel{}
+		cache := &memorySummaryCache{summaries: map[string]HistorySummary{}}
+		strategy := NewSummarizeTruncation(prompts, "summarize", cache, discardLog{})
+
+		request := CompletionRequest{Posts: conversation(10), ConversationID: "thread"}
+		_, err := strategy.Truncate(context.Background(), model, &request, 200)
+		require.NoError(t, err)
+		strategy.running.Wait()
+
+		posts := conversation(10)
+		posts[1].Message = "edited " + posts[1].Message
+		request = CompletionRequest{Posts: posts, ConversationID: "thread"}
+		_, err = strategy.Truncate(context.Background(), model, &request, 200)
+		require.NoError(t, err)
+		strategy.running.Wait()
+
+		assert.NotEqual(t, PostRoleSystem, request.Posts[1].Role, "the outdated summary is not used")
+		require.Len(t, model.requests, 2)
+		assert.NotContains(t, model.requests[1].Posts[1].Message, "summary 1")
+		assert.Contains(t, model.requests[1].Posts[1].Message, "edited message 000")
+	})
+
+	t.Run("falls back to dropping history when summarizing fails", func(t *testing.T) {
+		model := &fakeSummaryModel{err: errors.New("unavailable")}
+		cache := &memorySummaryCache{summaries: map[string]HistorySummary{}}
+		strategy := NewSummarizeTruncation(prompts, "summarize", cache, discardLog{})
+		request := CompletionRequest{Posts: conversation(10), ConversationID: "thread"}
+
+		truncated, err := strategy.Truncate(context.Background(), model, &request, 200)
+		require.NoError(t, err)
+		strategy.running.Wait()
+		assert.Empty(t, cache.summaries)
+
+		assert.True(t, truncated)
+		assert.Equal(t, PostRoleSystem, request.Posts[0].Role)
+		assert.NotEqual(t, PostRoleSystem, request.Posts[1].Role)
+		assert.LessOrEqual(t, postsTokens(request.Posts, model.CountTokens), 200)
+	})
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Feature identifies which part of the product made an LLM request.
+type Feature string
+
+const (
+	FeatureConversation   Feature = "conversation"
+	FeatureTitle          Feature = "title"
+	FeatureThreadAnalysis Feature = "thread_analysis"
+	FeatureChannelSummary Feature = "channel_summary"
+	FeatureMeetingSummary Feature = "meeting_summary"
+	FeatureReact          Feature = "react"
+	FeatureSearch         Feature = "search"
+	FeatureInterPlugin    Feature = "inter_plugin"
+	// FeatureHistorySummary is the summary of the history removed from a conversation to fit the context window.
+	FeatureHistorySummary  Feature = "history_summary"
+	FeatureImageGeneration Feature = "image_generation"
+)
+
+// TokenUsage is the value of an EventTypeUsage event.
+// InputTokens includes any tokens that were served from the provider's prompt cache, which are also counted in CachedTokens,
+// and any tokens that were written to it, which are also counted in CacheWriteTokens.
+type TokenUsage struct {
+	InputTokens      int64
+	OutputTokens     int64
+	CachedTokens     int64
+	CacheWriteTokens int64
+	// Model is the model that answered the request, set by ServiceUsageWrapper when the provider leaves it empty.
+	Model string
+}
+
+// Add returns the sum of the token counts of both usages.
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		InputTokens:      u.InputTokens + other.InputTokens,
+		OutputTokens:     u.OutputTokens + other.OutputTokens,
+		CachedTokens:     u.CachedTokens + other.CachedTokens,
+		CacheWriteTokens: u.CacheWriteTokens + other.CacheWriteTokens,
+	}
+}
+
+// UsageWithCacheTokens returns the usage reported by providers like Anthropic, whose input token count leaves out
+// the tokens read from and written to the prompt cache. They are added back so InputTokens covers the whole prompt.
+func UsageWithCacheTokens(inputTokens, outputTokens, cacheReadTokens, cacheWriteTokens int64) TokenUsage {
+	return TokenUsage{
+		InputTokens:      inputTokens + cacheReadTokens + cacheWriteTokens,
+		OutputTokens:     outputTokens,
+		CachedTokens:     cacheReadTokens,
+		CacheWriteTokens: cacheWriteTokens,
+	}
+}
+
+// UsageRecord is the token usage of a single LLM request.
+type UsageRecord struct {
+	BotID     string
+	UserID    string
+	ChannelID string
+	TeamID    string
+	Model     string
+	Feature   Feature
+	Usage     TokenUsage
+	CreateAt  int64
+}
+
+// UsageSink receives one UsageRecord for every LLM request that reported usage.
+type UsageSink interface {
+	RecordUsage(record UsageRecord)
+}
+
+// ServiceUsageWrapper completes the usage reported by a single service. Usage events are tagged with the model of the
+// service, so that requests answered after a failover are recorded under the model that answered them. Services that
+// don't report usage, such as OpenAI compatible servers without stream usage, get it estimated with the tokenizer.
+type ServiceUsageWrapper struct {
+	wrapped      LanguageModel
+	defaultModel string
+}
+
+func NewServiceUsageWrapper(wrapped LanguageModel, defaultModel string) *ServiceUsageWrapper {
+	return &ServiceUsageWrapper{
+		wrapped:      wrapped,
+		defaultModel: defaultModel,
+	}
+}
+
+func (w *ServiceUsageWrapper) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	result, err := w.wrapped.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := LanguageModelConfig{Model: w.defaultModel}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	output := make(chan TextStreamEvent)
+	go func() {
+		defer close(output)
+		reported := false
+		var outputText strings.Builder
+		for event := range result.Stream {
+			switch event.Type {
+			case EventTypeUsage:
+				if usage, ok := event.Value.(TokenUsage); ok {
+					if usage.Model == "" {
+						usage.Model = cfg.Model
+					}
+					event.Value = usage
+					reported = true
+				}
+			case EventTypeText, EventTypeReasoning:
+				if text, ok := event.Value.(string); ok {
+					outputText.WriteString(text)
+				}
+			case EventTypeToolCalls:
+				if toolCalls, err := json.Marshal(event.Value); err == nil {
+					outputText.Write(toolCalls)
+				}
+			}
+
+			// The estimate is sent before the final event, after which readers may stop reading.
+			if !reported && (event.Type == EventTypeEnd || event.Type == EventTypeToolCalls) {
+				output <- TextStreamEvent{
+					Type: EventTypeUsage,
+					Value: TokenUsage{
+						InputTokens:  int64(postsTokens(request.Posts, w.wrapped.CountTokens)),
+						OutputTokens: int64(w.wrapped.CountTokens(outputText.String())),
+						Model:        cfg.Model,
+					},
+				}
+				reported = true
+			}
+			output <- event
+		}
+	}()
+
+	return &TextStreamResult{Stream: output, Cancel: result.Cancel}, nil
+}
+
+func (w *ServiceUsageWrapper) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	// Go through the stream so the usage events are completed.
+	result, err := w.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.ReadAll()
+}
+
+func (w *ServiceUsageWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *ServiceUsageWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
+
+// UsageWrapper reports the token usage of every request made through it to a UsageSink, under the model reported
+// with the usage.
+type UsageWrapper struct {
+	wrapped LanguageModel
+	sink    UsageSink
+	botID   string
+}
+
+func NewUsageWrapper(wrapped LanguageModel, sink UsageSink, botID string) *UsageWrapper {
+	return &UsageWrapper{
+		wrapped: wrapped,
+		sink:    sink,
+		botID:   botID,
+	}
+}
+
+func (w *UsageWrapper) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	result, err := w.wrapped.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	record := NewUsageRecord(w.botID, request.Feature, request.Context)
+	output := make(chan TextStreamEvent)
+	go func() {
+		defer close(output)
+		reported := false
+		for event := range result.Stream {
+			if event.Type == EventTypeUsage {
+				if usage, ok := event.Value.(TokenUsage); ok {
+					record.Usage = record.Usage.Add(usage)
+					if usage.Model != "" {
+						record.Model = usage.Model
+					}
+					reported = true
+				}
+			}
+			output <- event
+		}
+		if reported {
+			record.CreateAt = time.Now().UnixMilli()
+			w.sink.RecordUsage(record)
+		}
+	}()
+
+	return &TextStreamResult{Stream: output, Cancel: result.Cancel}, nil
+}
+
+func (w *UsageWrapper) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	// Go through the stream so the usage events can be observed.
+	result, err := w.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.ReadAll()
+}
+
+func (w *UsageWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *UsageWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
+
+// NewUsageRecord returns a record of a request made for the user, channel and team of llmContext, which may be nil.
+func NewUsageRecord(botID string, feature Feature, llmContext *Context) UsageRecord {
+	record := UsageRecord{
+		BotID:   botID,
+		Feature: feature,
+	}
+	if llmContext != nil {
+		if llmContext.RequestingUser != nil {
+			record.UserID = llmContext.RequestingUser.Id
+		}
+		if llmContext.Channel != nil {
+			record.ChannelID = llmContext.Channel.Id
+			record.TeamID = llmContext.Channel.TeamId
+		}
+		if llmContext.Team != nil {
+			record.TeamID = llmContext.Team.Id
+		}
+	}
+	return record
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStreamModel struct {
+	events []TextStreamEvent
+}
+
+func (f *fakeStreamModel) ChatCompletion(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (*TextStreamResult, error) {
+	stream := make(chan TextStreamEvent)
+	go func() {
+		defer close(stream)
+		for _, event := range f.events {
+			stream <- event
+		}
+	}()
+	return &TextStreamResult{Stream: stream}, nil
+}
+
+func (f *fakeStreamModel) ChatCompletionNoStream(ctx context.Context, request CompletionRequest, opts ...LanguageModelOption) (string, error) {
+	result, err := f.ChatCompletion(ctx, request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.ReadAll()
+}
+
+func (f *fakeStreamModel) CountTokens(text string) int {
+	return len(text) / 4
+}
+
+func (f *fakeStreamModel) InputTokenLimit() int {
+	return 1000
+}
+
+type recordingSink struct {
+	records chan UsageRecord
+}
+
+func (s *recordingSink) RecordUsage(record UsageRecord) {
+	s.records <- record
+}
+
+func TestUsageWrapper(t *testing.T) {
+	request := CompletionRequest{
+		Posts:   []Post{{Role: PostRoleUser, Message: "hello"}},
+		Context: NewContext(),
+		Feature: FeatureReact,
+	}
+	request.Context.RequestingUser = &model.User{Id: "userid"}
+	request.Context.Channel = &model.Channel{Id: "channelid", TeamId: "teamid"}
+
+	t.Run("records summed usage once the stream ends", func(t *testing.T) {
+		wrapped := &fakeStreamModel{events: []TextStreamEvent{
+			{Type: EventTypeText, Value: "hi"},
+			{Type: EventTypeUsage, Value: TokenUsage{InputTokens: 10, OutputTokens: 2, CachedTokens: 4}},
+			{Type: EventTypeUsage, Value: TokenUsage{InputTokens: 5, OutputTokens: 1}},
+			{Type: EventTypeEnd},
+		}}
+		sink := &recordingSink{records: make(chan UsageRecord, 1)}
+		w := NewUsageWrapper(NewServiceUsageWrapper(wrapped, "default-model"), sink, "botid")
+
+		result, err := w.ChatCompletionNoStream(context.Background(), request, WithModel("override-model"))
+		require.NoError(t, err)
+		assert.Equal(t, "hi", result)
+
+		record := <-sink.records
+		assert.Equal(t, "botid", record.BotID)
+		assert.Equal(t, "userid", record.UserID)
+		assert.Equal(t, "channelid", record.ChannelID)
+		assert.Equal(t, "teamid", record.TeamID)
+		assert.Equal(t, "override-model", record.Model)
+		assert.Equal(t, FeatureReact, record.Feature)
+		assert.Equal(t, TokenUsage{InputTokens: 15, OutputTokens: 3, CachedTokens: 4}, record.Usage)
+		assert.NotZero(t, record.CreateAt)
+	})
+
+	t.Run("nothing is recorded without usage events", func(t *testing.T) {
+		wrapped := &fakeStreamModel{events: []TextStreamEvent{
+			{Type: EventTypeText, Value: "hi"},
+			{Type: EventTypeEnd},
+		}}
+		sink := &recordingSink{records: make(chan UsageRecord, 1)}
+		w := NewUsageWrapper(wrapped, sink, "botid")
+
+		stream, err := w.ChatCompletion(context.Background(), request)
+		require.NoError(t, err)
+		for range stream.Stream { //nolint:revive
+		}
+
+		assert.Empty(t, sink.records)
+	})
+
+	t.Run("usage is recorded under the model of the service that answered after a failover", func(t *testing.T) {
+		failing := &fakeStreamModel{events: []TextStreamEvent{
+			{Type: EventTypeError, Value: &ProviderError{StatusCode: 503, Err: errors.New("overloaded")}},
+		}}
+		fallback := &fakeStreamModel{events: []TextStreamEvent{
+			{Type: EventTypeText, Value: "hi"},
+			{Type: EventTypeUsage, Value: TokenUsage{InputTokens: 10, OutputTokens: 2}},
+			{Type: EventTypeEnd},
+		}}
+		sink := &recordingSink{records: make(chan UsageRecord, 1)}
+		w := NewUsageWrapper(NewFailoverWrapper([]FailoverService{
+			{Name: "primary", Model: NewServiceUsageWrapper(failing, "primary-model")},
+			{Name: "fallback", Model: NewServiceUsageWrapper(fallback, "fallback-model")},
+		}, nil), sink, "botid")
+
+		_, err := w.ChatCompletionNoStream(context.Background(), request)
+		require.NoError(t, err)
+
+		record := <-sink.records
+		assert.Equal(t, "fallback-model", record.Model)
+		assert.Equal(t, TokenUsage{InputTokens: 10, OutputTokens: 2}, record.Usage)
+	})
+}
+
+func TestServiceUsageWrapper(t *testing.T) {
+	request := CompletionRequest{Posts: []Post{
+		{Role: PostRoleSystem, Message: "You are a helpful assistant"},
+		{Role: PostRoleUser, Message: "What is the weather like?"},
+	}}
+
+	t.Run("usage is estimated when the service reports none", func(t *testing.T) {
+		wrapped := &fakeStreamModel{events: []TextStreamEvent{
+			{Type: EventTypeText, Value: "It is sunny "},
+			{Type: EventTypeText, Value: "and warm today"},
+			{Type: EventTypeEnd},
+		}}
+		w := NewServiceUsageWrapper(wrapped, "local-model")
+
+		stream, err := w.ChatCompletion(context.Background(), request)
+		require.NoError(t, err)
+		var events []TextStreamEvent
+		for event := range stream.Stream {
+			events = append(events, event)
+		}
+
+		require.Len(t, events, 4)
+		assert.Equal(t, TextStreamEvent{Type: EventTypeUsage, Value: TokenUsage{
+			InputTokens:  int64(len("You are a helpful assistant")/4 + len("What is the weather like?")/4),
+			OutputTokens: int64(len("It is sunny and warm today") / 4),
+			Model:        "local-model",
+		}}, events[2], "the estimate is sent before the end of the stream")
+		assert.Equal(t, EventTypeEnd, events[3].Type)
+	})
+
+	t.Run("nothing is estimated for failed streams", func(t *testing.T) {
+		wrapped := &fakeStreamModel{events: []TextStreamEvent{
+			{Type: EventTypeText, Value: "It is"},
+			{Type: EventTypeError, Value: errors.New("connection reset")},
+		}}
+		w := NewServiceUsageWrapper(wrapped, "local-model")
+
+		stream, err := w.ChatCompletion(context.Background(), request)
+		require.NoError(t, err)
+		for event := range stream.Stream {
+			assert.NotEqual(t, EventTypeUsage, event.Type)
+		}
+	})
+}
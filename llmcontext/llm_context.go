@@ -121,8 +121,8 @@ func (b *Builder) getToolsStoreForUser(c *llm.Context, bot *bots.Bot, isDM bool,
 		return llm.NewNoTools()
 	}
 
-	// Check if tools are disabled for this bot
-	if bot.GetConfig().DisableTools {
+	// Check if tools are disabled for this bot or unsupported by its model
+	if bot.ToolsDisabled() {
 		return llm.NewNoTools()
 	}
 
@@ -113,7 +113,7 @@ func (s *Service) createTranscription(recordingFileID string) (*subtitles.Subtit
 	return transcription, nil
 }
 
-func (s *Service) newCallRecordingThread(bot *bots.Bot, requestingUser *model.User, recordingPost *model.Post, channel *model.Channel, fileID string) (*model.Post, error) {
+func (s *Service) newCallRecordingThread(ctx context.Context, bot *bots.Bot, requestingUser *model.User, recordingPost *model.Post, channel *model.Channel, fileID string) (*model.Post, error) {
 	siteURL := s.pluginAPI.Configuration.GetConfig().ServiceSettings.SiteURL
 	T := i18n.LocalizerFunc(s.i18n, requestingUser.Locale)
 	surePost := &model.Post{
@@ -124,14 +124,14 @@ func (s *Service) newCallRecordingThread(bot *bots.Bot, requestingUser *model.Us
 		return nil, err
 	}
 
-	if err := s.summarizeCallRecording(bot, surePost.Id, requestingUser, fileID, channel); err != nil {
+	if err := s.summarizeCallRecording(ctx, bot, surePost.Id, requestingUser, fileID, channel); err != nil {
 		return nil, err
 	}
 
 	return surePost, nil
 }
 
-func (s *Service) newCallTranscriptionSummaryThread(bot *bots.Bot, requestingUser *model.User, transcriptionPost *model.Post, channel *model.Channel) (*model.Post, error) {
+func (s *Service) newCallTranscriptionSummaryThread(ctx context.Context, bot *bots.Bot, requestingUser *model.User, transcriptionPost *model.Post, channel *model.Channel) (*model.Post, error) {
 	if len(transcriptionPost.FileIds) != 1 {
 		return nil, errors.New("unexpected number of files in calls post")
 	}
@@ -198,7 +198,7 @@ func (s *Service) newCallTranscriptionSummaryThread(bot *bots.Bot, requestingUse
 			channel,
 			s.contextBuilder.WithLLMContextDefaultTools(bot, mmapi.IsDMWith(bot.GetMMBot().UserId, channel)),
 		)
-		summaryStream, err := s.SummarizeTranscription(bot, text, requestContext)
+		summaryStream, err := s.SummarizeTranscription(ctx, bot, text, requestContext)
 		if err != nil {
 			return fmt.Errorf("unable to summarize transcription: %w", err)
 		}
@@ -209,7 +209,7 @@ func (s *Service) newCallTranscriptionSummaryThread(bot *bots.Bot, requestingUse
 			Message:   "",
 		}
 		summaryPost.AddProp(ReferencedTranscriptPostID, transcriptionPost.Id)
-		if err := s.streamingService.StreamToNewPost(context.Background(), bot.GetMMBot().UserId, requestingUser.Id, summaryStream, summaryPost, transcriptionPost.Id); err != nil {
+		if err := s.streamingService.StreamToNewPost(ctx, bot.GetMMBot().UserId, requestingUser.Id, summaryStream, summaryPost, transcriptionPost.Id); err != nil {
 			return fmt.Errorf("unable to stream result to post: %w", err)
 		}
 
@@ -219,7 +219,7 @@ func (s *Service) newCallTranscriptionSummaryThread(bot *bots.Bot, requestingUse
 	return surePost, nil
 }
 
-func (s *Service) summarizeCallRecording(bot *bots.Bot, rootID string, requestingUser *model.User, recordingFileID string, channel *model.Channel) error {
+func (s *Service) summarizeCallRecording(ctx context.Context, bot *bots.Bot, rootID string, requestingUser *model.User, recordingFileID string, channel *model.Channel) error {
 	T := i18n.LocalizerFunc(s.i18n, requestingUser.Locale)
 
 	transcriptPost := &model.Post{
@@ -259,7 +259,7 @@ func (s *Service) summarizeCallRecording(bot *bots.Bot, rootID string, requestin
 			channel,
 			s.contextBuilder.WithLLMContextDefaultTools(bot, channel.Type == model.ChannelTypeDirect),
 		)
-		summaryStream, err := s.SummarizeTranscription(bot, transcription, llmContext)
+		summaryStream, err := s.SummarizeTranscription(ctx, bot, transcription, llmContext)
 		if err != nil {
 			return fmt.Errorf("unable to summarize transcription: %w", err)
 		}
@@ -268,13 +268,13 @@ func (s *Service) summarizeCallRecording(bot *bots.Bot, rootID string, requestin
 			return fmt.Errorf("unable to update transcript post: %w", err)
 		}
 
-		ctx, err := s.streamingService.GetStreamingContext(context.Background(), transcriptPost.Id)
+		streamCtx, err := s.streamingService.GetStreamingContext(ctx, transcriptPost.Id)
 		if err != nil {
 			return fmt.Errorf("unable to get post streaming context: %w", err)
 		}
 		defer s.streamingService.FinishStreaming(transcriptPost.Id)
 
-		s.streamingService.StreamToPost(ctx, summaryStream, transcriptPost, requestingUser.Locale)
+		s.streamingService.StreamToPost(streamCtx, summaryStream, transcriptPost, requestingUser.Locale)
 
 		return nil
 	}() //nolint:errcheck
@@ -282,7 +282,7 @@ func (s *Service) summarizeCallRecording(bot *bots.Bot, rootID string, requestin
 	return nil
 }
 
-func (s *Service) SummarizeTranscription(bot *bots.Bot, transcription *subtitles.Subtitles, context *llm.Context) (*llm.TextStreamResult, error) {
+func (s *Service) SummarizeTranscription(ctx context.Context, bot *bots.Bot, transcription *subtitles.Subtitles, context *llm.Context) (*llm.TextStreamResult, error) {
 	llmFormattedTranscription := transcription.FormatForLLM()
 	tokens := bot.LLM().CountTokens(llmFormattedTranscription)
 	tokenLimitWithMargin := int(float64(bot.LLM().InputTokenLimit())*0.75) - ContextTokenMargin
@@ -292,7 +292,9 @@ func (s *Service) SummarizeTranscription(bot *bots.Bot, transcription *subtitles
 	isChunked := false
 	if tokens > tokenLimitWithMargin {
 		s.pluginAPI.Log.Debug("Transcription too long, summarizing in chunks.", "tokens", tokens, "limit", tokenLimitWithMargin)
-		chunks := chunking.SplitPlaintextOnSentences(llmFormattedTranscription, tokenLimitWithMargin*4)
+		// Size chunks in characters using the ratio the tokenizer measured for this transcript.
+		charsPerToken := float64(len(llmFormattedTranscription)) / float64(tokens)
+		chunks := chunking.SplitPlaintextOnSentences(llmFormattedTranscription, int(float64(tokenLimitWithMargin)*charsPerToken))
 		summarizedChunks := make([]string, 0, len(chunks))
 		s.pluginAPI.Log.Debug("Split into chunks", "chunks", len(chunks))
 		for _, chunk := range chunks {
@@ -312,9 +314,10 @@ func (s *Service) SummarizeTranscription(bot *bots.Bot, transcription *subtitles
 					},
 				},
 				Context: context,
+				Feature: llm.FeatureMeetingSummary,
 			}
 
-			summarizedChunk, err := bot.LLM().ChatCompletionNoStream(request)
+			summarizedChunk, err := bot.LLM().ChatCompletionNoStream(ctx, request)
 			if err != nil {
 				return nil, fmt.Errorf("unable to get summarized chunk: %w", err)
 			}
@@ -345,9 +348,10 @@ func (s *Service) SummarizeTranscription(bot *bots.Bot, transcription *subtitles
 			},
 		},
 		Context: context,
+		Feature: llm.FeatureMeetingSummary,
 	}
 
-	summaryStream, err := bot.LLM().ChatCompletion(completionRequest)
+	summaryStream, err := bot.LLM().ChatCompletion(ctx, completionRequest)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get meeting summary: %w", err)
 	}
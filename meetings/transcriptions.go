@@ -4,6 +4,7 @@
 package meetings
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"slices"
@@ -21,7 +22,7 @@ const (
 )
 
 // HandleTranscribeFile handles file transcription requests
-func (s *Service) HandleTranscribeFile(userID string, bot *bots.Bot, post *model.Post, channel *model.Channel, fileID string) (map[string]string, error) {
+func (s *Service) HandleTranscribeFile(ctx context.Context, userID string, bot *bots.Bot, post *model.Post, channel *model.Channel, fileID string) (map[string]string, error) {
 	user, err := s.pluginAPI.User.Get(userID)
 	if err != nil {
 		return nil, err
@@ -36,7 +37,7 @@ func (s *Service) HandleTranscribeFile(userID string, bot *bots.Bot, post *model
 		return nil, errors.New("file not attached to specified post")
 	}
 
-	createdPost, err := s.newCallRecordingThread(bot, user, post, channel, fileID)
+	createdPost, err := s.newCallRecordingThread(ctx, bot, user, post, channel, fileID)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +53,7 @@ func (s *Service) HandleTranscribeFile(userID string, bot *bots.Bot, post *model
 }
 
 // HandleSummarizeTranscription handles transcription summarization requests
-func (s *Service) HandleSummarizeTranscription(userID string, bot *bots.Bot, post *model.Post, channel *model.Channel) (map[string]string, error) {
+func (s *Service) HandleSummarizeTranscription(ctx context.Context, userID string, bot *bots.Bot, post *model.Post, channel *model.Channel) (map[string]string, error) {
 	user, err := s.pluginAPI.User.Get(userID)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get user: %w", err)
@@ -67,7 +68,7 @@ func (s *Service) HandleSummarizeTranscription(userID string, bot *bots.Bot, pos
 		return nil, errors.New("not a calls or zoom bot post")
 	}
 
-	createdPost, err := s.newCallTranscriptionSummaryThread(bot, user, post, channel)
+	createdPost, err := s.newCallTranscriptionSummaryThread(ctx, bot, user, post, channel)
 	if err != nil {
 		return nil, fmt.Errorf("unable to summarize transcription: %w", err)
 	}
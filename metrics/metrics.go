@@ -28,6 +28,8 @@ type Metrics interface {
 	IncrementHTTPErrors()
 
 	GetMetricsForAIService(llmName string) *llmMetrics
+
+	IncrementLLMFailovers(botName, fromService, toService string)
 }
 
 type InstanceInfo struct {
@@ -48,7 +50,8 @@ type metrics struct {
 	httpRequestsTotal prometheus.Counter
 	httpErrorsTotal   prometheus.Counter
 
-	llmRequestsTotal *prometheus.CounterVec
+	llmRequestsTotal  *prometheus.CounterVec
+	llmFailoversTotal *prometheus.CounterVec
 }
 
 // NewMetrics Factory method to create a new metrics collector.
@@ -129,6 +132,15 @@ func NewMetrics(info InstanceInfo) Metrics {
 	}, []string{"llm_name"})
 	m.registry.MustRegister(m.llmRequestsTotal)
 
+	m.llmFailoversTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "failovers_total",
+		Help:        "The total number of LLM requests moved to a fallback service.",
+		ConstLabels: additionalLabels,
+	}, []string{"bot_name", "from_service", "to_service"})
+	m.registry.MustRegister(m.llmFailoversTotal)
+
 	return m
 }
 
@@ -154,6 +166,12 @@ func (m *metrics) IncrementHTTPErrors() {
 	}
 }
 
+func (m *metrics) IncrementLLMFailovers(botName, fromService, toService string) {
+	if m != nil {
+		m.llmFailoversTotal.With(prometheus.Labels{"bot_name": botName, "from_service": fromService, "to_service": toService}).Inc()
+	}
+}
+
 func (m *metrics) GetMetricsForAIService(llmName string) *llmMetrics {
 	if m == nil {
 		return nil
@@ -40,3 +40,8 @@ func (m *NoopMetrics) IncrementHTTPErrors() {
 func (m *NoopMetrics) GetMetricsForAIService(llmName string) *llmMetrics { //nolint:revive
 	return &llmMetrics{}
 }
+
+// IncrementLLMFailovers is a no-op implementation.
+func (m *NoopMetrics) IncrementLLMFailovers(botName, fromService, toService string) {
+	// No-op
+}
@@ -4,6 +4,7 @@
 package mmapi
 
 import (
+	"bytes"
 	"io"
 	"net/http"
 
@@ -29,6 +30,7 @@ type Client interface {
 	LogWarn(msg string, keyValuePairs ...interface{})
 	KVGet(key string, value interface{}) error
 	KVSet(key string, value interface{}) error
+	KVCompareAndSet(key string, oldValue, newValue interface{}) (bool, error)
 	KVDelete(key string) error
 	GetUserByUsername(username string) (*model.User, error)
 	GetUserStatus(userID string) (*model.Status, error)
@@ -40,6 +42,7 @@ type Client interface {
 	HasPermissionToChannel(userID, channelID string, permission *model.Permission) bool
 	GetFileInfo(fileID string) (*model.FileInfo, error)
 	GetFile(fileID string) (io.ReadCloser, error)
+	UploadFile(data []byte, channelID, filename string) (*model.FileInfo, error)
 	SendEphemeralPost(userID string, post *model.Post)
 }
 
@@ -90,6 +93,10 @@ func (m *client) KVSet(key string, value interface{}) error {
 	return err
 }
 
+func (m *client) KVCompareAndSet(key string, oldValue, newValue interface{}) (bool, error) {
+	return m.pluginAPI.KV.Set(key, newValue, pluginapi.SetAtomic(oldValue))
+}
+
 func (m *client) KVDelete(key string) error {
 	return m.pluginAPI.KV.Delete(key)
 }
@@ -130,6 +137,10 @@ func (m *client) GetFile(fileID string) (io.ReadCloser, error) {
 	return io.NopCloser(file), nil
 }
 
+func (m *client) UploadFile(data []byte, channelID, filename string) (*model.FileInfo, error) {
+	return m.pluginAPI.File.Upload(bytes.NewReader(data), filename, channelID)
+}
+
 func (m *client) SendEphemeralPost(userID string, post *model.Post) {
 	m.PostService.SendEphemeralPost(userID, post)
 }
@@ -0,0 +1,102 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package mmtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+)
+
+const (
+	MaxImagePromptLength = 4000
+
+	// GeneratedImageFileName is the name generated images are uploaded with.
+	GeneratedImageFileName = "generated-image.png"
+
+	imageGenerationTimeout = 2 * time.Minute
+)
+
+// ImageGenerators returns the image generator of a bot, nil if the bot can't generate images, and checks the rate
+// limits that generated images count towards.
+type ImageGenerators interface {
+	GetImageGenerator(bot *bots.Bot) bots.ImageGenerator
+	CheckRateLimits(bot *bots.Bot, userID, teamID string) error
+}
+
+type GenerateImageArgs struct {
+	Prompt string `jsonschema_description:"A detailed description of the image to generate."`
+	Size   string `jsonschema_description:"The size of the image as WIDTHxHEIGHT, for example 1024x1024, 1792x1024 for landscape or 1024x1792 for portrait. Leave empty for the default size."`
+}
+
+// toolGenerateImage returns the resolver of the GenerateImage tool, which uploads the image to the channel of the
+// conversation and leaves it to be attached to the response. Each image counts as a request of its own.
+func (p *MMToolProvider) toolGenerateImage(bot *bots.Bot, generator bots.ImageGenerator, cfg llm.ImageGenerationConfig) llm.ToolResolver {
+	return func(llmContext *llm.Context, argsGetter llm.ToolArgumentGetter) (string, error) {
+		var args GenerateImageArgs
+		err := argsGetter(&args)
+		if err != nil {
+			return "invalid parameters to function", fmt.Errorf("failed to get arguments for tool GenerateImage: %w", err)
+		}
+
+		args.Prompt = strings.TrimSpace(args.Prompt)
+		if args.Prompt == "" {
+			return "the image prompt is empty", errors.New("image prompt is empty")
+		}
+		if len(args.Prompt) > MaxImagePromptLength {
+			return "the image prompt is too long", errors.New("image prompt too long")
+		}
+
+		size := cfg.Size
+		if args.Size != "" {
+			if !slices.Contains(llm.ImageSizes, args.Size) {
+				return fmt.Sprintf("unsupported image size, use one of %s", strings.Join(llm.ImageSizes, ", ")), fmt.Errorf("unsupported image size %s", args.Size)
+			}
+			size = args.Size
+		}
+
+		if llmContext.Channel == nil {
+			return "images can only be generated in a channel", errors.New("no channel to upload the image to")
+		}
+
+		if llmContext.RequestingUser != nil {
+			if err := p.imageGenerators.CheckRateLimits(bot, llmContext.RequestingUser.Id, llmContext.Channel.TeamId); err != nil {
+				if errors.Is(err, bots.ErrRateLimited) {
+					return "the user has reached their request limit, so no image was generated", err
+				}
+				return "failed to generate the image", fmt.Errorf("failed to check rate limits: %w", err)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), imageGenerationTimeout)
+		defer cancel()
+		image, err := generator.GenerateImage(ctx, llm.ImageRequest{
+			Prompt:  args.Prompt,
+			Model:   cfg.Model,
+			Size:    size,
+			Context: llmContext,
+		})
+		if err != nil {
+			return "failed to generate the image", fmt.Errorf("failed to generate image: %w", err)
+		}
+
+		fileInfo, err := p.pluginAPI.UploadFile(image.Data, llmContext.Channel.Id, GeneratedImageFileName)
+		if err != nil {
+			return "failed to upload the image", fmt.Errorf("failed to upload generated image: %w", err)
+		}
+		llmContext.FileIDs = append(llmContext.FileIDs, fileInfo.Id)
+
+		result := "The image was generated and is attached to your response, don't link to it."
+		if image.RevisedPrompt != "" {
+			result += "\nThe image was generated from this revised prompt: " + image.RevisedPrompt
+		}
+		return result, nil
+	}
+}
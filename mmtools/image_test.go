@@ -0,0 +1,119 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package mmtools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/bots"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	mmapimocks "github.com/mattermost/mattermost-plugin-ai/mmapi/mocks"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeImageGenerator struct {
+	requests []llm.ImageRequest
+}
+
+func (f *fakeImageGenerator) GenerateImage(ctx context.Context, request llm.ImageRequest) (*llm.GeneratedImage, error) {
+	f.requests = append(f.requests, request)
+	return &llm.GeneratedImage{Data: []byte("png"), MimeType: "image/png", RevisedPrompt: "a red fox in the snow"}, nil
+}
+
+type fakeImageGenerators struct {
+	generator    bots.ImageGenerator
+	rateLimitErr error
+	checkedUsers *[]string
+}
+
+func (f fakeImageGenerators) GetImageGenerator(bot *bots.Bot) bots.ImageGenerator {
+	return f.generator
+}
+
+func (f fakeImageGenerators) CheckRateLimits(bot *bots.Bot, userID, teamID string) error {
+	if f.checkedUsers != nil {
+		*f.checkedUsers = append(*f.checkedUsers, userID)
+	}
+	return f.rateLimitErr
+}
+
+func argsGetterFor(args GenerateImageArgs) llm.ToolArgumentGetter {
+	return func(target any) error {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, target)
+	}
+}
+
+func TestGenerateImageTool(t *testing.T) {
+	bot := bots.NewBot(llm.BotConfig{ImageGeneration: llm.ImageGenerationConfig{Enabled: true, Model: "gpt-image-1", Size: "1024x1024"}}, nil)
+
+	t.Run("offered when the bot can generate images", func(t *testing.T) {
+		client := mmapimocks.NewMockClient(t)
+		client.On("GetPluginStatus", "github").Return(nil, nil)
+
+		provider := NewMMToolProvider(client, nil, nil, fakeImageGenerators{generator: &fakeImageGenerator{}})
+		assert.Contains(t, toolNames(provider.GetTools(true, bot)), "GenerateImage")
+		assert.NotContains(t, toolNames(provider.GetTools(false, bot)), "GenerateImage")
+
+		provider = NewMMToolProvider(client, nil, nil, fakeImageGenerators{})
+		assert.NotContains(t, toolNames(provider.GetTools(true, bot)), "GenerateImage")
+	})
+
+	t.Run("uploads the image for the response", func(t *testing.T) {
+		client := mmapimocks.NewMockClient(t)
+		client.On("UploadFile", []byte("png"), "channel1", GeneratedImageFileName).Return(&model.FileInfo{Id: "file1"}, nil)
+		generator := &fakeImageGenerator{}
+		var checkedUsers []string
+		provider := NewMMToolProvider(client, nil, nil, fakeImageGenerators{checkedUsers: &checkedUsers})
+		llmContext := &llm.Context{Channel: &model.Channel{Id: "channel1"}, RequestingUser: &model.User{Id: "user1"}}
+
+		result, err := provider.toolGenerateImage(bot, generator, bot.GetConfig().ImageGeneration)(llmContext, argsGetterFor(GenerateImageArgs{Prompt: "a fox", Size: "1792x1024"}))
+		require.NoError(t, err)
+		assert.Contains(t, result, "a red fox in the snow")
+		assert.Equal(t, []string{"file1"}, llmContext.FileIDs)
+		assert.Equal(t, []llm.ImageRequest{{Prompt: "a fox", Model: "gpt-image-1", Size: "1792x1024", Context: llmContext}}, generator.requests)
+		assert.Equal(t, []string{"user1"}, checkedUsers, "the image counts as a request")
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		generator := &fakeImageGenerator{}
+		provider := NewMMToolProvider(mmapimocks.NewMockClient(t), nil, nil, fakeImageGenerators{rateLimitErr: &bots.RateLimitError{Scope: bots.RateLimitScopeUserRequests}})
+		llmContext := &llm.Context{Channel: &model.Channel{Id: "channel1"}, RequestingUser: &model.User{Id: "user1"}}
+
+		result, err := provider.toolGenerateImage(bot, generator, bot.GetConfig().ImageGeneration)(llmContext, argsGetterFor(GenerateImageArgs{Prompt: "a fox"}))
+		assert.ErrorIs(t, err, bots.ErrRateLimited)
+		assert.Contains(t, result, "request limit")
+		assert.Empty(t, generator.requests)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		generator := &fakeImageGenerator{}
+		provider := NewMMToolProvider(mmapimocks.NewMockClient(t), nil, nil, fakeImageGenerators{})
+		resolver := provider.toolGenerateImage(bot, generator, bot.GetConfig().ImageGeneration)
+		llmContext := &llm.Context{Channel: &model.Channel{Id: "channel1"}}
+
+		_, err := resolver(llmContext, argsGetterFor(GenerateImageArgs{Prompt: " "}))
+		assert.Error(t, err)
+		_, err = resolver(llmContext, argsGetterFor(GenerateImageArgs{Prompt: "a fox", Size: "100x100"}))
+		assert.Error(t, err)
+		_, err = resolver(&llm.Context{}, argsGetterFor(GenerateImageArgs{Prompt: "a fox"}))
+		assert.Error(t, err)
+		assert.Empty(t, generator.requests)
+	})
+}
+
+func toolNames(tools []llm.Tool) []string {
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
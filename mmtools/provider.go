@@ -20,17 +20,19 @@ type ToolProvider interface {
 
 // MMToolProvider implements ToolProvider with all built-in Mattermost tools
 type MMToolProvider struct {
-	pluginAPI  mmapi.Client
-	search     *search.Search
-	httpClient *http.Client
+	pluginAPI       mmapi.Client
+	search          *search.Search
+	httpClient      *http.Client
+	imageGenerators ImageGenerators
 }
 
 // NewMMToolProvider creates a new tool provider
-func NewMMToolProvider(pluginAPI mmapi.Client, search *search.Search, httpClient *http.Client) *MMToolProvider {
+func NewMMToolProvider(pluginAPI mmapi.Client, search *search.Search, httpClient *http.Client, imageGenerators ImageGenerators) *MMToolProvider {
 	return &MMToolProvider{
-		pluginAPI:  pluginAPI,
-		search:     search,
-		httpClient: httpClient,
+		pluginAPI:       pluginAPI,
+		search:          search,
+		httpClient:      httpClient,
+		imageGenerators: imageGenerators,
 	}
 }
 
@@ -45,7 +47,7 @@ func (p *MMToolProvider) GetTools(isDM bool, bot *bots.Bot) []llm.Tool {
 				Name:        "SearchServer",
 				Description: "Search the Mattermost chat server the user is on for messages using semantic search. Use this tool whenever the user asks a question and you don't have the context to answer or you think your response would be more accurate with knowledge from the Mattermost server",
 				Schema:      llm.NewJSONSchemaFromStruct[SearchServerArgs](),
-				Resolver:    p.toolSearchServer,
+				Resolver:    p.toolSearchServer(bot),
 			})
 		}
 
@@ -58,6 +60,18 @@ func (p *MMToolProvider) GetTools(isDM bool, bot *bots.Bot) []llm.Tool {
 				Resolver:    p.toolResolveLookupMattermostUser,
 			})
 
+			// Add image generation tool if the bot's service can generate images
+			if p.imageGenerators != nil {
+				if generator := p.imageGenerators.GetImageGenerator(bot); generator != nil {
+					builtInTools = append(builtInTools, llm.Tool{
+						Name:        "GenerateImage",
+						Description: "Generate an image from a text description. The image is attached to your response.",
+						Schema:      llm.NewJSONSchemaFromStruct[GenerateImageArgs](),
+						Resolver:    p.toolGenerateImage(bot, generator, bot.GetConfig().ImageGeneration),
+					})
+				}
+			}
+
 			// Add GitHub tool if plugin is available
 			status, err := p.pluginAPI.GetPluginStatus("github")
 			if err == nil && status != nil && status.State == model.PluginStateRunning {
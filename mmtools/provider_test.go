@@ -54,7 +54,7 @@ func TestMMToolProvider_GetTools(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			// Create tool provider
-			provider := NewMMToolProvider(nil, test.searchService, &http.Client{})
+			provider := NewMMToolProvider(nil, test.searchService, &http.Client{}, nil)
 
 			// Create a mock bot
 			bot := &bots.Bot{}
@@ -89,7 +89,7 @@ func TestMMToolProvider_toolSearchServer(t *testing.T) {
 			name: "search succeeds - service enabled",
 			searchService: func() *search.Search {
 				mockEmbedding := mocks.NewMockEmbeddingSearch(t)
-				mockEmbedding.On("Search", mock.Anything, "test search term", mock.Anything).Return([]embeddings.SearchResult{}, nil)
+				mockEmbedding.On("Search", mock.Anything, "test search term", embeddings.SearchOptions{Limit: 10, UserID: "user123", BotID: "bot1"}).Return([]embeddings.SearchResult{}, nil)
 				return search.New(mockEmbedding, nil, nil, nil, nil)
 			}(),
 			searchTerm:  "test search term",
@@ -122,10 +122,12 @@ func TestMMToolProvider_toolSearchServer(t *testing.T) {
 		},
 	}
 
+	bot := bots.NewBot(llm.BotConfig{}, &model.Bot{UserId: "bot1"})
+
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			// Create tool provider
-			provider := NewMMToolProvider(nil, test.searchService, &http.Client{})
+			provider := NewMMToolProvider(nil, test.searchService, &http.Client{}, nil)
 
 			// Create mock LLM context
 			llmContext := &llm.Context{
@@ -142,7 +144,7 @@ func TestMMToolProvider_toolSearchServer(t *testing.T) {
 			}
 
 			// Execute the tool
-			result, err := provider.toolSearchServer(llmContext, argsGetter)
+			result, err := provider.toolSearchServer(bot)(llmContext, argsGetter)
 
 			// Verify results
 			if test.expectError {
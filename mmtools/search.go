@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/mattermost/mattermost-plugin-ai/bots"
 	"github.com/mattermost/mattermost-plugin-ai/embeddings"
 	"github.com/mattermost/mattermost-plugin-ai/llm"
 	"github.com/mattermost/mattermost/server/public/model"
@@ -20,10 +21,17 @@ const (
 )
 
 type SearchServerArgs struct {
-	Term string `jsonschema_description:"The terms to search for in the server. Must be more than 3 and less than 300 characters."`
+	Term string `jsonschema_description:"The terms to search for in the server. Must be more than 3 and less than 300 characters. Include identifiers such as ticket IDs, error codes and hostnames exactly as written."`
 }
 
-func (p *MMToolProvider) toolSearchServer(llmContext *llm.Context, argsGetter llm.ToolArgumentGetter) (string, error) {
+// toolSearchServer returns the resolver of the search tool, which searches for the bot using it.
+func (p *MMToolProvider) toolSearchServer(bot *bots.Bot) llm.ToolResolver {
+	return func(llmContext *llm.Context, argsGetter llm.ToolArgumentGetter) (string, error) {
+		return p.searchServer(bot, llmContext, argsGetter)
+	}
+}
+
+func (p *MMToolProvider) searchServer(bot *bots.Bot, llmContext *llm.Context, argsGetter llm.ToolArgumentGetter) (string, error) {
 	var args SearchServerArgs
 	err := argsGetter(&args)
 	if err != nil {
@@ -48,10 +56,12 @@ func (p *MMToolProvider) toolSearchServer(llmContext *llm.Context, argsGetter ll
 	searchResults, err := p.search.Search(ctx, args.Term, embeddings.SearchOptions{
 		Limit:  10,
 		UserID: llmContext.RequestingUser.Id,
+		BotID:  bot.GetMMBot().UserId,
 	})
 	if err != nil {
 		return "there was an error performing the search", fmt.Errorf("search failed: %w", err)
 	}
+	searchResults = p.search.ExpandResults(ctx, searchResults, p.search.ExpansionConfig().Tool)
 
 	// Format the results
 	formatted := p.formatSearchResults(searchResults, llmContext.RequestingUser.Id)
@@ -0,0 +1,183 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	openaiClient "github.com/sashabaranov/go-openai"
+)
+
+// chatCompletionRequest is the body of a chat completion request. go-openai's request type drops sampling
+// parameters set to zero and has no file inputs, so those fields are replaced and the request is sent without go-openai.
+type chatCompletionRequest struct {
+	openaiClient.ChatCompletionRequest
+	Messages    []chatMessage `json:"messages"`
+	Temperature *float32      `json:"temperature,omitempty"`
+	TopP        *float32      `json:"top_p,omitempty"`
+}
+
+// chatMessage is a message of a chat completion request. Content is a string or a list of chatMessagePart.
+type chatMessage struct {
+	Role       string                  `json:"role"`
+	Content    any                     `json:"content,omitempty"`
+	ToolCalls  []openaiClient.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string                  `json:"tool_call_id,omitempty"`
+}
+
+// chatMessagePartTypeFile parts hold a file input, which OpenAI reads PDFs from.
+const chatMessagePartTypeFile openaiClient.ChatMessagePartType = "file"
+
+type chatMessagePart struct {
+	Type     openaiClient.ChatMessagePartType  `json:"type"`
+	Text     string                            `json:"text,omitempty"`
+	ImageURL *openaiClient.ChatMessageImageURL `json:"image_url,omitempty"`
+	File     *fileInput                        `json:"file,omitempty"`
+}
+
+type fileInput struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data"`
+}
+
+// chatCompletionChunk is a streamed chunk, or the error the service reports in place of one.
+type chatCompletionChunk struct {
+	openaiClient.ChatCompletionStreamResponse
+	Error *openaiClient.APIError `json:"error,omitempty"`
+}
+
+// chatCompletionStream reads the server-sent events of a streamed chat completion.
+type chatCompletionStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+// Recv returns the next chunk of the stream, io.EOF once the service has sent all of them.
+func (s *chatCompletionStream) Recv() (openaiClient.ChatCompletionStreamResponse, error) {
+	data, err := nextEventData(s.reader)
+	if err != nil {
+		return openaiClient.ChatCompletionStreamResponse{}, err
+	}
+	if string(data) == "[DONE]" {
+		return openaiClient.ChatCompletionStreamResponse{}, io.EOF
+	}
+
+	var chunk chatCompletionChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return openaiClient.ChatCompletionStreamResponse{}, fmt.Errorf("failed to decode stream chunk: %w", err)
+	}
+	if chunk.Error != nil {
+		return openaiClient.ChatCompletionStreamResponse{}, chunk.Error
+	}
+	return chunk.ChatCompletionStreamResponse, nil
+}
+
+func (s *chatCompletionStream) Close() error {
+	return s.body.Close()
+}
+
+// nextEventData returns the data of the next server-sent event.
+func nextEventData(reader *bufio.Reader) ([]byte, error) {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && len(line) == 0 {
+			return nil, err
+		}
+
+		data, found := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		if !found {
+			// Blank lines separate events, other fields and comments carry nothing we use.
+			continue
+		}
+		return bytes.TrimSpace(data), nil
+	}
+}
+
+// createChatCompletionStream sends a streamed chat completion request, failing with an llm.ProviderError if the service rejects it.
+func (s *OpenAI) createChatCompletionStream(ctx context.Context, request chatCompletionRequest) (*chatCompletionStream, error) {
+	request.Stream = true
+	body, err := s.postStream(ctx, s.chatCompletionsURL(request.Model), request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chatCompletionStream{
+		body:   body,
+		reader: bufio.NewReader(body),
+	}, nil
+}
+
+// postStream sends a request for a stream of server-sent events and returns the body they are read from.
+func (s *OpenAI) postStream(ctx context.Context, endpoint string, request any) (io.ReadCloser, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	switch s.clientConfig.APIType {
+	case openaiClient.APITypeAzure:
+		req.Header.Set(openaiClient.AzureAPIKeyHeader, s.config.APIKey)
+	default:
+		if s.config.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+		}
+	}
+	if s.clientConfig.OrgID != "" {
+		req.Header.Set("OpenAI-Organization", s.clientConfig.OrgID)
+	}
+
+	resp, err := s.clientConfig.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, providerError(responseError(resp), llm.RetryAfterFromHeader(resp.Header))
+	}
+
+	return resp.Body, nil
+}
+
+// chatCompletionsURL is where chat completions are requested, Azure serves each model from its own deployment.
+func (s *OpenAI) chatCompletionsURL(model string) string {
+	baseURL := strings.TrimSuffix(s.clientConfig.BaseURL, "/")
+	if s.clientConfig.APIType == openaiClient.APITypeAzure || s.clientConfig.APIType == openaiClient.APITypeAzureAD {
+		deployment := s.clientConfig.GetAzureDeploymentByModel(model)
+		return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s", baseURL, url.PathEscape(deployment), url.QueryEscape(s.clientConfig.APIVersion))
+	}
+	return baseURL + "/chat/completions"
+}
+
+// responseError reads the error of a failed response the way go-openai reports it, so providerError recognizes it.
+func responseError(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &openaiClient.RequestError{HTTPStatus: resp.Status, HTTPStatusCode: resp.StatusCode, Err: err}
+	}
+
+	var errResp openaiClient.ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error == nil {
+		return &openaiClient.RequestError{HTTPStatus: resp.Status, HTTPStatusCode: resp.StatusCode, Err: errors.New(string(body)), Body: body}
+	}
+	errResp.Error.HTTPStatus = resp.Status
+	errResp.Error.HTTPStatusCode = resp.StatusCode
+	return errResp.Error
+}
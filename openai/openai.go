@@ -4,14 +4,13 @@
 package openai
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"image"
-	"image/png"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -34,54 +33,83 @@ type Config struct {
 	EmbeddingModel      string            `json:"embeddingModel"`
 	EmbeddingDimentions int               `json:"embeddingDimensions"`
 	CustomHeaders       map[string]string `json:"customHeaders"`
+	// StreamUsage asks compatible servers to report token usage at the end of streams. OpenAI and Azure always do.
+	StreamUsage bool `json:"streamUsage"`
 }
 
 type OpenAI struct {
 	client *openaiClient.Client
-	config Config
+	// clientConfig is also used for chat completions, which are requested without the client.
+	clientConfig openaiClient.ClientConfig
+	config       Config
+	// httpClient and modelsURL are used to list models, modelsURL is empty for Azure which lists deployments instead.
+	httpClient *http.Client
+	modelsURL  string
+	// documentInputs is set for the OpenAI API, which reads PDFs given as file inputs.
+	documentInputs bool
+	// streamUsage requests usage with stream_options, which some compatible servers reject.
+	streamUsage bool
+	// responsesAPI is set for the OpenAI API, where reasoning models are used through the Responses API.
+	responsesAPI bool
 }
 
 const (
 	MaxFunctionCalls   = 10
 	OpenAIMaxImageSize = 20 * 1024 * 1024 // 20 MB
+	// DefaultInputTokenLimit is used for models whose context window is neither configured nor known.
+	DefaultInputTokenLimit = 128000
+	DefaultImageModel      = openaiClient.CreateImageModelDallE3
+	DefaultSpeechModel     = openaiClient.TTSModel1
+	DefaultSpeechVoice     = openaiClient.VoiceAlloy
 )
 
 var ErrStreamingTimeout = errors.New("timeout streaming")
 
 func NewAzure(config Config, httpClient *http.Client) *OpenAI {
-	return newOpenAI(config, httpClient,
+	provider := newOpenAI(config, httpClient,
 		func(apiKey string) openaiClient.ClientConfig {
 			clientConfig := openaiClient.DefaultAzureConfig(apiKey, strings.TrimSuffix(config.APIURL, "/"))
-			clientConfig.APIVersion = "2024-06-01"
+			clientConfig.APIVersion = "2024-10-21" // First GA version supporting stream_options
 			return clientConfig
 		},
 	)
+	provider.streamUsage = true
+	return provider
 }
 
 func NewCompatible(config Config, httpClient *http.Client) *OpenAI {
-	return newOpenAI(config, httpClient,
+	provider := newOpenAI(config, httpClient,
 		func(apiKey string) openaiClient.ClientConfig {
 			clientConfig := openaiClient.DefaultConfig(apiKey)
 			clientConfig.BaseURL = strings.TrimSuffix(config.APIURL, "/")
 			return clientConfig
 		},
 	)
+	provider.streamUsage = config.StreamUsage
+	return provider
 }
 
 func New(config Config, httpClient *http.Client) *OpenAI {
-	return newOpenAI(config, httpClient,
+	provider := newOpenAI(config, httpClient,
 		func(apiKey string) openaiClient.ClientConfig {
 			clientConfig := openaiClient.DefaultConfig(apiKey)
 			clientConfig.OrgID = config.OrgID
 			return clientConfig
 		},
 	)
+	provider.documentInputs = true
+	provider.streamUsage = true
+	provider.responsesAPI = true
+	return provider
 }
 
+// DefaultEmbeddingModel is the embedding model used when none is configured
+const DefaultEmbeddingModel = string(openaiClient.LargeEmbedding3)
+
 // NewEmbeddings creates a new OpenAI client configured only for embeddings functionality
 func NewEmbeddings(config Config, httpClient *http.Client) *OpenAI {
 	if config.EmbeddingModel == "" {
-		config.EmbeddingModel = string(openaiClient.LargeEmbedding3)
+		config.EmbeddingModel = DefaultEmbeddingModel
 		config.EmbeddingDimentions = 3072
 	}
 	return newOpenAI(config, httpClient,
@@ -95,7 +123,7 @@ func NewEmbeddings(config Config, httpClient *http.Client) *OpenAI {
 // NewCompatibleEmbeddings creates a new OpenAI client configured only for embeddings functionality
 func NewCompatibleEmbeddings(config Config, httpClient *http.Client) *OpenAI {
 	if config.EmbeddingModel == "" {
-		config.EmbeddingModel = string(openaiClient.LargeEmbedding3)
+		config.EmbeddingModel = DefaultEmbeddingModel
 		config.EmbeddingDimentions = 3072
 	}
 
@@ -108,46 +136,17 @@ func NewCompatibleEmbeddings(config Config, httpClient *http.Client) *OpenAI {
 	)
 }
 
-// customHeadersTransport wraps an http.RoundTripper to add custom headers to every request
-type customHeadersTransport struct {
-	base    http.RoundTripper
-	headers map[string]string
-}
-
-func (t *customHeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Clone the request to avoid modifying the original
-	newReq := req.Clone(req.Context())
-
-	// Add custom headers
-	for key, value := range t.headers {
-		newReq.Header.Set(key, value)
-	}
-
-	return t.base.RoundTrip(newReq)
-}
-
-// wrapHTTPClientWithCustomHeaders wraps an http.Client to add custom headers to all requests
-func wrapHTTPClientWithCustomHeaders(baseClient *http.Client, customHeaders map[string]string) *http.Client {
-	if len(customHeaders) == 0 {
-		return baseClient
+// providerError attaches the status code and Retry-After of a failed request so callers can decide whether to retry.
+func providerError(err error, retryAfter time.Duration) error {
+	var apiErr *openaiClient.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode > 0 {
+		return &llm.ProviderError{StatusCode: apiErr.HTTPStatusCode, RetryAfter: retryAfter, Err: err}
 	}
-
-	transport := baseClient.Transport
-	if transport == nil {
-		transport = http.DefaultTransport
+	var requestErr *openaiClient.RequestError
+	if errors.As(err, &requestErr) {
+		return &llm.ProviderError{StatusCode: requestErr.HTTPStatusCode, RetryAfter: retryAfter, Err: err}
 	}
-
-	wrappedClient := &http.Client{
-		Transport: &customHeadersTransport{
-			base:    transport,
-			headers: customHeaders,
-		},
-		CheckRedirect: baseClient.CheckRedirect,
-		Jar:           baseClient.Jar,
-		Timeout:       baseClient.Timeout,
-	}
-
-	return wrappedClient
+	return err
 }
 
 func newOpenAI(
@@ -158,22 +157,51 @@ func newOpenAI(
 	clientConfig := baseConfigFunc(config.APIKey)
 
 	// Wrap the HTTP client with custom headers if any are provided
-	clientConfig.HTTPClient = wrapHTTPClientWithCustomHeaders(httpClient, config.CustomHeaders)
-
-	return &OpenAI{
-		client: openaiClient.NewClientWithConfig(clientConfig),
-		config: config,
+	wrappedHTTPClient := llm.WrapHTTPClientWithCustomHeaders(httpClient, config.CustomHeaders)
+	clientConfig.HTTPClient = wrappedHTTPClient
+
+	provider := &OpenAI{
+		client:       openaiClient.NewClientWithConfig(clientConfig),
+		clientConfig: clientConfig,
+		config:       config,
+		httpClient:   wrappedHTTPClient,
+	}
+	if clientConfig.APIType != openaiClient.APITypeAzure && clientConfig.APIType != openaiClient.APITypeAzureAD {
+		provider.modelsURL = strings.TrimSuffix(clientConfig.BaseURL, "/") + "/models"
 	}
+	return provider
 }
 
-func modifyCompletionRequestWithRequest(openAIRequest openaiClient.ChatCompletionRequest, interalRequest llm.CompletionRequest) openaiClient.ChatCompletionRequest {
-	openAIRequest.Messages = postsToChatCompletionMessages(interalRequest.Posts)
+func modifyCompletionRequestWithRequest(openAIRequest chatCompletionRequest, interalRequest llm.CompletionRequest, documentInputs bool) chatCompletionRequest {
+	openAIRequest.Messages = postsToChatCompletionMessages(interalRequest.Posts, documentInputs)
 	if interalRequest.Context.Tools != nil {
 		openAIRequest.Tools = toolsToOpenAITools(interalRequest.Context.Tools.GetTools())
 	}
 	return openAIRequest
 }
 
+func documentPart(file llm.File, documentInputs bool) chatMessagePart {
+	textPart := chatMessagePart{
+		Type: openaiClient.ChatMessagePartTypeText,
+		Text: file.DocumentText(),
+	}
+	if !documentInputs || file.MimeType != "application/pdf" || !file.SendNatively() {
+		return textPart
+	}
+
+	data, err := io.ReadAll(file.Reader)
+	if err != nil {
+		return textPart
+	}
+	return chatMessagePart{
+		Type: chatMessagePartTypeFile,
+		File: &fileInput{
+			Filename: file.Name,
+			FileData: "data:" + file.MimeType + ";base64," + base64.StdEncoding.EncodeToString(data),
+		},
+	}
+}
+
 func toolsToOpenAITools(tools []llm.Tool) []openaiClient.Tool {
 	result := make([]openaiClient.Tool, 0, len(tools))
 	for _, tool := range tools {
@@ -190,8 +218,10 @@ func toolsToOpenAITools(tools []llm.Tool) []openaiClient.Tool {
 	return result
 }
 
-func postsToChatCompletionMessages(posts []llm.Post) []openaiClient.ChatCompletionMessage {
-	result := make([]openaiClient.ChatCompletionMessage, 0, len(posts))
+// postsToChatCompletionMessages converts posts to messages, with PDFs as file inputs when documentInputs is set
+// and as their extracted text otherwise.
+func postsToChatCompletionMessages(posts []llm.Post, documentInputs bool) []chatMessage {
+	result := make([]chatMessage, 0, len(posts))
 
 	for _, post := range posts {
 		role := openaiClient.ChatMessageRoleUser
@@ -201,31 +231,35 @@ func postsToChatCompletionMessages(posts []llm.Post) []openaiClient.ChatCompleti
 		case llm.PostRoleSystem:
 			role = openaiClient.ChatMessageRoleSystem
 		}
-		completionMessage := openaiClient.ChatCompletionMessage{
+		completionMessage := chatMessage{
 			Role: role,
 		}
 
 		if len(post.Files) > 0 {
-			completionMessage.MultiContent = make([]openaiClient.ChatMessagePart, 0, len(post.Files)+1)
+			parts := make([]chatMessagePart, 0, len(post.Files)+1)
 			if post.Message != "" {
-				completionMessage.MultiContent = append(completionMessage.MultiContent, openaiClient.ChatMessagePart{
+				parts = append(parts, chatMessagePart{
 					Type: openaiClient.ChatMessagePartTypeText,
 					Text: post.Message,
 				})
 			}
 			for _, file := range post.Files {
+				if file.Kind == llm.FileKindDocument {
+					parts = append(parts, documentPart(file, documentInputs))
+					continue
+				}
 				if file.MimeType != "image/png" &&
 					file.MimeType != "image/jpeg" &&
 					file.MimeType != "image/gif" &&
 					file.MimeType != "image/webp" {
-					completionMessage.MultiContent = append(completionMessage.MultiContent, openaiClient.ChatMessagePart{
+					parts = append(parts, chatMessagePart{
 						Type: openaiClient.ChatMessagePartTypeText,
 						Text: "User submitted image was not a supported format. Tell the user this.",
 					})
 					continue
 				}
 				if file.Size > OpenAIMaxImageSize {
-					completionMessage.MultiContent = append(completionMessage.MultiContent, openaiClient.ChatMessagePart{
+					parts = append(parts, chatMessagePart{
 						Type: openaiClient.ChatMessagePartTypeText,
 						Text: "User submitted a image larger than 20MB. Tell the user this.",
 					})
@@ -237,7 +271,7 @@ func postsToChatCompletionMessages(posts []llm.Post) []openaiClient.ChatCompleti
 				}
 				imageEncoded := base64.StdEncoding.EncodeToString(fileBytes)
 				encodedString := fmt.Sprintf("data:"+file.MimeType+";base64,%s", imageEncoded)
-				completionMessage.MultiContent = append(completionMessage.MultiContent, openaiClient.ChatMessagePart{
+				parts = append(parts, chatMessagePart{
 					Type: openaiClient.ChatMessagePartTypeImageURL,
 					ImageURL: &openaiClient.ChatMessageImageURL{
 						URL:    encodedString,
@@ -245,7 +279,8 @@ func postsToChatCompletionMessages(posts []llm.Post) []openaiClient.ChatCompleti
 					},
 				})
 			}
-		} else {
+			completionMessage.Content = parts
+		} else if post.Message != "" {
 			completionMessage.Content = post.Message
 		}
 
@@ -269,7 +304,7 @@ func postsToChatCompletionMessages(posts []llm.Post) []openaiClient.ChatCompleti
 		// Add the results of the tool calls in additional messages
 		if len(post.ToolUse) > 0 {
 			for _, tool := range post.ToolUse {
-				result = append(result, openaiClient.ChatCompletionMessage{
+				result = append(result, chatMessage{
 					Role:       openaiClient.ChatMessageRoleTool,
 					ToolCallID: tool.ID,
 					Content:    tool.Result,
@@ -287,34 +322,17 @@ type ToolBufferElement struct {
 	args strings.Builder
 }
 
-func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionRequest, llmContext *llm.Context, output chan<- llm.TextStreamEvent) {
+func (s *OpenAI) streamResultToChannels(ctx context.Context, request chatCompletionRequest, llmContext *llm.Context, output chan<- llm.TextStreamEvent) {
 	request.Stream = true
+	if s.streamUsage {
+		request.StreamOptions = &openaiClient.StreamOptions{IncludeUsage: true}
+	}
 
-	ctx, cancel := context.WithCancelCause(context.Background())
+	ctx, cancel := context.WithCancelCause(ctx)
 	defer cancel(nil)
+	watchdog := s.startWatchdog(ctx, cancel)
 
-	// watchdog to cancel if the streaming stalls
-	watchdog := make(chan struct{})
-	go func() {
-		timer := time.NewTimer(s.config.StreamingTimeout)
-		defer timer.Stop()
-		for {
-			select {
-			case <-timer.C:
-				cancel(ErrStreamingTimeout)
-				return
-			case <-ctx.Done():
-				return
-			case <-watchdog:
-				if !timer.Stop() {
-					<-timer.C
-				}
-				timer.Reset(s.config.StreamingTimeout)
-			}
-		}
-	}()
-
-	stream, err := s.client.CreateChatCompletionStream(ctx, request)
+	stream, err := s.createChatCompletionStream(ctx, request)
 	if err != nil {
 		if ctxErr := context.Cause(ctx); ctxErr != nil {
 			output <- llm.TextStreamEvent{
@@ -334,13 +352,23 @@ func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionReque
 
 	// Buffering in the case of tool use
 	var toolsBuffer map[int]*ToolBufferElement
+
+	// The usage chunk arrives after the finish reason, so the final event is held until the stream is drained.
+	var usage *openaiClient.Usage
+	finalEvent := llm.TextStreamEvent{
+		Type:  llm.EventTypeEnd,
+		Value: nil,
+	}
 	for {
 		response, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
-			output <- llm.TextStreamEvent{
-				Type:  llm.EventTypeEnd,
-				Value: nil,
+			if usage != nil {
+				output <- llm.TextStreamEvent{
+					Type:  llm.EventTypeUsage,
+					Value: usageFromOpenAI(usage),
+				}
 			}
+			output <- finalEvent
 			return
 		}
 		if err != nil {
@@ -361,6 +389,10 @@ func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionReque
 		// Ping the watchdog when we receive a response
 		watchdog <- struct{}{}
 
+		if response.Usage != nil {
+			usage = response.Usage
+		}
+
 		if len(response.Choices) == 0 {
 			continue
 		}
@@ -392,11 +424,7 @@ func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionReque
 		case "":
 			// Not done yet, keep going
 		case openaiClient.FinishReasonStop:
-			output <- llm.TextStreamEvent{
-				Type:  llm.EventTypeEnd,
-				Value: nil,
-			}
-			return
+			continue
 		case openaiClient.FinishReasonToolCalls:
 			// Verify OpenAI functions are not recursing too deep.
 			numFunctionCalls := 0
@@ -444,16 +472,23 @@ func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionReque
 				})
 			}
 
-			output <- llm.TextStreamEvent{
+			finalEvent = llm.TextStreamEvent{
 				Type:  llm.EventTypeToolCalls,
 				Value: pendingToolCalls,
 			}
-			return
+			continue
 		default:
 			fmt.Printf("Unknown finish reason: %s", response.Choices[0].FinishReason)
 			return
 		}
 
+		if response.Choices[0].Delta.ReasoningContent != "" {
+			output <- llm.TextStreamEvent{
+				Type:  llm.EventTypeReasoning,
+				Value: response.Choices[0].Delta.ReasoningContent,
+			}
+		}
+
 		if response.Choices[0].Delta.Content != "" {
 			output <- llm.TextStreamEvent{
 				Type:  llm.EventTypeText,
@@ -463,14 +498,52 @@ func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionReque
 	}
 }
 
-func (s *OpenAI) streamResult(request openaiClient.ChatCompletionRequest, llmContext *llm.Context) (*llm.TextStreamResult, error) {
+// startWatchdog cancels ctx with ErrStreamingTimeout if the stream stalls, which is when nothing is sent on the
+// returned channel for the streaming timeout.
+func (s *OpenAI) startWatchdog(ctx context.Context, cancel context.CancelCauseFunc) chan<- struct{} {
+	watchdog := make(chan struct{})
+	go func() {
+		timer := time.NewTimer(s.config.StreamingTimeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				cancel(ErrStreamingTimeout)
+				return
+			case <-ctx.Done():
+				return
+			case <-watchdog:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(s.config.StreamingTimeout)
+			}
+		}
+	}()
+	return watchdog
+}
+
+func usageFromOpenAI(usage *openaiClient.Usage) llm.TokenUsage {
+	result := llm.TokenUsage{
+		InputTokens:  int64(usage.PromptTokens),
+		OutputTokens: int64(usage.CompletionTokens),
+	}
+	if usage.PromptTokensDetails != nil {
+		result.CachedTokens = int64(usage.PromptTokensDetails.CachedTokens)
+	}
+	return result
+}
+
+func (s *OpenAI) streamResult(ctx context.Context, request chatCompletionRequest, llmContext *llm.Context) (*llm.TextStreamResult, error) {
 	eventStream := make(chan llm.TextStreamEvent)
+	ctx, cancel := context.WithCancel(ctx)
 	go func() {
 		defer close(eventStream)
-		s.streamResultToChannels(request, llmContext, eventStream)
+		defer cancel()
+		s.streamResultToChannels(ctx, request, llmContext, eventStream)
 	}()
 
-	return &llm.TextStreamResult{Stream: eventStream}, nil
+	return &llm.TextStreamResult{Stream: eventStream, Cancel: cancel}, nil
 }
 
 func (s *OpenAI) GetDefaultConfig() llm.LanguageModelConfig {
@@ -489,11 +562,24 @@ func (s *OpenAI) createConfig(opts []llm.LanguageModelOption) llm.LanguageModelC
 	return cfg
 }
 
-func (s *OpenAI) completionRequestFromConfig(cfg llm.LanguageModelConfig) openaiClient.ChatCompletionRequest {
-	request := openaiClient.ChatCompletionRequest{
-		Model: cfg.Model,
+func (s *OpenAI) completionRequestFromConfig(cfg llm.LanguageModelConfig) chatCompletionRequest {
+	request := chatCompletionRequest{}
+	request.Model = cfg.Model
+	if cfg.ReasoningEffort != "" || cfg.ReasoningModel {
+		// Reasoning models reject max_tokens, their limit also covers the reasoning tokens.
+		request.ReasoningEffort = cfg.ReasoningEffort
+		request.MaxCompletionTokens = cfg.MaxGeneratedTokens
+	} else {
+		request.MaxTokens = cfg.MaxGeneratedTokens
+		// Reasoning models reject sampling parameters, they are only sent to other models.
+		request.Temperature = cfg.Temperature
+		request.TopP = cfg.TopP
+	}
+	request.Stop = cfg.StopSequences
+	if cfg.Seed != nil {
+		seed := int(*cfg.Seed)
+		request.Seed = &seed
 	}
-	request.MaxTokens = cfg.MaxGeneratedTokens
 
 	if cfg.JSONOutputFormat != nil {
 		request.ResponseFormat = &openaiClient.ChatCompletionResponseFormat{
@@ -509,21 +595,34 @@ func (s *OpenAI) completionRequestFromConfig(cfg llm.LanguageModelConfig) openai
 	return request
 }
 
-func (s *OpenAI) ChatCompletion(request llm.CompletionRequest, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
-	openAIRequest := s.completionRequestFromConfig(s.createConfig(opts))
-	openAIRequest = modifyCompletionRequestWithRequest(openAIRequest, request)
+func (s *OpenAI) ChatCompletion(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	cfg := s.createConfig(opts)
+	if s.useResponses(cfg) {
+		responsesRequest := s.responsesRequestFromConfig(cfg)
+		responsesRequest.Input = postsToResponsesInput(request.Posts, s.documentInputs)
+		if request.Context.Tools != nil {
+			responsesRequest.Tools = toolsToResponsesTools(request.Context.Tools.GetTools())
+		}
+		if s.config.SendUserID && request.Context.RequestingUser != nil {
+			responsesRequest.User = request.Context.RequestingUser.Id
+		}
+		return s.streamResponses(ctx, responsesRequest), nil
+	}
+
+	openAIRequest := s.completionRequestFromConfig(cfg)
+	openAIRequest = modifyCompletionRequestWithRequest(openAIRequest, request, s.documentInputs)
 	openAIRequest.Stream = true
 	if s.config.SendUserID {
 		if request.Context.RequestingUser != nil {
 			openAIRequest.User = request.Context.RequestingUser.Id
 		}
 	}
-	return s.streamResult(openAIRequest, request.Context)
+	return s.streamResult(ctx, openAIRequest, request.Context)
 }
 
-func (s *OpenAI) ChatCompletionNoStream(request llm.CompletionRequest, opts ...llm.LanguageModelOption) (string, error) {
+func (s *OpenAI) ChatCompletionNoStream(ctx context.Context, request llm.CompletionRequest, opts ...llm.LanguageModelOption) (string, error) {
 	// This could perform better if we didn't use the streaming API here, but the complexity is not worth it.
-	result, err := s.ChatCompletion(request, opts...)
+	result, err := s.ChatCompletion(ctx, request, opts...)
 	if err != nil {
 		return "", err
 	}
@@ -549,66 +648,165 @@ func (s *OpenAI) Transcribe(file io.Reader) (*subtitles.Subtitles, error) {
 	return timedTranscript, nil
 }
 
-func (s *OpenAI) GenerateImage(prompt string) (image.Image, error) {
+// GenerateImage generates a PNG image, with DALL-E 3 in a 1024x1024 size unless the request asks otherwise.
+func (s *OpenAI) GenerateImage(ctx context.Context, request llm.ImageRequest) (*llm.GeneratedImage, error) {
 	req := openaiClient.ImageRequest{
-		Prompt:         prompt,
-		Size:           openaiClient.CreateImageSize256x256,
-		ResponseFormat: openaiClient.CreateImageResponseFormatB64JSON,
-		N:              1,
+		Prompt: request.Prompt,
+		Model:  request.Model,
+		Size:   request.Size,
+		N:      1,
+	}
+	if req.Model == "" {
+		req.Model = DefaultImageModel
+	}
+	if req.Size == "" {
+		req.Size = openaiClient.CreateImageSize1024x1024
+	}
+	// GPT image models always return base64 data and reject the response format.
+	if !strings.HasPrefix(req.Model, "gpt-image") {
+		req.ResponseFormat = openaiClient.CreateImageResponseFormatB64JSON
+	}
+
+	resp, err := s.client.CreateImage(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate image: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, errors.New("no image was generated")
 	}
 
-	respBase64, err := s.client.CreateImage(context.Background(), req)
+	imgBytes, err := base64.StdEncoding.DecodeString(resp.Data[0].B64JSON)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	image := &llm.GeneratedImage{
+		Data:          imgBytes,
+		MimeType:      "image/png",
+		RevisedPrompt: resp.Data[0].RevisedPrompt,
+		Model:         req.Model,
+	}
+	if resp.Usage.TotalTokens > 0 {
+		image.Usage = &llm.TokenUsage{
+			InputTokens:  int64(resp.Usage.InputTokens),
+			OutputTokens: int64(resp.Usage.OutputTokens),
+			Model:        req.Model,
+		}
+	}
+	return image, nil
+}
+
+// Synthesize reads the request's text aloud into MP3 audio, with TTS-1 and the alloy voice unless the request asks otherwise.
+func (s *OpenAI) Synthesize(ctx context.Context, request llm.SpeechRequest) ([]byte, error) {
+	req := openaiClient.CreateSpeechRequest{
+		Model:          openaiClient.SpeechModel(request.Model),
+		Input:          request.Text,
+		Voice:          openaiClient.SpeechVoice(request.Voice),
+		ResponseFormat: openaiClient.SpeechResponseFormatMp3,
+	}
+	if req.Model == "" {
+		req.Model = DefaultSpeechModel
+	}
+	if req.Voice == "" {
+		req.Voice = DefaultSpeechVoice
 	}
 
-	imgBytes, err := base64.StdEncoding.DecodeString(respBase64.Data[0].B64JSON)
+	resp, err := s.client.CreateSpeech(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to synthesize speech: %w", err)
 	}
+	defer resp.Close()
 
-	r := bytes.NewReader(imgBytes)
-	imgData, err := png.Decode(r)
+	audio, err := io.ReadAll(resp)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to read synthesized speech: %w", err)
 	}
 
-	return imgData, nil
+	return audio, nil
 }
 
 func (s *OpenAI) CountTokens(text string) int {
-	// Counting tokens is really annoying, so we approximate for now.
-	charCount := float64(len(text)) / 4.0
-	wordCount := float64(len(strings.Fields(text))) / 0.75
-
-	// Average the two
-	return int((charCount + wordCount) / 2.0)
+	return llm.TokenizerForModel(s.config.DefaultModel).CountTokens(text)
 }
 
 func (s *OpenAI) InputTokenLimit() int {
 	if s.config.InputTokenLimit > 0 {
 		return s.config.InputTokenLimit
 	}
+	return DefaultInputTokenLimit
+}
+
+// modelsResponse is the response to a request listing models. OpenAI only lists their IDs,
+// the other fields are added by compatible services such as OpenRouter, vLLM and Groq.
+type modelsResponse struct {
+	Data []struct {
+		ID            string `json:"id"`
+		ContextLength int    `json:"context_length"`
+		MaxModelLen   int    `json:"max_model_len"`
+		ContextWindow int    `json:"context_window"`
+		TopProvider   struct {
+			MaxCompletionTokens int `json:"max_completion_tokens"`
+		} `json:"top_provider"`
+		Architecture struct {
+			InputModalities []string `json:"input_modalities"`
+		} `json:"architecture"`
+		SupportedParameters []string `json:"supported_parameters"`
+	} `json:"data"`
+}
+
+// ListModels returns the models served by the API with whatever the API reports about their capabilities.
+func (s *OpenAI) ListModels(ctx context.Context) ([]llm.ModelCapabilitiesOverride, error) {
+	if s.modelsURL == "" {
+		return nil, errors.New("listing models is not supported for Azure")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.modelsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+	}
+	if s.config.OrgID != "" {
+		req.Header.Set("OpenAI-Organization", s.config.OrgID)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list models: %s", resp.Status)
+	}
+
+	var response modelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode models: %w", err)
+	}
+
+	models := make([]llm.ModelCapabilitiesOverride, 0, len(response.Data))
+	for _, model := range response.Data {
+		override := llm.ModelCapabilitiesOverride{
+			Model:           model.ID,
+			ContextWindow:   max(model.ContextLength, model.MaxModelLen, model.ContextWindow),
+			MaxOutputTokens: model.TopProvider.MaxCompletionTokens,
+		}
+		if modalities := model.Architecture.InputModalities; len(modalities) > 0 {
+			override.Vision = boolPtr(slices.Contains(modalities, "image"))
+		}
+		if parameters := model.SupportedParameters; len(parameters) > 0 {
+			override.Tools = boolPtr(slices.Contains(parameters, "tools"))
+			override.JSONSchema = boolPtr(slices.Contains(parameters, "structured_outputs"))
+			override.Reasoning = boolPtr(slices.Contains(parameters, "reasoning"))
+		}
+		models = append(models, override)
+	}
+	return models, nil
+}
 
-	switch {
-	case strings.HasPrefix(s.config.DefaultModel, "gpt-4o"),
-		strings.HasPrefix(s.config.DefaultModel, "o1-preview"),
-		strings.HasPrefix(s.config.DefaultModel, "o1-mini"),
-		strings.HasPrefix(s.config.DefaultModel, "gpt-4-turbo"),
-		strings.HasPrefix(s.config.DefaultModel, "gpt-4-0125-preview"),
-		strings.HasPrefix(s.config.DefaultModel, "gpt-4-1106-preview"):
-		return 128000
-	case strings.HasPrefix(s.config.DefaultModel, "gpt-4"):
-		return 8192
-	case strings.HasPrefix(s.config.DefaultModel, "gpt-3.5-turbo"),
-		s.config.DefaultModel == "gpt-3.5-turbo-0125",
-		s.config.DefaultModel == "gpt-3.5-turbo-1106":
-		return 16385
-	case s.config.DefaultModel == "gpt-3.5-turbo-instruct":
-		return 4096
-	}
-
-	return 128000 // Default fallback
+func boolPtr(value bool) *bool {
+	return &value
 }
 
 func (s *OpenAI) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
@@ -0,0 +1,490 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamReportsUsage(t *testing.T) {
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requestBody))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+			`{"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`{"id":"1","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":8}}}`,
+		}
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewCompatible(Config{
+		APIURL:           server.URL,
+		DefaultModel:     "test-model",
+		StreamingTimeout: 10 * time.Second,
+		StreamUsage:      true,
+	}, &http.Client{})
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	})
+	require.NoError(t, err)
+
+	var events []llm.TextStreamEvent
+	for event := range result.Stream {
+		events = append(events, event)
+	}
+
+	require.Len(t, events, 3)
+	assert.Equal(t, llm.EventTypeText, events[0].Type)
+	assert.Equal(t, llm.EventTypeUsage, events[1].Type)
+	assert.Equal(t, llm.TokenUsage{InputTokens: 12, OutputTokens: 3, CachedTokens: 8}, events[1].Value)
+	assert.Equal(t, llm.EventTypeEnd, events[2].Type)
+
+	assert.Equal(t, map[string]any{"include_usage": true}, requestBody["stream_options"])
+}
+
+func TestStreamReportsProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"message":"Rate limit reached","type":"requests"}}`)
+	}))
+	defer server.Close()
+
+	provider := NewCompatible(Config{
+		APIURL:           server.URL,
+		DefaultModel:     "test-model",
+		StreamingTimeout: 10 * time.Second,
+	}, &http.Client{})
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	})
+	require.NoError(t, err)
+
+	event := <-result.Stream
+	require.Equal(t, llm.EventTypeError, event.Type)
+
+	var providerErr *llm.ProviderError
+	require.ErrorAs(t, event.Value.(error), &providerErr)
+	assert.Equal(t, http.StatusTooManyRequests, providerErr.StatusCode)
+	assert.Equal(t, 7*time.Second, providerErr.RetryAfter)
+	assert.True(t, llm.IsRetryableError(providerErr))
+}
+
+func TestStreamReasoning(t *testing.T) {
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requestBody))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"reasoning_content":"Thinking"}}]}`,
+			`{"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Answer"}}]}`,
+			`{"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		}
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewCompatible(Config{
+		APIURL:           server.URL,
+		DefaultModel:     "test-model",
+		OutputTokenLimit: 500,
+		StreamingTimeout: 10 * time.Second,
+	}, &http.Client{})
+
+	result, err := provider.ChatCompletion(context.Background(), llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	}, llm.WithReasoningEffort(llm.ReasoningEffortHigh))
+	require.NoError(t, err)
+
+	var events []llm.TextStreamEvent
+	for event := range result.Stream {
+		events = append(events, event)
+	}
+
+	require.Len(t, events, 3)
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeReasoning, Value: "Thinking"}, events[0])
+	assert.Equal(t, llm.TextStreamEvent{Type: llm.EventTypeText, Value: "Answer"}, events[1])
+
+	assert.Equal(t, "high", requestBody["reasoning_effort"])
+	assert.Equal(t, float64(500), requestBody["max_completion_tokens"])
+	assert.NotContains(t, requestBody, "max_tokens")
+	assert.NotContains(t, requestBody, "stream_options", "compatible servers are only asked for usage when configured to")
+}
+
+func TestResponsesReasoningSummaries(t *testing.T) {
+	var requestBodies []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/responses", r.URL.Path)
+		var requestBody map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requestBody))
+		requestBodies = append(requestBodies, requestBody)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"response.created","response":{"id":"resp_1"}}`,
+			`{"type":"response.reasoning_summary_part.added","summary_index":0}`,
+			`{"type":"response.reasoning_summary_text.delta","delta":"Looking up"}`,
+			`{"type":"response.reasoning_summary_part.added","summary_index":1}`,
+			`{"type":"response.reasoning_summary_text.delta","delta":"Found it"}`,
+			`{"type":"response.output_item.done","item":{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"Looking up"},{"type":"summary_text","text":"Found it"}],"encrypted_content":"secret"}}`,
+			`{"type":"response.output_item.done","item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"lookup","arguments":"{\"q\":\"x\"}"}}`,
+			`{"type":"response.completed","response":{"id":"resp_1","usage":{"input_tokens":20,"output_tokens":5,"input_tokens_details":{"cached_tokens":4}}}}`,
+		}
+		if len(requestBodies) > 1 {
+			events = []string{
+				`{"type":"response.output_text.delta","delta":"Answer"}`,
+				`{"type":"response.completed","response":{"id":"resp_2","usage":{"input_tokens":30,"output_tokens":2}}}`,
+			}
+		}
+		for _, event := range events {
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	provider := New(Config{
+		APIKey:           "test-key",
+		DefaultModel:     "o3",
+		OutputTokenLimit: 500,
+		StreamingTimeout: 10 * time.Second,
+	}, &http.Client{})
+	provider.clientConfig.BaseURL = server.URL
+
+	tools := llm.NewToolStore(nil, false)
+	tools.AddTools([]llm.Tool{{Name: "lookup", Description: "Looks things up", Schema: llm.NewJSONSchemaFromStruct[struct {
+		Q string `json:"q"`
+	}]()}})
+	request := llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleSystem, Message: "Be brief"}, {Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	}
+	request.Context.Tools = tools
+
+	result, err := provider.ChatCompletion(context.Background(), request, llm.WithReasoningEffort(llm.ReasoningEffortHigh))
+	require.NoError(t, err)
+	var events []llm.TextStreamEvent
+	for event := range result.Stream {
+		events = append(events, event)
+	}
+
+	reasoning := []llm.ReasoningBlock{{Text: "Looking up\n\nFound it", Signature: "rs_1", RedactedData: "secret"}}
+	toolCalls := []llm.ToolCall{{ID: "call_1", Name: "lookup", Arguments: []byte(`{"q":"x"}`)}}
+	assert.Equal(t, []llm.TextStreamEvent{
+		{Type: llm.EventTypeReasoning, Value: "Looking up"},
+		{Type: llm.EventTypeReasoning, Value: "\n\n"},
+		{Type: llm.EventTypeReasoning, Value: "Found it"},
+		{Type: llm.EventTypeUsage, Value: llm.TokenUsage{InputTokens: 20, OutputTokens: 5, CachedTokens: 4}},
+		{Type: llm.EventTypeReasoningBlocks, Value: reasoning},
+		{Type: llm.EventTypeToolCalls, Value: toolCalls},
+	}, events)
+
+	assert.Equal(t, map[string]any{"effort": "high", "summary": "auto"}, requestBodies[0]["reasoning"])
+	assert.Equal(t, float64(500), requestBodies[0]["max_output_tokens"])
+	assert.Equal(t, false, requestBodies[0]["store"])
+	assert.Equal(t, []any{"reasoning.encrypted_content"}, requestBodies[0]["include"])
+	assert.Equal(t, []any{
+		map[string]any{"type": "message", "role": "system", "content": "Be brief"},
+		map[string]any{"type": "message", "role": "user", "content": "Hi"},
+	}, requestBodies[0]["input"])
+	tool := requestBodies[0]["tools"].([]any)[0].(map[string]any)
+	assert.Equal(t, "lookup", tool["name"])
+	assert.Equal(t, false, tool["strict"])
+
+	// The reasoning is sent back with the tool results.
+	toolCalls[0].Result = "found"
+	request.Posts = append(request.Posts, llm.Post{Role: llm.PostRoleBot, ToolUse: toolCalls, Reasoning: reasoning})
+	response, err := provider.ChatCompletionNoStream(context.Background(), request, llm.WithReasoningEffort(llm.ReasoningEffortHigh))
+	require.NoError(t, err)
+	assert.Equal(t, "Answer", response)
+	assert.Equal(t, []any{
+		map[string]any{"type": "reasoning", "id": "rs_1", "summary": []any{map[string]any{"type": "summary_text", "text": "Looking up\n\nFound it"}}, "encrypted_content": "secret"},
+		map[string]any{"type": "function_call", "call_id": "call_1", "name": "lookup", "arguments": `{"q":"x"}`},
+		map[string]any{"type": "function_call_output", "call_id": "call_1", "output": "found"},
+	}, requestBodies[1]["input"].([]any)[2:])
+}
+
+func TestResponsesWithoutReasoningSummaries(t *testing.T) {
+	var summaries []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var requestBody map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requestBody))
+		summary := requestBody["reasoning"].(map[string]any)["summary"]
+		summaries = append(summaries, summary)
+
+		if summary != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"Your organization must be verified to generate reasoning summaries.","type":"invalid_request_error","param":"reasoning.summary","code":"unsupported_value"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"type":"response.output_text.delta","delta":"Answer"}`+"\n\n")
+		fmt.Fprint(w, `data: {"type":"response.completed","response":{"id":"resp_1"}}`+"\n\n")
+	}))
+	defer server.Close()
+
+	provider := New(Config{DefaultModel: "o3", StreamingTimeout: 10 * time.Second}, &http.Client{})
+	provider.clientConfig.BaseURL = server.URL
+
+	response, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	}, llm.WithReasoningModel())
+	require.NoError(t, err)
+	assert.Equal(t, "Answer", response)
+	assert.Equal(t, []any{"auto", nil}, summaries, "unverified organizations get answers without summaries")
+}
+
+func TestAzureChatCompletion(t *testing.T) {
+	var requestURL, apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURL = r.URL.String()
+		apiKey = r.Header.Get("api-key")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewAzure(Config{
+		APIKey:           "azure-key",
+		APIURL:           server.URL + "/",
+		DefaultModel:     "gpt-4.1",
+		StreamingTimeout: 10 * time.Second,
+	}, &http.Client{})
+
+	response, err := provider.ChatCompletionNoStream(context.Background(), llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", response)
+	assert.Equal(t, "/openai/deployments/gpt-41/chat/completions?api-version=2024-10-21", requestURL)
+	assert.Equal(t, "azure-key", apiKey)
+}
+
+func TestSamplingParameters(t *testing.T) {
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBody = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requestBody))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewCompatible(Config{
+		APIURL:           server.URL,
+		DefaultModel:     "test-model",
+		StreamingTimeout: 10 * time.Second,
+	}, &http.Client{})
+	request := llm.CompletionRequest{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "Hi"}},
+		Context: llm.NewContext(),
+	}
+
+	_, err := provider.ChatCompletionNoStream(context.Background(), request,
+		llm.WithTemperature(0),
+		llm.WithTopP(0.5),
+		llm.WithStopSequences([]string{"END"}),
+		llm.WithSeed(7),
+	)
+	require.NoError(t, err)
+	require.Contains(t, requestBody, "temperature", "a zero temperature must still be sent")
+	assert.Equal(t, float64(0), requestBody["temperature"])
+	assert.Equal(t, 0.5, requestBody["top_p"])
+	assert.Equal(t, []any{"END"}, requestBody["stop"])
+	assert.Equal(t, float64(7), requestBody["seed"])
+
+	_, err = provider.ChatCompletionNoStream(context.Background(), request,
+		llm.WithTemperature(1),
+		llm.WithReasoningEffort(llm.ReasoningEffortLow),
+	)
+	require.NoError(t, err)
+	assert.NotContains(t, requestBody, "temperature", "reasoning models reject sampling parameters")
+
+	_, err = provider.ChatCompletionNoStream(context.Background(), request,
+		llm.WithReasoningModel(),
+		llm.WithTemperature(0.2),
+		llm.WithMaxGeneratedTokens(100),
+	)
+	require.NoError(t, err)
+	assert.NotContains(t, requestBody, "temperature", "reasoning models reject sampling parameters without a reasoning effort too")
+	assert.NotContains(t, requestBody, "reasoning_effort")
+	assert.NotContains(t, requestBody, "max_tokens")
+	assert.Equal(t, float64(100), requestBody["max_completion_tokens"])
+}
+
+func TestListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"object":"list","data":[
+			{"id":"gpt-4o","object":"model"},
+			{"id":"anthropic/claude-sonnet-4","context_length":200000,"top_provider":{"max_completion_tokens":64000},
+			 "architecture":{"input_modalities":["text","image"]},"supported_parameters":["tools","reasoning","max_tokens"]},
+			{"id":"local-model","max_model_len":32768}
+		]}`)
+	}))
+	defer server.Close()
+
+	provider := NewCompatible(Config{APIURL: server.URL, APIKey: "test-key"}, &http.Client{})
+	models, err := provider.ListModels(context.Background())
+	require.NoError(t, err)
+
+	yes, no := true, false
+	assert.Equal(t, []llm.ModelCapabilitiesOverride{
+		{Model: "gpt-4o"},
+		{Model: "anthropic/claude-sonnet-4", ContextWindow: 200000, MaxOutputTokens: 64000, Vision: &yes, Tools: &yes, JSONSchema: &no, Reasoning: &yes},
+		{Model: "local-model", ContextWindow: 32768},
+	}, models)
+}
+
+func TestDocumentInputs(t *testing.T) {
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requestBody))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Done"},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	request := func() llm.CompletionRequest {
+		return llm.CompletionRequest{
+			Posts: []llm.Post{{
+				Role:    llm.PostRoleUser,
+				Message: "Summarize",
+				Files: []llm.File{
+					{Kind: llm.FileKindDocument, Name: "report.pdf", MimeType: "application/pdf", Size: 3, Reader: strings.NewReader("pdf"), Text: "report text"},
+					{Kind: llm.FileKindDocument, Name: "large.pdf", MimeType: "application/pdf", Size: 100 * 1024 * 1024, Text: "large text"},
+				},
+			}},
+			Context: llm.NewContext(),
+		}
+	}
+	content := func() []any {
+		messages := requestBody["messages"].([]any)
+		return messages[0].(map[string]any)["content"].([]any)
+	}
+
+	provider := NewCompatible(Config{APIURL: server.URL, DefaultModel: "test-model", StreamingTimeout: 10 * time.Second}, &http.Client{})
+	provider.documentInputs = true
+	_, err := provider.ChatCompletionNoStream(context.Background(), request())
+	require.NoError(t, err)
+
+	assert.Equal(t, []any{
+		map[string]any{"type": "text", "text": "Summarize"},
+		map[string]any{"type": "file", "file": map[string]any{"filename": "report.pdf", "file_data": "data:application/pdf;base64,cGRm"}},
+		map[string]any{"type": "text", "text": "File Name: large.pdf\nContent: large text"},
+	}, content())
+
+	// Compatible APIs are given the extracted text.
+	provider.documentInputs = false
+	_, err = provider.ChatCompletionNoStream(context.Background(), request())
+	require.NoError(t, err)
+
+	assert.Equal(t, []any{
+		map[string]any{"type": "text", "text": "Summarize"},
+		map[string]any{"type": "text", "text": "File Name: report.pdf\nContent: report text"},
+		map[string]any{"type": "text", "text": "File Name: large.pdf\nContent: large text"},
+	}, content())
+}
+
+func TestGenerateImage(t *testing.T) {
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/images/generations", r.URL.Path)
+		requestBody = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requestBody))
+		if requestBody["model"] == "gpt-image-1" {
+			fmt.Fprint(w, `{"created":1,"data":[{"b64_json":"cG5n"}],"usage":{"total_tokens":1060,"input_tokens":4,"output_tokens":1056}}`)
+			return
+		}
+		fmt.Fprint(w, `{"created":1,"data":[{"b64_json":"cG5n","revised_prompt":"a red fox"}]}`)
+	}))
+	defer server.Close()
+
+	provider := NewCompatible(Config{APIURL: server.URL}, &http.Client{})
+
+	image, err := provider.GenerateImage(context.Background(), llm.ImageRequest{Prompt: "a fox"})
+	require.NoError(t, err)
+	assert.Equal(t, &llm.GeneratedImage{Data: []byte("png"), MimeType: "image/png", RevisedPrompt: "a red fox", Model: "dall-e-3"}, image)
+	assert.Equal(t, map[string]any{
+		"prompt":          "a fox",
+		"model":           "dall-e-3",
+		"n":               float64(1),
+		"size":            "1024x1024",
+		"response_format": "b64_json",
+	}, requestBody)
+
+	// GPT image models reject the response format.
+	image, err = provider.GenerateImage(context.Background(), llm.ImageRequest{Prompt: "a fox", Model: "gpt-image-1", Size: "1536x1024"})
+	require.NoError(t, err)
+	assert.Equal(t, &llm.TokenUsage{InputTokens: 4, OutputTokens: 1056, Model: "gpt-image-1"}, image.Usage)
+	assert.Equal(t, "gpt-image-1", requestBody["model"])
+	assert.Equal(t, "1536x1024", requestBody["size"])
+	assert.NotContains(t, requestBody, "response_format")
+}
+
+func TestSynthesize(t *testing.T) {
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/audio/speech", r.URL.Path)
+		requestBody = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requestBody))
+		w.Header().Set("Content-Type", "audio/mpeg")
+		fmt.Fprint(w, "mp3")
+	}))
+	defer server.Close()
+
+	provider := NewCompatible(Config{APIURL: server.URL}, &http.Client{})
+
+	audio, err := provider.Synthesize(context.Background(), llm.SpeechRequest{Text: "Hello there"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("mp3"), audio)
+	assert.Equal(t, map[string]any{
+		"model":           "tts-1",
+		"input":           "Hello there",
+		"voice":           "alloy",
+		"response_format": "mp3",
+	}, requestBody)
+
+	_, err = provider.Synthesize(context.Background(), llm.SpeechRequest{Text: "Hello there", Model: "gpt-4o-mini-tts", Voice: "coral"})
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini-tts", requestBody["model"])
+	assert.Equal(t, "coral", requestBody["voice"])
+}
@@ -0,0 +1,437 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+	openaiClient "github.com/sashabaranov/go-openai"
+)
+
+// Reasoning models are asked for reasoning through the Responses API, the Chat Completions API does not return it.
+// Responses are not stored by OpenAI, the encrypted reasoning behind tool calls is sent back with their results instead.
+
+// responsesRequest is the body of a Responses API request.
+type responsesRequest struct {
+	Model           string              `json:"model"`
+	Input           []responsesItem     `json:"input"`
+	Tools           []responsesTool     `json:"tools,omitempty"`
+	Reasoning       *responsesReasoning `json:"reasoning,omitempty"`
+	MaxOutputTokens int                 `json:"max_output_tokens,omitempty"`
+	Text            *responsesText      `json:"text,omitempty"`
+	User            string              `json:"user,omitempty"`
+	Include         []string            `json:"include,omitempty"`
+	Store           bool                `json:"store"`
+	Stream          bool                `json:"stream"`
+}
+
+type responsesReasoning struct {
+	Effort string `json:"effort,omitempty"`
+	// Summary asks for a summary of the reasoning, the full reasoning is never returned.
+	Summary string `json:"summary,omitempty"`
+}
+
+type responsesText struct {
+	Format responsesTextFormat `json:"format"`
+}
+
+type responsesTextFormat struct {
+	Type   string             `json:"type"`
+	Name   string             `json:"name"`
+	Schema *jsonschema.Schema `json:"schema"`
+	Strict bool               `json:"strict"`
+}
+
+type responsesTool struct {
+	Type        string             `json:"type"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Parameters  *jsonschema.Schema `json:"parameters,omitempty"`
+	// Strict defaults to true, which needs schemas that list every property as required.
+	Strict bool `json:"strict"`
+}
+
+// responsesItem is an input item: a message, a tool call or its result, or the reasoning behind tool calls.
+// Output and Summary are set for the items that require them, even when they are empty.
+type responsesItem struct {
+	Type    string `json:"type"`
+	Role    string `json:"role,omitempty"`
+	Content any    `json:"content,omitempty"`
+
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    any    `json:"output,omitempty"`
+
+	ID               string `json:"id,omitempty"`
+	Summary          any    `json:"summary,omitempty"`
+	EncryptedContent string `json:"encrypted_content,omitempty"`
+}
+
+type responsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+}
+
+type responsesSummaryPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// responsesOutputItem is an item of the response, only function calls and reasoning are read from them.
+type responsesOutputItem struct {
+	Type             string                 `json:"type"`
+	ID               string                 `json:"id"`
+	CallID           string                 `json:"call_id"`
+	Name             string                 `json:"name"`
+	Arguments        string                 `json:"arguments"`
+	Summary          []responsesSummaryPart `json:"summary"`
+	EncryptedContent string                 `json:"encrypted_content"`
+}
+
+// responsesEvent is a streamed event, its fields are set depending on its type.
+type responsesEvent struct {
+	Type     string               `json:"type"`
+	Delta    string               `json:"delta"`
+	Item     *responsesOutputItem `json:"item"`
+	Response *responsesResponse   `json:"response"`
+	// Code and Message are set on error events.
+	Code    any    `json:"code"`
+	Message string `json:"message"`
+}
+
+type responsesResponse struct {
+	Error *openaiClient.APIError `json:"error"`
+	Usage *responsesUsage        `json:"usage"`
+}
+
+type responsesUsage struct {
+	InputTokens        int64 `json:"input_tokens"`
+	OutputTokens       int64 `json:"output_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+}
+
+// useResponses tells whether a request is sent to the Responses API, which only OpenAI serves.
+func (s *OpenAI) useResponses(cfg llm.LanguageModelConfig) bool {
+	return s.responsesAPI && (cfg.ReasoningEffort != "" || cfg.ReasoningModel)
+}
+
+func (s *OpenAI) responsesRequestFromConfig(cfg llm.LanguageModelConfig) responsesRequest {
+	request := responsesRequest{
+		Model: cfg.Model,
+		Reasoning: &responsesReasoning{
+			Effort:  cfg.ReasoningEffort,
+			Summary: "auto",
+		},
+		MaxOutputTokens: cfg.MaxGeneratedTokens,
+		Include:         []string{"reasoning.encrypted_content"},
+	}
+	// Reasoning models reject sampling parameters and stop sequences, so those are not sent.
+	if cfg.JSONOutputFormat != nil {
+		request.Text = &responsesText{
+			Format: responsesTextFormat{
+				Type:   "json_schema",
+				Name:   "output_format",
+				Schema: cfg.JSONOutputFormat,
+				Strict: true,
+			},
+		}
+	}
+	return request
+}
+
+// postsToResponsesInput converts posts to input items. The reasoning behind tool calls is sent back before them.
+func postsToResponsesInput(posts []llm.Post, documentInputs bool) []responsesItem {
+	result := make([]responsesItem, 0, len(posts))
+	for _, post := range posts {
+		if post.Role == llm.PostRoleBot && len(post.ToolUse) > 0 {
+			for _, reasoning := range post.Reasoning {
+				if reasoning.Signature == "" || reasoning.RedactedData == "" {
+					// Reasoning from other providers can't be sent to OpenAI.
+					continue
+				}
+				summary := []responsesSummaryPart{}
+				if reasoning.Text != "" {
+					summary = append(summary, responsesSummaryPart{Type: "summary_text", Text: reasoning.Text})
+				}
+				result = append(result, responsesItem{
+					Type:             "reasoning",
+					ID:               reasoning.Signature,
+					Summary:          summary,
+					EncryptedContent: reasoning.RedactedData,
+				})
+			}
+		}
+
+		for _, message := range postsToChatCompletionMessages([]llm.Post{post}, documentInputs) {
+			result = append(result, chatMessageToResponsesItems(message)...)
+		}
+	}
+	return result
+}
+
+// chatMessageToResponsesItems converts a chat message to the input items that carry the same content.
+func chatMessageToResponsesItems(message chatMessage) []responsesItem {
+	if message.Role == openaiClient.ChatMessageRoleTool {
+		output, _ := message.Content.(string)
+		return []responsesItem{{Type: "function_call_output", CallID: message.ToolCallID, Output: output}}
+	}
+
+	var result []responsesItem
+	switch content := message.Content.(type) {
+	case string:
+		result = append(result, responsesItem{Type: "message", Role: message.Role, Content: content})
+	case []chatMessagePart:
+		textType := "input_text"
+		if message.Role == openaiClient.ChatMessageRoleAssistant {
+			textType = "output_text"
+		}
+		parts := make([]responsesContentPart, 0, len(content))
+		for _, part := range content {
+			switch {
+			case part.ImageURL != nil:
+				parts = append(parts, responsesContentPart{Type: "input_image", ImageURL: part.ImageURL.URL, Detail: string(part.ImageURL.Detail)})
+			case part.File != nil:
+				parts = append(parts, responsesContentPart{Type: "input_file", Filename: part.File.Filename, FileData: part.File.FileData})
+			default:
+				parts = append(parts, responsesContentPart{Type: textType, Text: part.Text})
+			}
+		}
+		result = append(result, responsesItem{Type: "message", Role: message.Role, Content: parts})
+	}
+
+	for _, toolCall := range message.ToolCalls {
+		result = append(result, responsesItem{
+			Type:      "function_call",
+			CallID:    toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		})
+	}
+	return result
+}
+
+func toolsToResponsesTools(tools []llm.Tool) []responsesTool {
+	result := make([]responsesTool, 0, len(tools))
+	for _, tool := range tools {
+		result = append(result, responsesTool{
+			Type:        "function",
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.Schema,
+		})
+	}
+	return result
+}
+
+// responsesStream reads the server-sent events of a streamed response.
+type responsesStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+// Recv returns the next event of the stream, io.EOF once the service has sent all of them.
+func (s *responsesStream) Recv() (responsesEvent, error) {
+	data, err := nextEventData(s.reader)
+	if err != nil {
+		return responsesEvent{}, err
+	}
+
+	var event responsesEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return responsesEvent{}, fmt.Errorf("failed to decode stream event: %w", err)
+	}
+	return event, nil
+}
+
+func (s *responsesStream) Close() error {
+	return s.body.Close()
+}
+
+func (s *OpenAI) createResponsesStream(ctx context.Context, request responsesRequest) (*responsesStream, error) {
+	request.Stream = true
+	body, err := s.postStream(ctx, strings.TrimSuffix(s.clientConfig.BaseURL, "/")+"/responses", request)
+	if err != nil {
+		return nil, err
+	}
+	return &responsesStream{
+		body:   body,
+		reader: bufio.NewReader(body),
+	}, nil
+}
+
+// rejectsReasoningSummary tells whether the request failed because the organization may not receive reasoning
+// summaries, which OpenAI only returns to verified organizations.
+func rejectsReasoningSummary(err error) bool {
+	var apiErr *openaiClient.APIError
+	return errors.As(err, &apiErr) && apiErr.Param != nil && *apiErr.Param == "reasoning.summary"
+}
+
+func (s *OpenAI) streamResponsesToChannels(ctx context.Context, request responsesRequest, output chan<- llm.TextStreamEvent) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	watchdog := s.startWatchdog(ctx, cancel)
+
+	sendError := func(err error) {
+		if ctxErr := context.Cause(ctx); ctxErr != nil {
+			err = ctxErr
+		}
+		output <- llm.TextStreamEvent{
+			Type:  llm.EventTypeError,
+			Value: err,
+		}
+	}
+
+	stream, err := s.createResponsesStream(ctx, request)
+	if err != nil && rejectsReasoningSummary(err) {
+		// Answer without a summary rather than not at all.
+		request.Reasoning.Summary = ""
+		stream, err = s.createResponsesStream(ctx, request)
+	}
+	if err != nil {
+		sendError(err)
+		return
+	}
+	defer stream.Close()
+
+	var reasoning []llm.ReasoningBlock
+	var toolCalls []llm.ToolCall
+	summaryParts := 0
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			sendError(errors.New("stream ended before the response was complete"))
+			return
+		}
+		if err != nil {
+			sendError(err)
+			return
+		}
+
+		// Ping the watchdog when we receive an event
+		watchdog <- struct{}{}
+
+		switch event.Type {
+		case "response.reasoning_summary_part.added":
+			if summaryParts > 0 {
+				output <- llm.TextStreamEvent{
+					Type:  llm.EventTypeReasoning,
+					Value: "\n\n",
+				}
+			}
+			summaryParts++
+		case "response.reasoning_summary_text.delta":
+			output <- llm.TextStreamEvent{
+				Type:  llm.EventTypeReasoning,
+				Value: event.Delta,
+			}
+		case "response.output_text.delta":
+			output <- llm.TextStreamEvent{
+				Type:  llm.EventTypeText,
+				Value: event.Delta,
+			}
+		case "response.output_item.done":
+			if event.Item == nil {
+				continue
+			}
+			switch event.Item.Type {
+			case "function_call":
+				toolCalls = append(toolCalls, llm.ToolCall{
+					ID:        event.Item.CallID,
+					Name:      event.Item.Name,
+					Arguments: []byte(event.Item.Arguments),
+				})
+			case "reasoning":
+				summary := make([]string, 0, len(event.Item.Summary))
+				for _, part := range event.Item.Summary {
+					summary = append(summary, part.Text)
+				}
+				reasoning = append(reasoning, llm.ReasoningBlock{
+					Text:         strings.Join(summary, "\n\n"),
+					Signature:    event.Item.ID,
+					RedactedData: event.Item.EncryptedContent,
+				})
+			}
+		case "response.completed", "response.incomplete":
+			if event.Response != nil && event.Response.Usage != nil {
+				output <- llm.TextStreamEvent{
+					Type: llm.EventTypeUsage,
+					Value: llm.TokenUsage{
+						InputTokens:  event.Response.Usage.InputTokens,
+						OutputTokens: event.Response.Usage.OutputTokens,
+						CachedTokens: event.Response.Usage.InputTokensDetails.CachedTokens,
+					},
+				}
+			}
+			if len(toolCalls) == 0 {
+				output <- llm.TextStreamEvent{
+					Type:  llm.EventTypeEnd,
+					Value: nil,
+				}
+				return
+			}
+			if tooManyFunctionCalls(request.Input) {
+				sendError(errors.New("too many function calls"))
+				return
+			}
+			// The reasoning behind tool calls must be sent back with their results.
+			if len(reasoning) > 0 {
+				output <- llm.TextStreamEvent{
+					Type:  llm.EventTypeReasoningBlocks,
+					Value: reasoning,
+				}
+			}
+			output <- llm.TextStreamEvent{
+				Type:  llm.EventTypeToolCalls,
+				Value: toolCalls,
+			}
+			return
+		case "response.failed":
+			if event.Response != nil && event.Response.Error != nil {
+				sendError(event.Response.Error)
+			} else {
+				sendError(errors.New("response failed"))
+			}
+			return
+		case "error":
+			sendError(&openaiClient.APIError{Code: event.Code, Message: event.Message})
+			return
+		}
+	}
+}
+
+// tooManyFunctionCalls tells whether the input ends with more tool results than a response may follow up on.
+func tooManyFunctionCalls(input []responsesItem) bool {
+	numFunctionCalls := 0
+	for i := len(input) - 1; i >= 0 && input[i].Type == "function_call_output"; i-- {
+		numFunctionCalls++
+	}
+	return numFunctionCalls > MaxFunctionCalls
+}
+
+func (s *OpenAI) streamResponses(ctx context.Context, request responsesRequest) *llm.TextStreamResult {
+	eventStream := make(chan llm.TextStreamEvent)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer close(eventStream)
+		defer cancel()
+		s.streamResponsesToChannels(ctx, request, eventStream)
+	}()
+
+	return &llm.TextStreamResult{Stream: eventStream, Cancel: cancel}
+}
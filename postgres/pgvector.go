@@ -5,8 +5,10 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"strconv"
+	"strings"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
@@ -16,22 +18,60 @@ import (
 )
 
 type PGVector struct {
-	db *sqlx.DB
+	db     *sqlx.DB
+	config PGVectorConfig
+	metric metric
+	// table holds the embeddings of the generation of the index
+	table string
+	// indexDefinition is how the embedding index is built
+	indexDefinition string
+	// indexesBuilt is closed once the indexes built in the background are done, indexErr holding why they failed
+	indexesBuilt chan struct{}
+	indexErr     error
 }
 
 type PGVectorConfig struct {
 	Dimensions int `json:"dimensions"`
+	// Metric is one of the distance metrics, L2 when empty. Changing it rebuilds the index.
+	Metric string `json:"metric"`
+	// IndexType is HNSW when empty or IVFFlat. Changing it or its settings rebuilds the index.
+	IndexType string        `json:"indexType"`
+	HNSW      HNSWConfig    `json:"hnsw"`
+	IVFFlat   IVFFlatConfig `json:"ivfflat"`
+	// Generation is the generation of the index stored, each generation having its own table.
+	Generation int `json:"-"`
+	// Logger reports failures of the indexes built in the background, nil discarding them.
+	Logger embeddings.Logger `json:"-"`
+}
+
+// embeddingsTable returns the table of a generation of the index, the first one using the original table
+func embeddingsTable(generation int) string {
+	if generation <= 1 {
+		return "llm_posts_embeddings"
+	}
+	return fmt.Sprintf("llm_posts_embeddings_%d", generation)
 }
 
 func NewPGVector(db *sqlx.DB, config PGVectorConfig) (*PGVector, error) {
+	metric, err := config.metric()
+	if err != nil {
+		return nil, err
+	}
+	indexDefinition, err := config.indexDefinition()
+	if err != nil {
+		return nil, err
+	}
+
 	// Enable pgvector extension if not already enabled
 	if _, err := db.Exec("CREATE EXTENSION IF NOT EXISTS vector"); err != nil {
 		return nil, fmt.Errorf("failed to create vector extension: %w", err)
 	}
 
-	// Create the llm_posts_embeddings table if it doesn't exist
+	table := embeddingsTable(config.Generation)
+
+	// Create the embeddings table if it doesn't exist
 	createTableQuery := `
-		CREATE TABLE IF NOT EXISTS llm_posts_embeddings (
+		CREATE TABLE IF NOT EXISTS ` + table + ` (
 			id TEXT PRIMARY KEY,             								-- Post ID or chunk ID (post_id_chunk_N)
 			post_id TEXT NOT NULL REFERENCES Posts(Id) ON DELETE CASCADE,   -- Original post ID (same as id for non-chunks)
 			team_id TEXT NOT NULL,
@@ -45,17 +85,15 @@ func NewPGVector(db *sqlx.DB, config PGVectorConfig) (*PGVector, error) {
 			total_chunks INTEGER             -- NULL for non-chunks
 		)`
 	if _, err := db.Exec(createTableQuery); err != nil {
-		return nil, fmt.Errorf("failed to create llm_posts_embeddings table: %w", err)
+		return nil, fmt.Errorf("failed to create %s table: %w", table, err)
 	}
 
 	// Create indexes
 	queries := []string{
-		// Index for similarity search using HNSW
-		"CREATE INDEX IF NOT EXISTS llm_posts_embeddings_embedding_idx ON llm_posts_embeddings USING hnsw (embedding vector_l2_ops)",
 		// Index on post_id for efficient lookups and deletions
-		"CREATE INDEX IF NOT EXISTS llm_posts_embeddings_post_id_idx ON llm_posts_embeddings(post_id)",
+		"CREATE INDEX IF NOT EXISTS " + table + "_post_id_idx ON " + table + "(post_id)",
 		// Index on is_chunk to filter by chunks
-		"CREATE INDEX IF NOT EXISTS llm_posts_embeddings_is_chunk_idx ON llm_posts_embeddings(is_chunk)",
+		"CREATE INDEX IF NOT EXISTS " + table + "_is_chunk_idx ON " + table + "(is_chunk)",
 	}
 
 	for _, query := range queries {
@@ -64,7 +102,18 @@ func NewPGVector(db *sqlx.DB, config PGVectorConfig) (*PGVector, error) {
 		}
 	}
 
-	return &PGVector{db: db}, nil
+	// The full text and similarity search indexes are built in the background.
+	pv := &PGVector{
+		db:              db,
+		config:          config,
+		metric:          metric,
+		table:           table,
+		indexDefinition: indexDefinition,
+		indexesBuilt:    make(chan struct{}),
+	}
+	go pv.buildIndexes()
+
+	return pv, nil
 }
 
 func (pv *PGVector) Store(ctx context.Context, docs []embeddings.PostDocument, embeddings [][]float32) error {
@@ -74,7 +123,7 @@ func (pv *PGVector) Store(ctx context.Context, docs []embeddings.PostDocument, e
 			id = fmt.Sprintf("%s_chunk_%d", doc.PostID, doc.ChunkIndex)
 		}
 		_, err := pv.db.NamedExecContext(ctx, `
-			INSERT INTO llm_posts_embeddings (
+			INSERT INTO `+pv.table+` (
 				id, post_id, team_id, channel_id, user_id, content, embedding, created_at,
 				is_chunk, chunk_index, total_chunks
 			)
@@ -118,24 +167,55 @@ func sqlNullInt(condition bool, val int) interface{} {
 	return val
 }
 
-func (pv *PGVector) Search(ctx context.Context, embedding []float32, opts embeddings.SearchOptions) ([]embeddings.SearchResult, error) {
-	if opts.UserID == "" {
-		return nil, fmt.Errorf("user ID is required to validate permissions")
+// searchColumns are the columns of a document selected by searches, followed by the score of the document.
+var searchColumns = []string{
+	"e.post_id",
+	"e.team_id",
+	"e.channel_id",
+	"e.user_id",
+	"e.created_at",
+	"e.content",
+	"e.is_chunk",
+	"e.chunk_index",
+	"e.total_chunks",
+}
+
+// Full text search uses the simple configuration, which doesn't stem words or drop stop words,
+// so that identifiers such as ticket IDs, error codes and hostnames match exactly.
+const (
+	// textSearchVector must match the expression of the full text search index
+	textSearchVector = "to_tsvector('simple', e.content)"
+	// maxTextSearchWords bounds the number of words of the query searched for
+	maxTextSearchWords = 32
+)
+
+// textSearchQuery returns a query matching any of the words of the text, documents matching more of them ranking
+// higher. Each word is parsed on its own and the words are combined with OR, empty when the text has no words.
+func textSearchQuery(text string) (string, []any) {
+	var queries []string
+	var args []any
+	seen := map[string]bool{}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		queries = append(queries, "plainto_tsquery('simple', ?)")
+		args = append(args, word)
+		if len(queries) == maxTextSearchWords {
+			break
+		}
+	}
+	if len(queries) == 0 {
+		return "", nil
 	}
+	return "(" + strings.Join(queries, " || ") + ")", args
+}
 
-	queryBuilder := sq.Select(
-		"e.post_id",
-		"e.team_id",
-		"e.channel_id",
-		"e.user_id",
-		"e.created_at",
-		"e.content",
-		"e.is_chunk",
-		"e.chunk_index",
-		"e.total_chunks",
-		"(e.embedding <-> ?) as similarity",
-	).
-		From("llm_posts_embeddings e").
+// withSearchFilters restricts a search to the channels the user is a member of and to the filters of the options
+func withSearchFilters(queryBuilder sq.SelectBuilder, table string, opts embeddings.SearchOptions) sq.SelectBuilder {
+	queryBuilder = queryBuilder.
+		From(table+" e").
 		Join("Channels c ON e.channel_id = c.Id").
 		Join("ChannelMembers cm ON e.channel_id = cm.ChannelId").
 		Where("cm.UserId = ?", opts.UserID).
@@ -158,7 +238,19 @@ func (pv *PGVector) Search(ctx context.Context, embedding []float32, opts embedd
 		queryBuilder = queryBuilder.Where(sq.Lt{"e.created_at": opts.CreatedBefore})
 	}
 
-	queryBuilder = queryBuilder.OrderBy("similarity ASC")
+	return queryBuilder
+}
+
+func (pv *PGVector) Search(ctx context.Context, embedding []float32, opts embeddings.SearchOptions) ([]embeddings.SearchResult, error) {
+	if opts.UserID == "" {
+		return nil, fmt.Errorf("user ID is required to validate permissions")
+	}
+
+	queryBuilder := withSearchFilters(
+		sq.Select(searchColumns...).Column("(e.embedding "+pv.metric.operator+" ?) as similarity", pgvector.NewVector(embedding)),
+		pv.table,
+		opts,
+	).OrderBy("similarity ASC")
 
 	if opts.Limit > 0 && opts.Limit < 100000 {
 		queryBuilder = queryBuilder.Limit(uint64(opts.Limit)) //nolint:gosec
@@ -169,26 +261,115 @@ func (pv *PGVector) Search(ctx context.Context, embedding []float32, opts embedd
 		return nil, fmt.Errorf("failed to build SQL: %w", err)
 	}
 
-	// Need to append the embedding to the args slice from the select
-	args = append([]interface{}{pgvector.NewVector(embedding)}, args...)
+	var queryer sqlx.QueryerContext = pv.db
+	if settings := pv.config.searchSettings(); len(settings) > 0 {
+		// Index search settings only apply to the transaction of the search.
+		tx, err := pv.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer func() {
+			_ = tx.Rollback()
+		}()
+
+		for _, setting := range settings {
+			if _, err := tx.ExecContext(ctx, setting); err != nil {
+				return nil, fmt.Errorf("failed to apply search setting: %w", err)
+			}
+		}
+		queryer = tx
+	}
 
-	rows, err := pv.db.QueryxContext(ctx, query, args...)
+	rows, err := queryer.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query vectors with permissions: %w", err)
 	}
 	defer rows.Close()
 
-	return scanSearchResults(rows, opts.MinScore)
+	return scanSearchResults(rows, opts.MinScore, pv.metric.score)
 }
 
-// scanSearchResults extracts search results from query rows
-func scanSearchResults(rows *sqlx.Rows, minScore float32) ([]embeddings.SearchResult, error) {
+// SearchText performs a full text search matching any of the words of the query
+func (pv *PGVector) SearchText(ctx context.Context, text string, opts embeddings.SearchOptions) ([]embeddings.SearchResult, error) {
+	if opts.UserID == "" {
+		return nil, fmt.Errorf("user ID is required to validate permissions")
+	}
+
+	tsQuery, tsQueryArgs := textSearchQuery(text)
+	if tsQuery == "" {
+		return nil, nil
+	}
+
+	queryBuilder := withSearchFilters(
+		sq.Select(searchColumns...).Column("ts_rank_cd("+textSearchVector+", "+tsQuery+") as rank", tsQueryArgs...),
+		pv.table,
+		opts,
+	).
+		Where(textSearchVector+" @@ "+tsQuery, tsQueryArgs...).
+		OrderBy("rank DESC")
+
+	if opts.Limit > 0 && opts.Limit < 100000 {
+		queryBuilder = queryBuilder.Limit(uint64(opts.Limit)) //nolint:gosec
+	}
+
+	query, args, err := queryBuilder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL: %w", err)
+	}
+
+	rows, err := pv.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search text with permissions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSearchResults(rows, opts.MinScore, rankScore)
+}
+
+// GetChunks returns the documents stored for a post ordered by chunk index, without checking permissions
+func (pv *PGVector) GetChunks(ctx context.Context, postID string) ([]embeddings.PostDocument, error) {
+	query, args, err := sq.Select(searchColumns...).
+		Column("0 as score").
+		From(pv.table + " e").
+		Where(sq.Eq{"e.post_id": postID}).
+		OrderBy("e.chunk_index").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL: %w", err)
+	}
+
+	rows, err := pv.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunks: %w", err)
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows, 0, func(float32) float32 { return 0 })
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]embeddings.PostDocument, len(results))
+	for i, result := range results {
+		docs[i] = result.Document
+	}
+	return docs, nil
+}
+
+// rankScore maps the unbounded rank of a full text match to a score between 0 and 1
+func rankScore(rank float32) float32 {
+	return rank / (rank + 1)
+}
+
+// scanSearchResults extracts search results from query rows, computing their score from the last column
+func scanSearchResults(rows *sqlx.Rows, minScore float32, toScore func(float32) float32) ([]embeddings.SearchResult, error) {
 	var results []embeddings.SearchResult
 	for rows.Next() {
 		var postID, teamID, channelID, userID, content string
 		var isChunk bool
 		var chunkIndex, totalChunks *int
-		var similarity float32
+		var value float32
 		var createAt int64
 
 		if err := rows.Scan(
@@ -201,16 +382,12 @@ func scanSearchResults(rows *sqlx.Rows, minScore float32) ([]embeddings.SearchRe
 			&isChunk,
 			&chunkIndex,
 			&totalChunks,
-			&similarity,
+			&value,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		score := 1 - similarity
-		if score < 0 {
-			score = 0
-		}
-
+		score := toScore(value)
 		if score < minScore {
 			continue
 		}
@@ -247,7 +424,7 @@ func scanSearchResults(rows *sqlx.Rows, minScore float32) ([]embeddings.SearchRe
 
 func (pv *PGVector) Delete(ctx context.Context, postIDs []string) error {
 	query, args, err := sq.
-		Delete("llm_posts_embeddings").
+		Delete(pv.table).
 		Where(sq.Eq{"post_id": postIDs}).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
@@ -262,9 +439,17 @@ func (pv *PGVector) Delete(ctx context.Context, postIDs []string) error {
 }
 
 func (pv *PGVector) Clear(ctx context.Context) error {
-	_, err := pv.db.ExecContext(ctx, "TRUNCATE TABLE llm_posts_embeddings")
+	_, err := pv.db.ExecContext(ctx, "TRUNCATE TABLE "+pv.table)
 	if err != nil {
 		return fmt.Errorf("failed to clear vectors: %w", err)
 	}
 	return nil
 }
+
+// DropGeneration removes the table of a generation of the index along with its indexes
+func DropGeneration(ctx context.Context, db *sqlx.DB, generation int) error {
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+embeddingsTable(generation)); err != nil {
+		return fmt.Errorf("failed to drop index generation %d: %w", generation, err)
+	}
+	return nil
+}
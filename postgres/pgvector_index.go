@@ -0,0 +1,358 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Distance metrics
+const (
+	// MetricL2 compares embeddings by Euclidean distance, scored 1 / (1 + distance) so that identical embeddings
+	// score 1 and distant ones approach 0. Earlier versions scored 1 - distance, a minimum score s chosen for it
+	// is 1 / (2 - s) now.
+	MetricL2 = "l2"
+	// MetricCosine compares embeddings by the angle between them, scored 1 - distance / 2 so that
+	// identical directions score 1 and opposite ones 0.
+	MetricCosine = "cosine"
+	// MetricInnerProduct compares embeddings by inner product, scored (1 + product) / 2 clamped to 0–1.
+	// Only meaningful for normalized embeddings, for which it ranks like cosine but is faster.
+	MetricInnerProduct = "inner_product"
+)
+
+// Index types
+const (
+	IndexTypeHNSW    = "hnsw"
+	IndexTypeIVFFlat = "ivfflat"
+)
+
+const (
+	// defaultIVFFlatLists is the number of lists of IVFFlat indexes when not configured
+	defaultIVFFlatLists = 100
+	// legacyIndexDefinition is the definition of embedding indexes created before definitions were recorded
+	legacyIndexDefinition = "USING hnsw (embedding vector_l2_ops)"
+	// indexLockKey identifies the advisory locks preventing servers of a cluster from building the indexes of a
+	// generation at once, offset by the generation
+	indexLockKey = 7468216303
+	// indexBuildTimeout bounds the background build of the indexes of a table
+	indexBuildTimeout = 6 * time.Hour
+	// indexLockRetryInterval is how often a server waiting for another one to build the indexes checks whether it is done
+	indexLockRetryInterval = 10 * time.Second
+)
+
+// HNSWConfig tunes HNSW indexes, zero values using the pgvector defaults.
+type HNSWConfig struct {
+	// M is the maximum number of connections per layer
+	M int `json:"m"`
+	// EfConstruction is the size of the candidate list when building the index
+	EfConstruction int `json:"efConstruction"`
+	// EfSearch is the size of the candidate list when searching, higher being slower but more accurate
+	EfSearch int `json:"efSearch"`
+}
+
+// IVFFlatConfig tunes IVFFlat indexes, which build faster and use less memory than HNSW but are less accurate.
+type IVFFlatConfig struct {
+	// Lists is the number of lists the embeddings are clustered in, 100 when zero
+	Lists int `json:"lists"`
+	// Probes is the number of lists searched, higher being slower but more accurate
+	Probes int `json:"probes"`
+}
+
+type metric struct {
+	operator string
+	opsClass string
+	// score maps the value of the operator to a score between 0 and 1, higher being closer
+	score func(float32) float32
+}
+
+var metrics = map[string]metric{
+	MetricL2: {
+		operator: "<->",
+		opsClass: "vector_l2_ops",
+		score: func(distance float32) float32 {
+			return 1 / (1 + distance)
+		},
+	},
+	MetricCosine: {
+		operator: "<=>",
+		opsClass: "vector_cosine_ops",
+		score: func(distance float32) float32 {
+			return clampScore(1 - distance/2)
+		},
+	},
+	MetricInnerProduct: {
+		// The operator returns the negative inner product so that smaller values are closer.
+		operator: "<#>",
+		opsClass: "vector_ip_ops",
+		score: func(negativeProduct float32) float32 {
+			return clampScore((1 - negativeProduct) / 2)
+		},
+	},
+}
+
+// embeddingIndexName returns the name of the similarity search index of an embeddings table
+func embeddingIndexName(table string) string {
+	return table + "_embedding_idx"
+}
+
+// rebuildIndexName returns the name of the index while it is being rebuilt, the previous index serving searches
+func rebuildIndexName(table string) string {
+	return embeddingIndexName(table) + "_rebuild"
+}
+
+// textSearchIndexName returns the name of the full text search index of an embeddings table
+func textSearchIndexName(table string) string {
+	return table + "_content_tsv_idx"
+}
+
+func clampScore(score float32) float32 {
+	return min(max(score, 0), 1)
+}
+
+func (c PGVectorConfig) metric() (metric, error) {
+	name := c.Metric
+	if name == "" {
+		name = MetricL2
+	}
+	m, ok := metrics[name]
+	if !ok {
+		return metric{}, fmt.Errorf("unsupported distance metric: %s", c.Metric)
+	}
+	return m, nil
+}
+
+// indexDefinition returns how the embedding index is built, without its name
+func (c PGVectorConfig) indexDefinition() (string, error) {
+	m, err := c.metric()
+	if err != nil {
+		return "", err
+	}
+
+	var params []string
+	switch c.IndexType {
+	case "", IndexTypeHNSW:
+		if c.HNSW.M > 0 {
+			params = append(params, fmt.Sprintf("m = %d", c.HNSW.M))
+		}
+		if c.HNSW.EfConstruction > 0 {
+			params = append(params, fmt.Sprintf("ef_construction = %d", c.HNSW.EfConstruction))
+		}
+		definition := "USING hnsw (embedding " + m.opsClass + ")"
+		if len(params) > 0 {
+			definition += " WITH (" + strings.Join(params, ", ") + ")"
+		}
+		return definition, nil
+	case IndexTypeIVFFlat:
+		lists := c.IVFFlat.Lists
+		if lists <= 0 {
+			lists = defaultIVFFlatLists
+		}
+		return fmt.Sprintf("USING ivfflat (embedding %s) WITH (lists = %d)", m.opsClass, lists), nil
+	}
+
+	return "", fmt.Errorf("unsupported index type: %s", c.IndexType)
+}
+
+// searchSettings returns the statements tuning searches of the configured index
+func (c PGVectorConfig) searchSettings() []string {
+	var settings []string
+	switch c.IndexType {
+	case "", IndexTypeHNSW:
+		if c.HNSW.EfSearch > 0 {
+			settings = append(settings, fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", c.HNSW.EfSearch))
+		}
+	case IndexTypeIVFFlat:
+		if c.IVFFlat.Probes > 0 {
+			settings = append(settings, fmt.Sprintf("SET LOCAL ivfflat.probes = %d", c.IVFFlat.Probes))
+		}
+	}
+	return settings
+}
+
+// ensureEmbeddingIndex creates the embedding index, rebuilding it when its definition changed. It must run
+// holding the index lock. The definition is kept as the comment of the index. Indexes created before it was
+// recorded have the original definition, an HNSW index with the L2 metric.
+func ensureEmbeddingIndex(ctx context.Context, conn *sqlx.Conn, table, definition string) error {
+	current, exists, err := currentIndexDefinition(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := createIndexConcurrently(ctx, conn, embeddingIndexName(table), table, definition); err != nil {
+			return err
+		}
+		return commentIndex(ctx, conn, table, definition)
+	}
+	if current == definition {
+		return nil
+	}
+
+	return rebuildEmbeddingIndex(ctx, conn, table, definition)
+}
+
+// rebuildEmbeddingIndex builds the new index next to the current one, which keeps serving searches, and swaps
+// them once it is ready. The current index is left untouched when the build fails.
+func rebuildEmbeddingIndex(ctx context.Context, conn *sqlx.Conn, table, definition string) error {
+	indexName := embeddingIndexName(table)
+	rebuildName := rebuildIndexName(table)
+
+	// A previous rebuild may have been interrupted, leaving an invalid index behind.
+	if _, err := conn.ExecContext(ctx, "DROP INDEX IF EXISTS "+rebuildName); err != nil {
+		return fmt.Errorf("failed to drop interrupted index rebuild: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "CREATE INDEX CONCURRENTLY "+rebuildName+" ON "+table+" "+definition); err != nil {
+		_, _ = conn.ExecContext(context.Background(), "DROP INDEX IF EXISTS "+rebuildName)
+		return fmt.Errorf("failed to rebuild embedding index: %w", err)
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, statement := range []string{
+		"DROP INDEX " + indexName,
+		"ALTER INDEX " + rebuildName + " RENAME TO " + indexName,
+		"COMMENT ON INDEX " + indexName + " IS " + quoteLiteral(definition),
+	} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to swap embedding index: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to swap embedding index: %w", err)
+	}
+	return nil
+}
+
+// buildIndexes builds the indexes too slow to build while the plugin activates. They are built concurrently so
+// that posts keep being indexed meanwhile, by one server of a cluster at a time.
+func (pv *PGVector) buildIndexes() {
+	defer close(pv.indexesBuilt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), indexBuildTimeout)
+	defer cancel()
+
+	pv.indexErr = withIndexLock(ctx, pv.db, pv.config.Generation, func(conn *sqlx.Conn) error {
+		// The expression must match textSearchVector.
+		if err := createIndexConcurrently(ctx, conn, textSearchIndexName(pv.table), pv.table, "USING gin (to_tsvector('simple', content))"); err != nil {
+			return err
+		}
+		return ensureEmbeddingIndex(ctx, conn, pv.table, pv.indexDefinition)
+	})
+	if pv.indexErr != nil && pv.config.Logger != nil {
+		pv.config.Logger.LogError("Failed to build search indexes", "table", pv.table, "error", pv.indexErr)
+	}
+}
+
+// waitForIndexes waits for the indexes built in the background and returns why they failed
+func (pv *PGVector) waitForIndexes() error {
+	<-pv.indexesBuilt
+	return pv.indexErr
+}
+
+// withIndexLock runs fn holding the advisory lock of the indexes of a generation, waiting until the server
+// holding it is done or the context expires.
+func withIndexLock(ctx context.Context, db *sqlx.DB, generation int, fn func(conn *sqlx.Conn) error) error {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	lockKey := indexLockKey + int64(generation)
+	for {
+		var locked bool
+		if err := conn.GetContext(ctx, &locked, "SELECT pg_try_advisory_lock($1)", lockKey); err != nil {
+			return fmt.Errorf("failed to lock indexes: %w", err)
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for another server to build the indexes: %w", ctx.Err())
+		case <-time.After(indexLockRetryInterval):
+		}
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	}()
+
+	return fn(conn)
+}
+
+// createIndexConcurrently creates an index without blocking writes to the table. A build interrupted by a restart
+// leaves an invalid index behind, which is dropped and built again.
+func createIndexConcurrently(ctx context.Context, conn *sqlx.Conn, name, table, definition string) error {
+	var valid bool
+	err := conn.GetContext(ctx, &valid, `
+		SELECT i.indisvalid
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relname = $1 AND n.nspname = current_schema()`, name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("failed to get index %s: %w", name, err)
+	case valid:
+		return nil
+	default:
+		if _, err := conn.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+name); err != nil {
+			return fmt.Errorf("failed to drop interrupted build of index %s: %w", name, err)
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, "CREATE INDEX CONCURRENTLY IF NOT EXISTS "+name+" ON "+table+" "+definition); err != nil {
+		return fmt.Errorf("failed to create index %s: %w", name, err)
+	}
+	return nil
+}
+
+// currentIndexDefinition returns the definition recorded for the embedding index and whether it exists. An index
+// left invalid by an interrupted build doesn't count as existing.
+func currentIndexDefinition(ctx context.Context, conn *sqlx.Conn, table string) (string, bool, error) {
+	var definition sql.NullString
+	err := conn.GetContext(ctx, &definition, `
+		SELECT obj_description(c.oid, 'pg_class')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_index i ON i.indexrelid = c.oid
+		WHERE c.relname = $1 AND n.nspname = current_schema() AND i.indisvalid`, embeddingIndexName(table))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get embedding index: %w", err)
+	}
+	if !definition.Valid {
+		return legacyIndexDefinition, true, nil
+	}
+	return definition.String, true, nil
+}
+
+func commentIndex(ctx context.Context, conn *sqlx.Conn, table, definition string) error {
+	if _, err := conn.ExecContext(ctx, "COMMENT ON INDEX "+embeddingIndexName(table)+" IS "+quoteLiteral(definition)); err != nil {
+		return fmt.Errorf("failed to record embedding index definition: %w", err)
+	}
+	return nil
+}
+
+// quoteLiteral quotes a string for statements that don't accept parameters
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
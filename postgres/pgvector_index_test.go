@@ -0,0 +1,135 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexDefinition(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     PGVectorConfig
+		definition string
+		settings   []string
+	}{
+		{
+			name:       "defaults match indexes created before definitions were recorded",
+			config:     PGVectorConfig{},
+			definition: legacyIndexDefinition,
+		},
+		{
+			name:       "tuned HNSW with cosine distance",
+			config:     PGVectorConfig{Metric: MetricCosine, HNSW: HNSWConfig{M: 32, EfConstruction: 128, EfSearch: 100}},
+			definition: "USING hnsw (embedding vector_cosine_ops) WITH (m = 32, ef_construction = 128)",
+			settings:   []string{"SET LOCAL hnsw.ef_search = 100"},
+		},
+		{
+			name:       "IVFFlat with inner product",
+			config:     PGVectorConfig{Metric: MetricInnerProduct, IndexType: IndexTypeIVFFlat, IVFFlat: IVFFlatConfig{Probes: 10}},
+			definition: "USING ivfflat (embedding vector_ip_ops) WITH (lists = 100)",
+			settings:   []string{"SET LOCAL ivfflat.probes = 10"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			definition, err := test.config.indexDefinition()
+			require.NoError(t, err)
+			assert.Equal(t, test.definition, definition)
+			assert.Equal(t, test.settings, test.config.searchSettings())
+		})
+	}
+
+	_, err := PGVectorConfig{Metric: "manhattan"}.indexDefinition()
+	require.Error(t, err)
+	_, err = PGVectorConfig{IndexType: "diskann"}.indexDefinition()
+	require.Error(t, err)
+}
+
+func TestMetricScores(t *testing.T) {
+	score := func(name string, value float32) float32 {
+		return metrics[name].score(value)
+	}
+
+	assert.Equal(t, float32(1), score(MetricL2, 0))
+	assert.Equal(t, float32(0.5), score(MetricL2, 1))
+	assert.InDelta(t, 0.01, score(MetricL2, 99), 0.0001)
+
+	assert.Equal(t, float32(1), score(MetricCosine, 0))
+	assert.Equal(t, float32(0.5), score(MetricCosine, 1))
+	assert.Equal(t, float32(0), score(MetricCosine, 2))
+
+	// The inner product operator returns the negative product.
+	assert.Equal(t, float32(1), score(MetricInnerProduct, -1))
+	assert.Equal(t, float32(0.5), score(MetricInnerProduct, 0))
+	assert.Equal(t, float32(0), score(MetricInnerProduct, 1))
+	assert.Equal(t, float32(1), score(MetricInnerProduct, -3), "unnormalized embeddings are clamped")
+}
+
+func TestEmbeddingIndexRebuild(t *testing.T) {
+	db := testDB(t)
+	defer cleanupDB(t, db)
+
+	indexDefinition := func() string {
+		var definition string
+		require.NoError(t, db.Get(&definition, "SELECT indexdef FROM pg_indexes WHERE indexname = $1", embeddingIndexName(embeddingsTable(1))))
+		return definition
+	}
+
+	pgVector, err := NewPGVector(db, PGVectorConfig{Dimensions: 3})
+	require.NoError(t, err)
+	require.NoError(t, pgVector.waitForIndexes())
+	assert.Contains(t, indexDefinition(), "vector_l2_ops")
+
+	now := model.GetMillis()
+	addTestPosts(t, db, []string{"post1", "post2"}, []int64{now, now})
+	addTestChannels(t, db, []string{"channel1"}, false)
+	addTestChannelMembers(t, db, "channel1", []string{"user1"})
+
+	ctx := context.Background()
+	pgVector, err = NewPGVector(db, PGVectorConfig{Dimensions: 3, Metric: MetricCosine, HNSW: HNSWConfig{M: 8, EfSearch: 50}})
+	require.NoError(t, err)
+	require.NoError(t, pgVector.waitForIndexes())
+	assert.Contains(t, indexDefinition(), "vector_cosine_ops")
+	assert.Contains(t, indexDefinition(), "m='8'")
+
+	docs := []embeddings.PostDocument{
+		{PostID: "post1", CreateAt: now, TeamID: "team1", ChannelID: "channel1", UserID: "user1", Content: "same direction"},
+		{PostID: "post2", CreateAt: now, TeamID: "team1", ChannelID: "channel1", UserID: "user1", Content: "orthogonal"},
+	}
+	require.NoError(t, pgVector.Store(ctx, docs, [][]float32{{2, 0, 0}, {0, 1, 0}}))
+
+	results, err := pgVector.Search(ctx, []float32{1, 0, 0}, embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "post1", results[0].Document.PostID)
+	assert.InDelta(t, 1, results[0].Score, 0.0001)
+	assert.InDelta(t, 0.5, results[1].Score, 0.0001)
+
+	// Switching to IVFFlat rebuilds the index again, keeping the documents.
+	pgVector, err = NewPGVector(db, PGVectorConfig{Dimensions: 3, Metric: MetricInnerProduct, IndexType: IndexTypeIVFFlat, IVFFlat: IVFFlatConfig{Lists: 1}})
+	require.NoError(t, err)
+	require.NoError(t, pgVector.waitForIndexes())
+	assert.Contains(t, indexDefinition(), "ivfflat")
+
+	results, err = pgVector.Search(ctx, []float32{1, 0, 0}, embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, float32(1), results[0].Score, "the product of 2 is clamped")
+	assert.InDelta(t, 0.5, results[1].Score, 0.0001)
+}
+
+func TestEmbeddingsTable(t *testing.T) {
+	assert.Equal(t, "llm_posts_embeddings", embeddingsTable(0))
+	assert.Equal(t, "llm_posts_embeddings", embeddingsTable(1))
+	assert.Equal(t, "llm_posts_embeddings_2", embeddingsTable(2))
+	assert.Equal(t, "llm_posts_embeddings_2_embedding_idx_rebuild", rebuildIndexName(embeddingsTable(2)))
+}
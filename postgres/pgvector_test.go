@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/jmoiron/sqlx"
@@ -892,6 +893,139 @@ func TestSearchWithPermissions(t *testing.T) {
 	})
 }
 
+func TestSearchText(t *testing.T) {
+	setupTextSearchTest := func(t *testing.T) (context.Context, *PGVector, *sqlx.DB) {
+		db := testDB(t)
+
+		pgVector, err := NewPGVector(db, PGVectorConfig{Dimensions: 3})
+		require.NoError(t, err)
+
+		now := model.GetMillis()
+		addTestPosts(t, db, []string{"post1", "post2", "post3"}, []int64{now, now, now})
+		addTestChannels(t, db, []string{"channel1", "channel2"}, false)
+		addTestChannelMembers(t, db, "channel1", []string{"user1"})
+
+		docs := []embeddings.PostDocument{
+			{PostID: "post1", CreateAt: now, TeamID: "team1", ChannelID: "channel1", UserID: "user1", Content: "Deploy to db-01.prod.example.com failed with ERR_4012"},
+			{PostID: "post2", CreateAt: now, TeamID: "team1", ChannelID: "channel1", UserID: "user1", Content: "The database is slow today"},
+			{PostID: "post3", CreateAt: now, TeamID: "team1", ChannelID: "channel2", UserID: "user2", Content: "ERR_4012 again in another channel"},
+		}
+		embedVectors := [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}}
+
+		ctx := context.Background()
+		require.NoError(t, pgVector.Store(ctx, docs, embedVectors))
+		require.NoError(t, pgVector.waitForIndexes())
+
+		return ctx, pgVector, db
+	}
+
+	t.Run("builds the full text index in the background", func(t *testing.T) {
+		_, _, db := setupTextSearchTest(t)
+		defer cleanupDB(t, db)
+
+		var valid bool
+		require.NoError(t, db.Get(&valid, `
+			SELECT i.indisvalid FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+			WHERE c.relname = $1`, textSearchIndexName(embeddingsTable(1))))
+		assert.True(t, valid)
+	})
+
+	t.Run("matches any of the words", func(t *testing.T) {
+		ctx, pgVector, db := setupTextSearchTest(t)
+		defer cleanupDB(t, db)
+
+		results, err := pgVector.SearchText(ctx, "slow deploy", embeddings.SearchOptions{Limit: 10, UserID: "user1"})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+
+		results, err = pgVector.SearchText(ctx, "?!", embeddings.SearchOptions{Limit: 10, UserID: "user1"})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	})
+
+	t.Run("matches exact identifiers", func(t *testing.T) {
+		ctx, pgVector, db := setupTextSearchTest(t)
+		defer cleanupDB(t, db)
+
+		results, err := pgVector.SearchText(ctx, "what does ERR_4012 mean", embeddings.SearchOptions{Limit: 10, UserID: "user1"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "post1", results[0].Document.PostID)
+		assert.Greater(t, results[0].Score, float32(0))
+		assert.Less(t, results[0].Score, float32(1))
+
+		results, err = pgVector.SearchText(ctx, "db-01.prod.example.com", embeddings.SearchOptions{Limit: 10, UserID: "user1"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "post1", results[0].Document.PostID)
+	})
+
+	t.Run("only searches channels the user is a member of", func(t *testing.T) {
+		ctx, pgVector, db := setupTextSearchTest(t)
+		defer cleanupDB(t, db)
+
+		results, err := pgVector.SearchText(ctx, "ERR_4012", embeddings.SearchOptions{Limit: 10, UserID: "user2"})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+
+		_, err = pgVector.SearchText(ctx, "ERR_4012", embeddings.SearchOptions{Limit: 10})
+		require.Error(t, err)
+	})
+}
+
+func TestTextSearchQuery(t *testing.T) {
+	query, args := textSearchQuery("ERR_4012 on  db-01 err_4012")
+	assert.Equal(t, "(plainto_tsquery('simple', ?) || plainto_tsquery('simple', ?) || plainto_tsquery('simple', ?))", query)
+	assert.Equal(t, []any{"err_4012", "on", "db-01"}, args)
+
+	query, args = textSearchQuery("   ")
+	assert.Empty(t, query)
+	assert.Empty(t, args)
+
+	var words []string
+	for i := range 100 {
+		words = append(words, fmt.Sprintf("word%d", i))
+	}
+	_, args = textSearchQuery(strings.Join(words, " "))
+	assert.Len(t, args, maxTextSearchWords)
+}
+
+func TestGetChunks(t *testing.T) {
+	db := testDB(t)
+	defer cleanupDB(t, db)
+
+	pgVector, err := NewPGVector(db, PGVectorConfig{Dimensions: 3})
+	require.NoError(t, err)
+
+	now := model.GetMillis()
+	addTestPosts(t, db, []string{"post1", "post2"}, []int64{now, now})
+
+	chunk := func(postID string, index int) embeddings.PostDocument {
+		return embeddings.PostDocument{
+			PostID:    postID,
+			CreateAt:  now,
+			TeamID:    "team1",
+			ChannelID: "channel1",
+			UserID:    "user1",
+			Content:   fmt.Sprintf("%s chunk %d", postID, index),
+			ChunkInfo: chunking.ChunkInfo{IsChunk: true, ChunkIndex: index, TotalChunks: 3},
+		}
+	}
+	docs := []embeddings.PostDocument{chunk("post1", 2), chunk("post1", 0), chunk("post2", 0), chunk("post1", 1)}
+	embedVectors := [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}, {0.2, 0.3, 0.4}}
+
+	ctx := context.Background()
+	require.NoError(t, pgVector.Store(ctx, docs, embedVectors))
+
+	chunks, err := pgVector.GetChunks(ctx, "post1")
+	require.NoError(t, err)
+	assert.Equal(t, []embeddings.PostDocument{chunk("post1", 0), chunk("post1", 1), chunk("post1", 2)}, chunks)
+
+	chunks, err = pgVector.GetChunks(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
+
 func TestDeleteWithChunks(t *testing.T) {
 	t.Run("deletes both posts and their chunks", func(t *testing.T) {
 		db := testDB(t)
@@ -1082,3 +1216,41 @@ func TestClear(t *testing.T) {
 		assert.Equal(t, 0, count)
 	})
 }
+
+func TestGenerations(t *testing.T) {
+	db := testDB(t)
+	defer cleanupDB(t, db)
+
+	now := model.GetMillis()
+	addTestPosts(t, db, []string{"post1"}, []int64{now})
+	addTestChannels(t, db, []string{"channel1"}, false)
+	addTestChannelMembers(t, db, "channel1", []string{"user1"})
+
+	ctx := context.Background()
+	doc := embeddings.PostDocument{PostID: "post1", CreateAt: now, TeamID: "team1", ChannelID: "channel1", UserID: "user1", Content: "Content 1"}
+
+	first, err := NewPGVector(db, PGVectorConfig{Dimensions: 3})
+	require.NoError(t, err)
+	require.NoError(t, first.Store(ctx, []embeddings.PostDocument{doc}, [][]float32{{0.1, 0.2, 0.3}}))
+
+	// Generations have their own table, so the next one can use other dimensions.
+	second, err := NewPGVector(db, PGVectorConfig{Dimensions: 4, Generation: 2})
+	require.NoError(t, err)
+	results, err := second.Search(ctx, []float32{0.1, 0.2, 0.3, 0.4}, embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	require.NoError(t, second.Store(ctx, []embeddings.PostDocument{doc}, [][]float32{{0.1, 0.2, 0.3, 0.4}}))
+	results, err = second.Search(ctx, []float32{0.1, 0.2, 0.3, 0.4}, embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	require.NoError(t, DropGeneration(ctx, db, 1))
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = 'llm_posts_embeddings'"))
+	assert.Equal(t, 0, count)
+
+	results, err = second.Search(ctx, []float32{0.1, 0.2, 0.3, 0.4}, embeddings.SearchOptions{UserID: "user1"})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+}
@@ -5,22 +5,24 @@ package prompts
 
 // Automatically generated convenience vars for the filenames in prompts/
 const (
-	PromptDirectMessageQuestionSystem      = "direct_message_question_system"
-	PromptEmojiSelectSystem                = "emoji_select_system"
-	PromptFindActionItemsSystem            = "find_action_items_system"
-	PromptFindOpenQuestionsSystem          = "find_open_questions_system"
-	PromptLocale                           = "locale"
-	PromptMeetingSummaryGeneral            = "meeting_summary_general"
-	PromptMeetingSummarySystem             = "meeting_summary_system"
-	PromptMeetingSummaryUser               = "meeting_summary_user"
-	PromptSearchResults                    = "search_results"
-	PromptSearchSystem                     = "search_system"
-	PromptSearchUser                       = "search_user"
-	PromptStandardPersonality              = "standard_personality"
-	PromptStandardPersonalityWithoutLocale = "standard_personality_without_locale"
-	PromptSummarizeChannelRangeSystem      = "summarize_channel_range_system"
-	PromptSummarizeChannelSinceSystem      = "summarize_channel_since_system"
-	PromptSummarizeChunkSystem             = "summarize_chunk_system"
-	PromptSummarizeThreadSystem            = "summarize_thread_system"
-	PromptThreadUser                       = "thread_user"
+	PromptDirectMessageQuestionSystem        = "direct_message_question_system"
+	PromptEmojiSelectSystem                  = "emoji_select_system"
+	PromptFindActionItemsSystem              = "find_action_items_system"
+	PromptFindOpenQuestionsSystem            = "find_open_questions_system"
+	PromptLocale                             = "locale"
+	PromptMeetingSummaryGeneral              = "meeting_summary_general"
+	PromptMeetingSummarySystem               = "meeting_summary_system"
+	PromptMeetingSummaryUser                 = "meeting_summary_user"
+	PromptRerankSystem                       = "rerank_system"
+	PromptSearchResults                      = "search_results"
+	PromptSearchSystem                       = "search_system"
+	PromptSearchUser                         = "search_user"
+	PromptStandardPersonality                = "standard_personality"
+	PromptStandardPersonalityWithoutLocale   = "standard_personality_without_locale"
+	PromptSummarizeChannelRangeSystem        = "summarize_channel_range_system"
+	PromptSummarizeChannelSinceSystem        = "summarize_channel_since_system"
+	PromptSummarizeChunkSystem               = "summarize_chunk_system"
+	PromptSummarizeConversationHistorySystem = "summarize_conversation_history_system"
+	PromptSummarizeThreadSystem              = "summarize_thread_system"
+	PromptThreadUser                         = "thread_user"
 )
@@ -4,6 +4,7 @@
 package react
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -29,7 +30,7 @@ func New(
 	}
 }
 
-func (r *React) Resolve(message string, context *llm.Context) (string, error) {
+func (r *React) Resolve(ctx context.Context, message string, context *llm.Context) (string, error) {
 	context.Parameters = map[string]any{"Message": message}
 
 	// Format prompt for emoji selection
@@ -51,10 +52,15 @@ func (r *React) Resolve(message string, context *llm.Context) (string, error) {
 			},
 		},
 		Context: context,
+		Feature: llm.FeatureReact,
 	}
 
-	// Get emoji from LLM
-	emojiName, err := r.llm.ChatCompletionNoStream(completionRequest, llm.WithMaxGeneratedTokens(25))
+	// Get emoji from LLM. The bot's sampling settings are meant for conversations, pick the most likely emoji instead.
+	emojiName, err := r.llm.ChatCompletionNoStream(ctx, completionRequest,
+		llm.WithMaxGeneratedTokens(25),
+		llm.WithTemperature(0),
+		llm.WithStopSequences(nil),
+	)
 	if err != nil {
 		return "", fmt.Errorf("failed to get emoji from LLM: %w", err)
 	}
@@ -0,0 +1,105 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+)
+
+// CrossEncoder reranks results with a cross-encoder served by a rerank API.
+// Cohere, Jina and OpenAI compatible servers such as vLLM and Infinity share the same /rerank request format.
+type CrossEncoder struct {
+	apiURL     string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+type crossEncoderRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+}
+
+type crossEncoderResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float32 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+// NewCrossEncoder creates a reranker calling the rerank endpoint under apiURL.
+func NewCrossEncoder(apiURL, apiKey, model string, httpClient *http.Client) *CrossEncoder {
+	return &CrossEncoder{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: httpClient,
+	}
+}
+
+// Rerank scores every result against the query, the score of the results being the relevance score of the API.
+func (c *CrossEncoder) Rerank(ctx context.Context, query string, results []embeddings.SearchResult, opts embeddings.SearchOptions) ([]embeddings.SearchResult, error) {
+	documents := make([]string, len(results))
+	for i, result := range results {
+		documents[i] = result.Document.Content
+	}
+
+	body, err := json.Marshal(crossEncoderRequest{
+		Model:     c.model,
+		Query:     query,
+		Documents: documents,
+		TopN:      opts.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rerank request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+"/rerank", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("rerank request failed with status %d: %s", resp.StatusCode, message)
+	}
+
+	var response crossEncoderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode rerank response: %w", err)
+	}
+
+	reranked := make([]embeddings.SearchResult, 0, len(response.Results))
+	for _, scored := range response.Results {
+		if scored.Index < 0 || scored.Index >= len(results) {
+			return nil, fmt.Errorf("rerank response references unknown document %d", scored.Index)
+		}
+		result := results[scored.Index]
+		result.Score = scored.RelevanceScore
+		reranked = append(reranked, result)
+	}
+	sortByScore(reranked)
+
+	return reranked, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func result(postID, content string, score float32) embeddings.SearchResult {
+	return embeddings.SearchResult{Document: embeddings.PostDocument{PostID: postID, Content: content}, Score: score}
+}
+
+func postIDs(results []embeddings.SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Document.PostID
+	}
+	return ids
+}
+
+func TestCrossEncoderRerank(t *testing.T) {
+	candidates := []embeddings.SearchResult{
+		result("a", "The deploy is on Friday", 0.9),
+		result("b", "ERR_4012 means the token expired", 0.8),
+		result("c", "Lunch is at noon", 0.7),
+	}
+
+	t.Run("results are ordered by relevance score", func(t *testing.T) {
+		var request crossEncoderRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/rerank", r.URL.Path)
+			assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			_, _ = w.Write([]byte(`{"results": [{"index": 2, "relevance_score": 0.1}, {"index": 1, "relevance_score": 0.95}]}`))
+		}))
+		defer server.Close()
+
+		reranker := NewCrossEncoder(server.URL+"/v1/", "secret", "rerank-v3.5", server.Client())
+		results, err := reranker.Rerank(context.Background(), "what is ERR_4012", candidates, embeddings.SearchOptions{Limit: 2})
+		require.NoError(t, err)
+
+		assert.Equal(t, crossEncoderRequest{
+			Model:     "rerank-v3.5",
+			Query:     "what is ERR_4012",
+			Documents: []string{"The deploy is on Friday", "ERR_4012 means the token expired", "Lunch is at noon"},
+			TopN:      2,
+		}, request)
+		assert.Equal(t, []string{"b", "c"}, postIDs(results))
+		assert.Equal(t, float32(0.95), results[0].Score)
+	})
+
+	t.Run("API errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "invalid model", http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		reranker := NewCrossEncoder(server.URL, "", "unknown", server.Client())
+		_, err := reranker.Rerank(context.Background(), "query", candidates, embeddings.SearchOptions{})
+		require.ErrorContains(t, err, "invalid model")
+	})
+
+	t.Run("unknown documents in the response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"results": [{"index": 3, "relevance_score": 0.5}]}`))
+		}))
+		defer server.Close()
+
+		reranker := NewCrossEncoder(server.URL, "", "", server.Client())
+		_, err := reranker.Rerank(context.Background(), "query", candidates, embeddings.SearchOptions{})
+		require.Error(t, err)
+	})
+}
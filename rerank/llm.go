@@ -0,0 +1,122 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost-plugin-ai/prompts"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// maxLLMScore is the highest score the language model gives a result.
+const maxLLMScore = 10
+
+// LLM reranks results by asking a language model to score them.
+type LLM struct {
+	prompts *llm.Prompts
+	// model returns the language model of the bot scoring the results, nil keeping the retrieval order
+	model func(botID string) llm.LanguageModel
+}
+
+type llmScores struct {
+	Scores []llmScore `json:"scores"`
+}
+
+type llmScore struct {
+	ID    int `json:"id"`
+	Score int `json:"score"`
+}
+
+// NewLLM creates a reranker scoring results with the language model model returns for the bot of the search, looked
+// up on each search so that it follows configuration changes.
+func NewLLM(prompts *llm.Prompts, model func(botID string) llm.LanguageModel) *LLM {
+	return &LLM{
+		prompts: prompts,
+		model:   model,
+	}
+}
+
+// Rerank scores every result against the query, results scoring 0 to 10 and keeping a score between 0 and 1.
+// Results the model did not score are ranked last. The request is made for the user of the search, so that it is
+// recorded and counted towards the token limits of the user and team.
+func (l *LLM) Rerank(ctx context.Context, query string, results []embeddings.SearchResult, opts embeddings.SearchOptions) ([]embeddings.SearchResult, error) {
+	languageModel := l.model(opts.BotID)
+	if languageModel == nil {
+		return results, nil
+	}
+
+	promptCtx := llm.NewContext()
+	if opts.UserID != "" {
+		promptCtx.RequestingUser = &model.User{Id: opts.UserID}
+	}
+	if opts.TeamID != "" {
+		promptCtx.Team = &model.Team{Id: opts.TeamID}
+	}
+	promptCtx.Parameters = map[string]interface{}{
+		"Results": results,
+	}
+	systemMessage, err := l.prompts.Format(prompts.PromptRerankSystem, promptCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format rerank prompt: %w", err)
+	}
+
+	request := llm.CompletionRequest{
+		Posts: []llm.Post{
+			{Role: llm.PostRoleSystem, Message: systemMessage},
+			{Role: llm.PostRoleUser, Message: query},
+		},
+		Context: promptCtx,
+		Feature: llm.FeatureSearch,
+	}
+
+	output, err := languageModel.ChatCompletionNoStream(ctx, request,
+		llm.WithJSONOutput[llmScores](),
+		llm.WithTemperature(0),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to score search results: %w", err)
+	}
+
+	scores, err := parseLLMScores(output, len(results))
+	if err != nil {
+		return nil, err
+	}
+
+	reranked := make([]embeddings.SearchResult, len(results))
+	for i, result := range results {
+		result.Score = float32(scores[i]) / maxLLMScore
+		reranked[i] = result
+	}
+	sortByScore(reranked)
+
+	return reranked, nil
+}
+
+// parseLLMScores returns the score of each of the count results, 0 for results the model did not score.
+func parseLLMScores(output string, count int) ([]int, error) {
+	// Models without structured output support tend to wrap JSON in a code block.
+	output = strings.TrimSpace(output)
+	output = strings.TrimPrefix(output, "```json")
+	output = strings.Trim(output, "`\n ")
+
+	var parsed llmScores
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse search result scores: %w", err)
+	}
+
+	scores := make([]int, count)
+	for _, score := range parsed.Scores {
+		if score.ID < 0 || score.ID >= count {
+			continue
+		}
+		scores[score.ID] = min(max(score.Score, 0), maxLLMScore)
+	}
+	return scores, nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package rerank
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost-plugin-ai/llm/mocks"
+	"github.com/mattermost/mattermost-plugin-ai/prompts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMRerank(t *testing.T) {
+	llmPrompts, err := llm.NewPrompts(prompts.PromptsFolder)
+	require.NoError(t, err)
+
+	candidates := []embeddings.SearchResult{
+		result("a", "The deploy is on Friday", 0.9),
+		result("b", "ERR_4012 means the token expired", 0.8),
+		result("c", "Lunch is at noon", 0.7),
+	}
+
+	withModel := func(model llm.LanguageModel) *LLM {
+		return NewLLM(llmPrompts, func(botID string) llm.LanguageModel { return model })
+	}
+
+	t.Run("results are ordered by the scores of the model", func(t *testing.T) {
+		model := mocks.NewMockLanguageModel(t)
+		model.On("ChatCompletionNoStream", mock.Anything, mock.MatchedBy(func(request llm.CompletionRequest) bool {
+			return assert.Contains(t, request.Posts[0].Message, `<message id="1">`+"\nERR_4012 means the token expired\n</message>") &&
+				assert.Equal(t, "what is ERR_4012", request.Posts[1].Message)
+		}), mock.Anything).Return(`{"scores": [{"id": 0, "score": 2}, {"id": 1, "score": 9}, {"id": 2, "score": 0}]}`, nil)
+
+		results, err := withModel(model).Rerank(context.Background(), "what is ERR_4012", candidates, embeddings.SearchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "a", "c"}, postIDs(results))
+		assert.InDelta(t, 0.9, results[0].Score, 0.0001)
+	})
+
+	t.Run("scored by the bot of the search for its user", func(t *testing.T) {
+		model := mocks.NewMockLanguageModel(t)
+		model.On("ChatCompletionNoStream", mock.Anything, mock.MatchedBy(func(request llm.CompletionRequest) bool {
+			return request.Context.RequestingUser != nil && request.Context.RequestingUser.Id == "user1" &&
+				request.Context.Team != nil && request.Context.Team.Id == "team1"
+		}), mock.Anything).Return(`{"scores": []}`, nil)
+
+		var botIDs []string
+		reranker := NewLLM(llmPrompts, func(botID string) llm.LanguageModel {
+			botIDs = append(botIDs, botID)
+			return model
+		})
+		_, err := reranker.Rerank(context.Background(), "query", candidates, embeddings.SearchOptions{UserID: "user1", TeamID: "team1", BotID: "bot1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bot1"}, botIDs)
+	})
+
+	t.Run("no model keeps the retrieval order", func(t *testing.T) {
+		results, err := withModel(nil).Rerank(context.Background(), "query", candidates, embeddings.SearchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, candidates, results)
+	})
+
+	t.Run("invalid output", func(t *testing.T) {
+		model := mocks.NewMockLanguageModel(t)
+		model.On("ChatCompletionNoStream", mock.Anything, mock.Anything, mock.Anything).Return("b is the most relevant", nil)
+
+		_, err := withModel(model).Rerank(context.Background(), "query", candidates, embeddings.SearchOptions{})
+		require.Error(t, err)
+	})
+}
+
+func TestParseLLMScores(t *testing.T) {
+	t.Run("missing and unknown results", func(t *testing.T) {
+		scores, err := parseLLMScores(`{"scores": [{"id": 1, "score": 7}, {"id": 5, "score": 10}]}`, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []int{0, 7, 0}, scores)
+	})
+
+	t.Run("scores out of range are clamped", func(t *testing.T) {
+		scores, err := parseLLMScores(`{"scores": [{"id": 0, "score": 12}, {"id": 1, "score": -1}]}`, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []int{10, 0}, scores)
+	})
+
+	t.Run("code block", func(t *testing.T) {
+		scores, err := parseLLMScores("```json\n{\"scores\": [{\"id\": 0, \"score\": 4}]}\n```", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int{4}, scores)
+	})
+}
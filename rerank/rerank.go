@@ -0,0 +1,24 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+// Package rerank implements the rerankers reordering semantic search results by relevance to the query.
+package rerank
+
+import (
+	"slices"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+)
+
+// sortByScore orders results by decreasing score, ties keeping the retrieval order.
+func sortByScore(results []embeddings.SearchResult) {
+	slices.SortStableFunc(results, func(a, b embeddings.SearchResult) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+}
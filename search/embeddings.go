@@ -4,34 +4,62 @@
 package search
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mattermost/mattermost-plugin-ai/bots"
 	"github.com/mattermost/mattermost-plugin-ai/chunking"
 	"github.com/mattermost/mattermost-plugin-ai/embeddings"
 	"github.com/mattermost/mattermost-plugin-ai/enterprise"
+	"github.com/mattermost/mattermost-plugin-ai/flatvector"
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost-plugin-ai/mmapi"
 	"github.com/mattermost/mattermost-plugin-ai/openai"
 	"github.com/mattermost/mattermost-plugin-ai/postgres"
+	"github.com/mattermost/mattermost-plugin-ai/rerank"
 )
 
-// newVectorStore creates a new vector store based on the provided configuration
-func newVectorStore(db *sqlx.DB, config embeddings.UpstreamConfig, dimensions int) (embeddings.VectorStore, error) {
-	switch config.Type { //nolint:gocritic
+// newVectorStore creates the vector store of a generation of the index based on the provided configuration
+func newVectorStore(db *sqlx.DB, config embeddings.UpstreamConfig, dimensions int, generation int, logger embeddings.Logger) (embeddings.VectorStore, error) {
+	switch config.Type {
 	case embeddings.VectorStoreTypePGVector:
 		pgVectorConfig := postgres.PGVectorConfig{
 			Dimensions: dimensions,
 		}
-		if err := json.Unmarshal(config.Parameters, &pgVectorConfig); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal pgvector config: %w", err)
+		if len(config.Parameters) > 0 {
+			if err := json.Unmarshal(config.Parameters, &pgVectorConfig); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal pgvector config: %w", err)
+			}
 		}
+		pgVectorConfig.Generation = generation
+		pgVectorConfig.Logger = logger
 		return postgres.NewPGVector(db, pgVectorConfig)
+	case embeddings.VectorStoreTypeFlat:
+		persistence, err := flatvector.NewTablePersistence(db, generation)
+		if err != nil {
+			return nil, err
+		}
+		return flatvector.New(flatvector.FlatVectorConfig{Dimensions: dimensions}, persistence, flatvector.NewDBChannelAccess(db))
 	}
 
 	return nil, fmt.Errorf("unsupported vector store type: %s", config.Type)
 }
 
+// dropVectorStore removes the storage of a generation of the index
+func dropVectorStore(ctx context.Context, db *sqlx.DB, vectorStoreType string, generation int) error {
+	switch vectorStoreType {
+	case embeddings.VectorStoreTypePGVector:
+		return postgres.DropGeneration(ctx, db, generation)
+	case embeddings.VectorStoreTypeFlat:
+		return flatvector.DropGeneration(ctx, db, generation)
+	}
+
+	return fmt.Errorf("unsupported vector store type: %s", vectorStoreType)
+}
+
 // newEmbeddingProvider creates a new embedding provider based on the provided configuration
 func newEmbeddingProvider(config embeddings.UpstreamConfig, httpClient *http.Client) (embeddings.EmbeddingProvider, error) {
 	switch config.Type {
@@ -52,8 +80,121 @@ func newEmbeddingProvider(config embeddings.UpstreamConfig, httpClient *http.Cli
 	return nil, fmt.Errorf("unsupported embedding provider type: %s", config.Type)
 }
 
+// embeddingModel returns the model the embedding provider is configured with and the dimensions requested from it
+func embeddingModel(config embeddings.UpstreamConfig) (string, int) {
+	var openaiConfig openai.Config
+	if len(config.Parameters) > 0 {
+		_ = json.Unmarshal(config.Parameters, &openaiConfig)
+	}
+	if openaiConfig.EmbeddingModel == "" {
+		return openai.DefaultEmbeddingModel, 0
+	}
+	return openaiConfig.EmbeddingModel, openaiConfig.EmbeddingDimentions
+}
+
+// newReranker creates the reranker of the provided configuration, nil when reranking is disabled
+func newReranker(config embeddings.RerankerConfig, httpClient *http.Client, prompts *llm.Prompts, mmBots *bots.MMBots) (embeddings.Reranker, error) {
+	switch config.Type {
+	case "":
+		return nil, nil
+	case embeddings.RerankerTypeCrossEncoder:
+		if config.APIURL == "" {
+			return nil, fmt.Errorf("the cross-encoder reranker requires an API URL")
+		}
+		return rerank.NewCrossEncoder(config.APIURL, config.APIKey, config.Model, httpClient), nil
+	case embeddings.RerankerTypeLLM:
+		return rerank.NewLLM(prompts, rerankModel(mmBots)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported reranker type: %s", config.Type)
+}
+
+// rerankModel returns the language model of the bot a search runs for, or of the default bot when it is not found
+func rerankModel(mmBots *bots.MMBots) func(botID string) llm.LanguageModel {
+	return func(botID string) llm.LanguageModel {
+		if mmBots == nil {
+			return nil
+		}
+		bot := mmBots.GetBotByID(botID)
+		if bot == nil {
+			bot = mmBots.GetDefaultBot()
+		}
+		if bot == nil {
+			return nil
+		}
+		return bot.LLM()
+	}
+}
+
+// generationBackend opens the search of each generation of the index. The embedding model, vector store and
+// dimensions come from the configuration the generation was built with, the credentials of the embedding provider
+// and the search settings from the current one.
+type generationBackend struct {
+	db         *sqlx.DB
+	httpClient *http.Client
+	cfg        embeddings.EmbeddingSearchConfig
+	prompts    *llm.Prompts
+	bots       *bots.MMBots
+	logger     embeddings.Logger
+}
+
+func (b *generationBackend) Open(generation embeddings.Generation, config embeddings.GenerationConfig) (embeddings.EmbeddingSearch, error) {
+	vectorStoreConfig := b.cfg.VectorStore
+	if vectorStoreConfig.Type != config.VectorStore {
+		// The settings of the configured vector store don't apply to the one the generation was built with.
+		vectorStoreConfig = embeddings.UpstreamConfig{Type: config.VectorStore}
+	}
+	vector, err := newVectorStore(b.db, vectorStoreConfig, config.Dimensions, generation.ID, b.logger)
+	if err != nil {
+		return nil, err
+	}
+	embeddor, err := b.embeddingProvider(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if we have specific chunking options configured
+	chunkingOpts := b.cfg.ChunkingOptions
+	if chunkingOpts.ChunkSize == 0 {
+		chunkingOpts = chunking.DefaultOptions()
+	}
+
+	compositeSearch := embeddings.NewCompositeSearch(vector, embeddor, chunkingOpts)
+	compositeSearch.SetHybridConfig(b.cfg.Hybrid)
+
+	reranker, err := newReranker(b.cfg.Reranker, b.httpClient, b.prompts, b.bots)
+	if err != nil {
+		return nil, err
+	}
+	compositeSearch.SetReranker(reranker, b.cfg.Reranker.Candidates)
+	compositeSearch.SetLogger(b.logger)
+	return compositeSearch, nil
+}
+
+// embeddingProvider creates the embedding provider of a generation, requesting its model from the configured provider
+func (b *generationBackend) embeddingProvider(config embeddings.GenerationConfig) (embeddings.EmbeddingProvider, error) {
+	var openaiConfig openai.Config
+	if len(b.cfg.EmbeddingProvider.Parameters) > 0 {
+		if err := json.Unmarshal(b.cfg.EmbeddingProvider.Parameters, &openaiConfig); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal embedding provider config: %w", err)
+		}
+	}
+	openaiConfig.EmbeddingModel = config.Model
+	openaiConfig.EmbeddingDimentions = config.EmbeddingDimensions
+	parameters, err := json.Marshal(openaiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding provider config: %w", err)
+	}
+
+	return newEmbeddingProvider(embeddings.UpstreamConfig{Type: b.cfg.EmbeddingProvider.Type, Parameters: parameters}, b.httpClient)
+}
+
+func (b *generationBackend) Drop(ctx context.Context, generation embeddings.Generation) error {
+	return dropVectorStore(ctx, b.db, generation.VectorStore, generation.ID)
+}
+
 // InitEmbeddingsSearch creates and initializes the embedding search system
-func InitEmbeddingsSearch(db *sqlx.DB, httpClient *http.Client, cfg embeddings.EmbeddingSearchConfig, licenseChecker *enterprise.LicenseChecker) (embeddings.EmbeddingSearch, error) {
+func InitEmbeddingsSearch(db *sqlx.DB, httpClient *http.Client, cfg embeddings.EmbeddingSearchConfig, licenseChecker *enterprise.LicenseChecker, prompts *llm.Prompts, mmClient mmapi.Client, mmBots *bots.MMBots) (embeddings.EmbeddingSearch, error) {
 	if cfg.Type == "" {
 		return nil, fmt.Errorf("search is disabled")
 	}
@@ -64,22 +205,26 @@ func InitEmbeddingsSearch(db *sqlx.DB, httpClient *http.Client, cfg embeddings.E
 
 	switch cfg.Type { //nolint:gocritic
 	case embeddings.SearchTypeComposite:
-		vector, err := newVectorStore(db, cfg.VectorStore, cfg.Dimensions)
-		if err != nil {
-			return nil, err
+		backend := &generationBackend{
+			db:         db,
+			httpClient: httpClient,
+			cfg:        cfg,
+			prompts:    prompts,
+			bots:       mmBots,
+			logger:     mmClient,
 		}
-		embeddor, err := newEmbeddingProvider(cfg.EmbeddingProvider, httpClient)
+		model, embeddingDimensions := embeddingModel(cfg.EmbeddingProvider)
+		generations, err := embeddings.NewGenerations(backend, mmClient, embeddings.GenerationConfig{
+			Provider:            cfg.EmbeddingProvider.Type,
+			Model:               model,
+			EmbeddingDimensions: embeddingDimensions,
+			VectorStore:         cfg.VectorStore.Type,
+			Dimensions:          cfg.Dimensions,
+		})
 		if err != nil {
 			return nil, err
 		}
-
-		// Check if we have specific chunking options configured
-		chunkingOpts := cfg.ChunkingOptions
-		if chunkingOpts.ChunkSize == 0 {
-			chunkingOpts = chunking.DefaultOptions()
-		}
-
-		return embeddings.NewCompositeSearch(vector, embeddor, chunkingOpts), nil
+		return generations, nil
 	}
 
 	return nil, fmt.Errorf("unsupported search type: %s", cfg.Type)
@@ -0,0 +1,136 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+)
+
+// SetExpansionConfig sets how much context around the matching chunks is given to the language model
+func (s *Search) SetExpansionConfig(config embeddings.ExpansionConfig) {
+	s.expansion = config
+}
+
+// ExpansionConfig returns how search results are expanded
+func (s *Search) ExpansionConfig() embeddings.ExpansionConfig {
+	return s.expansion
+}
+
+// ExpandResults replaces the content of the results with the context of the expansion mode.
+// Results that can't be expanded keep their content.
+func (s *Search) ExpandResults(ctx context.Context, results []embeddings.SearchResult, mode string) []embeddings.SearchResult {
+	if mode == embeddings.ExpansionNone {
+		return results
+	}
+
+	expanded := make([]embeddings.SearchResult, len(results))
+	for i, result := range results {
+		expanded[i] = result
+		doc, err := s.expandDocument(ctx, result.Document, mode)
+		if err != nil {
+			s.mmclient.LogWarn("Failed to expand search result", "error", err, "post_id", result.Document.PostID, "mode", mode)
+			continue
+		}
+		expanded[i].Document = doc
+	}
+	return expanded
+}
+
+func (s *Search) expandDocument(ctx context.Context, doc embeddings.PostDocument, mode string) (embeddings.PostDocument, error) {
+	switch mode {
+	case embeddings.ExpansionNeighbors:
+		return s.withNeighborChunks(ctx, doc)
+	case embeddings.ExpansionPost, embeddings.ExpansionThread:
+		content, err := s.postContent(ctx, doc.PostID)
+		if err != nil {
+			return doc, err
+		}
+		doc.Content = content
+		doc.IsChunk = false
+
+		if mode == embeddings.ExpansionThread {
+			post, err := s.mmclient.GetPost(doc.PostID)
+			if err != nil {
+				return doc, fmt.Errorf("failed to get post: %w", err)
+			}
+			if post.RootId != "" {
+				// The root is read from the index like the post, so that it is redacted by the indexing policy
+				// and left out when the policy excludes it or its author opted out
+				chunks, err := s.getChunks(ctx, post.RootId)
+				if err != nil {
+					return doc, fmt.Errorf("failed to get thread root: %w", err)
+				}
+				if len(chunks) > 0 {
+					doc.Content = fmt.Sprintf("In reply to: %s\n\n%s", joinChunks(chunks), content)
+				}
+			}
+		}
+		return doc, nil
+	}
+
+	return doc, fmt.Errorf("unsupported expansion mode: %s", mode)
+}
+
+// withNeighborChunks adds the stored chunks around the chunk of the document to its content
+func (s *Search) withNeighborChunks(ctx context.Context, doc embeddings.PostDocument) (embeddings.PostDocument, error) {
+	if !doc.IsChunk {
+		return doc, nil
+	}
+
+	chunks, err := s.getChunks(ctx, doc.PostID)
+	if err != nil {
+		return doc, err
+	}
+
+	neighbors := s.expansion.NeighborChunks
+	if neighbors <= 0 {
+		neighbors = 1
+	}
+
+	var contents []string
+	for _, chunk := range chunks {
+		if chunk.ChunkIndex >= doc.ChunkIndex-neighbors && chunk.ChunkIndex <= doc.ChunkIndex+neighbors {
+			contents = append(contents, chunk.Content)
+		}
+	}
+	if len(contents) > 0 {
+		doc.Content = strings.Join(contents, "\n")
+	}
+	return doc, nil
+}
+
+// postContent returns the indexed content of a post, its message followed by the attachments indexed with it.
+// The index holds posts as redacted by the indexing policy, and none of the posts it excludes.
+func (s *Search) postContent(ctx context.Context, postID string) (string, error) {
+	chunks, err := s.getChunks(ctx, postID)
+	if err != nil {
+		return "", err
+	}
+	if len(chunks) == 0 {
+		return "", fmt.Errorf("the post is not indexed")
+	}
+	return joinChunks(chunks), nil
+}
+
+// joinChunks returns the content of the chunks of a post, one per line
+func joinChunks(chunks []embeddings.PostDocument) string {
+	contents := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		contents = append(contents, chunk.Content)
+	}
+	return strings.Join(contents, "\n")
+}
+
+// getChunks returns the documents stored for a post ordered by chunk index
+func (s *Search) getChunks(ctx context.Context, postID string) ([]embeddings.PostDocument, error) {
+	getter, ok := s.EmbeddingSearch.(embeddings.ChunkGetter)
+	if !ok {
+		return nil, fmt.Errorf("the search does not support getting the chunks of a post")
+	}
+	return getter.GetChunks(ctx, postID)
+}
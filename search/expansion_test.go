@@ -0,0 +1,134 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/chunking"
+	"github.com/mattermost/mattermost-plugin-ai/embeddings"
+	embeddingsmocks "github.com/mattermost/mattermost-plugin-ai/embeddings/mocks"
+	"github.com/mattermost/mattermost-plugin-ai/mmapi/mocks"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// chunkSearch is an embedding search that can return the chunks of a post.
+type chunkSearch struct {
+	*embeddingsmocks.MockEmbeddingSearch
+	chunks map[string][]embeddings.PostDocument
+}
+
+func (c chunkSearch) GetChunks(ctx context.Context, postID string) ([]embeddings.PostDocument, error) {
+	return c.chunks[postID], nil
+}
+
+func chunkResult(postID, content string, index int) embeddings.SearchResult {
+	return embeddings.SearchResult{
+		Document: embeddings.PostDocument{
+			PostID:    postID,
+			Content:   content,
+			ChunkInfo: chunking.ChunkInfo{IsChunk: true, ChunkIndex: index, TotalChunks: 4},
+		},
+		Score: 0.8,
+	}
+}
+
+func TestExpandResults(t *testing.T) {
+	results := []embeddings.SearchResult{chunkResult("reply", "second part", 1)}
+
+	t.Run("no expansion", func(t *testing.T) {
+		s := New(embeddingsmocks.NewMockEmbeddingSearch(t), mocks.NewMockClient(t), nil, nil, nil)
+		assert.Equal(t, results, s.ExpandResults(context.Background(), results, embeddings.ExpansionNone))
+	})
+
+	t.Run("neighboring chunks", func(t *testing.T) {
+		search := chunkSearch{
+			MockEmbeddingSearch: embeddingsmocks.NewMockEmbeddingSearch(t),
+			chunks: map[string][]embeddings.PostDocument{
+				"reply": {
+					chunkResult("reply", "first part", 0).Document,
+					chunkResult("reply", "second part", 1).Document,
+					chunkResult("reply", "third part", 2).Document,
+					chunkResult("reply", "fourth part", 3).Document,
+				},
+			},
+		}
+		s := New(search, mocks.NewMockClient(t), nil, nil, nil)
+
+		expanded := s.ExpandResults(context.Background(), results, embeddings.ExpansionNeighbors)
+		assert.Equal(t, "first part\nsecond part\nthird part", expanded[0].Document.Content)
+		assert.Equal(t, "second part", results[0].Document.Content, "results are not modified")
+
+		s.SetExpansionConfig(embeddings.ExpansionConfig{NeighborChunks: 2})
+		expanded = s.ExpandResults(context.Background(), results, embeddings.ExpansionNeighbors)
+		assert.Equal(t, "first part\nsecond part\nthird part\nfourth part", expanded[0].Document.Content)
+	})
+
+	postSearch := func(t *testing.T) chunkSearch {
+		return chunkSearch{
+			MockEmbeddingSearch: embeddingsmocks.NewMockEmbeddingSearch(t),
+			chunks: map[string][]embeddings.PostDocument{
+				"reply": {
+					chunkResult("reply", "first part", 0).Document,
+					chunkResult("reply", "second part", 1).Document,
+					chunkResult("reply", "report.pdf\nQuarterly numbers", 2).Document,
+				},
+			},
+		}
+	}
+
+	t.Run("full post", func(t *testing.T) {
+		s := New(postSearch(t), mocks.NewMockClient(t), nil, nil, nil)
+
+		expanded := s.ExpandResults(context.Background(), results, embeddings.ExpansionPost)
+		assert.Equal(t, "first part\nsecond part\nreport.pdf\nQuarterly numbers", expanded[0].Document.Content)
+		assert.False(t, expanded[0].Document.IsChunk)
+		assert.Equal(t, float32(0.8), expanded[0].Score)
+	})
+
+	t.Run("full post of an attachment match keeps the attachment", func(t *testing.T) {
+		s := New(postSearch(t), mocks.NewMockClient(t), nil, nil, nil)
+
+		attachmentResults := []embeddings.SearchResult{chunkResult("reply", "report.pdf\nQuarterly numbers", 2)}
+		expanded := s.ExpandResults(context.Background(), attachmentResults, embeddings.ExpansionPost)
+		assert.Contains(t, expanded[0].Document.Content, "Quarterly numbers")
+	})
+
+	t.Run("thread root context", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		client.On("GetPost", "reply").Return(&model.Post{Id: "reply", RootId: "root", Message: "first part second part"}, nil)
+		search := postSearch(t)
+		search.chunks["root"] = []embeddings.PostDocument{{PostID: "root", Content: "Why is the build failing? The token is [REDACTED]"}}
+		s := New(search, client, nil, nil, nil)
+
+		expanded := s.ExpandResults(context.Background(), results, embeddings.ExpansionThread)
+		assert.Equal(t, "In reply to: Why is the build failing? The token is [REDACTED]\n\nfirst part\nsecond part\nreport.pdf\nQuarterly numbers", expanded[0].Document.Content)
+	})
+
+	t.Run("thread roots excluded from the index are left out", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		client.On("GetPost", "reply").Return(&model.Post{Id: "reply", RootId: "root", Message: "first part second part"}, nil)
+		s := New(postSearch(t), client, nil, nil, nil)
+
+		expanded := s.ExpandResults(context.Background(), results, embeddings.ExpansionThread)
+		assert.Equal(t, "first part\nsecond part\nreport.pdf\nQuarterly numbers", expanded[0].Document.Content)
+	})
+
+	t.Run("results that can't be expanded keep their content", func(t *testing.T) {
+		client := mocks.NewMockClient(t)
+		client.On("GetPost", "reply").Return(nil, errors.New("not found"))
+		client.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		s := New(postSearch(t), client, nil, nil, nil)
+
+		assert.Equal(t, results, s.ExpandResults(context.Background(), results, embeddings.ExpansionThread))
+
+		// Posts that are no longer indexed
+		s = New(chunkSearch{MockEmbeddingSearch: embeddingsmocks.NewMockEmbeddingSearch(t)}, client, nil, nil, nil)
+		assert.Equal(t, results, s.ExpandResults(context.Background(), results, embeddings.ExpansionPost))
+	})
+}
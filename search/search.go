@@ -28,6 +28,7 @@ type Request struct {
 	TeamID     string `json:"teamId"`
 	ChannelID  string `json:"channelId"`
 	MaxResults int    `json:"maxResults"`
+	Mode       string `json:"mode"`
 }
 
 // Response represents a response to a search query
@@ -55,6 +56,7 @@ type Search struct {
 	prompts          *llm.Prompts
 	streamingService streaming.Service
 	licenseChecker   *enterprise.LicenseChecker
+	expansion        embeddings.ExpansionConfig
 }
 
 func New(
@@ -134,8 +136,10 @@ func (s *Search) convertToRAGResults(searchResults []embeddings.SearchResult) []
 	return ragResults
 }
 
-// RunSearch initiates a search and sends results to a DM
-func (s *Search) RunSearch(ctx context.Context, userID string, bot *bots.Bot, query, teamID, channelID string, maxResults int) (map[string]string, error) {
+// RunSearch initiates a search and sends results to a DM.
+// The search continues after RunSearch returns, so ctx should outlive the calling request.
+// An empty mode uses the configured search mode.
+func (s *Search) RunSearch(ctx context.Context, userID string, bot *bots.Bot, query, teamID, channelID string, maxResults int, mode string) (map[string]string, error) {
 	if !s.Enabled() {
 		return nil, fmt.Errorf("search functionality is not configured")
 	}
@@ -155,7 +159,7 @@ func (s *Search) RunSearch(ctx context.Context, userID string, bot *bots.Bot, qu
 	}
 
 	// Start processing the search asynchronously
-	go func(query, teamID, channelID string, maxResults int) {
+	go func(query, teamID, channelID string, maxResults int, mode string) {
 		// Create response post as a reply
 		responsePost := &model.Post{
 			RootId: questionPost.Id,
@@ -184,17 +188,20 @@ func (s *Search) RunSearch(ctx context.Context, userID string, bot *bots.Bot, qu
 			maxResults = 5
 		}
 
-		searchResults, err := s.Search(context.Background(), query, embeddings.SearchOptions{
+		searchResults, err := s.Search(ctx, query, embeddings.SearchOptions{
 			Limit:     maxResults,
 			TeamID:    teamID,
 			ChannelID: channelID,
 			UserID:    userID,
+			BotID:     bot.GetMMBot().UserId,
+			Mode:      mode,
 		})
 		if err != nil {
 			s.mmclient.LogError("Error performing search", "error", err)
 			processingError = err
 			return
 		}
+		searchResults = s.ExpandResults(ctx, searchResults, s.expansion.Answers)
 
 		ragResults := s.convertToRAGResults(searchResults)
 		if len(ragResults) == 0 {
@@ -231,9 +238,10 @@ func (s *Search) RunSearch(ctx context.Context, userID string, bot *bots.Bot, qu
 				},
 			},
 			Context: promptCtx,
+			Feature: llm.FeatureSearch,
 		}
 
-		resultStream, err := bot.LLM().ChatCompletion(prompt)
+		resultStream, err := bot.LLM().ChatCompletion(ctx, prompt)
 		if err != nil {
 			s.mmclient.LogError("Error generating answer", "error", err)
 			processingError = err
@@ -255,7 +263,7 @@ func (s *Search) RunSearch(ctx context.Context, userID string, bot *bots.Bot, qu
 			return
 		}
 
-		streamContext, err := s.streamingService.GetStreamingContext(context.Background(), responsePost.Id)
+		streamContext, err := s.streamingService.GetStreamingContext(ctx, responsePost.Id)
 		if err != nil {
 			s.mmclient.LogError("Error getting post streaming context", "error", err)
 			processingError = err
@@ -263,7 +271,7 @@ func (s *Search) RunSearch(ctx context.Context, userID string, bot *bots.Bot, qu
 		}
 		defer s.streamingService.FinishStreaming(responsePost.Id)
 		s.streamingService.StreamToPost(streamContext, resultStream, responsePost, "")
-	}(query, teamID, channelID, maxResults)
+	}(query, teamID, channelID, maxResults, mode)
 
 	return map[string]string{
 		"postid":    questionPost.Id,
@@ -271,8 +279,8 @@ func (s *Search) RunSearch(ctx context.Context, userID string, bot *bots.Bot, qu
 	}, nil
 }
 
-// SearchQuery performs a search and returns results immediately
-func (s *Search) SearchQuery(ctx context.Context, userID string, bot *bots.Bot, query, teamID, channelID string, maxResults int) (Response, error) {
+// SearchQuery performs a search and returns results immediately. An empty mode uses the configured search mode.
+func (s *Search) SearchQuery(ctx context.Context, userID string, bot *bots.Bot, query, teamID, channelID string, maxResults int, mode string) (Response, error) {
 	if !s.Enabled() {
 		return Response{}, fmt.Errorf("search functionality is not configured")
 	}
@@ -287,10 +295,13 @@ func (s *Search) SearchQuery(ctx context.Context, userID string, bot *bots.Bot,
 		TeamID:    teamID,
 		ChannelID: channelID,
 		UserID:    userID,
+		BotID:     bot.GetMMBot().UserId,
+		Mode:      mode,
 	})
 	if err != nil {
 		return Response{}, fmt.Errorf("search failed: %w", err)
 	}
+	searchResults = s.ExpandResults(ctx, searchResults, s.expansion.Answers)
 
 	ragResults := s.convertToRAGResults(searchResults)
 	if len(ragResults) == 0 {
@@ -323,9 +334,10 @@ func (s *Search) SearchQuery(ctx context.Context, userID string, bot *bots.Bot,
 			},
 		},
 		Context: promptCtx,
+		Feature: llm.FeatureSearch,
 	}
 
-	answer, err := bot.LLM().ChatCompletionNoStream(prompt)
+	answer, err := bot.LLM().ChatCompletionNoStream(ctx, prompt)
 	if err != nil {
 		return Response{}, fmt.Errorf("failed to generate answer: %w", err)
 	}
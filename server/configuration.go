@@ -4,9 +4,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/mattermost/mattermost-plugin-ai/config"
+	"github.com/mattermost/mattermost-plugin-ai/indexer"
+	"github.com/mattermost/mattermost/server/public/model"
 )
 
 // configuration captures the plugin's external configuration as exposed in the Mattermost server
@@ -47,3 +50,32 @@ func (p *Plugin) OnConfigurationChange() error {
 
 	return nil
 }
+
+// ConfigurationWillBeSaved rejects configurations enabling features the models of a bot are known not to support,
+// so that the admin sees the problem when saving rather than the bot silently failing.
+func (p *Plugin) ConfigurationWillBeSaved(newCfg *model.Config) (*model.Config, error) {
+	if p.bots == nil {
+		return nil, nil
+	}
+	settings, ok := newCfg.PluginSettings.Plugins[manifest.Id]
+	if !ok {
+		return nil, nil
+	}
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal plugin settings: %w", err)
+	}
+	var newConfiguration configuration
+	if err := json.Unmarshal(settingsJSON, &newConfiguration); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin settings: %w", err)
+	}
+
+	if err := p.bots.ValidateBotConfigs(newConfiguration.Bots, newConfiguration.ModelCapabilities); err != nil {
+		return nil, fmt.Errorf("agents are configured with unsupported model features: %w", err)
+	}
+	if err := indexer.ValidatePolicy(newConfiguration.EmbeddingSearchConfig.IndexingPolicy); err != nil {
+		return nil, fmt.Errorf("invalid indexing policy: %w", err)
+	}
+	return nil, nil
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/mattermost/mattermost-plugin-ai/api"
@@ -28,6 +29,7 @@ import (
 	"github.com/mattermost/mattermost-plugin-ai/prompts"
 	"github.com/mattermost/mattermost-plugin-ai/search"
 	"github.com/mattermost/mattermost-plugin-ai/streaming"
+	"github.com/mattermost/mattermost-plugin-ai/usage"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/mattermost/mattermost/server/public/pluginapi"
@@ -44,13 +46,20 @@ type Plugin struct {
 	configuration config.Container
 
 	pluginAPI            *pluginapi.Client
+	bots                 *bots.MMBots
 	apiService           *api.API
 	indexerService       *indexer.Indexer
 	conversationsService *conversations.Conversations
 	mcpClientManager     *mcp.ClientManager
+
+	// ctx is cancelled on deactivation to abort in-flight LLM requests
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func (p *Plugin) OnActivate() error {
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
 	pluginAPI := pluginapi.NewClient(p.API, p.Driver)
 	mmClient := mmapi.NewClient(pluginAPI)
 	licenseChecker := enterprise.NewLicenseChecker(pluginAPI)
@@ -77,7 +86,20 @@ func (p *Plugin) OnActivate() error {
 		p.configuration.Update(&newCfg)
 	}
 
-	bots := bots.New(p.API, pluginAPI, licenseChecker, &p.configuration, llmUpstreamHTTPClient)
+	prompts, promptManagerErr := llm.NewPrompts(prompts.PromptsFolder)
+	if promptManagerErr != nil {
+		pluginAPI.Log.Error("failed to initialize prompts", "error", promptManagerErr)
+		return promptManagerErr
+	}
+
+	bundlePath, err := p.API.GetBundlePath()
+	if err != nil {
+		pluginAPI.Log.Warn("failed to get bundle path, token counts will be estimated", "error", err)
+	} else {
+		llm.SetTokenizerVocabularyDir(filepath.Join(bundlePath, "assets", "tokenizers"))
+	}
+
+	bots := bots.New(p.API, pluginAPI, licenseChecker, &p.configuration, llmUpstreamHTTPClient, usage.NewStore(dbClient, pluginAPI.Log), prompts, metricsService)
 	p.configuration.RegisterUpdateListener(func() {
 		if ensureErr := bots.EnsureBots(p.configuration.GetBots()); ensureErr != nil {
 			pluginAPI.Log.Error("failed to ensure bots on configuration update", "error", ensureErr)
@@ -96,12 +118,6 @@ func (p *Plugin) OnActivate() error {
 		return setupTablesErr
 	}
 
-	prompts, promptManagerErr := llm.NewPrompts(prompts.PromptsFolder)
-	if promptManagerErr != nil {
-		pluginAPI.Log.Error("failed to initialize prompts", "error", promptManagerErr)
-		return promptManagerErr
-	}
-
 	streamingService := streaming.NewMMPostStreamService(mmClient, i18nBundle)
 
 	embeddingsSearch, err := search.InitEmbeddingsSearch(
@@ -109,13 +125,30 @@ func (p *Plugin) OnActivate() error {
 		llmUpstreamHTTPClient,
 		p.configuration.EmbeddingSearchConfig(),
 		licenseChecker,
+		prompts,
+		mmClient,
+		bots,
 	)
 	if err != nil {
 		pluginAPI.Log.Error("failed to initialize search infrastructure", "error", err)
 		// Continue without search functionality
 	}
 
-	indexerService := indexer.New(embeddingsSearch, mmClient, bots, dbClient.DB)
+	indexerService := indexer.New(embeddingsSearch, mmClient, bots, dbClient.DB, p.API)
+	indexerService.SetIndexingConfig(p.configuration.EmbeddingSearchConfig().Indexing)
+	if policyErr := indexerService.SetIndexingPolicy(p.configuration.EmbeddingSearchConfig().IndexingPolicy); policyErr != nil {
+		pluginAPI.Log.Error("invalid indexing policy, posts won't be indexed until it is fixed", "error", policyErr)
+	}
+	p.configuration.RegisterUpdateListener(func() {
+		indexerService.SetIndexingConfig(p.configuration.EmbeddingSearchConfig().Indexing)
+		if policyErr := indexerService.SetIndexingPolicy(p.configuration.EmbeddingSearchConfig().IndexingPolicy); policyErr != nil {
+			pluginAPI.Log.Error("invalid indexing policy, posts won't be indexed until it is fixed", "error", policyErr)
+			return
+		}
+		go indexerService.ApplyIndexingPolicy()
+	})
+	go indexerService.ResumeJob()
+	go indexerService.ApplyIndexingPolicy()
 
 	searchService := search.New(
 		embeddingsSearch,
@@ -124,11 +157,13 @@ func (p *Plugin) OnActivate() error {
 		streamingService,
 		licenseChecker,
 	)
+	searchService.SetExpansionConfig(p.configuration.EmbeddingSearchConfig().Expansion)
 
 	toolProvider := mmtools.NewMMToolProvider(
 		mmClient,
 		searchService,
 		untrustedHTTPClient,
+		bots,
 	)
 
 	// Build redirect URI
@@ -179,7 +214,10 @@ func (p *Plugin) OnActivate() error {
 	// TODO: Refactor to avoid circular dependency
 	conversationsService.SetMeetingsService(meetingsService)
 
+	streamingService.SetPostCompletedHandler(conversationsService.HandleVoiceReply)
+
 	apiService := api.New(
+		p.ctx,
 		bots,
 		conversationsService,
 		meetingsService,
@@ -200,6 +238,7 @@ func (p *Plugin) OnActivate() error {
 
 	// Keep only what we need
 	p.pluginAPI = pluginAPI
+	p.bots = bots
 	p.apiService = apiService
 	p.indexerService = indexerService
 	p.conversationsService = conversationsService
@@ -209,6 +248,11 @@ func (p *Plugin) OnActivate() error {
 }
 
 func (p *Plugin) OnDeactivate() error {
+	// Abort any in-flight LLM requests
+	if p.cancel != nil {
+		p.cancel()
+	}
+
 	// Clean up MCP client manager if it exists
 	p.mcpClientManager.Close()
 	return nil
@@ -228,7 +272,7 @@ func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
 		}
 	}
 
-	p.conversationsService.MessageHasBeenPosted(c, post)
+	p.conversationsService.MessageHasBeenPosted(p.ctx, post)
 }
 
 func (p *Plugin) MessageHasBeenUpdated(c *plugin.Context, newPost, oldPost *model.Post) {
@@ -249,6 +293,15 @@ func (p *Plugin) MessageHasBeenUpdated(c *plugin.Context, newPost, oldPost *mode
 				p.pluginAPI.Log.Error("Failed to index updated post in vector database", "error", err)
 			}
 		}
+
+		// Replies embed the message of the root post, so they are indexed again in the background when it changes
+		if newPost.RootId == "" && newPost.Message != oldPost.Message {
+			go func() {
+				if err := p.indexerService.IndexReplies(context.Background(), newPost); err != nil {
+					p.pluginAPI.Log.Error("Failed to index the replies of an updated post in vector database", "error", err)
+				}
+			}()
+		}
 	}
 }
 
@@ -22,6 +22,12 @@ const PostStreamingControlStart = "start"
 
 const ToolCallProp = "pending_tool_call"
 
+// ReasoningProp holds the reasoning the model streamed while generating the post, shown separately from the message.
+const ReasoningProp = "reasoning"
+
+// ReasoningBlocksProp holds the reasoning blocks that must be sent back to the provider along with the post's tool calls.
+const ReasoningBlocksProp = "reasoning_blocks"
+
 type Service interface {
 	StreamToNewPost(ctx context.Context, botID string, requesterUserID string, stream *llm.TextStreamResult, post *model.Post, respondingToPostID string) error
 	StreamToNewDM(ctx context.Context, botID string, stream *llm.TextStreamResult, userID string, post *model.Post, respondingToPostID string) error
@@ -37,11 +43,15 @@ type postStreamContext struct {
 
 var ErrAlreadyStreamingToPost = fmt.Errorf("already streaming to post")
 
+// PostCompletedHandler is called with a post once an answer was fully streamed to it.
+type PostCompletedHandler func(ctx context.Context, post *model.Post)
+
 type MMPostStreamService struct {
-	contexts      map[string]postStreamContext
-	contextsMutex sync.Mutex
-	mmClient      mmapi.Client
-	i18n          *i18n.Bundle
+	contexts             map[string]postStreamContext
+	contextsMutex        sync.Mutex
+	mmClient             mmapi.Client
+	i18n                 *i18n.Bundle
+	postCompletedHandler PostCompletedHandler
 }
 
 func NewMMPostStreamService(mmClient mmapi.Client, i18n *i18n.Bundle) *MMPostStreamService {
@@ -52,6 +62,12 @@ func NewMMPostStreamService(mmClient mmapi.Client, i18n *i18n.Bundle) *MMPostStr
 	}
 }
 
+// SetPostCompletedHandler sets the handler called after a stream ends cleanly, once the post is updated.
+// It must be set before streaming starts.
+func (p *MMPostStreamService) SetPostCompletedHandler(handler PostCompletedHandler) {
+	p.postCompletedHandler = handler
+}
+
 func (p *MMPostStreamService) StreamToNewPost(ctx context.Context, botID string, requesterUserID string, stream *llm.TextStreamResult, post *model.Post, respondingToPostID string) error {
 	// We use ModifyPostForBot directly here to add the responding to post ID
 	ModifyPostForBot(botID, requesterUserID, post, respondingToPostID)
@@ -62,7 +78,7 @@ func (p *MMPostStreamService) StreamToNewPost(ctx context.Context, botID string,
 
 	// The callback is already set when creating the context
 
-	ctx, err := p.GetStreamingContext(context.Background(), post.Id)
+	ctx, err := p.GetStreamingContext(ctx, post.Id)
 	if err != nil {
 		return err
 	}
@@ -104,7 +120,7 @@ func (p *MMPostStreamService) StreamToNewDM(ctx context.Context, botID string, s
 
 	// The callback is already set when creating the context
 
-	ctx, err := p.GetStreamingContext(context.Background(), post.Id)
+	ctx, err := p.GetStreamingContext(ctx, post.Id)
 	if err != nil {
 		return err
 	}
@@ -192,17 +208,48 @@ func (p *MMPostStreamService) FinishStreaming(postID string) {
 
 // StreamToPost streams the result of a TextStreamResult to a post.
 // it will internally handle logging needs and updating the post.
+// The stream is closed on return, so stopping the generation through ctx also aborts the upstream request.
 func (p *MMPostStreamService) StreamToPost(ctx context.Context, stream *llm.TextStreamResult, post *model.Post, userLocale string) {
 	T := i18n.LocalizerFunc(p.i18n, userLocale)
+	completed := false
+	defer func() {
+		// Runs last so that clients already show the post as finished while the handler works.
+		if completed && p.postCompletedHandler != nil {
+			p.postCompletedHandler(ctx, post)
+		}
+	}()
 	p.sendPostStreamingControlEvent(post, PostStreamingControlStart)
 	defer func() {
 		p.sendPostStreamingControlEvent(post, PostStreamingControlEnd)
 	}()
+	defer stream.Close()
 
+	var reasoning strings.Builder
 	for {
 		select {
 		case event := <-stream.Stream:
 			switch event.Type {
+			case llm.EventTypeReasoning:
+				if reasoningChunk, ok := event.Value.(string); ok {
+					reasoning.WriteString(reasoningChunk)
+					post.AddProp(ReasoningProp, reasoning.String())
+					p.mmClient.PublishWebSocketEvent("postupdate", map[string]interface{}{
+						"post_id":   post.Id,
+						"control":   "reasoning",
+						"reasoning": reasoning.String(),
+					}, &model.WebsocketBroadcast{
+						ChannelId: post.ChannelId,
+					})
+				}
+			case llm.EventTypeReasoningBlocks:
+				if blocks, ok := event.Value.([]llm.ReasoningBlock); ok {
+					blocksJSON, err := json.Marshal(blocks)
+					if err != nil {
+						p.mmClient.LogError("Failed to marshal reasoning blocks", "error", err)
+					} else {
+						post.AddProp(ReasoningBlocksProp, string(blocksJSON))
+					}
+				}
 			case llm.EventTypeText:
 				// Handle text event
 				if textChunk, ok := event.Value.(string); ok {
@@ -211,7 +258,8 @@ func (p *MMPostStreamService) StreamToPost(ctx context.Context, stream *llm.Text
 				}
 			case llm.EventTypeEnd:
 				// Stream has closed cleanly
-				if strings.TrimSpace(post.Message) == "" {
+				answered := strings.TrimSpace(post.Message) != ""
+				if !answered {
 					p.mmClient.LogError("LLM closed stream with no result")
 					post.Message = T("agents.stream_to_post_llm_not_return", "Sorry! The LLM did not return a result.")
 					p.sendPostStreamingUpdateEvent(post, post.Message)
@@ -220,6 +268,7 @@ func (p *MMPostStreamService) StreamToPost(ctx context.Context, stream *llm.Text
 					p.mmClient.LogError("Streaming failed to update post", "error", err)
 					return
 				}
+				completed = answered
 				return
 			case llm.EventTypeError:
 				// Handle error event
@@ -0,0 +1,59 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package usage
+
+import (
+	"github.com/mattermost/mattermost-plugin-ai/llm"
+	"github.com/mattermost/mattermost-plugin-ai/mmapi"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+)
+
+// Store persists per-request LLM token usage to the LLM_Usage table.
+type Store struct {
+	db  *mmapi.DBClient
+	log pluginapi.LogService
+}
+
+func NewStore(db *mmapi.DBClient, log pluginapi.LogService) *Store {
+	return &Store{
+		db:  db,
+		log: log,
+	}
+}
+
+// RecordUsage implements llm.UsageSink. Failures are only logged so accounting can never fail a request.
+func (s *Store) RecordUsage(record llm.UsageRecord) {
+	if _, err := s.db.ExecBuilder(s.db.Builder().Insert("LLM_Usage").
+		Columns(
+			"ID",
+			"CreateAt",
+			"BotID",
+			"UserID",
+			"ChannelID",
+			"TeamID",
+			"Model",
+			"Feature",
+			"InputTokens",
+			"OutputTokens",
+			"CachedTokens",
+			"CacheWriteTokens",
+		).
+		Values(
+			model.NewId(),
+			record.CreateAt,
+			record.BotID,
+			record.UserID,
+			record.ChannelID,
+			record.TeamID,
+			record.Model,
+			string(record.Feature),
+			record.Usage.InputTokens,
+			record.Usage.OutputTokens,
+			record.Usage.CachedTokens,
+			record.Usage.CacheWriteTokens,
+		)); err != nil {
+		s.log.Error("Failed to record LLM usage", "error", err, "bot_id", record.BotID, "feature", record.Feature)
+	}
+}
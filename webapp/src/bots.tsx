@@ -24,6 +24,7 @@ export interface LLMBot {
     userAccessLevel: UserAccessLevel;
     userIDs: string[];
     teamIDs: string[];
+    voiceReplies: boolean;
 }
 
 const defaultBotLocalStorageKey = 'defaultBot';
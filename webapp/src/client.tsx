@@ -213,6 +213,85 @@ export async function getAIBots() {
     });
 }
 
+export type VoiceReplySettings = {
+    enabled: boolean
+    voice: string
+}
+
+export async function getVoiceReplySettings(): Promise<VoiceReplySettings> {
+    const url = `${baseRoute()}/voice_replies`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'GET',
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export async function saveVoiceReplySettings(settings: VoiceReplySettings) {
+    const url = `${baseRoute()}/voice_replies`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'PUT',
+        body: JSON.stringify(settings),
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export type IndexingSettings = {
+    optOut: boolean
+}
+
+export async function getIndexingSettings(): Promise<IndexingSettings> {
+    const url = `${baseRoute()}/indexing_settings`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'GET',
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export async function saveIndexingSettings(settings: IndexingSettings) {
+    const url = `${baseRoute()}/indexing_settings`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'PUT',
+        body: JSON.stringify(settings),
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
 export async function createPost(post: any) {
     const created = await Client4.createPost(post);
     return created;
@@ -234,7 +313,7 @@ export async function getBotProfilePictureUrl(username: string) {
     return getProfilePictureUrl(user.id, user.last_picture_update);
 }
 
-export async function doRunSearch(query: string, teamId: string, channelId: string, botUsername?: string) {
+export async function doRunSearch(query: string, teamId: string, channelId: string, botUsername?: string, mode?: string) {
     const url = `${baseRoute()}/search/run${botUsername ? `?botUsername=${botUsername}` : ''}`;
     const response = await fetch(url, Client4.getOptions({
         method: 'POST',
@@ -242,6 +321,7 @@ export async function doRunSearch(query: string, teamId: string, channelId: stri
             query,
             teamId,
             channelId,
+            mode: mode || '',
         }),
     }));
 
@@ -322,10 +402,11 @@ export function getPost(postId: string) {
     return Client4.getPost(postId);
 }
 
-export async function doReindexPosts() {
+export async function doReindexPosts(since?: number) {
     const url = `${baseRoute()}/admin/reindex`;
     const response = await fetch(url, Client4.getOptions({
         method: 'POST',
+        body: since ? JSON.stringify({since}) : undefined,
     }));
 
     if (response.ok) {
@@ -418,3 +499,25 @@ export async function getChannelInterval(
         url,
     });
 }
+
+export async function generateImage(channelID: string, prompt: string, size?: string, rootID?: string, botUsername?: string) {
+    const url = `${channelRoute(channelID)}/generate_image${botUsername ? `?botUsername=${botUsername}` : ''}`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'POST',
+        body: JSON.stringify({
+            prompt,
+            size: size || '',
+            root_id: rootID || '',
+        }),
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
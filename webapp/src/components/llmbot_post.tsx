@@ -25,6 +25,7 @@ import IconCancel from './assets/icon_cancel';
 import ToolApprovalSet from './tool_approval_set';
 
 const SearchResultsPropKey = 'search_results';
+const ReasoningPropKey = 'reasoning';
 
 const PostBody = styled.div`
 `;
@@ -93,11 +94,31 @@ const PostSummaryHelpMessage = styled.div`
 	margin-top: 16px;
 `;
 
+const Reasoning = styled.details`
+	margin-bottom: 8px;
+	color: rgba(var(--center-channel-color-rgb), 0.64);
+	font-size: 12px;
+	line-height: 16px;
+
+	summary {
+		cursor: pointer;
+		font-weight: 600;
+	}
+`;
+
+const ReasoningText = styled.div`
+	margin-top: 4px;
+	padding-left: 8px;
+	border-left: 2px solid rgba(var(--center-channel-color-rgb), 0.16);
+	white-space: pre-wrap;
+`;
+
 export interface PostUpdateWebsocketMessage {
     post_id: string
     next?: string
     control?: string
     tool_call?: string
+    reasoning?: string
 }
 
 export enum ToolCallStatus {
@@ -126,6 +147,7 @@ interface Props {
 export const LLMBotPost = (props: Props) => {
     const selectPost = useSelectNotAIPost();
     const [message, setMessage] = useState(props.post.message);
+    const [reasoning, setReasoning] = useState(props.post.props?.[ReasoningPropKey] || '');
 
     // Generating is true while we are reciving new content from the websocket
     const [generating, setGenerating] = useState(false);
@@ -159,6 +181,13 @@ export const LLMBotPost = (props: Props) => {
         }
     }, [toolCallsJson]);
 
+    useEffect(() => {
+        const propReasoning = props.post.props?.[ReasoningPropKey];
+        if (propReasoning && propReasoning !== reasoning) {
+            setReasoning(propReasoning);
+        }
+    }, [props.post.props?.[ReasoningPropKey]]);
+
     useEffect(() => {
         if (props.post.message !== '' && props.post.message !== message) {
             setMessage(props.post.message);
@@ -189,6 +218,14 @@ export const LLMBotPost = (props: Props) => {
                     return;
                 }
 
+                if (data.control === 'reasoning' && data.reasoning !== undefined) {
+                    if (!stoppedRef.current) {
+                        setGenerating(true);
+                        setReasoning(data.reasoning);
+                    }
+                    return;
+                }
+
                 // Handle regular post updates
                 if (data.next && !stoppedRef.current) {
                     setGenerating(true);
@@ -220,6 +257,7 @@ export const LLMBotPost = (props: Props) => {
         setGenerating(true);
         setStopped(false);
         setMessage('');
+        setReasoning('');
         doRegenerate(props.post.id);
     };
 
@@ -267,6 +305,14 @@ export const LLMBotPost = (props: Props) => {
                 {permalinkView}
             </>
             }
+            {reasoning &&
+            <Reasoning>
+                <summary>
+                    <FormattedMessage defaultMessage='Reasoning'/>
+                </summary>
+                <ReasoningText>{reasoning}</ReasoningText>
+            </Reasoning>
+            }
             <PostText
                 message={message}
                 channelID={props.post.channel_id}
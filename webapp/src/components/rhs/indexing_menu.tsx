@@ -0,0 +1,73 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React, {useEffect, useState} from 'react';
+import {FormattedMessage, useIntl} from 'react-intl';
+import styled from 'styled-components';
+
+import {CheckIcon} from '@mattermost/compass-icons/components';
+
+import {getIndexingSettings, IndexingSettings, saveIndexingSettings} from '@/client';
+
+import DotMenu, {DropdownMenu, DropdownMenuItem} from '../dot_menu';
+
+const IndexingMenu = () => {
+    const intl = useIntl();
+    const [settings, setSettings] = useState<IndexingSettings | null>(null);
+
+    useEffect(() => {
+        getIndexingSettings().then(setSettings).catch(() => setSettings(null));
+    }, []);
+
+    if (!settings) {
+        return null;
+    }
+
+    const save = async (updated: IndexingSettings) => {
+        setSettings(await saveIndexingSettings(updated));
+    };
+
+    return (
+        <DotMenu
+            icon={<i className='icon icon-magnify'/>}
+            title={intl.formatMessage({defaultMessage: 'Search indexing'})}
+            dropdownMenu={StyledDropdownMenu}
+            portal={false}
+            testId='indexing-menu'
+        >
+            <StyledDropdownMenuItem onClick={() => save({...settings, optOut: !settings.optOut})}>
+                <FormattedMessage defaultMessage='Exclude my messages from search'/>
+                {settings.optOut && <StyledCheckIcon/>}
+            </StyledDropdownMenuItem>
+            {settings.optOut && (
+                <MenuInfoMessage>
+                    <FormattedMessage defaultMessage='Your messages are not indexed for semantic search. Messages indexed before you opted out have been removed.'/>
+                </MenuInfoMessage>
+            )}
+        </DotMenu>
+    );
+};
+
+const StyledDropdownMenu = styled(DropdownMenu)`
+	min-width: 260px;
+`;
+
+const StyledCheckIcon = styled(CheckIcon)`
+	margin-left: auto;
+	color: var(--button-bg);
+`;
+
+const StyledDropdownMenuItem = styled(DropdownMenuItem)`
+	padding: 8px 16px;
+	gap: 8px;
+`;
+
+const MenuInfoMessage = styled.div`
+	padding: 6px 16px;
+
+	color: rgba(var(--center-channel-color-rgb), 0.56);
+	font-size: 12px;
+	line-height: 16px;
+`;
+
+export default IndexingMenu;
@@ -3,9 +3,14 @@
 
 import {ChevronDownIcon} from '@mattermost/compass-icons/components';
 import React from 'react';
+import {useSelector} from 'react-redux';
 import styled from 'styled-components';
 import {FormattedMessage} from 'react-intl';
 
+import {GlobalState} from '@mattermost/types/store';
+
+import manifest from '@/manifest';
+
 import {DotMenuButton} from '../dot_menu';
 
 import {BotDropdown} from '../bot_selector';
@@ -13,6 +18,8 @@ import {BotDropdown} from '../bot_selector';
 import {LLMBot} from '@/bots';
 
 import {Button} from './common';
+import IndexingMenu from './indexing_menu';
+import VoiceReplyMenu from './voice_reply_menu';
 
 type Props = {
     currentTab: string
@@ -24,6 +31,7 @@ type Props = {
 }
 
 const RHSHeader = (props: Props) => {
+    const searchEnabled = useSelector<GlobalState, boolean>((state: any) => state['plugins-' + manifest.id].searchEnabled);
     let historyButton = null;
     if (props.currentTab === 'threads') {
         historyButton = (
@@ -77,6 +85,8 @@ const RHSHeader = (props: Props) => {
                     </>
                 </BotDropdown>
             )}
+            {props.activeBot?.voiceReplies && <VoiceReplyMenu/>}
+            {searchEnabled && <IndexingMenu/>}
         </Header>
     );
 };
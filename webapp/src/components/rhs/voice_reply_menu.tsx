@@ -0,0 +1,95 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React, {useEffect, useState} from 'react';
+import {FormattedMessage, useIntl} from 'react-intl';
+import styled from 'styled-components';
+
+import {CheckIcon} from '@mattermost/compass-icons/components';
+
+import {getVoiceReplySettings, saveVoiceReplySettings, VoiceReplySettings} from '@/client';
+
+import DotMenu, {DropdownMenu, DropdownMenuItem} from '../dot_menu';
+
+// Kept in sync with llm.SpeechVoices on the server.
+const voices = ['alloy', 'ash', 'ballad', 'coral', 'echo', 'fable', 'nova', 'onyx', 'sage', 'shimmer', 'verse'];
+
+const VoiceReplyMenu = () => {
+    const intl = useIntl();
+    const [settings, setSettings] = useState<VoiceReplySettings | null>(null);
+
+    useEffect(() => {
+        getVoiceReplySettings().then(setSettings).catch(() => setSettings(null));
+    }, []);
+
+    if (!settings) {
+        return null;
+    }
+
+    const save = async (updated: VoiceReplySettings) => {
+        setSettings(await saveVoiceReplySettings(updated));
+    };
+
+    return (
+        <DotMenu
+            icon={<i className={settings.enabled ? 'icon icon-volume-high' : 'icon icon-volume-off'}/>}
+            title={intl.formatMessage({defaultMessage: 'Voice replies'})}
+            dropdownMenu={StyledDropdownMenu}
+            portal={false}
+            testId='voice-reply-menu'
+        >
+            <StyledDropdownMenuItem onClick={() => save({...settings, enabled: !settings.enabled})}>
+                <FormattedMessage defaultMessage='Read answers aloud'/>
+                {settings.enabled && <StyledCheckIcon/>}
+            </StyledDropdownMenuItem>
+            {settings.enabled && (
+                <>
+                    <MenuInfoMessage>
+                        <FormattedMessage defaultMessage='Voice'/>
+                    </MenuInfoMessage>
+                    <StyledDropdownMenuItem onClick={() => save({...settings, voice: ''})}>
+                        <FormattedMessage defaultMessage='Agent default'/>
+                        {settings.voice === '' && <StyledCheckIcon/>}
+                    </StyledDropdownMenuItem>
+                    {voices.map((voice) => (
+                        <StyledDropdownMenuItem
+                            key={voice}
+                            onClick={() => save({...settings, voice})}
+                        >
+                            {voice.charAt(0).toUpperCase() + voice.slice(1)}
+                            {settings.voice === voice && <StyledCheckIcon/>}
+                        </StyledDropdownMenuItem>
+                    ))}
+                </>
+            )}
+        </DotMenu>
+    );
+};
+
+const StyledDropdownMenu = styled(DropdownMenu)`
+	min-width: 200px;
+	max-height: 400px;
+	overflow-y: auto;
+`;
+
+const StyledCheckIcon = styled(CheckIcon)`
+	margin-left: auto;
+	color: var(--button-bg);
+`;
+
+const StyledDropdownMenuItem = styled(DropdownMenuItem)`
+	padding: 8px 16px;
+`;
+
+const MenuInfoMessage = styled.div`
+	padding: 6px 20px;
+
+	color: rgba(var(--center-channel-color-rgb), 0.56);
+	font-size: 12px;
+	font-weight: 600;
+	line-height: 16px;
+	letter-spacing: 0.48px;
+	text-transform: uppercase;
+`;
+
+export default VoiceReplyMenu;
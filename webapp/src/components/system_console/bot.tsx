@@ -27,6 +27,13 @@ export type LLMService = {
     sendUserId: boolean
     outputTokenLimit: number
     customHeaders: {[key: string]: string}
+    enablePromptCaching?: boolean
+    fetchModelCapabilities?: boolean
+    streamUsage?: boolean
+    safetyThreshold?: string
+    region?: string
+    accessKeyID?: string
+    secretAccessKey?: string
 }
 
 export enum ChannelAccessLevel {
@@ -56,8 +63,64 @@ export type LLMBotConfig = {
     userAccessLevel: UserAccessLevel
     userIDs: string[]
     teamIDs: string[]
+    truncationStrategy?: string
+    rateLimits?: RateLimits
+    reasoningEffort?: string
+    thinkingBudgetTokens?: number
+    sampling?: Sampling
+    imageGeneration?: ImageGeneration
+    textToSpeech?: TextToSpeech
 }
 
+export type ImageGeneration = {
+    enabled: boolean
+    model: string
+    size: string
+}
+
+const defaultImageGeneration: ImageGeneration = {
+    enabled: false,
+    model: '',
+    size: '',
+};
+
+export type TextToSpeech = {
+    enabled: boolean
+    apiURL: string
+    apiKey: string
+    model: string
+    voice: string
+}
+
+const defaultTextToSpeech: TextToSpeech = {
+    enabled: false,
+    apiURL: '',
+    apiKey: '',
+    model: '',
+    voice: '',
+};
+
+export type Sampling = {
+    temperature?: number
+    topP?: number
+    stopSequences?: string[]
+    seed?: number
+}
+
+export type RateLimits = {
+    userRequestsPerMinute: number
+    userTokensPerDay: number
+    teamTokensPerDay: number
+    botTokensPerDay: number
+}
+
+const defaultRateLimits: RateLimits = {
+    userRequestsPerMinute: 0,
+    userTokensPerDay: 0,
+    teamTokensPerDay: 0,
+    botTokensPerDay: 0,
+};
+
 type Props = {
     bot: LLMBotConfig
     onChange: (bot: LLMBotConfig) => void
@@ -71,6 +134,8 @@ const mapServiceTypeToDisplayName = new Map<string, string>([
     ['azure', 'Azure'],
     ['anthropic', 'Anthropic'],
     ['cohere', 'Cohere'],
+    ['gemini', 'Google Gemini'],
+    ['bedrock', 'AWS Bedrock'],
     ['asage', 'asksage (Experimental)'],
 ]);
 
@@ -158,6 +223,8 @@ const Bot = (props: Props) => {
                             <SelectionItemOption value='azure'>{'Azure'}</SelectionItemOption>
                             <SelectionItemOption value='anthropic'>{'Anthropic'}</SelectionItemOption>
                             <SelectionItemOption value='cohere'>{'Cohere'}</SelectionItemOption>
+                            <SelectionItemOption value='gemini'>{'Google Gemini'}</SelectionItemOption>
+                            <SelectionItemOption value='bedrock'>{'AWS Bedrock'}</SelectionItemOption>
                             <SelectionItemOption value='asage'>{'asage (Experimental)'}</SelectionItemOption>
                         </SelectionItem>
                         <ServiceItem
@@ -171,7 +238,7 @@ const Bot = (props: Props) => {
                             value={props.bot.customInstructions}
                             onChange={(e) => props.onChange({...props.bot, customInstructions: e.target.value})}
                         />
-                        {(props.bot.service.type === 'openai' || props.bot.service.type === 'openaicompatible' || props.bot.service.type === 'azure' || props.bot.service.type === 'anthropic' || props.bot.service.type === 'cohere') && (
+                        {(props.bot.service.type === 'openai' || props.bot.service.type === 'openaicompatible' || props.bot.service.type === 'azure' || props.bot.service.type === 'anthropic' || props.bot.service.type === 'cohere' || props.bot.service.type === 'gemini' || props.bot.service.type === 'bedrock') && (
                             <>
                                 <BooleanItem
                                     label={
@@ -182,7 +249,7 @@ const Bot = (props: Props) => {
                                     }
                                     value={props.bot.enableVision}
                                     onChange={(to: boolean) => props.onChange({...props.bot, enableVision: to})}
-                                    helpText={intl.formatMessage({defaultMessage: 'Enable Vision to allow the bot to process images. Requires a compatible model.'})}
+                                    helpText={intl.formatMessage({defaultMessage: 'Enable Vision to allow the bot to process images. Requires a compatible model, saving fails for models known not to accept images.'})}
                                 />
                                 <BooleanItem
                                     label={
@@ -194,6 +261,60 @@ const Bot = (props: Props) => {
                                 />
                             </>
                         )}
+                        <SelectionItem
+                            label={intl.formatMessage({defaultMessage: 'Long conversations'})}
+                            value={props.bot.truncationStrategy || 'drop_oldest'}
+                            onChange={(e) => props.onChange({...props.bot, truncationStrategy: e.target.value})}
+                            helptext={intl.formatMessage({defaultMessage: 'How conversations longer than the model\'s context window are shortened. Summarizing keeps earlier context available at the cost of extra requests, made in the background so that answers don\'t wait for them. Until a summary is ready the oldest messages are dropped.'})}
+                        >
+                            <SelectionItemOption value='drop_oldest'>{intl.formatMessage({defaultMessage: 'Drop oldest messages'})}</SelectionItemOption>
+                            <SelectionItemOption value='summarize'>{intl.formatMessage({defaultMessage: 'Summarize oldest messages'})}</SelectionItemOption>
+                        </SelectionItem>
+                        {(props.bot.service.type === 'openai' || props.bot.service.type === 'openaicompatible' || props.bot.service.type === 'azure') && (
+                            <SelectionItem
+                                label={intl.formatMessage({defaultMessage: 'Reasoning effort'})}
+                                value={props.bot.reasoningEffort || ''}
+                                onChange={(e) => props.onChange({...props.bot, reasoningEffort: e.target.value})}
+                                helptext={intl.formatMessage({defaultMessage: 'How much the model reasons before answering. Only supported by reasoning models, leave unset for other models.'})}
+                            >
+                                <SelectionItemOption value=''>{intl.formatMessage({defaultMessage: 'Not set'})}</SelectionItemOption>
+                                <SelectionItemOption value='low'>{intl.formatMessage({defaultMessage: 'Low'})}</SelectionItemOption>
+                                <SelectionItemOption value='medium'>{intl.formatMessage({defaultMessage: 'Medium'})}</SelectionItemOption>
+                                <SelectionItemOption value='high'>{intl.formatMessage({defaultMessage: 'High'})}</SelectionItemOption>
+                            </SelectionItem>
+                        )}
+                        {(props.bot.service.type === 'anthropic' || props.bot.service.type === 'bedrock') && (
+                            <TextItem
+                                label={intl.formatMessage({defaultMessage: 'Thinking budget tokens'})}
+                                type='number'
+                                min='0'
+                                value={(props.bot.thinkingBudgetTokens ?? 0).toString()}
+                                onChange={(e) => {
+                                    const value = parseInt(e.target.value, 10);
+                                    props.onChange({...props.bot, thinkingBudgetTokens: isNaN(value) || value < 0 ? 0 : value});
+                                }}
+                                helptext={intl.formatMessage({defaultMessage: 'Tokens the model may use for extended thinking before answering, at least 1024. Set to 0 to disable extended thinking.'})}
+                            />
+                        )}
+                        {(props.bot.service.type === 'openai' || props.bot.service.type === 'openaicompatible' || props.bot.service.type === 'azure') && (
+                            <ImageGenerationItem
+                                imageGeneration={props.bot.imageGeneration ?? defaultImageGeneration}
+                                onChange={(imageGeneration) => props.onChange({...props.bot, imageGeneration})}
+                            />
+                        )}
+                        <TextToSpeechItem
+                            textToSpeech={props.bot.textToSpeech ?? defaultTextToSpeech}
+                            serviceCanSpeak={props.bot.service.type === 'openai' || props.bot.service.type === 'openaicompatible' || props.bot.service.type === 'azure'}
+                            onChange={(textToSpeech) => props.onChange({...props.bot, textToSpeech})}
+                        />
+                        <SamplingItem
+                            sampling={props.bot.sampling ?? {}}
+                            onChange={(sampling) => props.onChange({...props.bot, sampling})}
+                        />
+                        <RateLimitsItem
+                            rateLimits={props.bot.rateLimits ?? defaultRateLimits}
+                            onChange={(rateLimits) => props.onChange({...props.bot, rateLimits})}
+                        />
                         <ChannelAccessLevelItem
                             label={intl.formatMessage({defaultMessage: 'Channel access'})}
                             level={props.bot.channelAccessLevel ?? ChannelAccessLevel.All}
@@ -228,6 +349,179 @@ const Horizontal = styled.div`
 	gap: 8px;
 `;
 
+type RateLimitsItemProps = {
+    rateLimits: RateLimits
+    onChange: (rateLimits: RateLimits) => void
+}
+
+const RateLimitsItem = (props: RateLimitsItemProps) => {
+    const intl = useIntl();
+
+    const numberItem = (key: keyof RateLimits, label: string, helptext?: string) => (
+        <TextItem
+            label={label}
+            helptext={helptext}
+            type='number'
+            min='0'
+            value={props.rateLimits[key].toString()}
+            onChange={(e) => {
+                const value = parseInt(e.target.value, 10);
+                props.onChange({...props.rateLimits, [key]: isNaN(value) || value < 0 ? 0 : value});
+            }}
+        />
+    );
+
+    return (
+        <>
+            {numberItem('userRequestsPerMinute', intl.formatMessage({defaultMessage: 'Requests per minute per user'}), intl.formatMessage({defaultMessage: 'Limits are shared by all servers in the cluster. Set a limit to 0 to disable it.'}))}
+            {numberItem('userTokensPerDay', intl.formatMessage({defaultMessage: 'Tokens per day per user'}))}
+            {numberItem('teamTokensPerDay', intl.formatMessage({defaultMessage: 'Tokens per day per team'}), intl.formatMessage({defaultMessage: 'Direct and group messages are not part of a team and only count towards the user and bot limits.'}))}
+            {numberItem('botTokensPerDay', intl.formatMessage({defaultMessage: 'Tokens per day for this bot'}), intl.formatMessage({defaultMessage: 'Daily token limits reset at midnight UTC.'}))}
+        </>
+    );
+};
+
+type ImageGenerationItemProps = {
+    imageGeneration: ImageGeneration
+    onChange: (imageGeneration: ImageGeneration) => void
+}
+
+const ImageGenerationItem = (props: ImageGenerationItemProps) => {
+    const intl = useIntl();
+
+    return (
+        <>
+            <BooleanItem
+                label={intl.formatMessage({defaultMessage: 'Enable image generation'})}
+                value={props.imageGeneration.enabled}
+                onChange={(to: boolean) => props.onChange({...props.imageGeneration, enabled: to})}
+                helpText={intl.formatMessage({defaultMessage: 'Gives the agent a tool to generate images, which users approve like other tools. Generated images are attached to the agent\'s response.'})}
+            />
+            {props.imageGeneration.enabled && (
+                <>
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Image model'})}
+                        placeholder='dall-e-3'
+                        value={props.imageGeneration.model}
+                        onChange={(e) => props.onChange({...props.imageGeneration, model: e.target.value})}
+                    />
+                    <SelectionItem
+                        label={intl.formatMessage({defaultMessage: 'Default image size'})}
+                        value={props.imageGeneration.size}
+                        onChange={(e) => props.onChange({...props.imageGeneration, size: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'Not every model supports every size. DALL-E 3 supports 1024x1024, 1792x1024 and 1024x1792, GPT image models 1024x1024, 1536x1024 and 1024x1536.'})}
+                    >
+                        <SelectionItemOption value=''>{intl.formatMessage({defaultMessage: 'Model default'})}</SelectionItemOption>
+                        {['256x256', '512x512', '1024x1024', '1792x1024', '1024x1792', '1536x1024', '1024x1536'].map((size) => (
+                            <SelectionItemOption
+                                key={size}
+                                value={size}
+                            >
+                                {size}
+                            </SelectionItemOption>
+                        ))}
+                    </SelectionItem>
+                </>
+            )}
+        </>
+    );
+};
+
+type TextToSpeechItemProps = {
+    textToSpeech: TextToSpeech
+    serviceCanSpeak: boolean
+    onChange: (textToSpeech: TextToSpeech) => void
+}
+
+const TextToSpeechItem = (props: TextToSpeechItemProps) => {
+    const intl = useIntl();
+
+    return (
+        <>
+            <BooleanItem
+                label={intl.formatMessage({defaultMessage: 'Enable voice replies'})}
+                value={props.textToSpeech.enabled}
+                onChange={(to: boolean) => props.onChange({...props.textToSpeech, enabled: to})}
+                helpText={intl.formatMessage({defaultMessage: 'Lets users opt in to an audio version of the agent\'s answers, attached to its posts once they are complete.'})}
+            />
+            {props.textToSpeech.enabled && (
+                <>
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Text to speech API URL'})}
+                        placeholder='http://localhost:8880/v1'
+                        value={props.textToSpeech.apiURL}
+                        onChange={(e) => props.onChange({...props.textToSpeech, apiURL: e.target.value})}
+                        helptext={props.serviceCanSpeak ? intl.formatMessage({defaultMessage: 'An OpenAI compatible API serving /audio/speech. Leave empty to use the agent\'s service.'}) : intl.formatMessage({defaultMessage: 'An OpenAI compatible API serving /audio/speech. Required as the agent\'s service can\'t synthesize speech.'})}
+                    />
+                    {props.textToSpeech.apiURL !== '' && (
+                        <TextItem
+                            label={intl.formatMessage({defaultMessage: 'Text to speech API key'})}
+                            type='password'
+                            value={props.textToSpeech.apiKey}
+                            onChange={(e) => props.onChange({...props.textToSpeech, apiKey: e.target.value})}
+                        />
+                    )}
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Speech model'})}
+                        placeholder='tts-1'
+                        value={props.textToSpeech.model}
+                        onChange={(e) => props.onChange({...props.textToSpeech, model: e.target.value})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Default voice'})}
+                        placeholder='alloy'
+                        value={props.textToSpeech.voice}
+                        onChange={(e) => props.onChange({...props.textToSpeech, voice: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'Users can choose another voice for themselves.'})}
+                    />
+                </>
+            )}
+        </>
+    );
+};
+
+type SamplingItemProps = {
+    sampling: Sampling
+    onChange: (sampling: Sampling) => void
+}
+
+const SamplingItem = (props: SamplingItemProps) => {
+    const intl = useIntl();
+
+    // An empty field leaves the parameter to the provider's default.
+    const numberItem = (key: 'temperature' | 'topP' | 'seed', label: string, step: string, helptext?: string) => (
+        <TextItem
+            label={label}
+            helptext={helptext}
+            type='number'
+            min='0'
+            step={step}
+            value={props.sampling[key]?.toString() ?? ''}
+            onChange={(e) => {
+                const value = parseFloat(e.target.value);
+                props.onChange({...props.sampling, [key]: isNaN(value) ? undefined : value});
+            }}
+        />
+    );
+
+    return (
+        <>
+            {numberItem('temperature', intl.formatMessage({defaultMessage: 'Temperature'}), '0.1', intl.formatMessage({defaultMessage: 'Lower values give more focused and reproducible answers, higher values more varied ones. Leave empty to use the provider default.'}))}
+            {numberItem('topP', intl.formatMessage({defaultMessage: 'Top P'}), '0.05')}
+            <TextItem
+                label={intl.formatMessage({defaultMessage: 'Stop sequences'})}
+                helptext={intl.formatMessage({defaultMessage: 'Comma separated sequences that end the response when generated.'})}
+                value={(props.sampling.stopSequences ?? []).join(',')}
+                onChange={(e) => {
+                    // Empty sequences are kept while typing and ignored by the server.
+                    props.onChange({...props.sampling, stopSequences: e.target.value === '' ? undefined : e.target.value.split(',')});
+                }}
+            />
+            {numberItem('seed', intl.formatMessage({defaultMessage: 'Seed'}), '1', intl.formatMessage({defaultMessage: 'Only used by providers that support deterministic sampling.'}))}
+        </>
+    );
+};
+
 type ServiceItemProps = {
     service: LLMService
     onChange: (service: LLMService) => void
@@ -242,6 +536,7 @@ const ServiceItem = (props: ServiceItemProps) => {
     const getDefaultOutputTokenLimit = () => {
         switch (type) {
         case 'anthropic':
+        case 'bedrock':
             return '8192';
         default:
             return '0';
@@ -257,12 +552,41 @@ const ServiceItem = (props: ServiceItemProps) => {
                     onChange={(e) => props.onChange({...props.service, apiURL: e.target.value})}
                 />
             )}
-            <TextItem
-                label={intl.formatMessage({defaultMessage: 'API Key'})}
-                type='password'
-                value={props.service.apiKey}
-                onChange={(e) => props.onChange({...props.service, apiKey: e.target.value})}
-            />
+            {type === 'bedrock' ? (
+                <>
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Region'})}
+                        placeholder='us-east-1'
+                        value={props.service.region ?? ''}
+                        onChange={(e) => props.onChange({...props.service, region: e.target.value})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Access key ID'})}
+                        value={props.service.accessKeyID ?? ''}
+                        onChange={(e) => props.onChange({...props.service, accessKeyID: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'Leave the access keys empty to use the AWS environment variables or the IAM role of the instance the server runs on.'})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Secret access key'})}
+                        type='password'
+                        value={props.service.secretAccessKey ?? ''}
+                        onChange={(e) => props.onChange({...props.service, secretAccessKey: e.target.value})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Endpoint URL'})}
+                        value={props.service.apiURL}
+                        onChange={(e) => props.onChange({...props.service, apiURL: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'Optional. Replaces the regional Bedrock runtime endpoint, for example to use a VPC endpoint.'})}
+                    />
+                </>
+            ) : (
+                <TextItem
+                    label={intl.formatMessage({defaultMessage: 'API Key'})}
+                    type='password'
+                    value={props.service.apiKey}
+                    onChange={(e) => props.onChange({...props.service, apiKey: e.target.value})}
+                />
+            )}
             {isOpenAIType && (
                 <>
                     {!isCohere && (
@@ -317,6 +641,44 @@ const ServiceItem = (props: ServiceItemProps) => {
                     }}
                 />
             )}
+            {type === 'openaicompatible' && (
+                <BooleanItem
+                    label={intl.formatMessage({defaultMessage: 'Report token usage'})}
+                    value={props.service.streamUsage ?? false}
+                    onChange={(to: boolean) => props.onChange({...props.service, streamUsage: to})}
+                    helpText={intl.formatMessage({defaultMessage: 'Asks the server to report token usage at the end of streamed responses. Enable only if the server supports the stream_options parameter, otherwise usage is estimated from the length of requests and responses.'})}
+                />
+            )}
+            {(type === 'openai' || type === 'openaicompatible' || type === 'gemini') && (
+                <BooleanItem
+                    label={intl.formatMessage({defaultMessage: 'Fetch model capabilities'})}
+                    value={props.service.fetchModelCapabilities ?? false}
+                    onChange={(to: boolean) => props.onChange({...props.service, fetchModelCapabilities: to})}
+                    helpText={intl.formatMessage({defaultMessage: 'Reads the context window, output limit and supported features of the models from the provider\'s model list. Useful for models the plugin does not know about.'})}
+                />
+            )}
+            {type === 'gemini' && (
+                <SelectionItem
+                    label={intl.formatMessage({defaultMessage: 'Safety threshold'})}
+                    value={props.service.safetyThreshold || ''}
+                    onChange={(e) => props.onChange({...props.service, safetyThreshold: e.target.value})}
+                    helptext={intl.formatMessage({defaultMessage: 'The likelihood of harmful content at which Gemini blocks a response.'})}
+                >
+                    <SelectionItemOption value=''>{intl.formatMessage({defaultMessage: 'Model default'})}</SelectionItemOption>
+                    <SelectionItemOption value='BLOCK_LOW_AND_ABOVE'>{intl.formatMessage({defaultMessage: 'Block low and above'})}</SelectionItemOption>
+                    <SelectionItemOption value='BLOCK_MEDIUM_AND_ABOVE'>{intl.formatMessage({defaultMessage: 'Block medium and above'})}</SelectionItemOption>
+                    <SelectionItemOption value='BLOCK_ONLY_HIGH'>{intl.formatMessage({defaultMessage: 'Block only high'})}</SelectionItemOption>
+                    <SelectionItemOption value='BLOCK_NONE'>{intl.formatMessage({defaultMessage: 'Block none'})}</SelectionItemOption>
+                </SelectionItem>
+            )}
+            {(type === 'anthropic' || type === 'bedrock') && (
+                <BooleanItem
+                    label={intl.formatMessage({defaultMessage: 'Enable prompt caching'})}
+                    value={props.service.enablePromptCaching ?? false}
+                    onChange={(to: boolean) => props.onChange({...props.service, enablePromptCaching: to})}
+                    helpText={intl.formatMessage({defaultMessage: 'Caches the system prompt, tools and conversation history between requests. Cached input is cheaper to read, but writing to the cache costs more than regular input.'})}
+                />
+            )}
         </>
     );
 };
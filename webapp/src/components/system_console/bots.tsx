@@ -37,6 +37,7 @@ const defaultNewBot: LLMBotConfig = {
     userAccessLevel: UserAccessLevel.All,
     userIDs: [],
     teamIDs: [],
+    truncationStrategy: 'drop_oldest',
 };
 
 export const firstNewBot = {
@@ -15,7 +15,13 @@ import {IntItem} from '../number_items';
 
 import {EmbeddingSearchConfig} from './types';
 import {OpenAIProviderConfig, OpenAICompatibleProviderConfig} from './provider_configs';
+import {PGVectorStoreConfig} from './vector_store_configs';
 import {ChunkingOptionsConfig} from './chunking_options';
+import {HybridSearchConfig} from './hybrid_search';
+import {RerankerOptionsConfig} from './reranker_options';
+import {ResultExpansionConfig} from './result_expansion';
+import {IndexingOptionsConfig} from './indexing_options';
+import {IndexingPolicyConfig} from './indexing_policy';
 import {ReindexSection} from './reindex_section';
 import {ReindexConfirmation} from './reindex_confirmation';
 import {useJobStatus} from './use_job_status';
@@ -129,9 +135,17 @@ const EmbeddingSearchPanel = ({value, onChange}: Props) => {
                     })}
                 >
                     <SelectionItemOption value='pgvector'>{'PostgreSQL pgvector'}</SelectionItemOption>
+                    <SelectionItemOption value='flat'>{'Embedded'}</SelectionItemOption>
                 </SelectionItem>
                 }
 
+                {value.type && value.type !== '' && value.vectorStore.type === 'pgvector' && (
+                    <PGVectorStoreConfig
+                        value={value.vectorStore}
+                        onChange={(config) => onChange({...value, vectorStore: config})}
+                    />
+                )}
+
                 {value.type && value.type !== '' &&
                 <SelectionItem
                     label={intl.formatMessage({defaultMessage: 'Embedding Provider Type'})}
@@ -192,6 +206,31 @@ const EmbeddingSearchPanel = ({value, onChange}: Props) => {
                             value={value}
                             onChange={onChange}
                         />
+
+                        <HybridSearchConfig
+                            value={value}
+                            onChange={onChange}
+                        />
+
+                        <RerankerOptionsConfig
+                            value={value}
+                            onChange={onChange}
+                        />
+
+                        <ResultExpansionConfig
+                            value={value}
+                            onChange={onChange}
+                        />
+
+                        <IndexingOptionsConfig
+                            value={value}
+                            onChange={onChange}
+                        />
+
+                        <IndexingPolicyConfig
+                            value={value}
+                            onChange={onChange}
+                        />
                     </>
                 )}
 
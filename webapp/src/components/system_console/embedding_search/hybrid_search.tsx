@@ -0,0 +1,71 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React from 'react';
+import {useIntl} from 'react-intl';
+
+import {BooleanItem} from '../item';
+import {IntItem, FloatItem} from '../number_items';
+
+import {EmbeddingSearchConfig, HybridConfig} from './types';
+
+interface HybridSearchProps {
+    value: EmbeddingSearchConfig;
+    onChange: (config: EmbeddingSearchConfig) => void;
+}
+
+// Matches the server defaults used for zero values.
+const defaultHybridConfig: HybridConfig = {
+    enabled: false,
+    vectorWeight: 1,
+    lexicalWeight: 1,
+    rankConstant: 60,
+};
+
+export const HybridSearchConfig = ({value, onChange}: HybridSearchProps) => {
+    const intl = useIntl();
+    const hybrid = value.hybrid || defaultHybridConfig;
+    const update = (changes: Partial<HybridConfig>) => onChange({
+        ...value,
+        hybrid: {...hybrid, ...changes},
+    });
+
+    return (
+        <>
+            <BooleanItem
+                label={intl.formatMessage({defaultMessage: 'Hybrid Search'})}
+                value={hybrid.enabled}
+                onChange={(enabled) => update({enabled})}
+                helpText={intl.formatMessage({defaultMessage: 'Combine keyword search with semantic search, so that exact terms such as ticket IDs, error codes and hostnames are found.'})}
+            />
+            {hybrid.enabled && (
+                <>
+                    <FloatItem
+                        label={intl.formatMessage({defaultMessage: 'Semantic Search Weight'})}
+                        placeholder={defaultHybridConfig.vectorWeight.toString()}
+                        value={hybrid.vectorWeight || defaultHybridConfig.vectorWeight}
+                        onChange={(vectorWeight) => update({vectorWeight})}
+                        min={0}
+                        helptext={intl.formatMessage({defaultMessage: 'How much the ranking of semantic search counts in the combined results.'})}
+                    />
+                    <FloatItem
+                        label={intl.formatMessage({defaultMessage: 'Keyword Search Weight'})}
+                        placeholder={defaultHybridConfig.lexicalWeight.toString()}
+                        value={hybrid.lexicalWeight || defaultHybridConfig.lexicalWeight}
+                        onChange={(lexicalWeight) => update({lexicalWeight})}
+                        min={0}
+                        helptext={intl.formatMessage({defaultMessage: 'How much the ranking of keyword search counts in the combined results.'})}
+                    />
+                    <IntItem
+                        label={intl.formatMessage({defaultMessage: 'Rank Constant'})}
+                        placeholder={defaultHybridConfig.rankConstant.toString()}
+                        value={hybrid.rankConstant || defaultHybridConfig.rankConstant}
+                        onChange={(rankConstant) => update({rankConstant})}
+                        min={1}
+                        helptext={intl.formatMessage({defaultMessage: 'Lower values give the top results of each search more weight over lower ranked ones.'})}
+                    />
+                </>
+            )}
+        </>
+    );
+};
@@ -0,0 +1,57 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React from 'react';
+import {useIntl} from 'react-intl';
+
+import {BooleanItem} from '../item';
+import {IntItem} from '../number_items';
+
+import {EmbeddingSearchConfig, IndexingConfig} from './types';
+
+interface IndexingOptionsProps {
+    value: EmbeddingSearchConfig;
+    onChange: (config: EmbeddingSearchConfig) => void;
+}
+
+// Matches the server defaults used for zero values.
+const defaultIndexingConfig: IndexingConfig = {
+    attachments: false,
+    maxAttachmentLength: 20000,
+    threadContext: false,
+};
+
+export const IndexingOptionsConfig = ({value, onChange}: IndexingOptionsProps) => {
+    const intl = useIntl();
+    const indexing = value.indexing || defaultIndexingConfig;
+    const update = (changes: Partial<IndexingConfig>) => onChange({
+        ...value,
+        indexing: {...indexing, ...changes},
+    });
+
+    return (
+        <>
+            <BooleanItem
+                label={intl.formatMessage({defaultMessage: 'Index Attachments'})}
+                value={indexing.attachments}
+                onChange={(attachments) => update({attachments})}
+                helpText={intl.formatMessage({defaultMessage: 'Index the text of message attachments and the text the server extracted from attached files, such as PDFs and documents. File contents require document search by content to be enabled in the Mattermost server. Reindex to include existing posts.'})}
+            />
+            {indexing.attachments && (
+                <IntItem
+                    label={intl.formatMessage({defaultMessage: 'Maximum Attachment Length'})}
+                    value={indexing.maxAttachmentLength || defaultIndexingConfig.maxAttachmentLength}
+                    onChange={(maxAttachmentLength) => update({maxAttachmentLength})}
+                    min={1}
+                    helptext={intl.formatMessage({defaultMessage: 'How many characters of each attachment are indexed.'})}
+                />
+            )}
+            <BooleanItem
+                label={intl.formatMessage({defaultMessage: 'Index Thread Context'})}
+                value={indexing.threadContext}
+                onChange={(threadContext) => update({threadContext})}
+                helpText={intl.formatMessage({defaultMessage: 'Embed the root post of a thread along with its replies, so that short replies are found by what they answer. Reindex to include existing posts.'})}
+            />
+        </>
+    );
+};
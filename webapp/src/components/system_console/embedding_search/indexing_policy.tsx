@@ -0,0 +1,112 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React, {useState} from 'react';
+import {useIntl} from 'react-intl';
+import styled from 'styled-components';
+
+import {SelectChannel, SelectUser} from '../../select';
+import {BooleanItem, HelpText, ItemLabel, TextItem} from '../item';
+
+import {ContentRule, EmbeddingSearchConfig, IndexingPolicy} from './types';
+
+interface IndexingPolicyProps {
+    value: EmbeddingSearchConfig;
+    onChange: (config: EmbeddingSearchConfig) => void;
+}
+
+const defaultIndexingPolicy: IndexingPolicy = {
+    excludedUserIDs: [],
+    excludedTeamIDs: [],
+    excludedChannelIDs: [],
+    excludeDirectMessages: false,
+    excludePrivateChannels: false,
+    contentRules: [],
+};
+
+const patternsOf = (rules: ContentRule[], action: string) => rules.filter((rule) => rule.action === action).map((rule) => rule.pattern).join('\n');
+
+// Blank lines are dropped, since an empty pattern would match every post.
+const rulesOf = (text: string, action: string): ContentRule[] => text.split('\n').filter((line) => line.trim() !== '').map((pattern) => ({pattern, action}));
+
+export const IndexingPolicyConfig = ({value, onChange}: IndexingPolicyProps) => {
+    const intl = useIntl();
+    const policy = {...defaultIndexingPolicy, ...value.indexingPolicy};
+    const rules = policy.contentRules || [];
+
+    // The patterns are edited as text so that lines can be added before they are filled in.
+    const [redactPatterns, setRedactPatterns] = useState(patternsOf(rules, 'redact'));
+    const [skipPatterns, setSkipPatterns] = useState(patternsOf(rules, 'skip'));
+
+    const update = (changes: Partial<IndexingPolicy>) => onChange({
+        ...value,
+        indexingPolicy: {...policy, ...changes},
+    });
+    const updateRules = (redact: string, skip: string) => update({
+        contentRules: [...rulesOf(redact, 'redact'), ...rulesOf(skip, 'skip')],
+    });
+
+    return (
+        <>
+            <ItemLabel>{intl.formatMessage({defaultMessage: 'Excluded Users and Teams'})}</ItemLabel>
+            <div>
+                <SelectUser
+                    userIDs={policy.excludedUserIDs || []}
+                    teamIDs={policy.excludedTeamIDs || []}
+                    onChangeIDs={(excludedUserIDs, excludedTeamIDs) => update({excludedUserIDs, excludedTeamIDs})}
+                />
+                <PolicyHelpText>
+                    {intl.formatMessage({defaultMessage: 'Posts by the selected users and posts in the selected teams are not indexed.'})}
+                </PolicyHelpText>
+            </div>
+            <ItemLabel>{intl.formatMessage({defaultMessage: 'Excluded Channels'})}</ItemLabel>
+            <div>
+                <SelectChannel
+                    channelIDs={policy.excludedChannelIDs || []}
+                    onChangeChannelIDs={(excludedChannelIDs) => update({excludedChannelIDs})}
+                />
+                <PolicyHelpText>
+                    {intl.formatMessage({defaultMessage: 'Posts in the selected channels are not indexed.'})}
+                </PolicyHelpText>
+            </div>
+            <BooleanItem
+                label={intl.formatMessage({defaultMessage: 'Exclude Direct and Group Messages'})}
+                value={policy.excludeDirectMessages}
+                onChange={(excludeDirectMessages) => update({excludeDirectMessages})}
+                helpText={intl.formatMessage({defaultMessage: 'Do not index posts in direct and group message channels.'})}
+            />
+            <BooleanItem
+                label={intl.formatMessage({defaultMessage: 'Exclude Private Channels'})}
+                value={policy.excludePrivateChannels}
+                onChange={(excludePrivateChannels) => update({excludePrivateChannels})}
+                helpText={intl.formatMessage({defaultMessage: 'Do not index posts in private channels.'})}
+            />
+            <TextItem
+                label={intl.formatMessage({defaultMessage: 'Redaction Patterns'})}
+                value={redactPatterns}
+                multiline={true}
+                placeholder={'(?i)password:\\s*\\S+'}
+                onChange={(e) => {
+                    setRedactPatterns(e.target.value);
+                    updateRules(e.target.value, skipPatterns);
+                }}
+                helptext={intl.formatMessage({defaultMessage: 'Regular expressions, one per line. Text matching any of them is replaced with [REDACTED] before it is indexed.'})}
+            />
+            <TextItem
+                label={intl.formatMessage({defaultMessage: 'Skip Patterns'})}
+                value={skipPatterns}
+                multiline={true}
+                placeholder={'BEGIN (RSA |EC )?PRIVATE KEY'}
+                onChange={(e) => {
+                    setSkipPatterns(e.target.value);
+                    updateRules(redactPatterns, e.target.value);
+                }}
+                helptext={intl.formatMessage({defaultMessage: 'Regular expressions, one per line. Posts matching any of them are not indexed.'})}
+            />
+        </>
+    );
+};
+
+const PolicyHelpText = styled(HelpText)`
+    margin-top: 8px;
+`;
@@ -26,7 +26,7 @@ export const ReindexConfirmation = ({show, onConfirm, onCancel}: ReindexConfirma
                         <FormattedMessage defaultMessage='Are you sure you want to reindex all posts?'/>
                     </p>
                     <p>
-                        <FormattedMessage defaultMessage='This will clear the current index and rebuild it from scratch. The process will:'/>
+                        <FormattedMessage defaultMessage='This will build a new index from scratch, searches using the current index until the new one is complete. The process will:'/>
                     </p>
                     <ul>
                         <li><FormattedMessage defaultMessage='Index all existing posts in the database'/></li>
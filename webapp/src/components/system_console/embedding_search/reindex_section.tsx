@@ -61,6 +61,13 @@ const ButtonGroup = styled.div`
     gap: 8px;
 `;
 
+const GenerationList = styled.ul`
+    margin: 12px 0 0;
+    padding-left: 16px;
+    font-size: 12px;
+    color: rgba(var(--center-channel-color-rgb), 0.72);
+`;
+
 interface ReindexSectionProps {
     jobStatus: JobStatusType | null;
     statusMessage: StatusMessageType;
@@ -110,6 +117,22 @@ export const ReindexSection = ({
                                             progress={jobStatus.total_rows ? Math.min((jobStatus.processed_rows / jobStatus.total_rows) * 100, 100) : 0}
                                         />
                                     </ProgressContainer>
+                                    {Boolean(jobStatus.since) && (
+                                        <ProgressText>
+                                            <FormattedMessage
+                                                defaultMessage='Indexing posts created since {since}'
+                                                values={{since: new Date(jobStatus.since as number).toLocaleString()}}
+                                            />
+                                        </ProgressText>
+                                    )}
+                                    {Boolean(jobStatus.resumes) && (
+                                        <ProgressText>
+                                            <FormattedMessage
+                                                defaultMessage='Resumed {resumes, plural, one {# time} other {# times}} after a server restart'
+                                                values={{resumes: jobStatus.resumes}}
+                                            />
+                                        </ProgressText>
+                                    )}
                                 </>
                             )}
                         </>
@@ -131,8 +154,28 @@ export const ReindexSection = ({
                         )
                     )}
 
+                    {jobStatus?.generations && jobStatus.generations.length > 0 && (
+                        <GenerationList>
+                            {jobStatus.generations.map((generation) => (
+                                <li key={generation.id}>
+                                    <FormattedMessage
+                                        defaultMessage='Generation {id}: {model} ({provider}, {dimensions} dimensions, {vectorStore}) - {status}'
+                                        values={{
+                                            id: generation.id,
+                                            model: generation.model,
+                                            provider: generation.provider,
+                                            dimensions: generation.dimensions,
+                                            vectorStore: generation.vector_store,
+                                            status: generation.status,
+                                        }}
+                                    />
+                                </li>
+                            ))}
+                        </GenerationList>
+                    )}
+
                     <HelpText>
-                        <FormattedMessage defaultMessage='Reindex all posts to update the embedding search database. This process will clear the current index and rebuild it from scratch. It may take a significant amount of time for large installations.'/>
+                        <FormattedMessage defaultMessage='Reindex all posts to update the embedding search database. A new index is built with the current embedding settings while searches keep using the current one, which is replaced once the new index is complete. It may take a significant amount of time for large installations.'/>
                     </HelpText>
                 </div>
             </ActionContainer>
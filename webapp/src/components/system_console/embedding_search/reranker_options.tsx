@@ -0,0 +1,80 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React from 'react';
+import {useIntl} from 'react-intl';
+
+import {SelectionItem, SelectionItemOption, TextItem} from '../item';
+import {IntItem} from '../number_items';
+
+import {EmbeddingSearchConfig, RerankerConfig} from './types';
+
+interface RerankerOptionsProps {
+    value: EmbeddingSearchConfig;
+    onChange: (config: EmbeddingSearchConfig) => void;
+}
+
+const defaultRerankerConfig: RerankerConfig = {
+    type: '',
+    apiURL: '',
+    apiKey: '',
+    model: '',
+    candidates: 0,
+};
+
+export const RerankerOptionsConfig = ({value, onChange}: RerankerOptionsProps) => {
+    const intl = useIntl();
+    const reranker = value.reranker || defaultRerankerConfig;
+    const update = (changes: Partial<RerankerConfig>) => onChange({
+        ...value,
+        reranker: {...reranker, ...changes},
+    });
+
+    return (
+        <>
+            <SelectionItem
+                label={intl.formatMessage({defaultMessage: 'Reranker'})}
+                value={reranker.type}
+                onChange={(e) => update({type: e.target.value})}
+                helptext={intl.formatMessage({defaultMessage: 'Reorder search results by relevance to the query before they are used. A cross-encoder calls a rerank API such as Cohere, Jina or an OpenAI compatible server. The language model option asks the model of an agent to score the results.'})}
+            >
+                <SelectionItemOption value=''>{intl.formatMessage({defaultMessage: 'None'})}</SelectionItemOption>
+                <SelectionItemOption value='cross-encoder'>{intl.formatMessage({defaultMessage: 'Cross-encoder rerank API'})}</SelectionItemOption>
+                <SelectionItemOption value='llm'>{intl.formatMessage({defaultMessage: 'Agent language model'})}</SelectionItemOption>
+            </SelectionItem>
+            {reranker.type === 'cross-encoder' && (
+                <>
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Rerank API URL'})}
+                        value={reranker.apiURL}
+                        onChange={(e) => update({apiURL: e.target.value})}
+                        placeholder='https://api.cohere.com/v2'
+                        helptext={intl.formatMessage({defaultMessage: 'The base URL of the API, requests are sent to its /rerank endpoint.'})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Rerank API Key'})}
+                        type='password'
+                        value={reranker.apiKey}
+                        onChange={(e) => update({apiKey: e.target.value})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Rerank Model'})}
+                        value={reranker.model}
+                        onChange={(e) => update({model: e.target.value})}
+                        placeholder='rerank-v3.5'
+                    />
+                </>
+            )}
+            {reranker.type !== '' && (
+                <IntItem
+                    label={intl.formatMessage({defaultMessage: 'Rerank Candidates'})}
+                    placeholder={intl.formatMessage({defaultMessage: 'Four times the number of results'})}
+                    value={reranker.candidates}
+                    onChange={(candidates) => update({candidates})}
+                    min={0}
+                    helptext={intl.formatMessage({defaultMessage: 'How many results are retrieved to be reranked. More candidates find more relevant results at the cost of slower searches. Leave at 0 for four times the number of results requested.'})}
+                />
+            )}
+        </>
+    );
+};
@@ -0,0 +1,69 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React from 'react';
+import {useIntl} from 'react-intl';
+
+import {SelectionItem, SelectionItemOption} from '../item';
+import {IntItem} from '../number_items';
+
+import {EmbeddingSearchConfig, ExpansionConfig} from './types';
+
+interface ResultExpansionProps {
+    value: EmbeddingSearchConfig;
+    onChange: (config: EmbeddingSearchConfig) => void;
+}
+
+const defaultExpansionConfig: ExpansionConfig = {
+    answers: '',
+    tool: '',
+    neighborChunks: 1,
+};
+
+export const ResultExpansionConfig = ({value, onChange}: ResultExpansionProps) => {
+    const intl = useIntl();
+    const expansion = value.expansion || defaultExpansionConfig;
+    const update = (changes: Partial<ExpansionConfig>) => onChange({
+        ...value,
+        expansion: {...expansion, ...changes},
+    });
+
+    const options = (
+        <>
+            <SelectionItemOption value=''>{intl.formatMessage({defaultMessage: 'Matching chunk only'})}</SelectionItemOption>
+            <SelectionItemOption value='neighbors'>{intl.formatMessage({defaultMessage: 'Neighboring chunks'})}</SelectionItemOption>
+            <SelectionItemOption value='post'>{intl.formatMessage({defaultMessage: 'Full post'})}</SelectionItemOption>
+            <SelectionItemOption value='thread'>{intl.formatMessage({defaultMessage: 'Full post with thread root'})}</SelectionItemOption>
+        </>
+    );
+
+    return (
+        <>
+            <SelectionItem
+                label={intl.formatMessage({defaultMessage: 'Search Answer Context'})}
+                value={expansion.answers}
+                onChange={(e) => update({answers: e.target.value})}
+                helptext={intl.formatMessage({defaultMessage: 'How much of the matching posts is given to the agent answering a search.'})}
+            >
+                {options}
+            </SelectionItem>
+            <SelectionItem
+                label={intl.formatMessage({defaultMessage: 'Search Tool Context'})}
+                value={expansion.tool}
+                onChange={(e) => update({tool: e.target.value})}
+                helptext={intl.formatMessage({defaultMessage: 'How much of the matching posts is given to agents searching the server with a tool.'})}
+            >
+                {options}
+            </SelectionItem>
+            {(expansion.answers === 'neighbors' || expansion.tool === 'neighbors') && (
+                <IntItem
+                    label={intl.formatMessage({defaultMessage: 'Neighboring Chunks'})}
+                    value={expansion.neighborChunks || defaultExpansionConfig.neighborChunks}
+                    onChange={(neighborChunks) => update({neighborChunks})}
+                    min={1}
+                    helptext={intl.formatMessage({defaultMessage: 'How many chunks before and after the matching chunk are included.'})}
+                />
+            )}
+        </>
+    );
+};
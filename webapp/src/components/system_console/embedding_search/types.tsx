@@ -13,6 +13,47 @@ export interface ChunkingOptions {
     chunkingStrategy: string;
 }
 
+export interface HybridConfig {
+    enabled: boolean;
+    vectorWeight: number;
+    lexicalWeight: number;
+    rankConstant: number;
+}
+
+export interface RerankerConfig {
+    type: string;
+    apiURL: string;
+    apiKey: string;
+    model: string;
+    candidates: number;
+}
+
+export interface ExpansionConfig {
+    answers: string;
+    tool: string;
+    neighborChunks: number;
+}
+
+export interface IndexingConfig {
+    attachments: boolean;
+    maxAttachmentLength: number;
+    threadContext: boolean;
+}
+
+export interface ContentRule {
+    pattern: string;
+    action: string; // 'redact' | 'skip'
+}
+
+export interface IndexingPolicy {
+    excludedUserIDs: string[];
+    excludedTeamIDs: string[];
+    excludedChannelIDs: string[];
+    excludeDirectMessages: boolean;
+    excludePrivateChannels: boolean;
+    contentRules: ContentRule[];
+}
+
 export interface EmbeddingSearchConfig {
     type: string;
     vectorStore: UpstreamConfig;
@@ -20,16 +61,40 @@ export interface EmbeddingSearchConfig {
     parameters: Record<string, unknown>;
     dimensions: number;
     chunkingOptions?: ChunkingOptions;
+    hybrid?: HybridConfig;
+    reranker?: RerankerConfig;
+    expansion?: ExpansionConfig;
+    indexing?: IndexingConfig;
+    indexingPolicy?: IndexingPolicy;
 }
 
 // Match the server's JobStatus struct field names
 export interface JobStatusType {
+    id?: string;
     status: string; // 'running' | 'completed' | 'failed' | 'canceled' | 'no_job'
     error?: string;
     started_at: string; // ISO string from server's time.Time
     completed_at?: string;
     processed_rows: number;
     total_rows: number;
+    since?: number; // Creation time in milliseconds of the oldest posts indexed by an incremental job
+    updated_at?: string; // When the job last saved its progress
+    resumes?: number; // Times the job was resumed after a server restart
+    generation?: number; // Generation of the index built by the job
+    generations?: IndexGeneration[];
+}
+
+// Match the server's embeddings.Generation struct field names
+export interface IndexGeneration {
+    id: number;
+    status: string; // 'building' | 'active' | 'retired'
+    provider: string;
+    model: string;
+    dimensions: number;
+    vector_store: string;
+    created_at: number;
+    activated_at?: number;
+    retired_at?: number;
 }
 
 export interface StatusMessageType {
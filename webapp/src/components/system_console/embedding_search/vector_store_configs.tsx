@@ -0,0 +1,110 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React from 'react';
+import {useIntl} from 'react-intl';
+
+import {SelectionItem, SelectionItemOption} from '../item';
+import {IntItem} from '../number_items';
+
+import {UpstreamConfig} from './types';
+
+interface PGVectorConfigProps {
+    value: UpstreamConfig;
+    onChange: (config: UpstreamConfig) => void;
+}
+
+interface HNSWParameters {
+    m?: number;
+    efConstruction?: number;
+    efSearch?: number;
+}
+
+interface IVFFlatParameters {
+    lists?: number;
+    probes?: number;
+}
+
+export const PGVectorStoreConfig = ({value, onChange}: PGVectorConfigProps) => {
+    const intl = useIntl();
+    const parameters = value.parameters || {};
+    const indexType = (parameters.indexType as string) || 'hnsw';
+    const hnsw = (parameters.hnsw as HNSWParameters) || {};
+    const ivfflat = (parameters.ivfflat as IVFFlatParameters) || {};
+    const update = (changes: Record<string, unknown>) => onChange({
+        ...value,
+        parameters: {...parameters, ...changes},
+    });
+
+    return (
+        <>
+            <SelectionItem
+                label={intl.formatMessage({defaultMessage: 'Distance Metric'})}
+                value={(parameters.metric as string) || 'l2'}
+                onChange={(e) => update({metric: e.target.value})}
+                helptext={intl.formatMessage({defaultMessage: 'How embeddings are compared. Cosine suits most embedding models, inner product is faster for normalized embeddings. Changing the metric rebuilds the index in the background after the plugin restarts.'})}
+            >
+                <SelectionItemOption value='l2'>{'Euclidean (L2)'}</SelectionItemOption>
+                <SelectionItemOption value='cosine'>{'Cosine'}</SelectionItemOption>
+                <SelectionItemOption value='inner_product'>{'Inner product'}</SelectionItemOption>
+            </SelectionItem>
+            <SelectionItem
+                label={intl.formatMessage({defaultMessage: 'Index Type'})}
+                value={indexType}
+                onChange={(e) => update({indexType: e.target.value})}
+                helptext={intl.formatMessage({defaultMessage: 'HNSW gives more accurate results, IVFFlat builds faster and uses less memory.'})}
+            >
+                <SelectionItemOption value='hnsw'>{'HNSW'}</SelectionItemOption>
+                <SelectionItemOption value='ivfflat'>{'IVFFlat'}</SelectionItemOption>
+            </SelectionItem>
+            {indexType === 'hnsw' && (
+                <>
+                    <IntItem
+                        label={intl.formatMessage({defaultMessage: 'HNSW Connections (m)'})}
+                        placeholder='16'
+                        value={hnsw.m || 0}
+                        onChange={(m) => update({hnsw: {...hnsw, m}})}
+                        min={0}
+                        helptext={intl.formatMessage({defaultMessage: 'Maximum connections per layer. Leave at 0 for the pgvector default of 16.'})}
+                    />
+                    <IntItem
+                        label={intl.formatMessage({defaultMessage: 'HNSW Build Candidates (ef_construction)'})}
+                        placeholder='64'
+                        value={hnsw.efConstruction || 0}
+                        onChange={(efConstruction) => update({hnsw: {...hnsw, efConstruction}})}
+                        min={0}
+                        helptext={intl.formatMessage({defaultMessage: 'Candidates considered when building the index. Leave at 0 for the pgvector default of 64.'})}
+                    />
+                    <IntItem
+                        label={intl.formatMessage({defaultMessage: 'HNSW Search Candidates (ef_search)'})}
+                        placeholder='40'
+                        value={hnsw.efSearch || 0}
+                        onChange={(efSearch) => update({hnsw: {...hnsw, efSearch}})}
+                        min={0}
+                        helptext={intl.formatMessage({defaultMessage: 'Candidates considered when searching, higher values are more accurate but slower. Leave at 0 for the pgvector default of 40.'})}
+                    />
+                </>
+            )}
+            {indexType === 'ivfflat' && (
+                <>
+                    <IntItem
+                        label={intl.formatMessage({defaultMessage: 'IVFFlat Lists'})}
+                        placeholder='100'
+                        value={ivfflat.lists || 0}
+                        onChange={(lists) => update({ivfflat: {...ivfflat, lists}})}
+                        min={0}
+                        helptext={intl.formatMessage({defaultMessage: 'Number of clusters, around the number of indexed chunks divided by 1000. Leave at 0 for 100.'})}
+                    />
+                    <IntItem
+                        label={intl.formatMessage({defaultMessage: 'IVFFlat Probes'})}
+                        placeholder='1'
+                        value={ivfflat.probes || 0}
+                        onChange={(probes) => update({ivfflat: {...ivfflat, probes}})}
+                        min={0}
+                        helptext={intl.formatMessage({defaultMessage: 'Clusters searched, higher values are more accurate but slower. Leave at 0 for the pgvector default of 1.'})}
+                    />
+                </>
+            )}
+        </>
+    );
+};